@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// apiNode is the status of a node returned by the api.
+type apiNode struct {
+	Name string `json:"name"`
+	// Checked is false until the first check of the node, the status isn't known before.
+	Checked      bool                   `json:"checked"`
+	State        string                 `json:"state"`
+	Chain        string                 `json:"chain,omitempty"`
+	Client       string                 `json:"client,omitempty"`
+	CurrentBlock uint64                 `json:"current_block"`
+	HighestBlock uint64                 `json:"highest_block"`
+	Peers        int64                  `json:"peers"`
+	Up           bool                   `json:"up"`
+	Error        string                 `json:"error,omitempty"`
+	LastCheck    time.Time              `json:"last_check,omitempty"`
+	CheckErrors  map[string]uint64      `json:"check_errors,omitempty"`
+	Muted        *insync.Mute           `json:"muted,omitempty"`
+	Incident     *insync.IncidentRecord `json:"incident,omitempty"`
+}
+
+// apiMuteRequest is the body of POST /nodes/{id}/mute, the node is muted until it's unmuted without duration.
+type apiMuteRequest struct {
+	Duration string `json:"duration"`
+	User     string `json:"user"`
+}
+
+// apiHandler serves the rest api, which requires the token as bearer token:
+//
+//	GET /nodes lists the nodes with their status
+//	GET /nodes/{id}/status returns the status of the node
+//	POST /nodes/{id}/mute mutes the node, DELETE unmutes it
+//	GET /incidents returns the ongoing and the recently closed incidents
+//
+// The nodes are those of the monitor at the time of the request, e.g. with the nodes of the tenants, except for the
+// reference.
+func apiHandler(token string, mon *insync.Monitor, ref *insync.Node, st *insync.StateStore) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r, http.MethodGet) {
+			return
+		}
+		nodes := apiNodes(mon, ref)
+		list := make([]apiNode, 0, len(nodes))
+		for _, n := range nodes {
+			list = append(list, newAPINode(n, st))
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Nodes []apiNode `json:"nodes"`
+		}{list})
+	})
+	mux.HandleFunc("/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/nodes/"), "/")
+		var n *insync.Node
+		for _, node := range apiNodes(mon, ref) {
+			if node.Name() == name {
+				n = node
+			}
+		}
+		if n == nil && !(action == "mute" && name == insync.AllNodes) {
+			apiError(w, http.StatusNotFound, "unknown node "+name)
+			return
+		}
+		switch action {
+		case "status":
+			if apiMethod(w, r, http.MethodGet) {
+				writeJSON(w, http.StatusOK, newAPINode(n, st))
+			}
+		case "mute":
+			if apiMethod(w, r, http.MethodPost, http.MethodDelete) {
+				apiMute(w, r, st, name, "api")
+			}
+		default:
+			apiError(w, http.StatusNotFound, "not found")
+		}
+	})
+	mux.HandleFunc("/incidents", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r, http.MethodGet) {
+			return
+		}
+		limit := 50
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+				apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", s))
+				return
+			}
+		}
+		ongoing := make([]insync.IncidentRecord, 0)
+		for _, n := range apiNodes(mon, ref) {
+			if rec, ok := n.Incident().Snapshot(); ok {
+				ongoing = append(ongoing, rec)
+			}
+		}
+		history := st.History(limit)
+		if history == nil {
+			history = []insync.IncidentRecord{}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Ongoing []insync.IncidentRecord `json:"ongoing"`
+			History []insync.IncidentRecord `json:"history"`
+		}{ongoing, history})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="insync"`)
+			apiError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// isAPI reports whether the path belongs to the rest api.
+func isAPI(path string) bool {
+	return path == "/nodes" || strings.HasPrefix(path, "/nodes/") || path == "/incidents"
+}
+
+// apiNodes returns the nodes of the monitor without the reference, which may be nil.
+func apiNodes(mon *insync.Monitor, ref *insync.Node) []*insync.Node {
+	nodes := mon.Nodes()
+	for i, n := range nodes {
+		if n == ref {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+func newAPINode(n *insync.Node, st *insync.StateStore) apiNode {
+	status := n.Status()
+	an := apiNode{
+		Name:         n.Name(),
+		Checked:      n.Checked(),
+		State:        status.State.String(),
+		Chain:        status.Chain,
+		Client:       status.Client,
+		CurrentBlock: status.CurrentBlock,
+		HighestBlock: status.HighestBlock,
+		Peers:        status.Peers,
+		Up:           n.LastError() == nil,
+		LastCheck:    n.LastCheck(),
+		CheckErrors:  status.CheckErrors,
+	}
+	if err := n.LastError(); err != nil {
+		an.Error = redact.Error(err)
+	}
+	if m, ok := st.Muted(n.Name()); ok {
+		an.Muted = &m
+	}
+	if rec, ok := n.Incident().Snapshot(); ok {
+		an.Incident = &rec
+	}
+	return an
+}
+
+// apiMute mutes the node on POST and unmutes it on DELETE, the mutes without user in the body are attributed to user.
+func apiMute(w http.ResponseWriter, r *http.Request, st *insync.StateStore, name, user string) {
+	if r.Method == http.MethodDelete {
+		ok, err := st.UnmuteNode(name)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			apiError(w, http.StatusNotFound, name+" isn't muted")
+			return
+		}
+		slog.Info("node unmuted", "node", name, "user", user)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var req apiMuteRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apiError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid duration %q", req.Duration))
+			return
+		}
+	}
+	if req.User == "" {
+		req.User = user
+	}
+	if err := st.MuteNode(name, req.User, d); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("node muted", "node", name, "user", req.User, "for", d)
+	m, _ := st.Muted(name)
+	writeJSON(w, http.StatusOK, m)
+}
+
+// apiMethod replies with 405 unless the request uses one of the methods.
+func apiMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// The exit codes of nagios plugins.
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStatus = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkResult is the result of a single run of the checks of a node.
+type checkResult struct {
+	Node    string        `json:"node"`
+	Status  string        `json:"status"`
+	State   string        `json:"state"`
+	Error   string        `json:"error,omitempty"`
+	Block   uint64        `json:"current_block"`
+	Highest uint64        `json:"highest_block"`
+	Lag     uint64        `json:"lag"`
+	Peers   int64         `json:"peers"`
+	Latency time.Duration `json:"latency_ns,omitempty"`
+
+	code int
+}
+
+// checkCommand runs the checks of the nodes once and exits with the status code of nagios plugins,
+// so nagios and icinga can use insync as check plugin. It never sends alerts.
+func checkCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	node := fs.String("node", "", "the node to check, all nodes if empty")
+	format := fs.String("format", "nagios", "the output format, nagios or json")
+	timeout := fs.Duration("timeout", 10*time.Second, "the timeout of the checks")
+	if err := fs.Parse(args); err != nil {
+		fmt.Println("INSYNC UNKNOWN -", err)
+		return nagiosUnknown
+	}
+	if *format != "nagios" && *format != "json" {
+		fmt.Printf("INSYNC UNKNOWN - invalid format %q, expected nagios or json\n", *format)
+		return nagiosUnknown
+	}
+	// the plugin output is read from stdout, the warnings of the checks would only clutter the logs
+	logLevel.Set(slog.LevelError)
+	cfg, err := readConfig()
+	if err != nil {
+		fmt.Println("INSYNC UNKNOWN - error loading config:", redact.Error(err))
+		return nagiosUnknown
+	}
+	var ncs []insync.NodeConfig
+	for _, nc := range cfg.Nodes {
+		if *node == "" || nc.Name == *node {
+			ncs = append(ncs, nc)
+		}
+	}
+	if len(ncs) == 0 {
+		fmt.Printf("INSYNC UNKNOWN - unknown node %q\n", *node)
+		return nagiosUnknown
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	st, _ := insync.LoadState("")
+	var ref *insync.Node
+	if cfg.Reference != nil {
+		// for the light clients
+		ref = insync.NewNode(*cfg.Reference, nil)
+	}
+	results := make([]checkResult, len(ncs))
+	for i, nc := range ncs {
+		n := insync.NewNode(nc, st.Incident(nc.Name))
+		n.SetReference(ref)
+		results[i] = checkNode(ctx, cfg, n)
+	}
+	code := nagiosOK
+	for _, r := range results {
+		code = max(code, r.code)
+	}
+	if *format == "json" {
+		_ = json.NewEncoder(os.Stdout).Encode(struct {
+			Status string        `json:"status"`
+			Nodes  []checkResult `json:"nodes"`
+		}{nagiosStatus[code], results})
+		return code
+	}
+	fmt.Println(nagiosOutput(code, results, cfg.Checks))
+	return code
+}
+
+// checkNode runs the sync check and, if enabled, the peers check of the node.
+func checkNode(ctx context.Context, cfg *config, n *insync.Node) checkResult {
+	state, err := insync.NewSyncCheck(n, cfg.Checks.Sync, 0).Probe(ctx)
+	r := checkResult{Node: n.Name(), State: state.String(), Peers: -1}
+	switch state {
+	case insync.StateHealthy:
+		r.code = nagiosOK
+	case insync.StateDegraded:
+		r.code = nagiosWarning
+	default:
+		r.code = nagiosCritical
+	}
+	if err != nil {
+		r.Error = redact.Error(err)
+		r.Status = nagiosStatus[r.code]
+		return r
+	}
+	if cfg.Checks.Peers.Interval > 0 {
+		insync.NewPeersCheck(n, cfg.Checks.Peers).Run(ctx, insync.Notifiers{})
+	}
+	status := n.Status()
+	r.Block, r.Highest, r.Peers, r.Latency = status.CurrentBlock, status.HighestBlock, status.Peers, status.Latency
+	if r.Highest > r.Block {
+		r.Lag = r.Highest - r.Block
+	}
+	if r.Peers >= 0 && uint64(r.Peers) < cfg.Checks.Peers.MinPeers {
+		r.code = max(r.code, nagiosWarning)
+	}
+	r.Status = nagiosStatus[r.code]
+	return r
+}
+
+// nagiosOutput formats the results as plugin output: the status and a summary, followed by the performance data.
+func nagiosOutput(code int, results []checkResult, checks checksConfig) string {
+	var summary, perf []string
+	for _, r := range results {
+		s := r.Node + " is " + r.State
+		switch {
+		case r.Error != "":
+			// a pipe would start the performance data
+			s += ": " + strings.ReplaceAll(r.Error, "|", "/")
+		case r.Lag > 0:
+			s += fmt.Sprintf(", %d blocks behind", r.Lag)
+		default:
+			s += fmt.Sprintf(" at block %d", r.Block)
+		}
+		if r.Peers >= 0 && uint64(r.Peers) < checks.Peers.MinPeers {
+			s += fmt.Sprintf(", only %d peers", r.Peers)
+		}
+		summary = append(summary, s)
+		if r.Error != "" {
+			continue
+		}
+		prefix := ""
+		if len(results) > 1 {
+			prefix = r.Node + "_"
+		}
+		// any lag is degraded, more than max_lag out of sync
+		warn, crit := "0", strconv.FormatUint(checks.Sync.MaxLag, 10)
+		if checks.Sync.MaxLag == 0 {
+			warn = ""
+		}
+		perf = append(perf, fmt.Sprintf("'%slag'=%d;%s;%s;0", prefix, r.Lag, warn, crit))
+		perf = append(perf, fmt.Sprintf("'%sblock'=%dc", prefix, r.Block))
+		if r.Peers >= 0 {
+			perf = append(perf, fmt.Sprintf("'%speers'=%d;%d:;;0", prefix, r.Peers, checks.Peers.MinPeers))
+		}
+		if r.Latency > 0 {
+			perf = append(perf, fmt.Sprintf("'%slatency'=%ss;;;0", prefix, strconv.FormatFloat(r.Latency.Seconds(), 'f', 3, 64)))
+		}
+	}
+	out := "INSYNC " + nagiosStatus[code] + " - " + strings.Join(summary, "; ")
+	if len(perf) > 0 {
+		out += " | " + strings.Join(perf, " ")
+	}
+	return out
+}
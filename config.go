@@ -0,0 +1,754 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jon4hz/insync/pkg/alertmanager"
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/mqtt"
+	"github.com/jon4hz/insync/pkg/pagerduty"
+	"github.com/jon4hz/insync/pkg/plugin"
+	"github.com/jon4hz/insync/pkg/redact"
+	"github.com/jon4hz/insync/pkg/remediation"
+	"github.com/jon4hz/insync/pkg/routing"
+	"github.com/jon4hz/insync/pkg/telegram"
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// config is the complete insync configuration.
+// It's read from the yaml file passed with -config or built from the environment variables.
+type config struct {
+	BotToken         string              `yaml:"bot_token"`
+	AlertGroup       int64               `yaml:"alert_group"`
+	Nodes            []insync.NodeConfig `yaml:"nodes"`
+	Checks           checksConfig        `yaml:"checks"`
+	ReminderInterval insync.Duration     `yaml:"reminder_interval"`
+	QuietHours       string              `yaml:"quiet_hours"`
+	GroupWait        insync.Duration     `yaml:"group_wait"`
+	StateFile        string              `yaml:"state_file"`
+	Heartbeat        heartbeatConfig     `yaml:"heartbeat"`
+	Influx           influxConfig        `yaml:"influxdb"`
+	MQTT             mqtt.Config         `yaml:"mqtt"`
+	Alertmanager     alertmanager.Config `yaml:"alertmanager"`
+	HTTP             httpConfig          `yaml:"http"`
+	Debug            debugConfig         `yaml:"debug"`
+	GRPC             grpcConfig          `yaml:"grpc"`
+	// Routes are the named destinations of the alerts. The alert group and alertmanager
+	// settings above are added as the routes default and alertmanager.
+	Routes map[string]routeConfig `yaml:"routes"`
+	// Rules decide which routes an alert is sent to, all routes are used if there are no rules.
+	Rules []routing.RuleConfig `yaml:"rules"`
+	// DefaultRoutes receive the alerts no rule matches, they're dropped if there are none.
+	DefaultRoutes []string `yaml:"default_routes"`
+	// Schedules are the on-call schedules, referenced by the telegram routes.
+	Schedules map[string]telegram.ScheduleConfig `yaml:"schedules"`
+	// OnCall is the schedule of the alert group.
+	OnCall string `yaml:"on_call"`
+	// Reference is an endpoint the head blocks of the nodes are compared to, e.g. a public rpc provider.
+	// It isn't monitored.
+	Reference *insync.NodeConfig `yaml:"reference"`
+	// Reconnect configures the re-dialing of nodes whose connection broke.
+	Reconnect insync.ReconnectConfig `yaml:"reconnect"`
+	// Scheduler bounds the number of checks running at the same time.
+	Scheduler insync.SchedulerConfig `yaml:"scheduler"`
+	// ShutdownMessage posts a message to the telegram routes when insync stops.
+	ShutdownMessage bool `yaml:"shutdown_message"`
+	// ShutdownTimeout bounds the delivery of the pending alerts on shutdown, defaults to 25s.
+	ShutdownTimeout insync.Duration `yaml:"shutdown_timeout"`
+	// Pipeline configures the delivery of the alerts to the routes.
+	Pipeline pipelineConfig `yaml:"pipeline"`
+	// History records every check result in a database.
+	History historyConfig `yaml:"history"`
+	Log     logConfig     `yaml:"log"`
+	// Tracing exports the spans of the checks and the notifications with otlp.
+	Tracing tracing.Config `yaml:"tracing"`
+	// Sentry reports the errors of insync itself.
+	Sentry sentryConfig `yaml:"sentry"`
+	Proxy  proxyConfig  `yaml:"proxy"`
+	// Encryption encrypts the state file and the history at rest.
+	Encryption insync.EncryptionConfig `yaml:"encryption"`
+	Tenants    tenantsConfig           `yaml:"tenants"`
+	// Remediation are the actions repairing stuck nodes, e.g. restarting them.
+	Remediation []remediation.Config `yaml:"remediation"`
+	// RemediationLimits are the guardrails of all remediation actions.
+	RemediationLimits remediation.Limits `yaml:"remediation_limits"`
+	// Resync are the recipes of the guided resyncs, walked through step by step with /resync on telegram.
+	Resync []remediation.ResyncConfig `yaml:"resync"`
+	// Timezone of the schedules, the reports and the times in the telegram messages, e.g. Europe/Zurich, defaults to that of the host.
+	// The telegram routes may have their own.
+	Timezone string `yaml:"timezone"`
+	// location is the timezone, that of the host if none is configured. It's passed to the schedules and the reports,
+	// the local time of the process is left alone.
+	location *time.Location
+}
+
+// proxyConfig configures the http or socks5 proxies of the outgoing connections.
+type proxyConfig struct {
+	// RPC is the proxy of the nodes without their own proxy.
+	RPC string `yaml:"rpc"`
+	// Telegram is the proxy of the telegram api, the proxy of the environment (HTTPS_PROXY etc.) is used if empty.
+	Telegram string `yaml:"telegram"`
+}
+
+type pipelineConfig struct {
+	// Retries is the number of times a failed send is retried, defaults to 2, -1 disables retries.
+	Retries int `yaml:"retries"`
+	// FallbackRoute is alerted once another route failed FailureThreshold times in a row.
+	FallbackRoute    string `yaml:"fallback_route"`
+	FailureThreshold int    `yaml:"failure_threshold"`
+}
+
+type historyConfig struct {
+	// Path is the directory of the history database, the history is disabled if empty.
+	Path string `yaml:"path"`
+	// Retention is how long the records are kept, defaults to 30 days.
+	Retention insync.Duration `yaml:"retention"`
+	// ReportAt is the time of day the uptime of the nodes is posted to the telegram routes, e.g. 09:00.
+	ReportAt string `yaml:"report_at"`
+	// SummaryAt is the time of day the summary of the last day of every node is posted to the telegram routes.
+	SummaryAt string `yaml:"summary_at"`
+	// DigestAt is the day and time of day the weekly comparison of the nodes is posted to the telegram routes, e.g. Mon 09:00.
+	DigestAt string `yaml:"digest_at"`
+	// Monthly creates the availability report of the previous month on the first day of every month.
+	Monthly monthlyReportConfig `yaml:"monthly_report"`
+}
+
+type monthlyReportConfig struct {
+	// At is the time of day the report is created, e.g. 08:00, the report is disabled if empty.
+	At string `yaml:"at"`
+	// Path is the directory the reports are written to, e.g. availability-2021-11.html. They aren't written if empty.
+	Path string `yaml:"path"`
+	// Telegram sends the reports as file to the telegram routes.
+	Telegram bool `yaml:"telegram"`
+	// PDFCommand converts the html on stdin to pdf on stdout, e.g. [wkhtmltopdf, -, -]. Only html is created if empty.
+	PDFCommand []string `yaml:"pdf_command"`
+}
+
+// routeConfig configures a destination, exactly one of its fields must be set.
+type routeConfig struct {
+	// Verbosity is the level of detail of the alerts of the route: all, warning or critical, all by default.
+	Verbosity    string                `yaml:"verbosity"`
+	Telegram     *telegram.Config      `yaml:"telegram"`
+	Alertmanager *alertmanager.Config  `yaml:"alertmanager"`
+	PagerDuty    *pagerduty.Config     `yaml:"pagerduty"`
+	Exec         *plugin.ExecConfig    `yaml:"exec"`
+	Webhook      *plugin.WebhookConfig `yaml:"webhook"`
+}
+
+// httpConfig configures the http server, it's disabled if listen is empty.
+type httpConfig struct {
+	// Listen is the address of the server, the host can be the name of a network interface, e.g. eth0:8080.
+	Listen string `yaml:"listen"`
+	// Webhook enables the alertmanager webhook receiver at /webhook/alertmanager.
+	Webhook bool `yaml:"webhook"`
+	// Allow are the ips and cidrs allowed to connect, everyone if empty.
+	Allow []string       `yaml:"allow"`
+	Auth  httpAuthConfig `yaml:"auth"`
+	// APIToken enables the rest api, the clients send it as bearer token.
+	APIToken string `yaml:"api_token"`
+	// Dashboard enables the web ui at /dashboard.
+	Dashboard bool `yaml:"dashboard"`
+
+	allow []*net.IPNet
+}
+
+// httpAuthConfig configures the basic auth of the http server, it's disabled if the username is empty.
+type httpAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// heartbeatConfig configures the dead man's switch, it's disabled if the url is empty.
+type heartbeatConfig struct {
+	URL      string          `yaml:"url"`
+	Interval insync.Duration `yaml:"interval"`
+}
+
+type checksConfig struct {
+	Sync  insync.SyncCheckConfig  `yaml:"sync"`
+	Peers insync.PeersCheckConfig `yaml:"peers"`
+	Disk  insync.DiskCheckConfig  `yaml:"disk"`
+	Clock insync.ClockCheckConfig `yaml:"clock"`
+	// Fees records the base and priority fees for the daily summary and alerts on congestion.
+	Fees insync.FeeCheckConfig `yaml:"fees"`
+	// ValidatorClient checks the health endpoints of the validator clients of the nodes.
+	ValidatorClient insync.CheckConfig `yaml:"validator_client"`
+	// BeaconSync checks the sync status of the beacon nodes of the nodes.
+	BeaconSync insync.BeaconSyncCheckConfig `yaml:"beacon_sync"`
+	// Blobs checks the blob availability on the beacon nodes of the nodes.
+	Blobs insync.BlobCheckConfig `yaml:"blobs"`
+	// Proposals alerts the missed block proposals of the validators of the nodes.
+	Proposals insync.CheckConfig `yaml:"proposals"`
+	// SyncCommittee alerts the low sync committee participation of the validators of the nodes.
+	SyncCommittee insync.SyncCommitteeCheckConfig `yaml:"sync_committee"`
+	// Checkpoint verifies the finalized checkpoints of the beacon nodes against trusted sources.
+	Checkpoint insync.CheckpointCheckConfig `yaml:"checkpoint"`
+	// Explorer cross-checks the nodes and their validators against block explorers.
+	Explorer insync.ExplorerCheckConfig `yaml:"explorer"`
+	// Engine compares the engine api capabilities of the nodes with a jwt secret to those the consensus clients expect.
+	Engine insync.EngineCheckConfig `yaml:"engine"`
+	// Genesis compares the genesis block hashes of the nodes to those of their networks.
+	Genesis insync.CheckConfig `yaml:"genesis"`
+	// Metrics derives checks from the prometheus metrics of the clients.
+	Metrics insync.MetricsCheckConfig `yaml:"metrics"`
+	// Exec are the external check commands.
+	Exec []insync.ExecCheckConfig `yaml:"exec"`
+}
+
+// readConfig reads the config from the config file, or from the environment variables if there is none.
+func readConfig() (*config, error) {
+	var cfg *config
+	var err error
+	if *configFile != "" {
+		cfg, err = loadConfig(*configFile)
+	} else {
+		cfg, err = configFromEnv()
+	}
+	return cfg, err
+}
+
+// loadConfig reads the config from the given file.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if err := expandEnv(&root); err != nil {
+		return nil, err
+	}
+	var cfg config
+	if root.Kind != 0 {
+		if err := root.Decode(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, cfg.finalize()
+}
+
+// configFromEnv builds the config from the environment variables.
+func configFromEnv() (*config, error) {
+	nodes, err := insync.ParseNodes(os.Getenv("GETH_URL"))
+	if err != nil {
+		return nil, err
+	}
+	checkInterval := insync.Duration(mustParseDuration(os.Getenv("CHECK_INTERVAL")))
+	cfg := &config{
+		BotToken:   os.Getenv("BOT_TOKEN"),
+		AlertGroup: mustParseInt64(os.Getenv("ALERT_GROUP")),
+		Nodes:      nodes,
+		Checks: checksConfig{
+			Sync: insync.SyncCheckConfig{
+				CheckConfig: insync.CheckConfig{
+					Interval:       checkInterval,
+					Timeout:        insync.Duration(mustParseOptionalDuration(os.Getenv("CHECK_TIMEOUT"))),
+					ErrorThreshold: int(mustParseOptionalInt64(os.Getenv("ERROR_THRESHOLD"), 0)),
+					Retries:        int(mustParseOptionalInt64(os.Getenv("CHECK_RETRIES"), 0)),
+				},
+				ReportInterval:   insync.Duration(mustParseDuration(os.Getenv("REPORT_INTERVAL"))),
+				RecoveryChecks:   mustParseOptionalInt64(os.Getenv("RECOVERY_CHECKS"), 1),
+				MaxLag:           uint64(mustParseOptionalInt64(os.Getenv("MAX_LAG"), 0)),
+				ProgressLag:      uint64(mustParseOptionalInt64(os.Getenv("PROGRESS_LAG"), 0)),
+				ProgressInterval: insync.Duration(mustParseOptionalDuration(os.Getenv("PROGRESS_INTERVAL"))),
+			},
+		},
+		ReminderInterval: insync.Duration(mustParseOptionalDuration(os.Getenv("REMINDER_INTERVAL"))),
+		QuietHours:       os.Getenv("QUIET_HOURS"),
+		GroupWait:        insync.Duration(mustParseOptionalDuration(os.Getenv("GROUP_WAIT"))),
+		StateFile:        os.Getenv("STATE_FILE"),
+		Influx: influxConfig{
+			URL:      os.Getenv("INFLUX_URL"),
+			Token:    os.Getenv("INFLUX_TOKEN"),
+			Interval: insync.Duration(mustParseOptionalDuration(os.Getenv("INFLUX_INTERVAL"))),
+		},
+		MQTT: mqtt.Config{
+			Broker:    os.Getenv("MQTT_BROKER"),
+			Username:  os.Getenv("MQTT_USERNAME"),
+			Password:  os.Getenv("MQTT_PASSWORD"),
+			Topic:     os.Getenv("MQTT_TOPIC"),
+			Discovery: os.Getenv("MQTT_DISCOVERY") == "true",
+		},
+		Heartbeat: heartbeatConfig{
+			URL:      os.Getenv("HEARTBEAT_URL"),
+			Interval: insync.Duration(mustParseOptionalDuration(os.Getenv("HEARTBEAT_INTERVAL"))),
+		},
+		Alertmanager: alertmanager.Config{
+			URL: os.Getenv("ALERTMANAGER_URL"),
+		},
+		HTTP: httpConfig{
+			Listen:  os.Getenv("HTTP_LISTEN"),
+			Webhook: os.Getenv("WEBHOOK") == "true",
+			Allow:   splitList(os.Getenv("HTTP_ALLOW")),
+			Auth: httpAuthConfig{
+				Username: os.Getenv("HTTP_USERNAME"),
+				Password: os.Getenv("HTTP_PASSWORD"),
+			},
+			APIToken:  os.Getenv("HTTP_API_TOKEN"),
+			Dashboard: os.Getenv("HTTP_DASHBOARD") == "true",
+		},
+		Debug: debugConfig{
+			Listen: os.Getenv("DEBUG_LISTEN"),
+		},
+		GRPC: grpcConfig{
+			Listen:   os.Getenv("GRPC_LISTEN"),
+			Token:    os.Getenv("GRPC_TOKEN"),
+			CertFile: os.Getenv("GRPC_CERT_FILE"),
+			KeyFile:  os.Getenv("GRPC_KEY_FILE"),
+		},
+		Reconnect: insync.ReconnectConfig{
+			AlertAfter: insync.Duration(mustParseOptionalDuration(os.Getenv("RECONNECT_ALERT_AFTER"))),
+		},
+		Scheduler: insync.SchedulerConfig{
+			Workers: int(mustParseOptionalInt64(os.Getenv("CHECK_WORKERS"), 0)),
+		},
+		ShutdownMessage: os.Getenv("SHUTDOWN_MESSAGE") == "true",
+		ShutdownTimeout: insync.Duration(mustParseOptionalDuration(os.Getenv("SHUTDOWN_TIMEOUT"))),
+		Pipeline: pipelineConfig{
+			Retries: int(mustParseOptionalInt64(os.Getenv("SEND_RETRIES"), 0)),
+		},
+		History: historyConfig{
+			Path:      os.Getenv("HISTORY_DB"),
+			Retention: insync.Duration(mustParseOptionalDuration(os.Getenv("HISTORY_RETENTION"))),
+			ReportAt:  os.Getenv("SLA_REPORT_AT"),
+			SummaryAt: os.Getenv("DAILY_SUMMARY_AT"),
+			DigestAt:  os.Getenv("FLEET_DIGEST_AT"),
+			Monthly: monthlyReportConfig{
+				At:       os.Getenv("MONTHLY_REPORT_AT"),
+				Path:     os.Getenv("MONTHLY_REPORT_PATH"),
+				Telegram: os.Getenv("MONTHLY_REPORT_TELEGRAM") == "true",
+			},
+		},
+		Tracing: tracing.Config{
+			Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+			ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		},
+		Sentry: sentryConfig{
+			DSN:         os.Getenv("SENTRY_DSN"),
+			Environment: os.Getenv("SENTRY_ENVIRONMENT"),
+		},
+		Tenants: tenantsConfig{
+			Enabled:      os.Getenv("TENANTS") == "true",
+			MaxNodes:     int(mustParseOptionalInt64(os.Getenv("TENANT_MAX_NODES"), 0)),
+			AllowPrivate: os.Getenv("TENANT_ALLOW_PRIVATE") == "true",
+		},
+		Encryption: insync.EncryptionConfig{
+			Passphrase: os.Getenv("ENCRYPTION_PASSPHRASE"),
+			KeyFile:    os.Getenv("ENCRYPTION_KEY_FILE"),
+		},
+		Proxy: proxyConfig{
+			RPC:      os.Getenv("RPC_PROXY"),
+			Telegram: os.Getenv("TELEGRAM_PROXY"),
+		},
+		Log: logConfig{
+			Level:  os.Getenv("LOG_LEVEL"),
+			Format: os.Getenv("LOG_FORMAT"),
+			File: logFileConfig{
+				Path:       os.Getenv("LOG_FILE"),
+				MaxSize:    mustParseOptionalInt64(os.Getenv("LOG_MAX_SIZE"), 0),
+				MaxAge:     insync.Duration(mustParseOptionalDuration(os.Getenv("LOG_MAX_AGE"))),
+				MaxBackups: int(mustParseOptionalInt64(os.Getenv("LOG_MAX_BACKUPS"), 0)),
+				Compress:   os.Getenv("LOG_COMPRESS") == "true",
+			},
+		},
+		Timezone: os.Getenv("TIMEZONE"),
+	}
+	return cfg, cfg.finalize()
+}
+
+// finalize applies the defaults and validates the config.
+func (c *config) finalize() error {
+	c.registerSecrets()
+	if c.BotToken == "" {
+		return errors.New("missing bot token")
+	}
+	if len(c.Nodes) == 0 {
+		return errors.New("no node configured")
+	}
+	seen := make(map[string]bool)
+	for i := range c.Nodes {
+		n := &c.Nodes[i]
+		if n.URL == "" {
+			return fmt.Errorf("node %d: missing url", i)
+		}
+		if n.Name == "" {
+			n.Name = insync.NodeName(n.URL)
+		}
+		if seen[n.Name] {
+			return fmt.Errorf("duplicate node name %q", n.Name)
+		}
+		if n.Proxy == "" {
+			n.Proxy = c.Proxy.RPC
+		}
+		if err := n.Finalize(); err != nil {
+			return fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		if n.Mode == insync.ModeLight && c.Reference == nil {
+			return fmt.Errorf("node %s: the light mode requires a reference", n.Name)
+		}
+		seen[n.Name] = true
+	}
+	if r := c.Reference; r != nil {
+		if r.URL == "" {
+			return errors.New("reference: missing url")
+		}
+		if r.Name == "" {
+			r.Name = "reference"
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("the reference is named like the node %q", r.Name)
+		}
+		if r.Proxy == "" {
+			r.Proxy = c.Proxy.RPC
+		}
+		if err := r.Finalize(); err != nil {
+			return fmt.Errorf("reference: %w", err)
+		}
+	}
+
+	if err := c.Checks.Sync.Finalize(); err != nil {
+		return err
+	}
+	c.Checks.Peers.Finalize()
+	if err := c.Checks.Fees.Finalize(); err != nil {
+		return err
+	}
+	c.Checks.ValidatorClient.Finalize()
+	c.Checks.BeaconSync.Finalize()
+	c.Checks.Blobs.Finalize()
+	c.Checks.Proposals.Finalize()
+	if err := c.Checks.SyncCommittee.Finalize(); err != nil {
+		return err
+	}
+	if err := c.Checks.Checkpoint.Finalize(); err != nil {
+		return err
+	}
+	if err := c.Checks.Explorer.Finalize(); err != nil {
+		return err
+	}
+	c.Checks.Engine.Finalize()
+	c.Checks.Genesis.Finalize()
+	if err := c.Checks.Metrics.Finalize(); err != nil {
+		return err
+	}
+	c.Checks.Clock.Finalize()
+	if err := c.Checks.Disk.Finalize(); err != nil {
+		return err
+	}
+	execNames := make(map[string]bool)
+	for i := range c.Checks.Exec {
+		e := &c.Checks.Exec[i]
+		if err := e.Finalize(); err != nil {
+			return err
+		}
+		if execNames[e.Name] {
+			return fmt.Errorf("duplicate exec check %q", e.Name)
+		}
+		execNames[e.Name] = true
+	}
+	remediations := make(map[string]bool)
+	for i := range c.Remediation {
+		r := &c.Remediation[i]
+		if err := r.Finalize(); err != nil {
+			return err
+		}
+		if remediations[r.Name] {
+			return fmt.Errorf("duplicate remediation %q", r.Name)
+		}
+		remediations[r.Name] = true
+	}
+	if err := c.RemediationLimits.Finalize(); err != nil {
+		return err
+	}
+	resyncs := make(map[string]bool)
+	for i := range c.Resync {
+		r := &c.Resync[i]
+		if err := r.Finalize(); err != nil {
+			return err
+		}
+		if resyncs[r.Name] {
+			return fmt.Errorf("duplicate resync %q", r.Name)
+		}
+		resyncs[r.Name] = true
+	}
+	if c.Heartbeat.URL != "" && c.Heartbeat.Interval <= 0 {
+		c.Heartbeat.Interval = insync.Duration(time.Minute)
+	}
+	if c.Alertmanager.URL != "" && c.Alertmanager.ResendInterval <= 0 {
+		c.Alertmanager.ResendInterval = insync.Duration(time.Minute)
+	}
+	c.Scheduler.Finalize()
+	if c.ShutdownTimeout <= 0 {
+		// below the default termination grace period of kubernetes, 30s
+		c.ShutdownTimeout = insync.Duration(25 * time.Second)
+	}
+	if c.Pipeline.Retries == 0 {
+		c.Pipeline.Retries = 2
+	} else if c.Pipeline.Retries < 0 {
+		c.Pipeline.Retries = 0
+	}
+	if c.Pipeline.FailureThreshold <= 0 {
+		c.Pipeline.FailureThreshold = 5
+	}
+	if c.History.Retention <= 0 {
+		c.History.Retention = insync.Duration(30 * 24 * time.Hour)
+	}
+	if c.History.ReportAt != "" {
+		if c.History.Path == "" {
+			return errors.New("the sla report requires the history")
+		}
+		if _, err := time.Parse("15:04", c.History.ReportAt); err != nil {
+			return fmt.Errorf("invalid sla report time %q, expected e.g. 09:00", c.History.ReportAt)
+		}
+	}
+	if c.History.SummaryAt != "" {
+		if c.History.Path == "" {
+			return errors.New("the daily summary requires the history")
+		}
+		if _, err := time.Parse("15:04", c.History.SummaryAt); err != nil {
+			return fmt.Errorf("invalid daily summary time %q, expected e.g. 09:00", c.History.SummaryAt)
+		}
+	}
+	if c.History.DigestAt != "" {
+		if c.History.Path == "" {
+			return errors.New("the fleet digest requires the history")
+		}
+		if _, err := time.Parse("Mon 15:04", c.History.DigestAt); err != nil {
+			return fmt.Errorf("invalid fleet digest time %q, expected e.g. Mon 09:00", c.History.DigestAt)
+		}
+	}
+	if m := c.History.Monthly; m.At != "" {
+		if c.History.Path == "" {
+			return errors.New("the monthly report requires the history")
+		}
+		if _, err := time.Parse("15:04", m.At); err != nil {
+			return fmt.Errorf("invalid monthly report time %q, expected e.g. 08:00", m.At)
+		}
+		if m.Path == "" && !m.Telegram {
+			return errors.New("the monthly report needs a path or telegram")
+		}
+	}
+	c.location = time.Local
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		c.location = loc
+	}
+	if err := c.Encryption.Finalize(); err != nil {
+		return err
+	}
+	c.Tenants.finalize()
+	if c.Tenants.Enabled && c.StateFile == "" {
+		return errors.New("the tenants are stored in the state file, it's required for the multi-tenant mode")
+	}
+	if c.Proxy.Telegram != "" {
+		if _, err := insync.ParseProxy(c.Proxy.Telegram); err != nil {
+			return fmt.Errorf("telegram: %w", err)
+		}
+	}
+	if err := c.Reconnect.Finalize(); err != nil {
+		return err
+	}
+	if err := c.Log.finalize(); err != nil {
+		return err
+	}
+	if c.HTTP.Webhook && c.HTTP.Listen == "" {
+		return errors.New("the webhook receiver requires the http server")
+	}
+	if err := c.HTTP.finalize(); err != nil {
+		return err
+	}
+	if err := c.GRPC.finalize(); err != nil {
+		return err
+	}
+	if err := c.MQTT.Finalize(); err != nil {
+		return err
+	}
+	return c.finalizeRoutes()
+}
+
+// registerSecrets registers the tokens, passwords and credentials in urls of the config, so they're redacted
+// from the logs and error messages.
+func (c *config) registerSecrets() {
+	redact.Add(c.BotToken, c.Encryption.Passphrase, c.HTTP.Auth.Password, c.HTTP.APIToken, c.GRPC.Token, c.Influx.Token, c.MQTT.Password)
+	redact.URL(c.Influx.URL)
+	redact.URL(c.MQTT.Broker)
+	redact.URL(c.Proxy.RPC)
+	redact.URL(c.Proxy.Telegram)
+	nodes := c.Nodes
+	if c.Reference != nil {
+		nodes = append(nodes[:len(nodes):len(nodes)], *c.Reference)
+	}
+	for _, n := range nodes {
+		redact.URL(n.URL)
+		for _, u := range n.Fallbacks {
+			redact.URL(u)
+		}
+		redact.URL(n.Proxy)
+		redact.Add(n.Auth.Password, n.Auth.BearerToken, n.ValidatorClient.BearerToken)
+		redact.URL(n.ValidatorClient.URL)
+		redact.URL(n.Beacon)
+		for _, u := range n.Metrics {
+			redact.URL(u)
+		}
+		for _, v := range n.Headers {
+			redact.Add(v)
+		}
+	}
+	redact.Add(c.Checks.Explorer.Etherscan.APIKey, c.Checks.Explorer.Beaconchain.APIKey)
+	for _, u := range c.Checks.Checkpoint.Trusted {
+		redact.URL(u)
+	}
+	for _, r := range c.Remediation {
+		if w := r.Webhook; w != nil {
+			redact.URL(w.URL)
+			for _, v := range w.Headers {
+				redact.Add(v)
+			}
+		}
+	}
+	for _, r := range c.Resync {
+		for _, s := range r.Steps {
+			if w := s.Webhook; w != nil {
+				redact.URL(w.URL)
+				for _, v := range w.Headers {
+					redact.Add(v)
+				}
+			}
+		}
+	}
+	for _, v := range c.Tracing.Headers {
+		redact.Add(v)
+	}
+	if u, err := url.Parse(c.Sentry.DSN); err == nil && u.User != nil {
+		// the public key of the dsn
+		redact.Add(u.User.Username())
+	}
+	redact.URL(c.Alertmanager.URL)
+	for _, r := range c.Routes {
+		switch {
+		case r.PagerDuty != nil:
+			redact.Add(r.PagerDuty.RoutingKey)
+		case r.Alertmanager != nil:
+			redact.URL(r.Alertmanager.URL)
+		case r.Webhook != nil:
+			redact.URL(r.Webhook.URL)
+			for _, v := range r.Webhook.Headers {
+				redact.Add(v)
+			}
+		}
+	}
+}
+
+// finalizeRoutes adds the legacy alert group and alertmanager settings as routes and validates the routes and rules.
+func (c *config) finalizeRoutes() error {
+	if c.Routes == nil {
+		c.Routes = make(map[string]routeConfig)
+	}
+	if _, ok := c.Routes["default"]; !ok && c.AlertGroup != 0 {
+		c.Routes["default"] = routeConfig{Telegram: &telegram.Config{
+			Chat:       c.AlertGroup,
+			QuietHours: c.QuietHours,
+			GroupWait:  c.GroupWait,
+			OnCall:     c.OnCall,
+		}}
+	}
+	if _, ok := c.Routes["alertmanager"]; !ok && c.Alertmanager.URL != "" {
+		am := c.Alertmanager
+		c.Routes["alertmanager"] = routeConfig{Alertmanager: &am}
+	}
+	if len(c.Routes) == 0 {
+		return errors.New("missing alert group")
+	}
+	for name, sc := range c.Schedules {
+		if _, err := telegram.NewSchedule(sc); err != nil {
+			return fmt.Errorf("schedule %s: %w", name, err)
+		}
+	}
+	for name, r := range c.Routes {
+		if _, ok := insync.ParseVerbosity(r.Verbosity); r.Verbosity != "" && !ok {
+			return fmt.Errorf("route %s: invalid verbosity %q, expected all, warning or critical", name, r.Verbosity)
+		}
+		var n int
+		if t := r.Telegram; t != nil {
+			n++
+			if t.Chat == 0 {
+				return fmt.Errorf("route %s: missing chat", name)
+			}
+			if _, err := telegram.ParseQuietHours(t.QuietHours); t.QuietHours != "" && err != nil {
+				return fmt.Errorf("route %s: %w", name, err)
+			}
+			if _, ok := c.Schedules[t.OnCall]; t.OnCall != "" && !ok {
+				return fmt.Errorf("route %s: unknown schedule %q", name, t.OnCall)
+			}
+			if _, err := time.LoadLocation(t.Timezone); t.Timezone != "" && err != nil {
+				return fmt.Errorf("route %s: invalid timezone: %w", name, err)
+			}
+		}
+		if am := r.Alertmanager; am != nil {
+			n++
+			if am.URL == "" {
+				return fmt.Errorf("route %s: missing alertmanager url", name)
+			}
+			if am.ResendInterval <= 0 {
+				am.ResendInterval = insync.Duration(time.Minute)
+			}
+		}
+		if pd := r.PagerDuty; pd != nil {
+			n++
+			if pd.RoutingKey == "" {
+				return fmt.Errorf("route %s: missing pagerduty routing key", name)
+			}
+		}
+		if e := r.Exec; e != nil {
+			n++
+			if len(e.Command) == 0 {
+				return fmt.Errorf("route %s: missing command", name)
+			}
+		}
+		if w := r.Webhook; w != nil {
+			n++
+			if w.URL == "" {
+				return fmt.Errorf("route %s: missing webhook url", name)
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("route %s: exactly one of telegram, alertmanager, pagerduty, exec or webhook must be set", name)
+		}
+	}
+	for i, r := range c.Rules {
+		if len(r.Routes) == 0 {
+			return fmt.Errorf("rule %d: no routes", i)
+		}
+		for _, name := range r.Routes {
+			if _, ok := c.Routes[name]; !ok {
+				return fmt.Errorf("rule %d: unknown route %q", i, name)
+			}
+		}
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	for _, name := range c.DefaultRoutes {
+		if _, ok := c.Routes[name]; !ok {
+			return fmt.Errorf("unknown default route %q", name)
+		}
+	}
+	if f := c.Pipeline.FallbackRoute; f != "" {
+		if _, ok := c.Routes[f]; !ok {
+			return fmt.Errorf("unknown fallback route %q", f)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// dashboardSamples is the number of lag samples kept per node for the sparklines.
+const dashboardSamples = 120
+
+// dashboard serves the web ui at /dashboard, e.g. for the wall of a noc where telegram isn't visible.
+// It samples the lag of the nodes itself, so the sparklines don't require the history.
+type dashboard struct {
+	nodes []*insync.Node
+	st    *insync.StateStore
+
+	mu sync.Mutex
+	// lag are the last samples per node, -1 if the node was unreachable.
+	lag map[string][]int64
+}
+
+// dashboardNode is a node as shown on the dashboard.
+type dashboardNode struct {
+	apiNode
+	Lag []int64 `json:"lag"`
+}
+
+func newDashboard(nodes []*insync.Node, st *insync.StateStore) *dashboard {
+	return &dashboard{nodes: nodes, st: st, lag: make(map[string][]int64, len(nodes))}
+}
+
+// run samples the lag of the nodes every interval.
+func (d *dashboard) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.sample()
+		}
+	}
+}
+
+func (d *dashboard) sample() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, n := range d.nodes {
+		if !n.Checked() {
+			continue
+		}
+		v := int64(-1)
+		if n.LastError() == nil {
+			st := n.Status()
+			v = 0
+			if st.HighestBlock > st.CurrentBlock {
+				v = int64(st.HighestBlock - st.CurrentBlock)
+			}
+		}
+		samples := append(d.lag[n.Name()], v)
+		if len(samples) > dashboardSamples {
+			samples = samples[len(samples)-dashboardSamples:]
+		}
+		d.lag[n.Name()] = samples
+	}
+}
+
+// handler serves the page, its data at /dashboard/state and the mute controls at /dashboard/nodes/{name}/mute.
+// It's protected like the rest of the http server, the mutes are attributed to the basic auth user.
+func (d *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		_, _ = w.Write(dashboardHTML)
+	})
+	mux.HandleFunc("/dashboard/state", func(w http.ResponseWriter, r *http.Request) {
+		if !apiMethod(w, r, http.MethodGet) {
+			return
+		}
+		d.mu.Lock()
+		nodes := make([]dashboardNode, 0, len(d.nodes))
+		for _, n := range d.nodes {
+			nodes = append(nodes, dashboardNode{apiNode: newAPINode(n, d.st), Lag: append([]int64{}, d.lag[n.Name()]...)})
+		}
+		d.mu.Unlock()
+		var all *insync.Mute
+		if m, ok := d.st.Mutes()[insync.AllNodes]; ok {
+			all = &m
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Nodes   []dashboardNode `json:"nodes"`
+			MuteAll *insync.Mute    `json:"mute_all,omitempty"`
+			Time    time.Time       `json:"time"`
+		}{nodes, all, time.Now()})
+	})
+	mux.HandleFunc("/dashboard/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/dashboard/nodes/"), "/")
+		if action != "mute" || !d.isNode(name) {
+			apiError(w, http.StatusNotFound, "not found")
+			return
+		}
+		// the page sends json, which other sites can't send without a cors preflight
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			apiError(w, http.StatusUnsupportedMediaType, "expected json")
+			return
+		}
+		if !apiMethod(w, r, http.MethodPost, http.MethodDelete) {
+			return
+		}
+		user, _, ok := r.BasicAuth()
+		if !ok {
+			user = "dashboard"
+		}
+		apiMute(w, r, d.st, name, user)
+	})
+	return mux
+}
+
+func (d *dashboard) isNode(name string) bool {
+	if name == insync.AllNodes {
+		return true
+	}
+	for _, n := range d.nodes {
+		if n.Name() == name {
+			return true
+		}
+	}
+	return false
+}
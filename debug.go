@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// debugConfig configures the debug server, it's disabled if listen is empty.
+type debugConfig struct {
+	// Listen is the address of the debug server, e.g. localhost:6060.
+	// It's a separate server, so the profiles aren't exposed together with the health checks and metrics.
+	Listen string `yaml:"listen"`
+}
+
+// debugMux serves the profiles of net/http/pprof at /debug/pprof/.
+func debugMux(addr string) *http.ServeMux {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			slog.Warn("the debug server isn't bound to localhost, the profiles can be fetched by anyone reaching it", "addr", addr)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"strings"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+var dryRun = flag.Bool("dry-run", false, "run all checks but only log the alerts instead of sending them and the remediations instead of running them")
+
+// dryRunRoute logs the alerts of a route instead of sending them.
+type dryRunRoute struct {
+	name string
+}
+
+// SetAuditor ignores the auditor, nothing is delivered in a dry run.
+func (r dryRunRoute) SetAuditor(insync.NotificationRecorder, string) {}
+
+func (r dryRunRoute) Send(a insync.Alert) error {
+	state := "firing"
+	if a.Resolved {
+		state = "resolved"
+	}
+	slog.Info("dry run, would send alert", "route", r.name, "node", a.Node, "alert", a.Name, "severity", a.Severity.String(), "state", state, "text", strings.TrimSpace(a.Text))
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in the values of the config with the environment variables,
+// e.g. to keep the bot token in a secret. $${ is kept as a literal ${.
+// The values are expanded after parsing, so the variables can't break the yaml.
+func expandEnv(n *yaml.Node) error {
+	for _, c := range n.Content {
+		if err := expandEnv(c); err != nil {
+			return err
+		}
+	}
+	if n.Kind != yaml.ScalarNode || !strings.Contains(n.Value, "${") {
+		return nil
+	}
+	v, err := expand(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	n.Value = v
+	if n.Style == 0 {
+		// resolve the type of plain values again, e.g. port: ${PORT}
+		n.Tag = ""
+	}
+	return nil
+}
+
+// expand replaces the variables in s.
+func expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable in %q", s)
+		}
+		b.WriteString(s[:i])
+		name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		v, ok := os.LookupEnv(name)
+		switch {
+		case ok && (v != "" || !hasDefault):
+		case hasDefault:
+			v = def
+		default:
+			return "", fmt.Errorf("the environment variable %s isn't set", name)
+		}
+		b.WriteString(v)
+		s = s[i+end+1:]
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("INSYNC_TEST_TOKEN", "123:abc")
+	t.Setenv("INSYNC_TEST_EMPTY", "")
+	tests := []struct {
+		name string
+		s    string
+		want string
+		ok   bool
+	}{
+		{name: "no variables", s: "http://localhost:8545", want: "http://localhost:8545", ok: true},
+		{name: "variable", s: "${INSYNC_TEST_TOKEN}", want: "123:abc", ok: true},
+		{name: "within text", s: "Bearer ${INSYNC_TEST_TOKEN}!", want: "Bearer 123:abc!", ok: true},
+		{name: "several variables", s: "${INSYNC_TEST_TOKEN}/${INSYNC_TEST_TOKEN}", want: "123:abc/123:abc", ok: true},
+		{name: "default of unset variable", s: "${INSYNC_TEST_UNSET:-8080}", want: "8080", ok: true},
+		{name: "default of empty variable", s: "${INSYNC_TEST_EMPTY:-8080}", want: "8080", ok: true},
+		{name: "empty variable without default", s: "a${INSYNC_TEST_EMPTY}b", want: "ab", ok: true},
+		{name: "default ignored if set", s: "${INSYNC_TEST_TOKEN:-none}", want: "123:abc", ok: true},
+		{name: "escaped", s: "$${INSYNC_TEST_TOKEN}", want: "${INSYNC_TEST_TOKEN}", ok: true},
+		{name: "unset variable", s: "${INSYNC_TEST_UNSET}"},
+		{name: "unterminated", s: "${INSYNC_TEST_TOKEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expand(tt.s)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("INSYNC_TEST_PORT", "8080")
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("port: ${INSYNC_TEST_PORT}\nname: \"${INSYNC_TEST_PORT}\"\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := expandEnv(&doc); err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Port interface{} `yaml:"port"`
+		Name interface{} `yaml:"name"`
+	}
+	if err := doc.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	// plain values get their type from the expanded value, quoted ones stay strings
+	if v.Port != 8080 || v.Name != "8080" {
+		t.Fatalf("got port %#v and name %#v, want 8080 and \"8080\"", v.Port, v.Name)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/telegram"
+)
+
+// exportCommand writes the incidents of the state file as csv or json, e.g.
+// insync -config config.yml export -from 2021-11-01 -to 2021-12-01 -format csv.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	from := fs.String("from", "", "start of the export, a date (2006-01-02), a timestamp (RFC3339) or a window like 30d, defaults to 30d")
+	to := fs.String("to", "", "end of the export, a date or timestamp, defaults to now")
+	format := fs.String("format", "csv", "csv or json")
+	output := fs.String("output", "", "file to write to, stdout if empty")
+	stateFile := fs.String("state", os.Getenv("STATE_FILE"), "the state file, read from the config file if given with -config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	encryption := insync.EncryptionConfig{
+		Passphrase: os.Getenv("ENCRYPTION_PASSPHRASE"),
+		KeyFile:    os.Getenv("ENCRYPTION_KEY_FILE"),
+	}
+	if *configFile != "" {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		*stateFile = cfg.StateFile
+		encryption = cfg.Encryption
+	}
+	if *stateFile == "" {
+		return fmt.Errorf("there is no state file, pass it with -state")
+	}
+
+	end := time.Now()
+	if *to != "" {
+		t, err := parseExportTime(*to, end)
+		if err != nil {
+			return err
+		}
+		end = t
+	}
+	start := end.Add(-30 * 24 * time.Hour)
+	if *from != "" {
+		t, err := parseExportTime(*from, end)
+		if err != nil {
+			return err
+		}
+		start = t
+	}
+
+	cipher, err := encryption.Cipher()
+	if err != nil {
+		return err
+	}
+	st, err := insync.LoadEncryptedState(*stateFile, cipher)
+	if err != nil {
+		return fmt.Errorf("error loading state: %w", err)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return insync.ExportIncidents(w, *format, st.Incidents(start, end))
+}
+
+// parseExportTime parses a date, a timestamp or a window before end.
+func parseExportTime(s string, end time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := telegram.ParseWindow(s); err == nil {
+		return end.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date (2006-01-02), a timestamp (RFC3339) or a window like 30d", s)
+}
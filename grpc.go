@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/jon4hz/insync/pkg/grpcapi"
+)
+
+// grpcConfig configures the grpc api, it's disabled if listen is empty.
+type grpcConfig struct {
+	Listen string `yaml:"listen"`
+	// Token is required from the clients as bearer token, the api is open if it's empty.
+	Token string `yaml:"token"`
+	// CertFile and KeyFile enable tls, which is required if insync was built with go < 1.24.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func (c *grpcConfig) finalize() error {
+	if c.Listen == "" {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("the grpc api requires both a cert and a key file")
+	}
+	if c.CertFile == "" && !grpcapi.Cleartext {
+		return errors.New("this build of insync only serves grpc over tls, set the cert and the key file")
+	}
+	return nil
+}
+
+// startGRPC starts the server of the grpc api in the background.
+func startGRPC(cfg grpcConfig, api *grpcapi.Server) *http.Server {
+	if cfg.Token == "" {
+		slog.Warn("the grpc api has no token, anyone reaching it can watch the nodes", "addr", cfg.Listen)
+	}
+	srv := api.HTTPServer(cfg.Listen)
+	go func() {
+		slog.Info("grpc server listening", "addr", cfg.Listen, "tls", cfg.CertFile != "")
+		var err error
+		if cfg.CertFile != "" {
+			err = srv.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("error running grpc server", "err", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+	"github.com/jon4hz/insync/pkg/routing"
+)
+
+// telegramCheckInterval is how long the result of the telegram check is cached,
+// so frequent probes don't hit the telegram api.
+const telegramCheckInterval = 30 * time.Second
+
+// health reports the health of insync itself.
+type health struct {
+	b     *gotgbot.Bot
+	nodes []*insync.Node
+	// maxAge is the maximum time since the last sync check of a node.
+	maxAge time.Duration
+
+	mu          sync.Mutex
+	telegramErr error
+	telegramAt  time.Time
+	// ready is set once telegram was reached and a node was checked successfully.
+	ready bool
+	// stopping is set once insync is shutting down, the readiness fails from then on.
+	stopping bool
+}
+
+func newHealth(b *gotgbot.Bot, nodes []*insync.Node, checkInterval time.Duration) *health {
+	return &health{b: b, nodes: nodes, maxAge: 3 * checkInterval}
+}
+
+// healthStatus is the response of the health endpoints.
+type healthStatus struct {
+	OK       bool              `json:"ok"`
+	Telegram string            `json:"telegram,omitempty"`
+	Nodes    map[string]string `json:"nodes,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// liveness reports whether the checks of all nodes are running, /livez and /healthz.
+func (h *health) liveness(w http.ResponseWriter, r *http.Request) {
+	if err := checksRecent(h.nodes, h.maxAge); err != nil {
+		writeStatus(w, healthStatus{Error: err.Error()})
+		return
+	}
+	writeStatus(w, healthStatus{OK: true})
+}
+
+// readiness reports whether insync can reach telegram and the nodes, /readyz.
+// It fails until the bot authenticated with telegram and a node was checked successfully, afterwards if telegram
+// or all nodes are unreachable. A single unreachable node is reported but alerted anyway.
+// Once insync is shutting down, it fails as well.
+func (h *health) readiness(w http.ResponseWriter, r *http.Request) {
+	st := healthStatus{OK: true, Telegram: "ok", Nodes: make(map[string]string, len(h.nodes))}
+	if err := h.telegram(); err != nil {
+		st.OK, st.Telegram = false, redact.Error(err)
+	}
+	var reachable, checked int
+	for _, n := range h.nodes {
+		if err := n.LastError(); err != nil {
+			st.Nodes[n.Name()] = redact.Error(err)
+			continue
+		}
+		st.Nodes[n.Name()] = "ok"
+		reachable++
+		if n.Checked() {
+			checked++
+		}
+	}
+	if reachable == 0 {
+		st.OK, st.Error = false, "no node is reachable"
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if st.OK && checked > 0 {
+		h.ready = true
+	}
+	switch {
+	case h.stopping:
+		st.OK, st.Error = false, "shutting down"
+	case !h.ready && st.OK:
+		st.OK, st.Error = false, "waiting for the first check"
+	}
+	writeStatus(w, st)
+}
+
+// stop fails the readiness from now on.
+func (h *health) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopping = true
+}
+
+// telegram checks whether the telegram api is reachable with the bot token.
+func (h *health) telegram() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.telegramAt) < telegramCheckInterval {
+		return h.telegramErr
+	}
+	_, err := h.b.GetMe()
+	h.telegramErr, h.telegramAt = err, time.Now()
+	return err
+}
+
+func writeStatus(w http.ResponseWriter, st healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if !st.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// checksRecent returns an error if the sync check of any node didn't run within maxAge.
+func checksRecent(nodes []*insync.Node, maxAge time.Duration) error {
+	for _, n := range nodes {
+		if last := n.LastCheck(); time.Since(last) > maxAge {
+			return fmt.Errorf("%s wasn't checked since %s", n.Name(), last.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// pipelineHandler reports the metrics of the routes, /pipeline.
+func pipelineHandler(router *routing.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Routes []routing.Stats `json:"routes"`
+		}{router.Stats()})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// healthcheckCommand queries the health endpoint of the running instance and fails if it's unhealthy,
+// e.g. as docker healthcheck in images without curl. Without the http server, the nodes are checked once instead.
+func healthcheckCommand(args []string) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	ready := fs.Bool("ready", false, "query /readyz instead of /healthz, which also fails if telegram or all nodes are unreachable")
+	rawURL := fs.String("url", "", "the url of the health endpoint, derived from the listen address of the http server if empty")
+	timeout := fs.Duration("timeout", 5*time.Second, "the timeout of the healthcheck")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if *rawURL != "" {
+		return queryHealth(ctx, *rawURL)
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if cfg.HTTP.Listen == "" {
+		return checkNodesOnce(ctx, cfg)
+	}
+	path := "/healthz"
+	if *ready {
+		path = "/readyz"
+	}
+	u, err := localURL(cfg.HTTP.Listen, path)
+	if err != nil {
+		return err
+	}
+	return queryHealth(ctx, u)
+}
+
+// localURL returns the url of the path on the server listening on addr, the loopback address if it listens on all interfaces.
+func localURL(addr, path string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + path, nil
+}
+
+// queryHealth fails if the health endpoint doesn't report ok.
+func queryHealth(ctx context.Context, u string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var st healthStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return fmt.Errorf("invalid response of %s: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK || !st.OK {
+		msg := st.Error
+		if msg == "" {
+			msg = resp.Status
+		}
+		return errors.New(msg)
+	}
+	fmt.Fprintln(os.Stdout, "ok")
+	return nil
+}
+
+// checkNodesOnce runs the sync check of every node once, it fails if none of the nodes can be reached.
+func checkNodesOnce(ctx context.Context, cfg *config) error {
+	st, _ := insync.LoadState("")
+	var ref *insync.Node
+	if cfg.Reference != nil {
+		// for the light clients
+		ref = insync.NewNode(*cfg.Reference, nil)
+	}
+	var errs []error
+	for _, nc := range cfg.Nodes {
+		n := insync.NewNode(nc, st.Incident(nc.Name))
+		n.SetReference(ref)
+		insync.NewSyncCheck(n, cfg.Checks.Sync, 0).Run(ctx, insync.Notifiers{})
+		if err := n.LastError(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+			continue
+		}
+		fmt.Fprintln(os.Stdout, "ok")
+		return nil
+	}
+	return errors.Join(errs...)
+}
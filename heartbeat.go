@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// heartbeat pings an external url (e.g. healthchecks.io) while insync is healthy,
+// so someone notices if insync itself stops working.
+//
+// insync is considered healthy as long as the sync check of every node ran recently.
+// Otherwise the /fail endpoint of the url is pinged, which is understood by healthchecks.io.
+type heartbeat struct {
+	url      string
+	interval time.Duration
+	// maxAge is the maximum time since the last check of a node.
+	maxAge time.Duration
+	nodes  []*insync.Node
+	client *http.Client
+}
+
+func newHeartbeat(cfg heartbeatConfig, checkInterval time.Duration, nodes []*insync.Node) *heartbeat {
+	return &heartbeat{
+		url:      strings.TrimSuffix(cfg.URL, "/"),
+		interval: time.Duration(cfg.Interval),
+		maxAge:   2*checkInterval + time.Duration(cfg.Interval),
+		nodes:    nodes,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *heartbeat) run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		url := h.url
+		if err := h.healthy(); err != nil {
+			slog.Warn("insync is unhealthy, skipping the heartbeat", "err", err)
+			url += "/fail"
+		}
+		if err := h.ping(url); err != nil {
+			slog.Error("error sending heartbeat", "err", err)
+		}
+	}
+}
+
+// healthy returns an error if the sync check of any node didn't run recently.
+func (h *heartbeat) healthy() error {
+	return checksRecent(h.nodes, h.maxAge)
+}
+
+func (h *heartbeat) ping(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// influxConfig configures the influxdb sink, it's disabled if the url is empty.
+type influxConfig struct {
+	// URL is the write endpoint, e.g. http://influxdb:8086/api/v2/write?org=ops&bucket=nodes for influxdb 2
+	// or http://influxdb:8086/write?db=nodes for influxdb 1. Any endpoint accepting the line protocol works.
+	URL string `yaml:"url"`
+	// Token is sent as influxdb token, credentials of influxdb 1 can be passed in the url.
+	Token string `yaml:"token"`
+	// Interval is the time between two writes, defaults to the interval of the sync check.
+	Interval insync.Duration `yaml:"interval"`
+	// Measurement defaults to insync_node.
+	Measurement string `yaml:"measurement"`
+}
+
+// influxBacklog is the number of points kept while the endpoint is down, the oldest are dropped first.
+const influxBacklog = 10000
+
+// influx writes the status of the nodes to an influxdb, or anything else accepting the line protocol.
+type influx struct {
+	cfg    influxConfig
+	nodes  []*insync.Node
+	client *http.Client
+	// pending are the points not written yet.
+	pending []string
+}
+
+func newInflux(cfg influxConfig, checkInterval time.Duration, nodes []*insync.Node) *influx {
+	if cfg.Interval <= 0 {
+		cfg.Interval = insync.Duration(checkInterval)
+	}
+	if cfg.Measurement == "" {
+		cfg.Measurement = "insync_node"
+	}
+	return &influx{cfg: cfg, nodes: nodes, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (f *influx) run(ctx context.Context) {
+	t := time.NewTicker(time.Duration(f.cfg.Interval))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			f.sample(now)
+			if err := f.write(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("error writing to influxdb", "pending", len(f.pending), "err", err)
+			}
+		}
+	}
+}
+
+// sample adds a point per checked node to the pending points.
+func (f *influx) sample(now time.Time) {
+	for _, n := range f.nodes {
+		if !n.Checked() {
+			continue
+		}
+		f.pending = append(f.pending, influxPoint(f.cfg.Measurement, n, now))
+	}
+	if len(f.pending) > influxBacklog {
+		f.pending = f.pending[len(f.pending)-influxBacklog:]
+	}
+}
+
+// write posts the pending points, they're kept for the next write if it fails.
+func (f *influx) write(ctx context.Context) error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	body := strings.Join(f.pending, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if f.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+f.cfg.Token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if resp.StatusCode == http.StatusBadRequest {
+			// influxdb rejects malformed points for good, retrying them would block the newer ones
+			f.pending = nil
+		}
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	f.pending = nil
+	return nil
+}
+
+// influxPoint encodes the status of the node in the line protocol, tagged with the node, the chain and the client.
+func influxPoint(measurement string, n *insync.Node, now time.Time) string {
+	st := n.Status()
+	var b strings.Builder
+	b.WriteString(influxEscape(measurement, ", "))
+	for _, tag := range [][2]string{{"node", n.Name()}, {"chain", st.Chain}, {"client", st.Client}} {
+		if tag[1] != "" {
+			fmt.Fprintf(&b, ",%s=%s", tag[0], influxEscape(tag[1], ",= "))
+		}
+	}
+	up := n.LastError() == nil
+	state := st.State
+	if !up {
+		state = insync.StateUnreachable
+	}
+	var lag uint64
+	if st.HighestBlock > st.CurrentBlock {
+		lag = st.HighestBlock - st.CurrentBlock
+	}
+	fmt.Fprintf(&b, " state=%q,up=%t,current_block=%di,highest_block=%di,lag=%di",
+		state.String(), up, st.CurrentBlock, st.HighestBlock, lag)
+	if st.Peers >= 0 {
+		fmt.Fprintf(&b, ",peers=%di", st.Peers)
+	}
+	if st.Latency > 0 {
+		b.WriteString(",latency_seconds=" + strconv.FormatFloat(st.Latency.Seconds(), 'f', -1, 64))
+	}
+	fmt.Fprintf(&b, " %d", now.UnixNano())
+	return b.String()
+}
+
+// influxEscape escapes the characters of a measurement or a tag with a backslash.
+func influxEscape(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
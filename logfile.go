@@ -0,0 +1,190 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// backupTimeFormat is the timestamp in the names of the rotated log files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// logFileConfig configures the log file, insync logs to stderr if the path is empty.
+type logFileConfig struct {
+	Path string `yaml:"path"`
+	// MaxSize is the size in megabytes after which the file is rotated, defaults to 100.
+	MaxSize int64 `yaml:"max_size"`
+	// MaxAge is the age after which the file is rotated, 0 disables the rotation by age.
+	MaxAge insync.Duration `yaml:"max_age"`
+	// MaxBackups is the number of rotated files kept, defaults to 7.
+	MaxBackups int `yaml:"max_backups"`
+	// Compress gzips the rotated files.
+	Compress bool `yaml:"compress"`
+}
+
+func (c *logFileConfig) finalize() {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 100
+	}
+	if c.MaxBackups <= 0 {
+		c.MaxBackups = 7
+	}
+}
+
+// logFile is a log file which is rotated once it's too large or too old.
+type logFile struct {
+	cfg logFileConfig
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// cleanupMu serializes the compression and pruning of the backups.
+	cleanupMu sync.Mutex
+	cleanup   sync.WaitGroup
+}
+
+// openLogFile opens the log file, appending to it if it exists.
+func openLogFile(cfg logFileConfig) (*logFile, error) {
+	l := &logFile{cfg: cfg}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.due(int64(len(p))) {
+		if err := l.rotate(); err != nil {
+			// keep logging to the current file rather than losing the logs
+			fmt.Fprintf(os.Stderr, "error rotating log file: %s\n", err)
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file has to be rotated before writing n bytes.
+func (l *logFile) due(n int64) bool {
+	if l.size > 0 && l.size+n > l.cfg.MaxSize<<20 {
+		return true
+	}
+	return l.cfg.MaxAge > 0 && l.size > 0 && time.Since(l.opened) > time.Duration(l.cfg.MaxAge)
+}
+
+// rotate renames the current file and opens a new one. The backups are compressed and pruned in the background.
+func (l *logFile) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(l.cfg.Path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(l.cfg.Path, ext), time.Now().Format(backupTimeFormat), ext)
+	renameErr := os.Rename(l.cfg.Path, backup)
+	if err := l.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	l.cleanup.Add(1)
+	go func() {
+		defer l.cleanup.Done()
+		l.cleanupMu.Lock()
+		defer l.cleanupMu.Unlock()
+		if l.cfg.Compress {
+			if err := compressFile(backup); err != nil {
+				slog.Error("error compressing log file", "file", backup, "err", err)
+			}
+		}
+		if err := l.prune(); err != nil {
+			slog.Error("error removing old log files", "err", err)
+		}
+	}()
+	return nil
+}
+
+// prune removes the oldest backups exceeding MaxBackups.
+func (l *logFile) prune() error {
+	ext := filepath.Ext(l.cfg.Path)
+	backups, err := filepath.Glob(strings.TrimSuffix(l.cfg.Path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return err
+	}
+	// the timestamps sort chronologically
+	sort.Strings(backups)
+	for len(backups) > l.cfg.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the file once the background compression is done.
+func (l *logFile) Close() error {
+	// the cleanup logs its errors, so it has to finish before the file is locked
+	l.cleanup.Wait()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// compressFile gzips the file and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// logLevel is the level of the default logger, it's set once the config is read.
+var logLevel = new(slog.LevelVar)
+
+// logOutput is the writer of the default logger.
+var logOutput io.Writer = os.Stderr
+
+// reporter reports the logged errors to sentry, nil if it's disabled.
+var reporter *sentry
+
+// setupLogging makes the default logger write to w, in the given format. The log package is redirected to it, too.
+func setupLogging(w io.Writer, format string) {
+	logOutput = w
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	if reporter != nil {
+		h = &sentryHandler{Handler: h, s: reporter}
+	}
+	slog.SetDefault(slog.New(redact.Handler(h)))
+}
+
+// fatal logs the error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type logConfig struct {
+	// Level is debug, info, warn or error, defaults to info.
+	Level string `yaml:"level"`
+	// Format is text or json, defaults to text.
+	Format string `yaml:"format"`
+	// File is the log file, the logs are written to stderr if the path is empty.
+	File logFileConfig `yaml:"file"`
+
+	level slog.Level
+}
+
+func (c *logConfig) finalize() error {
+	if c.Level == "" {
+		c.Level = "info"
+	}
+	if err := c.level.UnmarshalText([]byte(c.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", c.Level)
+	}
+	c.File.finalize()
+	switch c.Format {
+	case "":
+		c.Format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", c.Format)
+	}
+	return nil
+}
@@ -2,49 +2,487 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	// the timezones are embedded, the alpine image and windows don't have them
+	_ "time/tzdata"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/jon4hz/insync/pkg/alertmanager"
+	"github.com/jon4hz/insync/pkg/grpcapi"
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/mqtt"
+	"github.com/jon4hz/insync/pkg/pagerduty"
+	"github.com/jon4hz/insync/pkg/plugin"
+	"github.com/jon4hz/insync/pkg/remediation"
+	"github.com/jon4hz/insync/pkg/routing"
+	"github.com/jon4hz/insync/pkg/telegram"
+	"github.com/jon4hz/insync/pkg/tracing"
 )
 
-type syncCounter struct {
-	sync.Mutex
-	counter int64
-}
+var configFile = flag.String("config", os.Getenv("CONFIG_FILE"), "path to the config file, the environment variables are used if empty")
 
-var (
-	ethUrl         = os.Getenv("GETH_URL")
-	tgBotToken     = os.Getenv("BOT_TOKEN")
-	reportInterval = mustParseDuration(os.Getenv("REPORT_INTERVAL"))
-	checkInterval  = mustParseDuration(os.Getenv("CHECK_INTERVAL"))
-	alertGroup     = mustParseInt64(os.Getenv("ALERT_GROUP"))
-)
+var debugRPC = flag.Bool("debug-rpc", false, "log the json-rpc payloads and the duration of every call to the nodes, implies the debug log level")
 
-func init() {
-	if reportInterval <= checkInterval {
-		panic("report interval must be greater than check interval")
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	setupLogging(os.Stderr, "text")
+	switch flag.Arg(0) {
+	case "export":
+		if err := exportCommand(flag.Args()[1:]); err != nil {
+			fatal("error exporting incidents", "err", err)
+		}
+		return
+	case "send-test":
+		if err := sendTestCommand(flag.Args()[1:]); err != nil {
+			fatal("error sending test alert", "err", err)
+		}
+		return
+	case "check":
+		os.Exit(checkCommand(flag.Args()[1:]))
+	case "healthcheck":
+		if err := healthcheckCommand(flag.Args()[1:]); err != nil {
+			fatal("unhealthy", "err", err)
+		}
+		return
 	}
+	if flag.NArg() > 0 {
+		if err := serviceCommand(flag.Arg(0)); err != nil {
+			fatal("error running command", "command", flag.Arg(0), "err", err)
+		}
+		return
+	}
+	runService(run)
 }
 
-func main() {
-	c, err := createGethClient(ethUrl)
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [export|send-test|check|healthcheck|install|uninstall|start|stop]\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "export writes the incidents as csv or json, see export -h")
+	fmt.Fprintln(flag.CommandLine.Output(), "send-test sends a test alert through the routing, see send-test -h")
+	fmt.Fprintln(flag.CommandLine.Output(), "check runs the checks once and reports the result as nagios plugin, see check -h")
+	fmt.Fprintln(flag.CommandLine.Output(), "healthcheck exits with 1 if the running instance is unhealthy, see healthcheck -h")
+	fmt.Fprintln(flag.CommandLine.Output(), "the other commands manage the windows service of insync")
+	flag.PrintDefaults()
+}
+
+// run monitors the nodes until the context is done or insync receives a termination signal.
+func run(ctx context.Context) {
+	cfg, err := readConfig()
+	if err != nil {
+		fatal("error loading config", "err", err)
+	}
+	logLevel.Set(cfg.Log.level)
+	if *debugRPC {
+		logLevel.Set(slog.LevelDebug)
+		insync.EnableRPCDebugLog()
+	}
+	if cfg.Sentry.DSN != "" {
+		if reporter, err = newSentry(cfg.Sentry); err != nil {
+			fatal("error configuring sentry", "err", err)
+		}
+	}
+	if cfg.Log.File.Path != "" {
+		lf, err := openLogFile(cfg.Log.File)
+		if err != nil {
+			fatal("error opening log file", "err", err)
+		}
+		defer lf.Close()
+		setupLogging(lf, cfg.Log.Format)
+	} else {
+		setupLogging(logOutput, cfg.Log.Format)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cipher, err := cfg.Encryption.Cipher()
+	if err != nil {
+		fatal("error creating cipher", "err", err)
+	}
+	st, err := insync.LoadEncryptedState(cfg.StateFile, cipher)
+	if err != nil {
+		fatal("error loading state", "err", err)
+	}
+	nodes := make([]*insync.Node, 0, len(cfg.Nodes))
+	for _, nc := range cfg.Nodes {
+		nodes = append(nodes, insync.NewNode(nc, st.Incident(nc.Name)))
+	}
+	// the reference isn't monitored, only its head block is compared to those of the nodes
+	var ref *insync.Node
+	if cfg.Reference != nil {
+		ref = insync.NewNode(*cfg.Reference, nil)
+		for _, n := range nodes {
+			n.SetReference(ref)
+		}
+	}
+	b, err := createTelegramBot(cfg.BotToken, cfg.Proxy.Telegram)
+	if err != nil {
+		fatal("error creating telegram bot", "err", err)
+	}
+	var hist *history.Store
+	if cfg.History.Path != "" {
+		if hist, err = history.OpenEncrypted(cfg.History.Path, time.Duration(cfg.History.Retention), cipher); err != nil {
+			fatal("error opening history", "err", err)
+		}
+		defer hist.Close()
+	}
+	// the settings the chats changed with /settings are stored in the history
+	var prefs *telegram.Preferences
+	if hist != nil {
+		if prefs, err = telegram.LoadPreferences(hist); err != nil {
+			fatal("error loading the settings of the chats", "err", err)
+		}
+	}
+	routes, workers, chats := createRoutes(b, cfg, prefs)
+	router, err := newRouter(routes, cfg)
+	if err != nil {
+		fatal("error creating router", "err", err)
+	}
+	if hist != nil {
+		router.SetAuditor(hist)
+	}
+	// the alerts of the nodes registered with /setup are sent to the chats that registered them
+	var routed insync.Notifier = router
+	var tm *tenants
+	var setup telegram.Tenants
+	if cfg.Tenants.Enabled {
+		var audit insync.NotificationRecorder
+		if hist != nil {
+			audit = hist
+		}
+		tm = newTenants(ctx, b, cfg, st, router, audit)
+		routed, setup = tm, tm
+	}
+	alerts := newAlertCounter(st.MuteFilter(routed))
+	var nf insync.Notifier = alerts
+	mon := insync.NewMonitor(nf, cfg.Reconnect, cfg.Scheduler)
+	if tm != nil {
+		tm.load(mon)
+	}
+	// the remediations waiting for confirmation and the steps of the resyncs are confirmed with the buttons of the bot
+	var rem *remediation.Remediator
+	var actions telegram.Actions
+	var resyncs telegram.Resyncs
+	if len(cfg.Remediation) > 0 || len(cfg.Resync) > 0 {
+		if rem, err = remediation.New(cfg.Remediation, cfg.Resync, cfg.RemediationLimits, nodes, st, nf); err != nil {
+			fatal("error creating remediation", "err", err)
+		}
+		if *dryRun {
+			rem.SetDryRun()
+		}
+		actions = rem
+		if len(cfg.Resync) > 0 {
+			resyncs = rem
+		}
+	}
+	updater, err := telegram.StartBot(b, nodes, st, hist, prefs, router, chats, setup, actions, resyncs, ref, cfg.location)
 	if err != nil {
-		log.Fatalf("error creating geth client: %s", err)
+		fatal("error starting telegram bot", "err", err)
+	}
+	var bg sync.WaitGroup
+	for name, w := range workers {
+		w := w
+		goSupervised(&bg, nf, name, func() { w(ctx) })
+	}
+	if reporter != nil {
+		goSupervised(&bg, nf, "sentry", func() { reporter.run(ctx) })
+	}
+	if cfg.Tracing.Endpoint != "" {
+		exp := tracing.Enable(cfg.Tracing)
+		goSupervised(&bg, nf, "tracing", func() { exp.Run(ctx) })
+	}
+
+	var servers []*http.Server
+	var h *health
+	if cfg.HTTP.Listen != "" {
+		mux := http.NewServeMux()
+		h = newHealth(b, nodes, time.Duration(cfg.Checks.Sync.Interval))
+		mux.HandleFunc("/livez", h.liveness)
+		mux.HandleFunc("/healthz", h.liveness)
+		mux.HandleFunc("/readyz", h.readiness)
+		mux.HandleFunc("/pipeline", pipelineHandler(router))
+		mux.HandleFunc("/metrics", metricsHandler(nodes, router, alerts))
+		if hist != nil {
+			mux.HandleFunc("/notifications", notificationsHandler(hist))
+		}
+		if cfg.HTTP.APIToken != "" {
+			api := apiHandler(cfg.HTTP.APIToken, mon, ref, st)
+			mux.Handle("/nodes", api)
+			mux.Handle("/nodes/", api)
+			mux.Handle("/incidents", api)
+		}
+		if cfg.HTTP.Dashboard {
+			if len(cfg.HTTP.allow) == 0 && cfg.HTTP.Auth.Username == "" {
+				slog.Warn("the dashboard has neither an allowlist nor basic auth, anyone reaching it can mute the nodes")
+			}
+			dash := newDashboard(nodes, st)
+			dh := dash.handler()
+			mux.Handle("/dashboard", dh)
+			mux.Handle("/dashboard/", dh)
+			goSupervised(&bg, nf, "dashboard", func() { dash.run(ctx, time.Duration(cfg.Checks.Sync.Interval)) })
+		}
+		if cfg.HTTP.Webhook {
+			mux.Handle("/webhook/alertmanager", alertmanager.WebhookHandler(nf))
+		}
+		servers = append(servers, startServer(cfg.HTTP.Listen, protect(cfg.HTTP, mux)))
+	}
+	if cfg.Debug.Listen != "" {
+		servers = append(servers, startServer(cfg.Debug.Listen, debugMux(cfg.Debug.Listen)))
+	}
+	var recorders insync.Recorders
+	var events *grpcapi.Server
+	if cfg.GRPC.Listen != "" {
+		events = grpcapi.New(cfg.GRPC.Token)
+		recorders = append(recorders, events)
+		servers = append(servers, startGRPC(cfg.GRPC, events))
+	}
+	if cfg.MQTT.Broker != "" {
+		pub := mqtt.New(cfg.MQTT, nodes)
+		recorders = append(recorders, pub)
+		goSupervised(&bg, nf, "mqtt", func() { pub.Run(ctx) })
+	}
+	if cfg.Influx.URL != "" {
+		fx := newInflux(cfg.Influx, time.Duration(cfg.Checks.Sync.Interval), nodes)
+		goSupervised(&bg, nf, "influxdb", func() { fx.run(ctx) })
+	}
+	if cfg.Heartbeat.URL != "" {
+		hb := newHeartbeat(cfg.Heartbeat, time.Duration(cfg.Checks.Sync.Interval), nodes)
+		goSupervised(&bg, nf, "heartbeat", func() { hb.run(ctx) })
+	}
+	if rem != nil {
+		goSupervised(&bg, nf, "remediation", func() { rem.Run(ctx, time.Duration(cfg.Checks.Sync.Interval)) })
+	}
+	goSupervised(&bg, nf, "route watchdog", func() { router.Run(ctx, 30*time.Second) })
+	if sd := newSystemd(time.Duration(cfg.Checks.Sync.Interval), nodes); sd != nil {
+		goSupervised(&bg, nf, "systemd", func() { sd.run(ctx) })
+	}
+
+	for i, n := range nodes {
+		checks := []insync.Check{insync.NewSyncCheck(n, cfg.Checks.Sync, time.Duration(cfg.ReminderInterval))}
+		if cfg.Checks.Peers.Interval > 0 {
+			checks = append(checks, insync.NewPeersCheck(n, cfg.Checks.Peers))
+		}
+		if cfg.Checks.ValidatorClient.Interval > 0 && cfg.Nodes[i].ValidatorClient.URL != "" {
+			checks = append(checks, insync.NewValidatorClientCheck(n, cfg.Checks.ValidatorClient))
+		}
+		if cfg.Checks.BeaconSync.Interval > 0 && cfg.Nodes[i].Beacon != "" {
+			checks = append(checks, insync.NewBeaconSyncCheck(n, cfg.Checks.BeaconSync))
+		}
+		if cfg.Checks.Blobs.Interval > 0 && cfg.Nodes[i].Beacon != "" {
+			checks = append(checks, insync.NewBlobCheck(n, cfg.Checks.Blobs))
+		}
+		if cfg.Checks.Proposals.Interval > 0 && len(cfg.Nodes[i].Validators) > 0 {
+			checks = append(checks, insync.NewProposalCheck(n, cfg.Checks.Proposals))
+		}
+		if cfg.Checks.SyncCommittee.Interval > 0 && len(cfg.Nodes[i].Validators) > 0 {
+			checks = append(checks, insync.NewSyncCommitteeCheck(n, cfg.Checks.SyncCommittee))
+		}
+		if cfg.Checks.Checkpoint.Interval > 0 && cfg.Nodes[i].Beacon != "" {
+			checks = append(checks, insync.NewCheckpointCheck(n, cfg.Checks.Checkpoint))
+		}
+		if cfg.Checks.Explorer.Interval > 0 {
+			checks = append(checks, insync.NewExplorerCheck(n, cfg.Checks.Explorer))
+		}
+		if cfg.Checks.Engine.Interval > 0 && cfg.Nodes[i].Auth.JWTSecretFile != "" {
+			checks = append(checks, insync.NewEngineCheck(n, cfg.Checks.Engine))
+		}
+		if cfg.Checks.Genesis.Interval > 0 {
+			checks = append(checks, insync.NewGenesisCheck(n, cfg.Checks.Genesis))
+		}
+		if cfg.Checks.Metrics.Interval > 0 && len(cfg.Nodes[i].Metrics) > 0 {
+			checks = append(checks, insync.NewMetricsCheck(n, cfg.Checks.Metrics))
+		}
+		if cfg.Checks.Fees.Interval > 0 {
+			checks = append(checks, insync.NewFeeCheck(n, cfg.Checks.Fees))
+		}
+		if cfg.Checks.Disk.Interval > 0 && cfg.Nodes[i].DataDir != "" {
+			checks = append(checks, insync.NewDiskCheck(n, cfg.Checks.Disk))
+		}
+		for _, ec := range cfg.Checks.Exec {
+			if ec.Runs(n.Name()) {
+				checks = append(checks, insync.NewExecCheck(n, ec))
+			}
+		}
+		mon.AddNode(n, checks...)
+	}
+	if ref != nil {
+		mon.AddNode(ref, insync.NewHeadCheck(ref, cfg.Checks.Sync.CheckConfig))
+	}
+	if hist != nil {
+		recorders = append(recorders, hist)
+		goSupervised(&bg, nf, "history", func() { hist.Run(ctx) })
+		// the daily and weekly reports are posted at the time of day of every chat
+		for _, z := range timezones(routes) {
+			z := z
+			if cfg.History.ReportAt != "" {
+				goSupervised(&bg, nf, "sla report", func() { runSLAReport(ctx, cfg.History.ReportAt, z.loc, hist, nodes, z.routes) })
+			}
+			if cfg.History.SummaryAt != "" {
+				goSupervised(&bg, nf, "daily summary", func() { runDailySummary(ctx, cfg.History.SummaryAt, z.loc, hist, nodes, ref, z.routes) })
+			}
+			if cfg.History.DigestAt != "" {
+				goSupervised(&bg, nf, "fleet digest", func() { runFleetDigest(ctx, cfg.History.DigestAt, z.loc, hist, nodes, z.routes) })
+			}
+		}
+		if cfg.History.Monthly.At != "" {
+			goSupervised(&bg, nf, "monthly report", func() { runMonthlyReport(ctx, cfg.History.Monthly, cfg.location, hist, st, nodes, routes) })
+		}
+	}
+	if len(recorders) > 0 {
+		mon.SetRecorder(recorders)
+	}
+	if cfg.Checks.Clock.Interval > 0 {
+		mon.AddCheck(insync.NewClockCheck(nodes, cfg.Checks.Clock))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mon.Run(ctx)
+	}()
+	slog.Info("monitoring", "nodes", len(nodes))
+	if *dryRun {
+		slog.Info("dry run, the alerts are logged instead of sent")
+	}
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", time.Duration(cfg.ShutdownTimeout))
+	if h != nil {
+		h.stop()
+	}
+	// exit before the orchestrator kills insync, e.g. at the end of kubernetes' terminationGracePeriodSeconds
+	deadline := time.AfterFunc(time.Duration(cfg.ShutdownTimeout), func() {
+		fatal("shutdown timed out, exiting before all alerts were delivered", "timeout", time.Duration(cfg.ShutdownTimeout))
+	})
+	defer deadline.Stop()
+
+	// stop the checks first, so no alerts are sent while the notifiers are drained
+	<-done
+	if events != nil {
+		// the streams would keep the grpc server from shutting down
+		events.Close()
+	}
+	for _, srv := range servers {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error stopping http server", "addr", srv.Addr, "err", err)
+		}
+		cancel()
+	}
+	bg.Wait()
+	router.Close()
+	if tm != nil {
+		tm.close()
+	}
+	for name, r := range routes {
+		tr, ok := r.(*telegram.Route)
+		if !ok {
+			continue
+		}
+		if err := tr.Close(); err != nil {
+			slog.Error("error draining route", "route", name, "err", err)
+		}
+		if cfg.ShutdownMessage {
+			if err := tr.Notice(fmt.Sprintf("⏹ insync stopped monitoring %d node(s)", len(nodes))); err != nil {
+				slog.Error("error sending message", "err", err)
+			}
+		}
+	}
+	if err := updater.Stop(); err != nil {
+		slog.Error("error stopping telegram bot", "err", err)
 	}
-	b, err := createTelegramBot(tgBotToken)
+}
+
+// goSupervised runs f in a goroutine tracked by the wait group, restarting it if it panics.
+func goSupervised(wg *sync.WaitGroup, nf insync.Notifier, worker string, f func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		insync.Supervise(nf, "", worker, f)
+	}()
+}
+
+// newRouter creates the router of the configured rules.
+func newRouter(routes map[string]insync.Notifier, cfg *config) (*routing.Router, error) {
+	router, err := routing.New(routes, cfg.Rules, cfg.Pipeline.Retries)
 	if err != nil {
-		log.Fatalf("error creating telegram bot: %s", err)
+		return nil, err
+	}
+	for name, rc := range cfg.Routes {
+		if v, ok := insync.ParseVerbosity(rc.Verbosity); ok {
+			if err := router.SetVerbosity(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := router.SetDefault(cfg.DefaultRoutes); err != nil {
+		return nil, err
+	}
+	if cfg.Pipeline.FallbackRoute != "" {
+		if err := router.SetFallback(cfg.Pipeline.FallbackRoute, cfg.Pipeline.FailureThreshold); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// createRoutes creates the notifiers of the configured routes and returns them together with their background workers
+// and the telegram chats. The workers run until the context is done. The settings of the chats apply to their telegram
+// routes, prefs may be nil.
+func createRoutes(b *gotgbot.Bot, cfg *config, prefs *telegram.Preferences) (map[string]insync.Notifier, map[string]func(ctx context.Context), []int64) {
+	routes := make(map[string]insync.Notifier, len(cfg.Routes))
+	workers := make(map[string]func(ctx context.Context))
+	var chats []int64
+	for name, rc := range cfg.Routes {
+		if *dryRun {
+			routes[name] = dryRunRoute{name: name}
+			if rc.Telegram != nil {
+				// the bot still answers the commands in the chats
+				chats = append(chats, rc.Telegram.Chat)
+			}
+			continue
+		}
+		switch {
+		case rc.Telegram != nil:
+			t := rc.Telegram
+			var onCall *telegram.Schedule
+			if t.OnCall != "" {
+				onCall = telegram.MustNewSchedule(cfg.Schedules[t.OnCall])
+			}
+			loc := telegram.MustLoadLocation(t.Timezone)
+			if loc == nil {
+				loc = cfg.location
+			}
+			r := telegram.NewRoute(b, t.Chat, telegram.MustParseQuietHours(t.QuietHours), time.Duration(t.GroupWait), onCall, loc)
+			if prefs != nil {
+				r.SetPreferences(prefs)
+			}
+			workers[name+" digest"] = func(ctx context.Context) { r.RunDigest(ctx, time.Minute) }
+			routes[name] = r
+			chats = append(chats, t.Chat)
+		case rc.Alertmanager != nil:
+			am := alertmanager.New(*rc.Alertmanager)
+			workers[name+" reminder"] = am.Run
+			routes[name] = am
+		case rc.PagerDuty != nil:
+			routes[name] = pagerduty.New(*rc.PagerDuty)
+		case rc.Exec != nil:
+			routes[name] = plugin.NewExec(*rc.Exec)
+		case rc.Webhook != nil:
+			routes[name] = plugin.NewWebhook(*rc.Webhook)
+		}
 	}
-	checkSyncing(c, b, alertGroup, checkInterval, reportInterval)
+	return routes, workers, chats
 }
 
 func mustParseDuration(s string) time.Duration {
@@ -55,6 +493,14 @@ func mustParseDuration(s string) time.Duration {
 	return d
 }
 
+// mustParseOptionalDuration is like mustParseDuration but returns 0 for an empty string.
+func mustParseOptionalDuration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	return mustParseDuration(s)
+}
+
 func mustParseInt64(s string) int64 {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -63,13 +509,34 @@ func mustParseInt64(s string) int64 {
 	return int64(i)
 }
 
-func createGethClient(url string) (*ethclient.Client, error) {
-	return ethclient.Dial(url)
+// mustParseOptionalInt64 is like mustParseInt64 but returns def for an empty string.
+func mustParseOptionalInt64(s string, def int64) int64 {
+	if s == "" {
+		return def
+	}
+	return mustParseInt64(s)
+}
+
+// splitList splits a comma separated list, ignoring empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
 }
 
-func createTelegramBot(token string) (*gotgbot.Bot, error) {
-	b, err := gotgbot.NewBot(os.Getenv("BOT_TOKEN"), &gotgbot.BotOpts{
-		Client:      http.Client{},
+func createTelegramBot(token, proxy string) (*gotgbot.Bot, error) {
+	proxyFunc, err := insync.ProxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	b, err := gotgbot.NewBot(token, &gotgbot.BotOpts{
+		Client:      http.Client{Transport: transport},
 		GetTimeout:  gotgbot.DefaultGetTimeout,
 		PostTimeout: gotgbot.DefaultPostTimeout,
 	})
@@ -78,77 +545,3 @@ func createTelegramBot(token string) (*gotgbot.Bot, error) {
 	}
 	return b, nil
 }
-
-func (s *syncCounter) get() int64 {
-	s.Lock()
-	defer s.Unlock()
-	return s.counter
-}
-
-func (s *syncCounter) increase() {
-	s.Lock()
-	defer s.Unlock()
-	s.counter++
-}
-
-func (s *syncCounter) reset() {
-	s.Lock()
-	defer s.Unlock()
-	s.counter = 0
-}
-
-func checkSyncing(c *ethclient.Client, b *gotgbot.Bot, alertGroup int64, checkInterval, reportInterval time.Duration) {
-	checkTicker := time.NewTicker(checkInterval)
-	defer checkTicker.Stop()
-	reportTicker := time.NewTicker(reportInterval)
-	defer reportTicker.Stop()
-
-	counter := syncCounter{}
-	var sync *ethereum.SyncProgress
-
-	go func() {
-		for range checkTicker.C {
-			var err error
-			sync, err = c.SyncProgress(context.Background())
-			if err != nil {
-				log.Printf("error while checking sync status: %s", err)
-				continue
-			}
-			if sync == nil {
-				counter.increase()
-			}
-		}
-	}()
-
-	var prevOutOfSynced bool
-	for range reportTicker.C {
-		if counter.get() > 0 && prevOutOfSynced {
-			log.Println("node is back in sync")
-			_, err := b.SendMessage(alertGroup, inSyncMsg(), nil)
-			if err != nil {
-				log.Printf("error sending message: %s", err)
-			}
-			prevOutOfSynced = false
-		} else if counter.get() == 0 && !prevOutOfSynced {
-			log.Printf("node is out of sync: current block %d, highest block %d", sync.CurrentBlock, sync.HighestBlock)
-			_, err := b.SendMessage(alertGroup, outOfSyncMsg(sync, reportInterval), nil)
-			if err != nil {
-				log.Printf("error sending message: %s", err)
-			}
-			prevOutOfSynced = true
-		}
-		counter.reset()
-	}
-}
-
-func outOfSyncMsg(sync *ethereum.SyncProgress, r time.Duration) string {
-	var s strings.Builder
-	s.WriteString(fmt.Sprintf("🔴 your node is out of sync since %s\n", r))
-	s.WriteString(fmt.Sprintf("Current block: %d\n", sync.CurrentBlock))
-	s.WriteString(fmt.Sprintf("Highest block: %d\n", sync.HighestBlock))
-	return s.String()
-}
-
-func inSyncMsg() string {
-	return "🟢 your node is back in sync"
-}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/routing"
+)
+
+// nodeStates are the states of the state gauge, in order.
+var nodeStates = []insync.NodeState{insync.StateHealthy, insync.StateDegraded, insync.StateSyncing, insync.StateUnreachable}
+
+// alertKey identifies an alert counter.
+type alertKey struct {
+	node, check, name, severity string
+	resolved                    bool
+}
+
+// alertCounter counts the alerts passed on to the notifier.
+type alertCounter struct {
+	nf insync.Notifier
+
+	mu     sync.Mutex
+	counts map[alertKey]uint64
+}
+
+func newAlertCounter(nf insync.Notifier) *alertCounter {
+	return &alertCounter{nf: nf, counts: make(map[alertKey]uint64)}
+}
+
+func (c *alertCounter) Send(a insync.Alert) error {
+	c.mu.Lock()
+	c.counts[alertKey{node: a.Node, check: a.Key, name: a.Name, severity: a.Severity.String(), resolved: a.Resolved}]++
+	c.mu.Unlock()
+	return c.nf.Send(a)
+}
+
+// metricsHandler serves the metrics in the prometheus text format, /metrics.
+func metricsHandler(nodes []*insync.Node, router *routing.Router, alerts *alertCounter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m := metricsWriter{w: w}
+
+		statuses := make([]insync.NodeStatus, len(nodes))
+		labels := make(map[string][]string, len(nodes))
+		for i, n := range nodes {
+			statuses[i] = n.Status()
+			labels[n.Name()] = nodeLabels(n.Name(), statuses[i])
+		}
+
+		m.help("insync_node_state", "gauge", "The sync state of the node, 1 for the current state.")
+		for i, n := range nodes {
+			for _, s := range nodeStates {
+				v := 0.0
+				if statuses[i].State == s {
+					v = 1
+				}
+				m.sample("insync_node_state", v, labels[n.Name()], "check", "sync", "state", s.String())
+			}
+		}
+		m.help("insync_node_up", "gauge", "Whether the last call to the node succeeded.")
+		for _, n := range nodes {
+			v := 0.0
+			if n.LastError() == nil {
+				v = 1
+			}
+			m.sample("insync_node_up", v, labels[n.Name()])
+		}
+		m.help("insync_node_fallback", "gauge", "Whether the node is monitored through a fallback endpoint.")
+		for i, n := range nodes {
+			v := 0.0
+			if statuses[i].Fallback != "" {
+				v = 1
+			}
+			m.sample("insync_node_fallback", v, labels[n.Name()])
+		}
+		m.help("insync_node_current_block", "gauge", "The current block of the node.")
+		for i, n := range nodes {
+			m.sample("insync_node_current_block", float64(statuses[i].CurrentBlock), labels[n.Name()], "check", "sync")
+		}
+		m.help("insync_node_highest_block", "gauge", "The highest block known to the node.")
+		for i, n := range nodes {
+			m.sample("insync_node_highest_block", float64(statuses[i].HighestBlock), labels[n.Name()], "check", "sync")
+		}
+		m.help("insync_node_lag_blocks", "gauge", "The number of blocks the node is behind.")
+		for i, n := range nodes {
+			var lag uint64
+			if st := statuses[i]; st.HighestBlock > st.CurrentBlock {
+				lag = st.HighestBlock - st.CurrentBlock
+			}
+			m.sample("insync_node_lag_blocks", float64(lag), labels[n.Name()], "check", "sync")
+		}
+		m.help("insync_node_peers", "gauge", "The peer count of the node.")
+		for i, n := range nodes {
+			if p := statuses[i].Peers; p >= 0 {
+				m.sample("insync_node_peers", float64(p), labels[n.Name()], "check", "peers")
+			}
+		}
+		m.help("insync_node_latency_seconds", "gauge", "The response time of the last successful sync check.")
+		for i, n := range nodes {
+			if l := statuses[i].Latency; l > 0 {
+				m.sample("insync_node_latency_seconds", l.Seconds(), labels[n.Name()], "check", "sync")
+			}
+		}
+		m.help("insync_check_errors_total", "counter", "The failed runs of the checks.")
+		for i, n := range nodes {
+			errs := statuses[i].CheckErrors
+			checks := make([]string, 0, len(errs))
+			for check := range errs {
+				checks = append(checks, check)
+			}
+			sort.Strings(checks)
+			for _, check := range checks {
+				m.sample("insync_check_errors_total", float64(errs[check]), labels[n.Name()], "check", check)
+			}
+		}
+
+		m.help("insync_alerts_total", "counter", "The alerts sent, before muting and routing.")
+		alerts.mu.Lock()
+		keys := make([]alertKey, 0, len(alerts.counts))
+		for k := range alerts.counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			l, ok := labels[k.node]
+			if !ok {
+				// alerts about insync itself or about nodes of alertmanager webhooks
+				l = nodeLabels(k.node, insync.NodeStatus{})
+			}
+			m.sample("insync_alerts_total", float64(alerts.counts[k]), l, "check", k.check, "alert", k.name, "severity", k.severity, "resolved", fmt.Sprint(k.resolved))
+		}
+		alerts.mu.Unlock()
+
+		stats := router.Stats()
+		m.help("insync_notifications_sent_total", "counter", "The alerts delivered per route.")
+		for _, st := range stats {
+			m.sample("insync_notifications_sent_total", float64(st.Sent), nil, "route", st.Route)
+		}
+		m.help("insync_notifications_failed_total", "counter", "The failed deliveries per route.")
+		for _, st := range stats {
+			m.sample("insync_notifications_failed_total", float64(st.Failed), nil, "route", st.Route)
+		}
+		m.help("insync_notification_retries_total", "counter", "The retried deliveries per route.")
+		for _, st := range stats {
+			m.sample("insync_notification_retries_total", float64(st.Retries), nil, "route", st.Route)
+		}
+		m.help("insync_route_queue_depth", "gauge", "The alerts waiting to be grouped or held during quiet hours.")
+		for _, st := range stats {
+			m.sample("insync_route_queue_depth", float64(st.QueueDepth), nil, "route", st.Route)
+		}
+		m.help("insync_route_latency_seconds", "gauge", "The moving average of the delivery latency.")
+		for _, st := range stats {
+			m.sample("insync_route_latency_seconds", st.Latency.Seconds(), nil, "route", st.Route)
+		}
+	}
+}
+
+// metricsWriter writes the prometheus text format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) help(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample, the labels are pairs of names and values, e.g. the labels of a node followed by more labels.
+func (m metricsWriter) sample(name string, v float64, labels []string, more ...string) {
+	labels = append(labels[:len(labels):len(labels)], more...)
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	fmt.Fprintf(m.w, "%s{%s} %g\n", name, strings.Join(pairs, ","), v)
+}
+
+// nodeLabels returns the labels of the series of a node, so fleets can be aggregated by chain and client.
+func nodeLabels(node string, st insync.NodeStatus) []string {
+	return []string{"node", node, "chain", st.Chain, "client", st.Client}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// notificationsHandler returns the recorded notifications as json, /notifications.
+// The query parameters from and to take the same values as the export command, e.g. from=7d,
+// route, node and alert filter the notifications and failed=true only returns the failed ones.
+func notificationsHandler(hist *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		end := time.Now()
+		if s := q.Get("to"); s != "" {
+			t, err := parseExportTime(s, end)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			end = t
+		}
+		start := end.Add(-24 * time.Hour)
+		if s := q.Get("from"); s != "" {
+			t, err := parseExportTime(s, end)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			start = t
+		}
+		records, err := hist.Notifications(start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		matched := make([]insync.NotificationRecord, 0, len(records))
+		for _, n := range records {
+			if notificationMatches(n, q.Get("route"), q.Get("node"), q.Get("alert"), q.Get("failed") == "true") {
+				matched = append(matched, n)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Notifications []insync.NotificationRecord `json:"notifications"`
+		}{matched})
+	}
+}
+
+// notificationMatches reports whether the notification matches the filters, empty filters match every notification.
+func notificationMatches(n insync.NotificationRecord, route, node, alert string, failed bool) bool {
+	if route != "" && n.Route != route {
+		return false
+	}
+	if node != "" && !listContains(n.Node, node) {
+		return false
+	}
+	if alert != "" && !listContains(n.Alert, alert) {
+		return false
+	}
+	return !failed || n.Error != ""
+}
+
+// listContains reports whether the comma separated list contains s.
+func listContains(list, s string) bool {
+	for _, e := range strings.Split(list, ",") {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
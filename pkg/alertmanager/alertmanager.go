@@ -0,0 +1,169 @@
+// Package alertmanager forwards insync alerts to a prometheus alertmanager and relays alertmanager webhooks.
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Client forwards alerts to a prometheus alertmanager using the v2 api.
+//
+// Alertmanager expects firing alerts to be sent repeatedly, otherwise it resolves them on its own.
+// That's why the active alerts are kept and resent every resendInterval.
+type Client struct {
+	sync.Mutex
+	url            string
+	labels         map[string]string
+	resendInterval time.Duration
+	client         *http.Client
+	// active alerts, keyed by node and alert key
+	active map[string]amAlert
+}
+
+// amAlert is the alert format of the alertmanager v2 api.
+type amAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// New creates a client for the alertmanager at the configured url.
+func New(cfg Config) *Client {
+	return &Client{
+		url:            strings.TrimSuffix(cfg.URL, "/") + "/api/v2/alerts",
+		labels:         cfg.Labels,
+		resendInterval: time.Duration(cfg.ResendInterval),
+		client:         &http.Client{Timeout: 10 * time.Second},
+		active:         make(map[string]amAlert),
+	}
+}
+
+// Target returns the host of the alertmanager.
+func (am *Client) Target() string {
+	return insync.NodeName(am.url)
+}
+
+// Send forwards the alert. An alert replaces the previous alert with the same key of the node,
+// which is resolved. Recovery alerts only resolve the previous alert.
+func (am *Client) Send(a insync.Alert) error {
+	if a.Key == "" {
+		return nil
+	}
+	now := time.Now()
+	id := a.Node + "/" + a.Key
+
+	am.Lock()
+	var alerts []amAlert
+	prev, ok := am.active[id]
+	switch {
+	case ok && !a.Resolved && prev.Labels["alertname"] == a.Name:
+		// a follow up like a reminder, only refresh the description so the labels stay stable
+		prev.Annotations = am.convert(a, now).Annotations
+		am.active[id] = prev
+		alerts = append(alerts, prev)
+	default:
+		if ok {
+			prev.EndsAt = now
+			alerts = append(alerts, prev)
+			delete(am.active, id)
+		}
+		if !a.Resolved {
+			next := am.convert(a, now)
+			am.active[id] = next
+			alerts = append(alerts, next)
+		}
+	}
+	am.Unlock()
+
+	if len(alerts) == 0 {
+		return nil
+	}
+	return am.post(alerts)
+}
+
+func (am *Client) convert(a insync.Alert, now time.Time) amAlert {
+	labels := map[string]string{
+		"alertname": a.Name,
+		"node":      a.Node,
+		"severity":  a.Severity.String(),
+		"job":       "insync",
+	}
+	for k, v := range am.labels {
+		labels[k] = v
+	}
+	return amAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s %s", a.Node, a.Summary),
+			"description": a.Text,
+		},
+		StartsAt: now,
+	}
+}
+
+// Run resends the active alerts periodically.
+func (am *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(am.resendInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		am.Lock()
+		alerts := make([]amAlert, 0, len(am.active))
+		for _, a := range am.active {
+			alerts = append(alerts, a)
+		}
+		am.Unlock()
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := am.post(alerts); err != nil {
+			slog.Error("error resending alerts to alertmanager", "err", err)
+		}
+	}
+}
+
+func (am *Client) post(alerts []amAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), am.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, am.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := am.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alertmanager returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Config configures the forwarding of alerts to a prometheus alertmanager, it's disabled if the url is empty.
+type Config struct {
+	URL string `yaml:"url"`
+	// Labels are added to every alert.
+	Labels         map[string]string `yaml:"labels"`
+	ResendInterval insync.Duration   `yaml:"resend_interval"`
+}
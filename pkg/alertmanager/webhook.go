@@ -0,0 +1,105 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// webhookPayload is the payload alertmanager sends to webhook receivers.
+type webhookPayload struct {
+	Version     string         `json:"version"`
+	Status      string         `json:"status"`
+	Receiver    string         `json:"receiver"`
+	ExternalURL string         `json:"externalURL"`
+	Alerts      []webhookAlert `json:"alerts"`
+}
+
+type webhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// WebhookHandler accepts alertmanager webhook payloads and relays the alerts to the notifier.
+func WebhookHandler(nf insync.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var p webhookPayload
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&p); err != nil {
+			http.Error(w, fmt.Sprintf("invalid payload: %s", err), http.StatusBadRequest)
+			return
+		}
+		for _, wa := range p.Alerts {
+			// no key, so the alert isn't forwarded back to alertmanager
+			if err := nf.Send(relayedAlert(wa)); err != nil {
+				slog.Error("error relaying alert", "err", err)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// relayedAlert converts an alert received from alertmanager.
+func relayedAlert(wa webhookAlert) insync.Alert {
+	name := wa.Labels["alertname"]
+	node := wa.Labels["node"]
+	if node == "" {
+		node = wa.Labels["instance"]
+	}
+	if node == "" {
+		node = name
+	}
+	sev, ok := insync.ParseSeverity(wa.Labels["severity"])
+	if !ok {
+		sev = insync.SeverityWarning
+	}
+	summary := wa.Annotations["summary"]
+	if summary == "" {
+		summary = name
+	}
+
+	a := insync.Alert{
+		Node:     node,
+		Severity: sev,
+		Summary:  name,
+		Name:     name,
+		Icon:     "🔴",
+		Resolved: wa.Status == "resolved",
+	}
+	status := "FIRING"
+	if a.Resolved {
+		a.Icon, a.Severity, status = "🟢", insync.SeverityInfo, "RESOLVED"
+	}
+
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("%s [%s] %s\n", a.Icon, status, name))
+	s.WriteString(summary + "\n")
+	if d := wa.Annotations["description"]; d != "" {
+		s.WriteString(d + "\n")
+	}
+	keys := make([]string, 0, len(wa.Labels))
+	for k := range wa.Labels {
+		if k != "alertname" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.WriteString(fmt.Sprintf("%s: %s\n", k, wa.Labels[k]))
+	}
+	a.Text = s.String()
+	return a
+}
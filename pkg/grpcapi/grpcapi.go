@@ -0,0 +1,221 @@
+// Package grpcapi serves the grpc api of insync, which streams the state transitions and check results
+// of the nodes, see insync.proto. The grpc protocol is implemented on top of the http/2 support of net/http.
+package grpcapi
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// watchMethod is the path of the Watch rpc.
+const watchMethod = "/insync.v1.Insync/Watch"
+
+// maxRequestSize limits the size of the request messages.
+const maxRequestSize = 1 << 16
+
+// bufferSize is the number of events buffered per stream before the client counts as too slow.
+const bufferSize = 256
+
+// The grpc status codes used by the server.
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+// Server streams the events passed to it as insync.Recorder to the clients of the Watch rpc.
+type Server struct {
+	token string
+
+	mu      sync.Mutex
+	streams map[*stream]bool
+	closed  bool
+}
+
+// stream is a running Watch call.
+type stream struct {
+	req    watchRequest
+	events chan []byte
+	// overflow is closed if the client couldn't keep up.
+	overflow chan struct{}
+	once     sync.Once
+}
+
+// New creates the server, the clients have to send the token as bearer token unless it's empty.
+func New(token string) *Server {
+	return &Server{token: token, streams: make(map[*stream]bool)}
+}
+
+func (s *Server) RecordResult(r insync.CheckResult) {
+	s.publish(r.Node, false, func() []byte { return encodeResult(r) })
+}
+
+func (s *Server) RecordTransition(t insync.TransitionRecord) {
+	s.publish(t.Node, true, func() []byte { return encodeTransition(t) })
+}
+
+// publish passes the event to the matching streams, it's encoded once if any stream wants it.
+func (s *Server) publish(node string, transition bool, encode func() []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var event []byte
+	for st := range s.streams {
+		if !st.req.matches(node, transition) {
+			continue
+		}
+		if event == nil {
+			event = encode()
+		}
+		select {
+		case st.events <- event:
+		default:
+			st.once.Do(func() { close(st.overflow) })
+		}
+	}
+}
+
+// Close ends the running streams with UNAVAILABLE and rejects new ones, e.g. on shutdown.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for st := range s.streams {
+		close(st.events)
+		delete(s.streams, st)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "insync only serves grpc here", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	if s.token != "" {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(s.token)) != 1 {
+			writeStatus(w, codeUnauthenticated, "invalid token")
+			return
+		}
+	}
+	if r.URL.Path != watchMethod {
+		writeStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		writeStatus(w, codeUnimplemented, "compression isn't supported")
+		return
+	}
+	msg, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+	req, err := decodeWatchRequest(msg)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+	st := &stream{req: req, events: make(chan []byte, bufferSize), overflow: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		writeStatus(w, codeUnavailable, "insync is shutting down")
+		return
+	}
+	s.streams[st] = true
+	s.mu.Unlock()
+	defer s.remove(st)
+
+	slog.Debug("grpc watch started", "remote", r.RemoteAddr, "nodes", req.nodes)
+	// the trailers are sent once the stream ends
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	code, text := codeOK, ""
+loop:
+	for {
+		select {
+		case <-r.Context().Done():
+			break loop
+		case <-st.overflow:
+			code, text = codeResourceExhausted, "the client is too slow, events were dropped"
+			break loop
+		case event, ok := <-st.events:
+			if !ok {
+				code, text = codeUnavailable, "insync is shutting down"
+				break loop
+			}
+			if err := writeMessage(w, event); err != nil {
+				code, text = codeUnavailable, err.Error()
+				break loop
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	slog.Debug("grpc watch ended", "remote", r.RemoteAddr, "code", code, "msg", text)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", text)
+}
+
+func (s *Server) remove(st *stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, st)
+}
+
+// writeStatus ends the call before the response was sent, the status is sent as header (trailers-only response).
+func writeStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+// readMessage reads a length-prefixed message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("error reading the request: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestSize {
+		return nil, fmt.Errorf("the request is larger than %d bytes", maxRequestSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("error reading the request: %w", err)
+	}
+	return msg, nil
+}
+
+// writeMessage writes a length-prefixed, uncompressed message.
+func writeMessage(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
@@ -0,0 +1,26 @@
+//go:build go1.24
+// +build go1.24
+
+package grpcapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// Cleartext reports whether the server accepts grpc without tls, net/http supports http/2 over cleartext since go 1.24.
+const Cleartext = true
+
+// HTTPServer returns the http server of the api, it accepts http/2 with and without tls.
+func (s *Server) HTTPServer(addr string) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		Protocols:         new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv
+}
@@ -0,0 +1,21 @@
+//go:build !go1.24
+// +build !go1.24
+
+package grpcapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// Cleartext reports whether the server accepts grpc without tls, net/http supports http/2 over cleartext since go 1.24.
+const Cleartext = false
+
+// HTTPServer returns the http server of the api, grpc requires tls.
+func (s *Server) HTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,128 @@
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// The messages of insync.proto are encoded by hand, they're small enough not to need the protobuf runtime.
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+// watchRequest is the decoded WatchRequest.
+type watchRequest struct {
+	nodes           []string
+	transitionsOnly bool
+}
+
+// matches reports whether the event of the node is requested.
+func (r watchRequest) matches(node string, transition bool) bool {
+	if r.transitionsOnly && !transition {
+		return false
+	}
+	if len(r.nodes) == 0 {
+		return true
+	}
+	for _, n := range r.nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+var errInvalidMessage = errors.New("invalid message")
+
+func decodeWatchRequest(b []byte) (watchRequest, error) {
+	var req watchRequest
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return req, errInvalidMessage
+		}
+		b = b[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return req, errInvalidMessage
+			}
+			b = b[n:]
+			if field == 2 {
+				req.transitionsOnly = v != 0
+			}
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return req, errInvalidMessage
+			}
+			if field == 1 {
+				req.nodes = append(req.nodes, string(b[n:n+int(l)]))
+			}
+			b = b[n+int(l):]
+		case wire64:
+			if len(b) < 8 {
+				return req, errInvalidMessage
+			}
+			b = b[8:]
+		case wire32:
+			if len(b) < 4 {
+				return req, errInvalidMessage
+			}
+			b = b[4:]
+		default:
+			return req, errInvalidMessage
+		}
+	}
+	return req, nil
+}
+
+// message builds an encoded message.
+type message []byte
+
+func (m message) key(field, wire uint64) message {
+	return binary.AppendUvarint(m, field<<3|wire)
+}
+
+func (m message) bytes(field uint64, b []byte) message {
+	m = m.key(field, wireBytes)
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+// string omits empty strings like proto3 does.
+func (m message) string(field uint64, s string) message {
+	if s == "" {
+		return m
+	}
+	return m.bytes(field, []byte(s))
+}
+
+// time encodes the time as int64 unix nanos, zero times are omitted.
+func (m message) time(field uint64, t time.Time) message {
+	if t.IsZero() {
+		return m
+	}
+	return binary.AppendUvarint(m.key(field, wireVarint), uint64(t.UnixNano()))
+}
+
+func encodeTransition(t insync.TransitionRecord) []byte {
+	var m message
+	m = m.time(1, t.Time).string(2, t.Node).string(3, t.From).string(4, t.To).time(5, t.Since)
+	return message(nil).bytes(1, m)
+}
+
+func encodeResult(r insync.CheckResult) []byte {
+	var m message
+	m = m.time(1, r.Time).string(2, r.Node).string(3, r.Check).string(4, r.Status).string(5, r.Detail)
+	return message(nil).bytes(2, m)
+}
@@ -0,0 +1,48 @@
+package history
+
+import "time"
+
+// Fees are the recorded base and priority fees of a chain during a window, in gwei.
+type Fees struct {
+	BaseFee, PriorityFee FeeRange
+}
+
+// FeeRange is the minimum, average and maximum of a fee, Samples is the number of records.
+type FeeRange struct {
+	Min, Avg, Max float64
+	Samples       int
+}
+
+func (r *FeeRange) add(fee float64) {
+	if r.Samples == 0 || fee < r.Min {
+		r.Min = fee
+	}
+	if fee > r.Max {
+		r.Max = fee
+	}
+	// the running average
+	r.Samples++
+	r.Avg += (fee - r.Avg) / float64(r.Samples)
+}
+
+// Fees computes the fees recorded by the fee checks of the nodes between from and to. The nodes should be of the same
+// chain, their records are combined.
+func (s *Store) Fees(nodes []string, from, to time.Time) (Fees, error) {
+	var fees Fees
+	for _, node := range nodes {
+		results, err := s.Results(node, from, to)
+		if err != nil {
+			return fees, err
+		}
+		for _, r := range results {
+			if r.Check != "fees" || r.Status == "error" {
+				continue
+			}
+			fees.BaseFee.add(r.Value)
+			if r.PriorityFee > 0 {
+				fees.PriorityFee.add(r.PriorityFee)
+			}
+		}
+	}
+	return fees, nil
+}
@@ -0,0 +1,62 @@
+package history
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// minGrowthSpan is the minimum time between the first and last disk check for a growth rate, shorter windows are too noisy.
+	minGrowthSpan = 24 * time.Hour
+	// maxFullIn is the longest projection until the disk is full, beyond that it's not worth reporting.
+	maxFullIn = 10 * 365 * 24 * time.Hour
+)
+
+// Growth is the growth of the disk usage of a node during a window, fitted to the disk checks.
+type Growth struct {
+	// Usage is the last disk usage in percent.
+	Usage float64
+	// PerWeek is the growth in percentage points per week, negative if the disk usage shrinks, e.g. after pruning.
+	PerWeek float64
+	// Full is the projected time until the disk is full, 0 if the disk usage doesn't grow or it would take years.
+	Full time.Duration
+	// OK reports whether there were enough disk checks for a growth rate.
+	OK bool
+}
+
+// DiskGrowth computes the growth rate of the disk usage of the node between from and to. It's the least squares fit of
+// the disk checks, so the growth of the database isn't thrown off by a single compaction.
+func (s *Store) DiskGrowth(node string, from, to time.Time) (Growth, error) {
+	results, err := s.Results(node, from, to)
+	if err != nil {
+		return Growth{}, err
+	}
+	var g Growth
+	var first, last time.Time
+	var n, sx, sy, sxx, sxy float64
+	for _, r := range results {
+		if r.Check != "disk" || r.Status == "error" {
+			continue
+		}
+		if first.IsZero() {
+			first = r.Time
+		}
+		last, g.Usage = r.Time, r.Value
+		// the time in days since the first check, keeps the sums small
+		x := r.Time.Sub(first).Hours() / 24
+		n++
+		sx += x
+		sy += r.Value
+		sxx += x * x
+		sxy += x * r.Value
+	}
+	if last.Sub(first) < minGrowthSpan || n*sxx == sx*sx {
+		return g, nil
+	}
+	perDay := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	g.PerWeek, g.OK = perDay*7, true
+	if full := (100 - g.Usage) / perDay * float64(24*time.Hour); perDay > 0 && full < float64(maxFullIn) {
+		g.Full = time.Duration(math.Max(full, 0))
+	}
+	return g, nil
+}
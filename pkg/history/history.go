@@ -0,0 +1,232 @@
+// Package history records every check result and state change of the nodes in an embedded leveldb database,
+// the basis for uptime reports and charts.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// key prefixes of the records, followed by the node (see nodePrefix), the time and for results the check.
+// The notifications are keyed by the time and the route.
+const (
+	resultPrefix       = "r/"
+	transitionPrefix   = "t/"
+	notificationPrefix = "n/"
+)
+
+// Store is the history database, it implements insync.Recorder and insync.NotificationRecorder.
+type Store struct {
+	db *leveldb.DB
+	// cipher encrypts the records, nil if they are unencrypted.
+	cipher *insync.Cipher
+	// retention is how long the records are kept, 0 keeps them forever.
+	retention time.Duration
+}
+
+// Open opens or creates the database in the directory.
+func Open(path string, retention time.Duration) (*Store, error) {
+	return OpenEncrypted(path, retention, nil)
+}
+
+// OpenEncrypted is like Open but encrypts the records with the cipher.
+// The keys contain the node and route names and stay readable, unencrypted records of older versions are read as well.
+func OpenEncrypted(path string, retention time.Duration, c *insync.Cipher) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, retention: retention, cipher: c}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RecordResult stores the result of a check.
+func (s *Store) RecordResult(r insync.CheckResult) {
+	s.put(nodePrefix(resultPrefix, r.Node)+timeKey(r.Time)+"/"+r.Check, r)
+}
+
+// RecordTransition stores the state change of a node.
+func (s *Store) RecordTransition(t insync.TransitionRecord) {
+	s.put(nodePrefix(transitionPrefix, t.Node)+timeKey(t.Time), t)
+}
+
+// RecordNotification stores a delivered or failed notification.
+func (s *Store) RecordNotification(n insync.NotificationRecord) {
+	s.put(notificationPrefix+timeKey(n.Time)+"/"+n.Route, n)
+}
+
+func (s *Store) put(key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("error encoding history record", "err", err)
+		return
+	}
+	data = []byte(redact.String(string(data)))
+	if err := s.db.Put([]byte(key), s.cipher.Seal(data), nil); err != nil {
+		slog.Error("error writing history", "err", err)
+	}
+}
+
+// Results returns the check results of the node between from and to, oldest first.
+func (s *Store) Results(node string, from, to time.Time) ([]insync.CheckResult, error) {
+	var results []insync.CheckResult
+	err := s.scan(nodePrefix(resultPrefix, node), from, to, func(data []byte) error {
+		var r insync.CheckResult
+		if err := s.decode(data, &r); err != nil {
+			return err
+		}
+		results = append(results, r)
+		return nil
+	})
+	return results, err
+}
+
+// Transitions returns the state changes of the node between from and to, oldest first.
+func (s *Store) Transitions(node string, from, to time.Time) ([]insync.TransitionRecord, error) {
+	var records []insync.TransitionRecord
+	err := s.scan(nodePrefix(transitionPrefix, node), from, to, func(data []byte) error {
+		var t insync.TransitionRecord
+		if err := s.decode(data, &t); err != nil {
+			return err
+		}
+		records = append(records, t)
+		return nil
+	})
+	return records, err
+}
+
+// Notifications returns the notifications between from and to, oldest first.
+func (s *Store) Notifications(from, to time.Time) ([]insync.NotificationRecord, error) {
+	var records []insync.NotificationRecord
+	err := s.scan(notificationPrefix, from, to, func(data []byte) error {
+		var n insync.NotificationRecord
+		if err := s.decode(data, &n); err != nil {
+			return err
+		}
+		records = append(records, n)
+		return nil
+	})
+	return records, err
+}
+
+// decode decrypts and decodes a record.
+func (s *Store) decode(data []byte, v interface{}) error {
+	data, err := s.cipher.Open(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// scan calls f with the records of the prefix between from and to.
+func (s *Store) scan(prefix string, from, to time.Time, f func([]byte) error) error {
+	it := s.db.NewIterator(&util.Range{
+		Start: []byte(prefix + timeKey(from)),
+		Limit: []byte(prefix + timeKey(to)),
+	}, nil)
+	defer it.Release()
+	for it.Next() {
+		if err := f(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// Run deletes the records older than the retention once an hour, until the context is done.
+func (s *Store) Run(ctx context.Context) {
+	if s.retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := s.prune(time.Now().Add(-s.retention)); err != nil {
+			slog.Error("error pruning history", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes all records older than before, except for the settings of the chats. The keys of the notifications
+// and those of the records of every node sort by time, so only the ranges of the old records are read.
+func (s *Store) prune(before time.Time) error {
+	batch := new(leveldb.Batch)
+	prefixes := []string{notificationPrefix}
+	for _, prefix := range []string{resultPrefix, transitionPrefix} {
+		nodes, err := s.nodePrefixes(prefix)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, nodes...)
+	}
+	for _, prefix := range prefixes {
+		if err := s.deleteRange(batch, prefix, prefix+timeKey(before)); err != nil {
+			return err
+		}
+	}
+	return s.db.Write(batch, nil)
+}
+
+// nodePrefixes returns the key prefixes of the nodes with records of the prefix, see nodePrefix.
+// It seeks from node to node instead of reading all their records.
+func (s *Store) nodePrefixes(prefix string) ([]string, error) {
+	it := s.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer it.Release()
+	var nodes []string
+	for ok := it.First(); ok; {
+		key := string(it.Key())
+		i := strings.Index(key[len(prefix):], "/")
+		if i < 0 {
+			ok = it.Next()
+			continue
+		}
+		node := key[:len(prefix)+i+1]
+		nodes = append(nodes, node)
+		// 0 follows the slash, the keys of the node are all below it
+		ok = it.Seek([]byte(strings.TrimSuffix(node, "/") + "0"))
+	}
+	return nodes, it.Error()
+}
+
+// deleteRange adds the deletion of the keys from start up to limit to the batch.
+func (s *Store) deleteRange(batch *leveldb.Batch, start, limit string) error {
+	it := s.db.NewIterator(&util.Range{Start: []byte(start), Limit: []byte(limit)}, nil)
+	defer it.Release()
+	for it.Next() {
+		batch.Delete(append([]byte(nil), it.Key()...))
+	}
+	return it.Error()
+}
+
+// nodeEscaper escapes the slashes in the node names, e.g. of node a/b, so the records of a node don't fall into the
+// range of the records of node a. Names without % and / keep the keys of older versions.
+var nodeEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// nodePrefix returns the key prefix of the records of the node.
+func nodePrefix(prefix, node string) string {
+	return prefix + nodeEscaper.Replace(node) + "/"
+}
+
+// timeKey encodes the time so the keys sort chronologically.
+func timeKey(t time.Time) string {
+	return fmt.Sprintf("%016x", t.UnixNano())
+}
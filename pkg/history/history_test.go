@@ -0,0 +1,134 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestNodePrefix(t *testing.T) {
+	tests := []struct {
+		node string
+		want string
+	}{
+		{node: "node-1", want: "r/node-1/"},
+		{node: "a/b", want: "r/a%2Fb/"},
+		{node: "a%2Fb", want: "r/a%252Fb/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			if got := nodePrefix(resultPrefix, tt.node); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResults(t *testing.T) {
+	s := openTest(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Hour)
+		for _, node := range []string{"a", "a/b", "a-b"} {
+			s.RecordResult(insync.CheckResult{Time: at, Node: node, Check: "sync"})
+			s.RecordTransition(insync.TransitionRecord{Time: at, Node: node})
+		}
+	}
+	tests := []struct {
+		name     string
+		node     string
+		from, to time.Time
+		want     int
+	}{
+		{name: "all", node: "a", from: start, to: start.Add(3 * time.Hour), want: 3},
+		{name: "from is included", node: "a", from: start.Add(time.Hour), to: start.Add(3 * time.Hour), want: 2},
+		{name: "to is excluded", node: "a", from: start, to: start.Add(2 * time.Hour), want: 2},
+		{name: "node with a slash", node: "a/b", from: start, to: start.Add(3 * time.Hour), want: 3},
+		{name: "unknown node", node: "b", from: start, to: start.Add(3 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.Results(tt.node, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != tt.want {
+				t.Fatalf("got %d results, want %d", len(results), tt.want)
+			}
+			for _, r := range results {
+				if r.Node != tt.node {
+					t.Fatalf("got result of %s, want %s", r.Node, tt.node)
+				}
+			}
+			transitions, err := s.Transitions(tt.node, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transitions) != tt.want {
+				t.Fatalf("got %d transitions, want %d", len(transitions), tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := openTest(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i) * time.Hour)
+		for _, node := range []string{"a", "a/b", "a-b"} {
+			s.RecordResult(insync.CheckResult{Time: at, Node: node, Check: "sync"})
+			s.RecordResult(insync.CheckResult{Time: at, Node: node, Check: "peers"})
+			s.RecordTransition(insync.TransitionRecord{Time: at, Node: node})
+		}
+		s.RecordNotification(insync.NotificationRecord{Time: at, Route: "ops"})
+	}
+	if err := s.SaveSettings(ChatSettings{Chat: 1, Language: "de", Updated: start}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.prune(start.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	end := start.Add(4 * time.Hour)
+	for _, node := range []string{"a", "a/b", "a-b"} {
+		results, err := s.Results(node, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 4 || !results[0].Time.Equal(start.Add(2*time.Hour)) {
+			t.Fatalf("got %d results of %s, want the 4 of the last 2 hours", len(results), node)
+		}
+		transitions, err := s.Transitions(node, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transitions) != 2 || !transitions[0].Time.Equal(start.Add(2*time.Hour)) {
+			t.Fatalf("got %d transitions of %s, want the 2 of the last 2 hours", len(transitions), node)
+		}
+	}
+	notifications, err := s.Notifications(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(notifications))
+	}
+	settings, err := s.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 1 || settings[0].Language != "de" {
+		t.Fatalf("got settings %+v, want those of chat 1", settings)
+	}
+}
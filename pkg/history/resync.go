@@ -0,0 +1,87 @@
+package history
+
+import (
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Resync is a period a node was out of sync, from the first observation until it was healthy again.
+type Resync struct {
+	Node  string
+	Start time.Time
+	End   time.Time
+	// Restart is set if the node was unreachable right before, e.g. because it was restarted.
+	Restart bool
+	// PeakLag is the highest lag in blocks and Rate the average block import rate in blocks/s, 0 without samples.
+	PeakLag uint64
+	Rate    float64
+}
+
+// Duration returns how long the resync took.
+func (r Resync) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Resyncs returns the resyncs of the node which ended between from and to, oldest first.
+func (s *Store) Resyncs(node string, from, to time.Time) ([]Resync, error) {
+	initial, err := s.stateAt(node, from)
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := s.Transitions(node, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var resyncs []Resync
+	var current *Resync
+	if initial == insync.StateSyncing {
+		start, err := s.outageStart(node, from)
+		if err != nil {
+			return nil, err
+		}
+		current = &Resync{Node: node, Start: start}
+	}
+	for _, t := range transitions {
+		state, _ := insync.ParseNodeState(t.To)
+		switch {
+		case state == insync.StateSyncing && current == nil:
+			prev, _ := insync.ParseNodeState(t.From)
+			current = &Resync{Node: node, Start: t.Since, Restart: prev == insync.StateUnreachable}
+		case state == insync.StateHealthy && current != nil:
+			current.End = t.Time
+			if err := s.resyncSpeed(current); err != nil {
+				return nil, err
+			}
+			resyncs = append(resyncs, *current)
+			current = nil
+		}
+	}
+	return resyncs, nil
+}
+
+// resyncSpeed fills in the peak lag and the average import rate of the resync from the recorded sync checks.
+func (s *Store) resyncSpeed(r *Resync) error {
+	results, err := s.Results(r.Node, r.Start, r.End)
+	if err != nil {
+		return err
+	}
+	var sum float64
+	var samples int
+	for _, res := range results {
+		if res.Check != "sync" {
+			continue
+		}
+		if l := uint64(res.Value); l > r.PeakLag {
+			r.PeakLag = l
+		}
+		if res.Rate > 0 {
+			sum += res.Rate
+			samples++
+		}
+	}
+	if samples > 0 {
+		r.Rate = sum / float64(samples)
+	}
+	return nil
+}
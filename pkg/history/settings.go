@@ -0,0 +1,58 @@
+package history
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// settingsPrefix is the key prefix of the settings of the chats, followed by the chat id.
+// The settings are kept regardless of the retention.
+const settingsPrefix = "s/"
+
+// ChatSettings are the preferences of a telegram chat, changed with /settings.
+// The empty fields keep the configuration of the route of the chat.
+type ChatSettings struct {
+	Chat int64 `json:"chat"`
+	// Language is the language of the messages of the bot, e.g. de.
+	Language string `json:"language,omitempty"`
+	// Verbosity is the level of detail of the alerts, e.g. critical.
+	Verbosity string `json:"verbosity,omitempty"`
+	// QuietHours replace those of the route, e.g. 23:00-07:00, off disables them.
+	QuietHours string `json:"quiet_hours,omitempty"`
+	// Nodes are the nodes the chat is subscribed to, all if empty.
+	Nodes []string `json:"nodes,omitempty"`
+	// User is the user who changed the settings last, at Updated.
+	User    string    `json:"user,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// SaveSettings stores the settings of the chat, replacing the previous ones.
+func (s *Store) SaveSettings(cs ChatSettings) error {
+	data, err := json.Marshal(cs)
+	if err != nil {
+		return err
+	}
+	return s.db.Put([]byte(settingsKey(cs.Chat)), s.cipher.Seal(data), nil)
+}
+
+// Settings returns the settings of all chats which changed them.
+func (s *Store) Settings() ([]ChatSettings, error) {
+	it := s.db.NewIterator(util.BytesPrefix([]byte(settingsPrefix)), nil)
+	defer it.Release()
+	var settings []ChatSettings
+	for it.Next() {
+		var cs ChatSettings
+		if err := s.decode(it.Value(), &cs); err != nil {
+			return nil, err
+		}
+		settings = append(settings, cs)
+	}
+	return settings, it.Error()
+}
+
+func settingsKey(chat int64) string {
+	return settingsPrefix + strconv.FormatInt(chat, 10)
+}
@@ -0,0 +1,181 @@
+package history
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// SLA summarizes the availability of a node during a window.
+// A node counts as down while it's out of sync or unreachable, lagging behind doesn't count as outage.
+type SLA struct {
+	Node string
+	From time.Time
+	To   time.Time
+	// Uptime is the percentage of the window the node was up.
+	Uptime    float64
+	Downtime  time.Duration
+	Incidents int
+	// MTTR is the mean time to recovery of the outages which ended during the window.
+	MTTR time.Duration
+	// LongestOutage is the longest outage during the window, cut off at the window bounds.
+	LongestOutage time.Duration
+}
+
+// SLA computes the availability of the node between from and to, based on the recorded state changes.
+func (s *Store) SLA(node string, from, to time.Time) (SLA, error) {
+	sla := SLA{Node: node, From: from, To: to}
+	initial, err := s.stateAt(node, from)
+	if err != nil {
+		return sla, err
+	}
+	transitions, err := s.Transitions(node, from, to)
+	if err != nil {
+		return sla, err
+	}
+
+	var downSince time.Time
+	if down(initial) {
+		downSince = from
+		sla.Incidents++
+	}
+	var recovered int
+	var recovery time.Duration
+	endOutage := func(at time.Time, since time.Time) {
+		d := at.Sub(downSince)
+		sla.Downtime += d
+		if d > sla.LongestOutage {
+			sla.LongestOutage = d
+		}
+		recovered++
+		recovery += at.Sub(since)
+		downSince = time.Time{}
+	}
+	for _, t := range transitions {
+		state, _ := insync.ParseNodeState(t.To)
+		switch {
+		case down(state) && downSince.IsZero():
+			downSince = t.Time
+			sla.Incidents++
+		case !down(state) && !downSince.IsZero():
+			// the outage may have started before the window, the recovery time covers all of it
+			start := downSince
+			if start.Equal(from) {
+				if prev, err := s.outageStart(node, from); err == nil && !prev.IsZero() {
+					start = prev
+				}
+			}
+			endOutage(t.Time, start)
+		}
+	}
+	if !downSince.IsZero() {
+		d := to.Sub(downSince)
+		sla.Downtime += d
+		if d > sla.LongestOutage {
+			sla.LongestOutage = d
+		}
+	}
+	if recovered > 0 {
+		sla.MTTR = recovery / time.Duration(recovered)
+	}
+	if window := to.Sub(from); window > 0 {
+		sla.Uptime = 100 * float64(window-sla.Downtime) / float64(window)
+	}
+	return sla, nil
+}
+
+// down reports whether the node counts as down in the state.
+func down(state insync.NodeState) bool {
+	return state == insync.StateSyncing || state == insync.StateUnreachable
+}
+
+// stateAt returns the state of the node at the time, according to the last state change before it.
+// Nodes without recorded state changes are considered healthy.
+func (s *Store) stateAt(node string, at time.Time) (insync.NodeState, error) {
+	t, ok, err := s.lastTransition(node, at)
+	if err != nil || !ok {
+		return insync.StateHealthy, err
+	}
+	state, _ := insync.ParseNodeState(t.To)
+	return state, nil
+}
+
+// outageStart returns the time the node went down, if it's down at the given time.
+func (s *Store) outageStart(node string, at time.Time) (time.Time, error) {
+	prefix := nodePrefix(transitionPrefix, node)
+	it := s.db.NewIterator(&util.Range{Start: []byte(prefix), Limit: []byte(prefix + timeKey(at))}, nil)
+	defer it.Release()
+	var start time.Time
+	for ok := it.Last(); ok; ok = it.Prev() {
+		var t insync.TransitionRecord
+		if err := s.decode(it.Value(), &t); err != nil {
+			return time.Time{}, err
+		}
+		state, _ := insync.ParseNodeState(t.To)
+		if !down(state) {
+			break
+		}
+		start = t.Time
+	}
+	return start, it.Error()
+}
+
+// lastTransition returns the last state change of the node before the time.
+func (s *Store) lastTransition(node string, before time.Time) (insync.TransitionRecord, bool, error) {
+	prefix := nodePrefix(transitionPrefix, node)
+	it := s.db.NewIterator(&util.Range{Start: []byte(prefix), Limit: []byte(prefix + timeKey(before))}, nil)
+	defer it.Release()
+	if !it.Last() {
+		return insync.TransitionRecord{}, false, it.Error()
+	}
+	var t insync.TransitionRecord
+	if err := s.decode(it.Value(), &t); err != nil {
+		return t, false, err
+	}
+	return t, true, nil
+}
+
+// Outage is a period a node was down, cut off at the bounds of the window it was queried for.
+type Outage struct {
+	Start time.Time
+	End   time.Time
+	// State is the state the node was down in last, syncing or unreachable.
+	State insync.NodeState
+}
+
+// Outages returns the outages of the node between from and to, oldest first.
+func (s *Store) Outages(node string, from, to time.Time) ([]Outage, error) {
+	initial, err := s.stateAt(node, from)
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := s.Transitions(node, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var outages []Outage
+	var current *Outage
+	if down(initial) {
+		current = &Outage{Start: from, State: initial}
+	}
+	for _, t := range transitions {
+		state, _ := insync.ParseNodeState(t.To)
+		switch {
+		case down(state) && current == nil:
+			current = &Outage{Start: t.Time, State: state}
+		case down(state):
+			current.State = state
+		case current != nil:
+			current.End = t.Time
+			outages = append(outages, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.End = to
+		outages = append(outages, *current)
+	}
+	return outages, nil
+}
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Summary summarizes the recorded check results of a node during a window, on top of its availability.
+// The measurements are zero if the check didn't run or the records predate them.
+type Summary struct {
+	SLA
+	// Lag is the average lag of the successful sync checks, MaxLag the worst one, in blocks.
+	Lag    float64
+	MaxLag uint64
+	// MinPeers and MaxPeers are the range of the peer count, Peers reports whether it was checked.
+	Peers              bool
+	MinPeers, MaxPeers uint64
+	// LatencyP50, LatencyP90 and LatencyP99 are the percentiles of the response time of the sync checks.
+	LatencyP50, LatencyP90, LatencyP99 time.Duration
+	// DiskFrom and DiskTo are the first and last disk usage of the window in percent, Disk reports whether it was checked.
+	Disk             bool
+	DiskFrom, DiskTo float64
+	// Blobs is the average blob count of the head blocks of the beacon node, Unavailable the number of blob checks
+	// failing the data availability check. BlobChecks is the number of blob checks.
+	Blobs                   float64
+	BlobChecks, Unavailable int
+}
+
+// Summary computes the summary of the node between from and to.
+func (s *Store) Summary(node string, from, to time.Time) (Summary, error) {
+	sla, err := s.SLA(node, from, to)
+	if err != nil {
+		return Summary{SLA: sla}, err
+	}
+	sum := Summary{SLA: sla}
+	results, err := s.Results(node, from, to)
+	if err != nil {
+		return sum, err
+	}
+	var lag float64
+	var synced int
+	var latencies []time.Duration
+	for _, r := range results {
+		if r.Status == "error" {
+			continue
+		}
+		switch r.Check {
+		case "sync":
+			if r.Latency <= 0 {
+				// unreachable, the check didn't get an answer
+				continue
+			}
+			lag += r.Value
+			if l := uint64(r.Value); l > sum.MaxLag {
+				sum.MaxLag = l
+			}
+			synced++
+			latencies = append(latencies, r.Latency)
+		case "peers":
+			peers := uint64(r.Value)
+			if !sum.Peers || peers < sum.MinPeers {
+				sum.MinPeers = peers
+			}
+			if !sum.Peers || peers > sum.MaxPeers {
+				sum.MaxPeers = peers
+			}
+			sum.Peers = true
+		case "disk":
+			if !sum.Disk {
+				sum.DiskFrom = r.Value
+			}
+			sum.DiskTo, sum.Disk = r.Value, true
+		case "blobs":
+			sum.BlobChecks++
+			sum.Blobs += (r.Value - sum.Blobs) / float64(sum.BlobChecks)
+			if r.Status == "unavailable" {
+				sum.Unavailable++
+			}
+		}
+	}
+	if synced > 0 {
+		sum.Lag = lag / float64(synced)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	sum.LatencyP50 = percentile(latencies, 50)
+	sum.LatencyP90 = percentile(latencies, 90)
+	sum.LatencyP99 = percentile(latencies, 99)
+	return sum, nil
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations, 0 if there are none.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (p*len(sorted)+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,150 @@
+package insync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// Severity is the urgency of an alert.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityCritical: "critical",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name like warning, ignoring the case.
+func ParseSeverity(s string) (Severity, bool) {
+	for sev, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return sev, true
+		}
+	}
+	return 0, false
+}
+
+// Alert is a single notification about a node.
+type Alert struct {
+	Node     string
+	Severity Severity
+	Text     string
+
+	// Summary describes the alert in a few words, e.g. "out of sync".
+	// Alerts with the same summary are grouped together.
+	Summary string
+	Icon    string
+
+	// Name identifies the kind of alert, e.g. NodeOutOfSync.
+	Name string
+	// Key identifies the condition the alert is about, e.g. sync or peers.
+	// A later alert with the same key for the same node supersedes the earlier one.
+	Key string
+	// Resolved is set if the alert reports the recovery of the condition.
+	Resolved bool
+	// Replace is set if the alert updates the previous alert with the same key of the node, e.g. the progress of an
+	// initial sync. Telegram edits the message of the previous alert, the other destinations receive every update.
+	Replace bool
+	// Incident the alert belongs to, might be nil. Telegram messages of the same incident are threaded.
+	Incident *Incident
+	// Span is the span of the check raising the alert, the deliveries are traced as its children.
+	Span tracing.SpanContext
+	// Actions are offered with the alert, e.g. a remediation waiting for confirmation.
+	// Telegram shows them as buttons, the other destinations ignore them.
+	Actions []AlertAction
+}
+
+// AlertAction is an action a user can take on an alert.
+type AlertAction struct {
+	Label string
+	// ID identifies the action towards the handler running it, at most 48 bytes.
+	ID string
+}
+
+// SelfNode is the node of the alerts about insync itself, e.g. of a failing route.
+const SelfNode = "insync"
+
+// TestAlert returns a synthetic alert to verify the delivery, e.g. after changing the routing.
+// It's sent on behalf of the node, insync itself if empty.
+func TestAlert(node, sender string, severity Severity) Alert {
+	if node == "" {
+		node = SelfNode
+	}
+	return Alert{
+		Node:     node,
+		Name:     "InsyncTest",
+		Key:      "test",
+		Summary:  "test alert",
+		Icon:     "🧪",
+		Severity: severity,
+		Text:     fmt.Sprintf("🧪 test alert for %s with severity %s, sent by %s\nNothing to do, it only verifies that alerts are delivered.", node, severity, sender),
+	}
+}
+
+// alertJSON is the json form of an alert, as passed to notifier plugins.
+type alertJSON struct {
+	Time     time.Time `json:"time"`
+	Node     string    `json:"node"`
+	Name     string    `json:"name"`
+	Key      string    `json:"key,omitempty"`
+	Severity string    `json:"severity"`
+	Summary  string    `json:"summary"`
+	Text     string    `json:"text"`
+	Resolved bool      `json:"resolved"`
+	Incident string    `json:"incident,omitempty"`
+}
+
+// MarshalJSON encodes the alert together with the id of its incident.
+func (a Alert) MarshalJSON() ([]byte, error) {
+	j := alertJSON{
+		Time:     time.Now(),
+		Node:     a.Node,
+		Name:     a.Name,
+		Key:      a.Key,
+		Severity: a.Severity.String(),
+		Summary:  a.Summary,
+		Text:     a.Text,
+		Resolved: a.Resolved,
+	}
+	if a.Incident != nil {
+		j.Incident = a.Incident.ID()
+	}
+	return json.Marshal(j)
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Send(a Alert) error
+}
+
+// Notifiers delivers alerts to all of its notifiers.
+type Notifiers []Notifier
+
+// Send delivers the alert to all notifiers and returns their joined errors.
+func (ns Notifiers) Send(a Alert) error {
+	var errs []string
+	for _, n := range ns {
+		if err := n.Send(a); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package insync
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// backoff computes exponentially growing delays between attempts, capped at max.
+// A random jitter of up to half the delay is subtracted, so clients don't retry in lockstep.
+type backoff struct {
+	min, max time.Duration
+}
+
+// delay returns the delay before the given attempt, starting at 0.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.min
+	for i := 0; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for the delay before the attempt and reports false if the context is done first.
+func (b backoff) sleep(ctx context.Context, attempt int) bool {
+	t := time.NewTimer(b.delay(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
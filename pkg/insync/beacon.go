@@ -0,0 +1,57 @@
+package insync
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// httpClient is the client of the http apis besides json-rpc, e.g. of the beacon nodes and the validator clients.
+var httpClient = &http.Client{}
+
+// getJSON requests the url with the bearer token, if there is one, and decodes the json response into v unless it's nil.
+func getJSON(ctx context.Context, url, token string, v interface{}) error {
+	resp, err := httpGet(ctx, url, "application/json", token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpGet requests the url, any status but 2xx fails with an rpc.HTTPError, so the errors are classified like those
+// of json-rpc calls. The caller must close the body.
+func httpGet(ctx context.Context, url, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, rpc.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	}
+	return resp, nil
+}
+
+// beaconGet requests the path from the beacon node api of the node, e.g. /eth/v1/node/syncing.
+func (n *Node) beaconGet(ctx context.Context, p retryPolicy, path string, v interface{}) error {
+	return p.do(ctx, func(ctx context.Context) error {
+		return getJSON(ctx, strings.TrimSuffix(n.beacon, "/")+path, "", v)
+	})
+}
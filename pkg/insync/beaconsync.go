@@ -0,0 +1,163 @@
+package insync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BeaconSyncCheck checks the sync status of the beacon node of the node: its sync distance, its head slot compared to
+// the slot of the wall clock, and whether it imports the blocks optimistically, i.e. without its execution client
+// verifying them. A beacon node more than the max distance behind or optimistic is alerted as critical, its validators
+// can't attest or propose correctly. The sync status is part of /status.
+type BeaconSyncCheck struct {
+	n     *Node
+	cfg   BeaconSyncCheckConfig
+	retry retryPolicy
+	// genesis and slot are the genesis time and the slot duration of the chain, fetched once.
+	genesis time.Time
+	slot    time.Duration
+	// unsynced is set while the beacon node is alerted as out of sync.
+	unsynced bool
+}
+
+// NewBeaconSyncCheck creates the beacon sync check of the node, the node must have a beacon node.
+func NewBeaconSyncCheck(n *Node, cfg BeaconSyncCheckConfig) *BeaconSyncCheck {
+	return &BeaconSyncCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg.CheckConfig), unsynced: n.checkState("beacon_sync") == "unsynced"}
+}
+
+func (c *BeaconSyncCheck) Name() string { return "beacon_sync" }
+
+func (c *BeaconSyncCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *BeaconSyncCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	st, err := c.syncStatus(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking beacon sync status", "node", n.name, "check", "beacon_sync", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("beacon_sync", "error", err.Error())
+		n.countCheckError("beacon_sync")
+		return
+	}
+	n.setBeaconSync(st)
+	detail := BeaconSyncDetail(st)
+	unsynced := st.SyncDistance > c.cfg.MaxDistance || st.Optimistic
+	status := "ok"
+	if unsynced {
+		status = "unsynced"
+	}
+	n.record(CheckResult{Check: "beacon_sync", Status: status, Detail: detail, Value: float64(st.SyncDistance)})
+	switch {
+	case unsynced && !c.unsynced:
+		slog.Warn("beacon node out of sync", "node", n.name, "check", "beacon_sync", "head_slot", st.HeadSlot, "wall_slot", st.WallSlot,
+			"sync_distance", st.SyncDistance, "optimistic", st.Optimistic)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "beacon node out of sync",
+			Name:     "NodeBeaconOutOfSync",
+			Key:      "beacon_sync",
+			Icon:     "🔴",
+			Severity: SeverityCritical,
+			Text:     fmt.Sprintf("🔴 the beacon node of %s is out of sync: %s", n.name, detail),
+		})
+		c.unsynced = true
+		n.setCheckState("beacon_sync", "unsynced")
+	case !unsynced && c.unsynced:
+		slog.Info("beacon node in sync", "node", n.name, "check", "beacon_sync", "head_slot", st.HeadSlot)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "beacon node in sync",
+			Name:     "NodeBeaconOutOfSync",
+			Key:      "beacon_sync",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 the beacon node of %s is in sync again: %s", n.name, detail),
+		})
+		c.unsynced = false
+		n.setCheckState("beacon_sync", "")
+	}
+}
+
+// syncStatus gets the sync status of the beacon node and the slot of the wall clock.
+func (c *BeaconSyncCheck) syncStatus(ctx context.Context) (BeaconSyncStatus, error) {
+	var st BeaconSyncStatus
+	if err := c.chainTime(ctx); err != nil {
+		return st, err
+	}
+	var syncing struct {
+		Data struct {
+			HeadSlot     string `json:"head_slot"`
+			SyncDistance string `json:"sync_distance"`
+			IsOptimistic bool   `json:"is_optimistic"`
+		} `json:"data"`
+	}
+	if err := c.n.beaconGet(ctx, c.retry, "/eth/v1/node/syncing", &syncing); err != nil {
+		return st, err
+	}
+	var err error
+	if st.HeadSlot, err = strconv.ParseUint(syncing.Data.HeadSlot, 10, 64); err != nil {
+		return st, fmt.Errorf("invalid head slot: %w", err)
+	}
+	if st.SyncDistance, err = strconv.ParseUint(syncing.Data.SyncDistance, 10, 64); err != nil {
+		return st, fmt.Errorf("invalid sync distance: %w", err)
+	}
+	st.Optimistic = syncing.Data.IsOptimistic
+	if now := time.Now(); now.After(c.genesis) {
+		st.WallSlot = uint64(now.Sub(c.genesis) / c.slot)
+	}
+	return st, nil
+}
+
+// chainTime fetches the genesis time and the slot duration of the chain, once they're known they're kept.
+func (c *BeaconSyncCheck) chainTime(ctx context.Context) error {
+	if c.slot > 0 {
+		return nil
+	}
+	var genesis struct {
+		Data struct {
+			GenesisTime string `json:"genesis_time"`
+		} `json:"data"`
+	}
+	if err := c.n.beaconGet(ctx, c.retry, "/eth/v1/beacon/genesis", &genesis); err != nil {
+		return err
+	}
+	t, err := strconv.ParseInt(genesis.Data.GenesisTime, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid genesis time: %w", err)
+	}
+	var spec struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.n.beaconGet(ctx, c.retry, "/eth/v1/config/spec", &spec); err != nil {
+		return err
+	}
+	seconds, err := strconv.ParseUint(fmt.Sprint(spec.Data["SECONDS_PER_SLOT"]), 10, 64)
+	if err != nil || seconds == 0 {
+		return fmt.Errorf("invalid seconds per slot %v", spec.Data["SECONDS_PER_SLOT"])
+	}
+	c.genesis, c.slot = time.Unix(t, 0), time.Duration(seconds)*time.Second
+	return nil
+}
+
+// BeaconSyncDetail describes the sync status of a beacon node, e.g. sync distance 0, head slot 8,000,000 at
+// wall-clock slot 8,000,001 (1 behind), execution verified.
+func BeaconSyncDetail(st BeaconSyncStatus) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "sync distance %s, head slot %s at wall-clock slot %s", FormatNumber(st.SyncDistance), FormatNumber(st.HeadSlot), FormatNumber(st.WallSlot))
+	if behind := st.Behind(); behind > 0 {
+		fmt.Fprintf(&s, " (%s behind)", FormatNumber(behind))
+	}
+	if st.Optimistic {
+		s.WriteString(", execution optimistic")
+	} else {
+		s.WriteString(", execution verified")
+	}
+	return s.String()
+}
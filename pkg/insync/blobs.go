@@ -0,0 +1,126 @@
+package insync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// BlobCheck alerts if the beacon node fails the data availability check of its head block, i.e. it can't get the
+// blob sidecars of the blob commitments in the block. A node failing the check can't import the blocks, so its chain
+// stalls. The blob count of every head block is recorded.
+type BlobCheck struct {
+	n     *Node
+	cfg   BlobCheckConfig
+	retry retryPolicy
+	// failures is the number of checks in a row whose head block failed the data availability check.
+	failures    int
+	unavailable bool
+}
+
+// NewBlobCheck creates the blob check of the node, the node must have a beacon node.
+func NewBlobCheck(n *Node, cfg BlobCheckConfig) *BlobCheck {
+	return &BlobCheck{
+		n:           n,
+		cfg:         cfg,
+		retry:       newRetryPolicy(cfg.CheckConfig),
+		unavailable: n.checkState("blobs") == "unavailable",
+	}
+}
+
+func (c *BlobCheck) Name() string { return "blobs" }
+
+func (c *BlobCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+// beaconBlock is the part of a signed beacon block the blob check needs.
+type beaconBlock struct {
+	Data struct {
+		Message struct {
+			Slot string `json:"slot"`
+			Body struct {
+				// BlobKZGCommitments are missing before deneb.
+				BlobKZGCommitments []string `json:"blob_kzg_commitments"`
+			} `json:"body"`
+		} `json:"message"`
+	} `json:"data"`
+}
+
+func (c *BlobCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var block beaconBlock
+	err := n.beaconGet(ctx, c.retry, "/eth/v2/beacon/blocks/head", &block)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking beacon head block", "node", n.name, "check", "blobs", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("blobs", "error", err.Error())
+		n.countCheckError("blobs")
+		return
+	}
+	slot, err := strconv.ParseUint(block.Data.Message.Slot, 10, 64)
+	if err != nil {
+		slog.Warn("invalid beacon head block", "node", n.name, "check", "blobs", "err", err)
+		n.recordResult("blobs", "error", err.Error())
+		n.countCheckError("blobs")
+		return
+	}
+	blobs := len(block.Data.Message.Body.BlobKZGCommitments)
+	available, daErr := blobs, error(nil)
+	if blobs > 0 {
+		var sidecars struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		// e.g. 404 if the node doesn't have them
+		daErr = n.beaconGet(ctx, c.retry, fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%d", slot), &sidecars)
+		if ctx.Err() != nil {
+			return
+		}
+		available = len(sidecars.Data)
+	}
+	detail := fmt.Sprintf("slot %d, %d of %d blobs available", slot, available, blobs)
+	if daErr != nil {
+		detail += ": " + daErr.Error()
+	}
+	if daErr == nil && available >= blobs {
+		n.record(CheckResult{Check: "blobs", Status: "ok", Detail: detail, Value: float64(blobs)})
+		c.failures = 0
+		if c.unavailable {
+			slog.Info("blobs available again", "node", n.name, "check", "blobs", "slot", slot)
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "blobs available again",
+				Name:     "NodeBlobsUnavailable",
+				Key:      "blobs",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s passes the data availability check again, slot %d has %d blob(s)", n.name, slot, blobs),
+			})
+			c.unavailable = false
+			n.setCheckState("blobs", "")
+		}
+		return
+	}
+	n.record(CheckResult{Check: "blobs", Status: "unavailable", Detail: detail, Value: float64(blobs)})
+	c.failures++
+	slog.Warn("blobs unavailable", "node", n.name, "check", "blobs", "slot", slot, "blobs", blobs, "available", available, "err", daErr)
+	if c.failures < c.cfg.Failures || c.unavailable {
+		return
+	}
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "failing the data availability check",
+		Name:     "NodeBlobsUnavailable",
+		Key:      "blobs",
+		Icon:     "🔴",
+		Severity: SeverityCritical,
+		Text: fmt.Sprintf("🔴 %s fails the data availability check, %s (%d checks in a row). Its chain stalls until it gets the blobs.",
+			n.name, detail, c.failures),
+	})
+	c.unavailable = true
+	n.setCheckState("blobs", "unavailable")
+}
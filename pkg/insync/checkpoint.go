@@ -0,0 +1,162 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// CheckpointCheck verifies the chain of a checkpoint synced beacon node against trusted beacon node apis, to protect
+// against syncing from a malicious checkpoint. The finalized checkpoint of the node descends from the anchor it was
+// synced from, so it's looked up on the trusted sources: a source which doesn't have the block, or not as canonical,
+// is a mismatch, which is critical. Sources which can't be reached are skipped.
+type CheckpointCheck struct {
+	n     *Node
+	cfg   CheckpointCheckConfig
+	retry retryPolicy
+	// mismatch is set while the checkpoint of the node didn't match one of the trusted sources.
+	mismatch bool
+}
+
+// NewCheckpointCheck creates the checkpoint check of the node, the node must have a beacon node.
+func NewCheckpointCheck(n *Node, cfg CheckpointCheckConfig) *CheckpointCheck {
+	return &CheckpointCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg.CheckConfig), mismatch: n.checkState("checkpoint") == "mismatch"}
+}
+
+// finalityCheckpoints is the part of the finality checkpoints of a state the checkpoint check needs.
+type finalityCheckpoints struct {
+	Data struct {
+		Finalized struct {
+			Epoch string `json:"epoch"`
+			Root  string `json:"root"`
+		} `json:"finalized"`
+	} `json:"data"`
+}
+
+func (c *CheckpointCheck) Name() string { return "checkpoint" }
+
+func (c *CheckpointCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *CheckpointCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var checkpoints finalityCheckpoints
+	err := n.beaconGet(ctx, c.retry, "/eth/v1/beacon/states/head/finality_checkpoints", &checkpoints)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking finalized checkpoint", "node", n.name, "check", "checkpoint", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("checkpoint", "error", err.Error())
+		n.countCheckError("checkpoint")
+		return
+	}
+	finalized := checkpoints.Data.Finalized
+	epoch, err := strconv.ParseUint(finalized.Epoch, 10, 64)
+	if err != nil {
+		slog.Warn("invalid finalized checkpoint", "node", n.name, "check", "checkpoint", "err", err)
+		n.recordResult("checkpoint", "error", err.Error())
+		n.countCheckError("checkpoint")
+		return
+	}
+	if epoch == 0 {
+		// nothing finalized yet, e.g. at genesis of a devnet
+		return
+	}
+	var mismatches []string
+	verified := 0
+	for _, source := range c.cfg.Trusted {
+		ok, err := c.canonical(ctx, source, epoch, finalized.Root)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("error checking trusted checkpoint source", "node", n.name, "check", "checkpoint", "source", NodeName(source), "err", err)
+			continue
+		}
+		verified++
+		if !ok {
+			mismatches = append(mismatches, NodeName(source))
+		}
+	}
+	if verified == 0 {
+		slog.Warn("the checkpoint can't be verified, no trusted source answered", "node", n.name, "check", "checkpoint")
+		return
+	}
+	detail := fmt.Sprintf("epoch %s, root %s", finalized.Epoch, finalized.Root)
+	if len(mismatches) == 0 {
+		n.recordResult("checkpoint", "ok", detail)
+		if c.mismatch {
+			slog.Info("checkpoint matches again", "node", n.name, "check", "checkpoint")
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "checkpoint verified",
+				Name:     "NodeCheckpointMismatch",
+				Key:      "checkpoint",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s matches the trusted checkpoint sources again, %s", n.name, detail),
+			})
+			c.mismatch = false
+			n.setCheckState("checkpoint", "")
+		}
+		return
+	}
+	n.recordResult("checkpoint", "mismatch", detail)
+	if c.mismatch {
+		return
+	}
+	slog.Error("checkpoint mismatch", "node", n.name, "check", "checkpoint", "epoch", finalized.Epoch, "root", finalized.Root, "sources", strings.Join(mismatches, ","))
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "checkpoint mismatch",
+		Name:     "NodeCheckpointMismatch",
+		Key:      "checkpoint",
+		Icon:     "🔴",
+		Severity: SeverityCritical,
+		Text: fmt.Sprintf("🔴 %s doesn't match the trusted checkpoint sources %s, its finalized checkpoint is %s. It may have been synced from a malicious checkpoint, resync it from a trusted one.",
+			n.name, strings.Join(mismatches, ", "), detail),
+	})
+	c.mismatch = true
+	n.setCheckState("checkpoint", "mismatch")
+}
+
+// canonical reports whether the block of the root, finalized in the epoch, is canonical on the trusted beacon node api.
+// A source which didn't finalize the epoch yet can't tell, it fails.
+func (c *CheckpointCheck) canonical(ctx context.Context, source string, epoch uint64, root string) (bool, error) {
+	source = strings.TrimSuffix(source, "/")
+	var checkpoints finalityCheckpoints
+	err := c.retry.do(ctx, func(ctx context.Context) error {
+		return getJSON(ctx, source+"/eth/v1/beacon/states/head/finality_checkpoints", "", &checkpoints)
+	})
+	if err != nil {
+		return false, err
+	}
+	if e, err := strconv.ParseUint(checkpoints.Data.Finalized.Epoch, 10, 64); err != nil || e < epoch {
+		return false, fmt.Errorf("the source didn't finalize epoch %d yet", epoch)
+	}
+	var header struct {
+		Data struct {
+			Canonical bool `json:"canonical"`
+		} `json:"data"`
+	}
+	err = c.retry.do(ctx, func(ctx context.Context) error {
+		return getJSON(ctx, source+"/eth/v1/beacon/headers/"+root, "", &header)
+	})
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		// the source doesn't know the block
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return header.Data.Canonical, nil
+}
@@ -0,0 +1,211 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Check is a periodic check of a node. The monitor calls Run on every tick of the interval,
+// the check keeps its state between the runs and sends alerts once the state changes.
+type Check interface {
+	Name() string
+	Interval() time.Duration
+	Run(ctx context.Context, nf Notifier)
+}
+
+// PeersCheck alerts if the peer count of the node drops below the configured minimum.
+type PeersCheck struct {
+	n     *Node
+	cfg   PeersCheckConfig
+	errs  *errorTracker
+	retry retryPolicy
+	low   bool
+}
+
+// NewPeersCheck creates the peer count check of the node.
+func NewPeersCheck(n *Node, cfg PeersCheckConfig) *PeersCheck {
+	return &PeersCheck{
+		n:     n,
+		cfg:   cfg,
+		errs:  newErrorTracker(n.name, "peers", cfg.ErrorThreshold),
+		retry: newRetryPolicy(cfg.CheckConfig),
+		low:   n.checkState("peers") == "low",
+	}
+}
+
+func (c *PeersCheck) Name() string { return "peers" }
+
+func (c *PeersCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *PeersCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var peers hexutil.Uint64
+	err := n.call(ctx, c.retry, &peers, "net_peerCount")
+	if ctx.Err() != nil {
+		return
+	}
+	c.errs.observe(nf, err)
+	if err != nil {
+		slog.Warn("error checking peer count", "node", n.name, "check", "peers", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("peers", "error", err.Error())
+		n.countCheckError("peers")
+		return
+	}
+	n.setPeers(uint64(peers))
+	status := "ok"
+	if uint64(peers) < c.cfg.MinPeers {
+		status = "low"
+	}
+	n.record(CheckResult{Check: "peers", Status: status, Detail: fmt.Sprintf("%d peers", peers), Value: float64(peers)})
+	if uint64(peers) < c.cfg.MinPeers && !c.low {
+		slog.Warn("low peer count", "node", n.name, "check", "peers", "peers", peers)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "low on peers",
+			Name:     "NodeLowPeers",
+			Key:      "peers",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text:     fmt.Sprintf("🟠 %s has only %d peers (minimum %d)", n.name, peers, c.cfg.MinPeers),
+		})
+		c.low = true
+		n.setCheckState("peers", "low")
+	} else if uint64(peers) >= c.cfg.MinPeers && c.low {
+		slog.Info("peer count recovered", "node", n.name, "check", "peers", "peers", peers)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "have enough peers again",
+			Name:     "NodeLowPeers",
+			Key:      "peers",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s has %d peers again", n.name, peers),
+		})
+		c.low = false
+		n.setCheckState("peers", "")
+	}
+}
+
+// adminPolicy is the retry policy of the calls made on behalf of other packages, like the remediation.
+var adminPolicy = retryPolicy{timeout: dialTimeout}
+
+// PeerCount returns the current peer count of the node.
+func (n *Node) PeerCount(ctx context.Context) (uint64, error) {
+	var peers hexutil.Uint64
+	err := n.call(ctx, adminPolicy, &peers, "net_peerCount")
+	return uint64(peers), err
+}
+
+// AddPeer asks the node to connect to the peer with admin_addPeer, the admin api has to be enabled.
+func (n *Node) AddPeer(ctx context.Context, enode string) error {
+	var ok bool
+	if err := n.call(ctx, adminPolicy, &ok, "admin_addPeer", enode); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the node refused to add the peer")
+	}
+	return nil
+}
+
+// DiskCheck alerts if the disk usage of the node's data directory exceeds the configured threshold.
+type DiskCheck struct {
+	n    *Node
+	cfg  DiskCheckConfig
+	full bool
+}
+
+// NewDiskCheck creates the disk usage check of the node, the node must have a data directory.
+func NewDiskCheck(n *Node, cfg DiskCheckConfig) *DiskCheck {
+	return &DiskCheck{n: n, cfg: cfg, full: n.checkState("disk") == "full"}
+}
+
+func (c *DiskCheck) Name() string { return "disk" }
+
+func (c *DiskCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *DiskCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	usage, err := diskUsage(n.dataDir)
+	if err != nil {
+		slog.Warn("error checking disk usage", "node", n.name, "check", "disk", "err", err)
+		n.recordResult("disk", "error", err.Error())
+		n.countCheckError("disk")
+		return
+	}
+	n.setDiskUsage(usage)
+	status := "ok"
+	if usage >= c.cfg.Threshold {
+		status = "full"
+	}
+	n.record(CheckResult{Check: "disk", Status: status, Detail: fmt.Sprintf("%.1f%% used", usage), Value: usage})
+	if usage >= c.cfg.Threshold && !c.full {
+		slog.Warn("high disk usage", "node", n.name, "check", "disk", "usage", fmt.Sprintf("%.1f%%", usage))
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "running out of disk space",
+			Name:     "NodeDiskFull",
+			Key:      "disk",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text:     fmt.Sprintf("🟠 %s disk usage at %.1f%% (threshold %.0f%%)", n.name, usage, c.cfg.Threshold),
+		})
+		c.full = true
+		n.setCheckState("disk", "full")
+	} else if usage < c.cfg.Threshold && c.full {
+		slog.Info("disk usage recovered", "node", n.name, "check", "disk", "usage", fmt.Sprintf("%.1f%%", usage))
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "back below the disk usage threshold",
+			Name:     "NodeDiskFull",
+			Key:      "disk",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s disk usage back at %.1f%%", n.name, usage),
+		})
+		c.full = false
+		n.setCheckState("disk", "")
+	}
+}
+
+// HeadCheck polls the head block of a reference endpoint, e.g. a public rpc provider the nodes are compared to.
+// It doesn't alert, the errors are only logged.
+type HeadCheck struct {
+	n     *Node
+	cfg   CheckConfig
+	retry retryPolicy
+}
+
+// NewHeadCheck creates the head check of the reference.
+func NewHeadCheck(n *Node, cfg CheckConfig) *HeadCheck {
+	return &HeadCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg)}
+}
+
+func (c *HeadCheck) Name() string { return "head" }
+
+func (c *HeadCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *HeadCheck) Run(ctx context.Context, _ Notifier) {
+	n := c.n
+	var head hexutil.Uint64
+	err := n.call(ctx, c.retry, &head, "eth_blockNumber")
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking head block", "node", n.name, "check", "head", "err", err)
+		n.setState(StateUnreachable)
+		return
+	}
+	n.setBlocks(uint64(head), uint64(head))
+	n.setState(StateHealthy)
+	n.markChecked()
+	n.markSucceeded()
+}
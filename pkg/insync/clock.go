@@ -0,0 +1,166 @@
+package insync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ntpEpochOffset is the number of seconds between the ntp epoch, 1900, and the unix epoch.
+const ntpEpochOffset = 2208988800
+
+// ClockCheck warns if the clock of the host running insync is skewed, which breaks the checks based on block timestamps.
+//
+// With an ntp server the clock is compared to the server. Otherwise it is compared to the newest block of the nodes,
+// which only detects a clock running behind, as blocks always lag a bit.
+type ClockCheck struct {
+	nodes  []*Node
+	cfg    ClockCheckConfig
+	retry  retryPolicy
+	skewed bool
+}
+
+// NewClockCheck creates the clock check, comparing to the blocks of the nodes if no ntp server is configured.
+func NewClockCheck(nodes []*Node, cfg ClockCheckConfig) *ClockCheck {
+	return &ClockCheck{nodes: nodes, cfg: cfg, retry: newRetryPolicy(cfg.CheckConfig)}
+}
+
+func (c *ClockCheck) Name() string { return "clock" }
+
+func (c *ClockCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *ClockCheck) Run(ctx context.Context, nf Notifier) {
+	var skew time.Duration
+	var err error
+	source := c.cfg.NTPServer
+	if source != "" {
+		skew, err = ntpOffset(ctx, source, time.Duration(c.cfg.Timeout))
+	} else {
+		source = "the newest blocks"
+		skew, err = c.blockOffset(ctx)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking the clock", "check", "clock", "err", err)
+		return
+	}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead"
+	}
+	if abs > time.Duration(c.cfg.MaxSkew) && !c.skewed {
+		slog.Warn("clock skew", "check", "clock", "offset", FormatDuration(abs), "direction", direction, "source", source)
+		sendAlert(nf, Alert{
+			Node:     SelfNode,
+			Summary:  "host clock skewed",
+			Name:     "InsyncClockSkew",
+			Key:      "clock",
+			Icon:     "🕰",
+			Severity: SeverityWarning,
+			Text: fmt.Sprintf("🕰 the clock of the insync host is %s %s of %s (maximum %s)\nChecks based on block timestamps may be wrong.",
+				FormatDuration(abs), direction, source, FormatDuration(time.Duration(c.cfg.MaxSkew))),
+		})
+		c.skewed = true
+	} else if abs <= time.Duration(c.cfg.MaxSkew) && c.skewed {
+		slog.Info("clock in sync again", "check", "clock", "offset", abs)
+		sendAlert(nf, Alert{
+			Node:     SelfNode,
+			Summary:  "host clock in sync again",
+			Name:     "InsyncClockSkew",
+			Key:      "clock",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 the clock of the insync host is in sync with %s again", source),
+		})
+		c.skewed = false
+	}
+}
+
+// blockOffset returns how far the newest block of the nodes is in the future. It's never negative,
+// as a block in the past may as well be a stale node.
+func (c *ClockCheck) blockOffset(ctx context.Context) (time.Duration, error) {
+	var newest time.Time
+	var lastErr error
+	for _, n := range c.nodes {
+		var head struct {
+			Timestamp hexutil.Uint64 `json:"timestamp"`
+		}
+		if err := n.call(ctx, c.retry, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+			lastErr = fmt.Errorf("%s: %w", n.name, err)
+			continue
+		}
+		if t := time.Unix(int64(head.Timestamp), 0); t.After(newest) {
+			newest = t
+		}
+	}
+	if newest.IsZero() {
+		if lastErr == nil {
+			lastErr = errors.New("no nodes")
+		}
+		return 0, lastErr
+	}
+	if d := time.Until(newest); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+// ntpOffset queries the ntp server (sntp, rfc 4330) and returns the offset of the server to the local clock,
+// positive if the local clock is behind.
+func ntpOffset(ctx context.Context, server string, timeout time.Duration) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x1b // no leap indicator, version 3, client mode
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := conn.Read(resp); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	if stratum := resp[1]; stratum == 0 {
+		return 0, fmt.Errorf("ntp server %s sent a kiss-of-death", server)
+	}
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64 bit ntp timestamp.
+func ntpTime(b []byte) time.Time {
+	sec := binary.BigEndian.Uint32(b[:4])
+	frac := binary.BigEndian.Uint32(b[4:])
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
@@ -0,0 +1,429 @@
+package insync
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// NodeConfig configures a node. The name is derived from the url if empty.
+type NodeConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Fallbacks are the urls the node is monitored through while the url is unreachable, e.g. a second rpc endpoint.
+	// They use the same authentication, headers, tls and proxy as the url.
+	Fallbacks []string `yaml:"fallbacks"`
+	// DataDir is the local data directory of the node, used by the disk check.
+	DataDir string `yaml:"data_dir"`
+	// ValidatorClient is the health endpoint of the validator client running with the node, used by the validator
+	// client check.
+	ValidatorClient ValidatorClientConfig `yaml:"validator_client"`
+	// Beacon is the url of the beacon node api of the consensus client paired with the node, e.g. http://localhost:5052,
+	// used by the beacon sync and blob checks.
+	Beacon string `yaml:"beacon"`
+	// Validators are the indices or public keys of the validators of the beacon node, used by the proposal and sync
+	// committee checks.
+	Validators []string `yaml:"validators"`
+	// Metrics are the prometheus metrics endpoints of the clients, e.g. geth's http://localhost:6060/debug/metrics/prometheus,
+	// used by the metrics check.
+	Metrics []string `yaml:"metrics"`
+	// Mode is how the sync of the node is checked: full, the default, with eth_syncing, or light for light clients like
+	// helios and portal clients, whose finalized head is compared to that of the reference instead.
+	Mode string `yaml:"mode"`
+	// Genesis is the expected genesis block hash, used by the genesis check. It defaults to that of the chain if it's
+	// well known, i.e. mainnet, goerli or sepolia.
+	Genesis string `yaml:"genesis"`
+	// Chain is the name of the chain, e.g. mainnet, used as metric label. It's detected if empty.
+	Chain string     `yaml:"chain"`
+	Auth  AuthConfig `yaml:"auth"`
+	// Headers are added to every request, only supported for http endpoints.
+	Headers map[string]string `yaml:"headers"`
+	TLS     TLSConfig         `yaml:"tls"`
+	// Proxy is the url of the http or socks5 proxy the node is connected through.
+	// Http endpoints use the proxy of the environment (HTTPS_PROXY etc.) if empty.
+	Proxy string `yaml:"proxy"`
+	// DialControl is called for the connections to the endpoints after the address is resolved and before it's
+	// connected to, e.g. to reject addresses. It can't be configured.
+	DialControl func(network, address string, c syscall.RawConn) error `yaml:"-"`
+}
+
+// CheckConfig holds the settings shared by all checks.
+// A check with an interval of 0 is disabled.
+type CheckConfig struct {
+	Interval Duration `yaml:"interval"`
+	// Timeout of a single attempt of a check, defaults to the interval.
+	Timeout Duration `yaml:"timeout"`
+	// Retries is the number of times a check is retried after a timeout or connection error,
+	// before it counts as failed. Defaults to 2, -1 disables retries.
+	Retries int `yaml:"retries"`
+	// ErrorThreshold is the number of consecutive rpc errors after which an alert is sent, 0 disables the alert.
+	ErrorThreshold int `yaml:"error_threshold"`
+}
+
+// SyncCheckConfig configures the sync check.
+type SyncCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// ReportInterval is the time a node has to be out of sync before it's reported.
+	ReportInterval Duration `yaml:"report_interval"`
+	RecoveryChecks int64    `yaml:"recovery_checks"`
+	// MaxLag is the number of blocks a syncing node may lag behind before it's considered out of sync.
+	MaxLag uint64 `yaml:"max_lag"`
+	// ProgressLag is the lag in blocks from which on a node is considered doing its initial sync, 0 disables it.
+	// Instead of alerting it out of sync, a single progress message is updated every ProgressInterval, defaults to 5m.
+	ProgressLag      uint64   `yaml:"progress_lag"`
+	ProgressInterval Duration `yaml:"progress_interval"`
+}
+
+// PeersCheckConfig configures the peer count check.
+type PeersCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	MinPeers    uint64 `yaml:"min_peers"`
+}
+
+// DiskCheckConfig configures the disk usage check.
+type DiskCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// Threshold is the disk usage in percent at which an alert is sent.
+	Threshold float64 `yaml:"threshold"`
+}
+
+// ClockCheckConfig configures the check of the local clock.
+type ClockCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// MaxSkew is the maximum offset of the clock, defaults to 2s.
+	MaxSkew Duration `yaml:"max_skew"`
+	// NTPServer is the ntp server the clock is compared to, e.g. pool.ntp.org.
+	// The clock is compared to the blocks of the nodes if empty.
+	NTPServer string `yaml:"ntp_server"`
+}
+
+// BlobCheckConfig configures the check of the blob availability on the beacon nodes.
+type BlobCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// Failures is the number of checks in a row whose head block failed the data availability check before
+	// an alert is sent, defaults to 3.
+	Failures int `yaml:"failures"`
+}
+
+// BeaconSyncCheckConfig configures the check of the sync status of the beacon nodes.
+type BeaconSyncCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// MaxDistance is the sync distance in slots above which the beacon node is out of sync, defaults to 4.
+	MaxDistance uint64 `yaml:"max_distance"`
+}
+
+// FeeCheckConfig configures the fee check and its congestion alerts.
+type FeeCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// MaxBaseFee is the base fee in gwei above which the network is congested, 0 disables it.
+	MaxBaseFee float64 `yaml:"max_base_fee"`
+	// MaxPending is the number of pending transactions in the txpool of the node above which it's congested,
+	// 0 disables it. It requires the txpool api.
+	MaxPending uint64 `yaml:"max_pending"`
+	// Accounts are the addresses of the operational transactions. The node is congested once the next transaction of
+	// an account is pending for longer than MaxInclusionDelay, defaults to 5m.
+	Accounts          []string `yaml:"accounts"`
+	MaxInclusionDelay Duration `yaml:"max_inclusion_delay"`
+}
+
+// SyncCommitteeCheckConfig configures the check of the sync committee participation.
+type SyncCommitteeCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// MinParticipation is the participation in percent below which a validator is alerted, defaults to 95.
+	MinParticipation float64 `yaml:"min_participation"`
+	// Window is the number of head blocks the participation is computed over, defaults to 32.
+	Window int `yaml:"window"`
+}
+
+// CheckpointCheckConfig configures the verification of the checkpoints of the beacon nodes.
+type CheckpointCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// Trusted are the beacon node apis the checkpoints are verified against, e.g. of beacon nodes synced from genesis.
+	Trusted []string `yaml:"trusted"`
+}
+
+// ExplorerCheckConfig configures the cross-check of the nodes against block explorers.
+type ExplorerCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	Etherscan   EtherscanConfig   `yaml:"etherscan"`
+	Beaconchain BeaconchainConfig `yaml:"beaconchain"`
+}
+
+// EtherscanConfig configures the comparison of the head blocks with etherscan, it's disabled without api key.
+type EtherscanConfig struct {
+	// URL is the api of etherscan, defaults to DefaultEtherscanURL.
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	// ChainID is the chain of the explorer, defaults to 1. Only the nodes of the chain are compared.
+	ChainID uint64 `yaml:"chain_id"`
+	// MaxLag is the number of blocks a node may be behind etherscan, defaults to 10.
+	MaxLag uint64 `yaml:"max_lag"`
+}
+
+// BeaconchainConfig configures the check of the attestation effectiveness of the validators on beaconcha.in,
+// it's disabled without MinEffectiveness.
+type BeaconchainConfig struct {
+	// URL is the api of beaconcha.in, defaults to DefaultBeaconchainURL.
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	// MinEffectiveness is the attestation effectiveness in percent below which a validator is alerted.
+	MinEffectiveness float64 `yaml:"min_effectiveness"`
+}
+
+// EngineCheckConfig configures the check of the engine api capabilities.
+type EngineCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	// Methods are the engine api methods the consensus client expects, defaults to DefaultEngineMethods.
+	// Add those of the next fork ahead of it.
+	Methods []string `yaml:"methods"`
+	// ForkTime is the time of the fork the methods are required from, e.g. 2025-05-07T10:05:11Z. The missing methods
+	// are a warning until then and critical afterwards, always a warning if it's zero.
+	ForkTime time.Time `yaml:"fork_time"`
+}
+
+// ExecCheckConfig configures an external check command, see ExecCheck.
+type ExecCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	Name        string `yaml:"name"`
+	// Command is the command and its arguments.
+	Command []string `yaml:"command"`
+	// Nodes limits the check to the nodes with these names, it runs for all nodes if empty.
+	Nodes []string `yaml:"nodes"`
+}
+
+// ReconnectConfig configures how broken connections to the nodes are re-established.
+type ReconnectConfig struct {
+	// MinBackoff and MaxBackoff bound the exponential backoff between attempts.
+	MinBackoff Duration `yaml:"min_backoff"`
+	MaxBackoff Duration `yaml:"max_backoff"`
+	// AlertAfter is the time reconnecting may fail before an alert is sent, 0 disables the alert.
+	AlertAfter Duration `yaml:"alert_after"`
+}
+
+// SchedulerConfig bounds the number of checks running at the same time.
+type SchedulerConfig struct {
+	// Workers is the number of checks running at the same time, defaults to 8.
+	Workers int `yaml:"workers"`
+	// PerNode is the number of checks of a single node running at the same time, defaults to 2.
+	PerNode int `yaml:"per_node"`
+}
+
+// Duration is a time.Duration which can be unmarshaled from strings like 5s.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Finalize applies the defaults of the shared settings.
+func (c *CheckConfig) Finalize() {
+	if c.Timeout <= 0 {
+		c.Timeout = c.Interval
+	}
+	if c.Retries == 0 {
+		c.Retries = 2
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *SyncCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.Interval <= 0 {
+		return errors.New("sync check interval must be greater than 0")
+	}
+	if c.ReportInterval <= c.Interval {
+		return errors.New("report interval must be greater than check interval")
+	}
+	if c.RecoveryChecks == 0 {
+		c.RecoveryChecks = 1
+	}
+	if c.RecoveryChecks < 1 {
+		return errors.New("recovery checks must be at least 1")
+	}
+	if c.ProgressLag > 0 && c.ProgressLag <= c.MaxLag {
+		return errors.New("progress lag must be greater than max lag")
+	}
+	if c.ProgressInterval <= 0 {
+		c.ProgressInterval = Duration(5 * time.Minute)
+	}
+	return nil
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *DiskCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.Interval > 0 && (c.Threshold <= 0 || c.Threshold > 100) {
+		return errors.New("disk check threshold must be between 0 and 100")
+	}
+	return nil
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *FeeCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.MaxBaseFee < 0 {
+		return errors.New("fee check max base fee must not be negative")
+	}
+	for _, a := range c.Accounts {
+		if !common.IsHexAddress(a) {
+			return fmt.Errorf("fee check: invalid account %q", a)
+		}
+	}
+	if c.MaxInclusionDelay <= 0 {
+		c.MaxInclusionDelay = Duration(5 * time.Minute)
+	}
+	return nil
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *SyncCommitteeCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.MinParticipation == 0 {
+		c.MinParticipation = 95
+	}
+	if c.MinParticipation < 0 || c.MinParticipation > 100 {
+		return errors.New("sync committee check min participation must be between 0 and 100")
+	}
+	if c.Window <= 0 {
+		c.Window = 32
+	}
+	return nil
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *CheckpointCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.Interval > 0 && len(c.Trusted) == 0 {
+		return errors.New("checkpoint check: missing trusted sources")
+	}
+	for _, u := range c.Trusted {
+		if !isHTTP(u) {
+			return errors.New("checkpoint check: only http trusted sources are supported")
+		}
+	}
+	return nil
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *ExplorerCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.Etherscan.URL == "" {
+		c.Etherscan.URL = DefaultEtherscanURL
+	}
+	if c.Etherscan.ChainID == 0 {
+		c.Etherscan.ChainID = 1
+	}
+	if c.Etherscan.MaxLag == 0 {
+		c.Etherscan.MaxLag = 10
+	}
+	if c.Beaconchain.URL == "" {
+		c.Beaconchain.URL = DefaultBeaconchainURL
+	}
+	if c.Beaconchain.MinEffectiveness < 0 || c.Beaconchain.MinEffectiveness > 100 {
+		return errors.New("explorer check: min effectiveness must be between 0 and 100")
+	}
+	if c.Interval > 0 && c.Etherscan.APIKey == "" && c.Beaconchain.MinEffectiveness == 0 {
+		return errors.New("explorer check: neither an etherscan api key nor a beaconcha.in min effectiveness")
+	}
+	return nil
+}
+
+// Finalize applies the defaults.
+func (c *EngineCheckConfig) Finalize() {
+	c.CheckConfig.Finalize()
+	if len(c.Methods) == 0 {
+		c.Methods = DefaultEngineMethods
+	}
+}
+
+// Finalize applies the defaults.
+func (c *BlobCheckConfig) Finalize() {
+	c.CheckConfig.Finalize()
+	if c.Failures <= 0 {
+		c.Failures = 3
+	}
+}
+
+// Finalize applies the defaults.
+func (c *BeaconSyncCheckConfig) Finalize() {
+	c.CheckConfig.Finalize()
+	if c.MaxDistance == 0 {
+		c.MaxDistance = 4
+	}
+}
+
+// Finalize applies the defaults.
+func (c *ClockCheckConfig) Finalize() {
+	c.CheckConfig.Finalize()
+	if c.MaxSkew <= 0 {
+		c.MaxSkew = Duration(2 * time.Second)
+	}
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *ReconnectConfig) Finalize() error {
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = Duration(time.Second)
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = Duration(time.Minute)
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		return errors.New("reconnect max backoff must not be smaller than the min backoff")
+	}
+	return nil
+}
+
+// Finalize applies the defaults.
+func (c *SchedulerConfig) Finalize() {
+	if c.Workers <= 0 {
+		c.Workers = 8
+	}
+	if c.PerNode <= 0 {
+		c.PerNode = 2
+	}
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *ExecCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	if c.Name == "" {
+		return errors.New("exec check: missing name")
+	}
+	if len(c.Command) == 0 {
+		return fmt.Errorf("exec check %s: missing command", c.Name)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("exec check %s: interval must be greater than 0", c.Name)
+	}
+	return nil
+}
+
+// Runs reports whether the check runs for the node with the given name.
+func (c *ExecCheckConfig) Runs(node string) bool {
+	if len(c.Nodes) == 0 {
+		return true
+	}
+	for _, n := range c.Nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,374 @@
+package insync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// reconnectAfter is the number of consecutive connection errors after which the node is re-dialed.
+const reconnectAfter = 3
+
+// dialTimeout is the timeout of a single connection attempt.
+const dialTimeout = 10 * time.Second
+
+// notConnectedError is returned while there is no connection to the node, it wraps the last dial error.
+type notConnectedError struct {
+	err error
+}
+
+func (e notConnectedError) Error() string {
+	return "not connected: " + e.err.Error()
+}
+
+func (e notConnectedError) Unwrap() error {
+	return e.err
+}
+
+// dial connects to the node and replaces the current connection. If the primary endpoint can't be reached,
+// the fallbacks are tried in order. The error of the primary endpoint is returned if none of them can be reached.
+func (n *Node) dial() error {
+	c, err := n.dialEndpoint(n.url)
+	endpoint, primaryErr := 0, err
+	for i := 0; err != nil && i < len(n.fallbacks); i++ {
+		var ferr error
+		if c, ferr = n.dialEndpoint(n.fallbacks[i]); ferr == nil {
+			endpoint, err = i+1, nil
+		} else {
+			slog.Warn("error connecting to fallback", "node", n.name, "fallback", NodeName(n.fallbacks[i]), "err", ferr)
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.dialErr = err
+		return err
+	}
+	n.replace(c, endpoint, primaryErr)
+	return nil
+}
+
+// dialEndpoint connects to the endpoint. If the node has fallbacks, the endpoint is probed,
+// http endpoints aren't connected to before the first call.
+func (n *Node) dialEndpoint(rawURL string) (*rpc.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	c, err := n.dialRPC(ctx, rawURL)
+	if err != nil || len(n.fallbacks) == 0 {
+		return c, err
+	}
+	var res json.RawMessage
+	if err := c.CallContext(ctx, &res, "eth_syncing"); err != nil && !answered(err) {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// replace replaces the current connection. n.mu must be held.
+func (n *Node) replace(c *rpc.Client, endpoint int, primaryErr error) {
+	if n.rpc != nil {
+		n.rpc.Close()
+	}
+	n.rpc, n.client, n.dialErr, n.failures = c, ethclient.NewClient(c), nil, 0
+	n.endpoint, n.primaryErr, n.pinned = endpoint, primaryErr, false
+}
+
+// HasFallbacks reports whether the node has fallback endpoints.
+func (n *Node) HasFallbacks() bool {
+	return len(n.fallbacks) > 0
+}
+
+// SwitchEndpoint connects to the next endpoint of the node and returns its host: the first fallback from the primary url,
+// the primary url from the last fallback. The node stays on a fallback until it's switched again or its connection breaks.
+func (n *Node) SwitchEndpoint() (string, error) {
+	if len(n.fallbacks) == 0 {
+		return "", errors.New("the node has no fallback endpoints")
+	}
+	n.mu.Lock()
+	next := (n.endpoint + 1) % (len(n.fallbacks) + 1)
+	n.mu.Unlock()
+	u := n.url
+	if next > 0 {
+		u = n.fallbacks[next-1]
+	}
+	c, err := n.dialEndpoint(u)
+	if err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	n.replace(c, next, errors.New("switched manually"))
+	n.pinned = next > 0
+	n.mu.Unlock()
+	n.resetIdentity()
+	slog.Info("switched endpoint", "node", n.name, "endpoint", NodeName(u))
+	return NodeName(u), nil
+}
+
+// fallback returns the host of the fallback the node is monitored through and the error of the primary endpoint,
+// an empty host while the primary endpoint is used.
+func (n *Node) fallback() (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.endpoint == 0 {
+		return "", nil
+	}
+	return NodeName(n.fallbacks[n.endpoint-1]), n.primaryErr
+}
+
+// answered reports whether the error is an answer of the node, like an error response, rather than a connection error.
+func answered(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassConnRefused, ErrorClassTimeout, ErrorClassOther:
+		return false
+	}
+	return true
+}
+
+// close closes the connection of a removed node.
+func (n *Node) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.rpc != nil {
+		n.rpc.Close()
+	}
+	n.rpc, n.client, n.dialErr = nil, nil, errors.New("the node was removed")
+}
+
+// Close closes the connection of a node which isn't monitored, e.g. one probed before it's added.
+func (n *Node) Close() {
+	n.close()
+}
+
+// conn returns the current connection, or an error wrapping the last dial error if there is none.
+func (n *Node) conn() (*ethclient.Client, *rpc.Client, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.rpc == nil {
+		return nil, nil, notConnectedError{err: n.dialErr}
+	}
+	return n.client, n.rpc, nil
+}
+
+// LastError returns the error of the last call, or why there is no connection.
+func (n *Node) LastError() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.rpc == nil {
+		return notConnectedError{err: n.dialErr}
+	}
+	return n.err
+}
+
+// syncProgress returns the sync progress of the node, nil if it's in sync.
+func (n *Node) syncProgress(ctx context.Context, p retryPolicy) (*ethereum.SyncProgress, error) {
+	c, _, err := n.conn()
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := n.rpcSpan(ctx, "eth_syncing")
+	defer span.End()
+	var sync *ethereum.SyncProgress
+	err = p.do(ctx, func(ctx context.Context) error {
+		var err error
+		start := time.Now()
+		sync, err = c.SyncProgress(ctx)
+		n.logCall("eth_syncing", nil, sync, time.Since(start), err)
+		if err == nil {
+			n.setLatency(time.Since(start))
+		}
+		return err
+	})
+	n.report(err)
+	span.SetError(err)
+	return sync, err
+}
+
+// call performs a raw rpc call.
+func (n *Node) call(ctx context.Context, p retryPolicy, result interface{}, method string, args ...interface{}) error {
+	_, c, err := n.conn()
+	if err != nil {
+		return err
+	}
+	ctx, span := n.rpcSpan(ctx, method)
+	defer span.End()
+	err = p.do(ctx, func(ctx context.Context) error {
+		start := time.Now()
+		err := c.CallContext(ctx, result, method, args...)
+		n.logCall(method, args, result, time.Since(start), err)
+		return err
+	})
+	n.report(err)
+	span.SetError(err)
+	return err
+}
+
+// rpcSpan starts the span of an rpc call, including its retries.
+func (n *Node) rpcSpan(ctx context.Context, method string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, method, tracing.KindClient)
+	span.SetAttributes("node", n.name, "rpc.system", "jsonrpc", "rpc.method", method)
+	return ctx, span
+}
+
+// report records the result of a call, after all retries. Repeated connection errors mark the connection as broken,
+// a stale websocket connection for example doesn't recover on its own.
+func (n *Node) report(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.err = err
+	if err == nil || answered(err) {
+		// the node answered, so the connection is fine
+		n.failures = 0
+		return
+	}
+	n.failures++
+	if n.failures == reconnectAfter {
+		select {
+		case n.broken <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// maintain re-dials the node with exponential backoff whenever its connection is broken.
+// If reconnecting fails for longer than the configured time, an alert is sent.
+// While the node is monitored through a fallback, the primary endpoint is retried every max backoff.
+func (n *Node) maintain(ctx context.Context, nf Notifier, cfg ReconnectConfig) {
+	b := backoff{min: time.Duration(cfg.MinBackoff), max: time.Duration(cfg.MaxBackoff)}
+	// the node might have been connected to a fallback right away
+	n.reportFallback(nf, "")
+	var retry <-chan time.Time
+	if len(n.fallbacks) > 0 {
+		t := time.NewTicker(time.Duration(cfg.MaxBackoff))
+		defer t.Stop()
+		retry = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry:
+			n.restorePrimary(nf)
+			continue
+		case <-n.broken:
+		}
+		previous, _ := n.fallback()
+		slog.Info("reconnecting", "node", n.name)
+		since := time.Now()
+		var alerted bool
+		for attempt := 0; ; attempt++ {
+			err := n.dial()
+			if err == nil {
+				break
+			}
+			slog.Warn("error reconnecting", "node", n.name, "class", ClassifyError(err).String(), "err", err)
+			if d := time.Since(since); !alerted && cfg.AlertAfter > 0 && d >= time.Duration(cfg.AlertAfter) {
+				alerted = true
+				sendAlert(nf, Alert{
+					Node:     n.name,
+					Summary:  "failing to reconnect",
+					Name:     "NodeReconnectFailing",
+					Key:      "connection",
+					Icon:     "⚠️",
+					Severity: SeverityWarning,
+					Text:     fmt.Sprintf("⚠️ %s: reconnecting failed for %s (%s)\nLast error: %s\n", n.name, FormatDuration(d), ClassifyError(err), err),
+				})
+			}
+			if !b.sleep(ctx, attempt) {
+				return
+			}
+		}
+		slog.Info("reconnected", "node", n.name)
+		n.resetIdentity()
+		n.reportFallback(nf, previous)
+		if alerted {
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "reconnected",
+				Name:     "NodeReconnectFailing",
+				Key:      "connection",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s: reconnected after %s", n.name, FormatDuration(time.Since(since))),
+			})
+		}
+	}
+}
+
+// reportFallback alerts if the node is monitored through another endpoint than before reconnecting.
+func (n *Node) reportFallback(nf Notifier, previous string) {
+	host, primaryErr := n.fallback()
+	switch {
+	case host == previous:
+	case host == "":
+		n.sendPrimaryRestored(nf)
+	default:
+		slog.Warn("monitoring through fallback", "node", n.name, "fallback", host, "err", primaryErr)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "monitored through a fallback",
+			Name:     "NodeFallback",
+			Key:      "endpoint",
+			Icon:     "⚠️",
+			Severity: SeverityWarning,
+			Text:     fmt.Sprintf("⚠️ %s: the primary endpoint is unreachable, monitoring through the fallback %s\nLast error: %s\n", n.name, host, primaryErr),
+		})
+	}
+}
+
+// restorePrimary switches back to the primary endpoint if the node is monitored through a fallback
+// and the primary endpoint can be reached again. Fallbacks chosen with SwitchEndpoint are kept.
+func (n *Node) restorePrimary(nf Notifier) {
+	n.mu.Lock()
+	skip := n.endpoint == 0 || n.pinned
+	n.mu.Unlock()
+	if skip {
+		return
+	}
+	c, err := n.dialEndpoint(n.url)
+	if err != nil {
+		slog.Debug("primary endpoint still unreachable", "node", n.name, "err", err)
+		return
+	}
+	n.mu.Lock()
+	if n.endpoint == 0 || n.pinned {
+		// reconnected to the primary endpoint or switched manually meanwhile
+		n.mu.Unlock()
+		c.Close()
+		return
+	}
+	n.replace(c, 0, nil)
+	n.mu.Unlock()
+	n.resetIdentity()
+	n.sendPrimaryRestored(nf)
+}
+
+func (n *Node) sendPrimaryRestored(nf Notifier) {
+	slog.Info("switched back to the primary endpoint", "node", n.name)
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "monitored through the primary endpoint again",
+		Name:     "NodeFallback",
+		Key:      "endpoint",
+		Resolved: true,
+		Icon:     "🟢",
+		Severity: SeverityInfo,
+		Text:     fmt.Sprintf("🟢 %s: the primary endpoint is reachable again, switched back from the fallback", n.name),
+	})
+}
+
+func sendAlert(nf Notifier, a Alert) {
+	if err := nf.Send(a); err != nil {
+		slog.Error("error sending message", "node", a.Node, "alert", a.Name, "err", err)
+	}
+}
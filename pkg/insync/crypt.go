@@ -0,0 +1,158 @@
+package insync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedMagic prefixes the encrypted data, followed by the salt of the key, the nonce and the ciphertext.
+// Json never starts with a zero byte, so unencrypted data of older versions is told apart.
+var encryptedMagic = []byte("\x00insync1")
+
+const saltSize = 16
+
+// ErrEncrypted is returned when reading encrypted data without a key.
+var ErrEncrypted = errors.New("the data is encrypted, configure the passphrase or key file")
+
+// EncryptionConfig configures the encryption at rest of the state file and the history, it's disabled if empty.
+type EncryptionConfig struct {
+	Passphrase string `yaml:"passphrase"`
+	// KeyFile is a file containing the secret, e.g. generated with openssl rand -hex 32.
+	KeyFile string `yaml:"key_file"`
+}
+
+// Finalize validates the config.
+func (c *EncryptionConfig) Finalize() error {
+	if c.Passphrase != "" && c.KeyFile != "" {
+		return errors.New("encryption: passphrase and key_file are mutually exclusive")
+	}
+	return nil
+}
+
+// Cipher returns the cipher of the configured secret, nil if the encryption is disabled.
+func (c EncryptionConfig) Cipher() (*Cipher, error) {
+	secret := c.Passphrase
+	if c.KeyFile != "" {
+		data, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if secret = strings.TrimSpace(string(data)); secret == "" {
+			return nil, fmt.Errorf("the key file %s is empty", c.KeyFile)
+		}
+	}
+	if secret == "" {
+		return nil, nil
+	}
+	return NewCipher([]byte(secret))
+}
+
+// Cipher encrypts data with AES-256-GCM, using a key derived from the secret with scrypt.
+// A nil Cipher passes the data through unencrypted.
+type Cipher struct {
+	secret []byte
+	salt   []byte
+	aead   cipher.AEAD
+
+	mu sync.Mutex
+	// keys are the keys derived for the salts of data written with other salts, e.g. before a restart.
+	keys map[string]cipher.AEAD
+}
+
+// NewCipher derives a key with a random salt from the secret.
+func NewCipher(secret []byte) (*Cipher, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{
+		secret: secret,
+		salt:   salt,
+		aead:   aead,
+		keys:   map[string]cipher.AEAD{string(salt): aead},
+	}, nil
+}
+
+func deriveKey(secret, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts the data.
+func (c *Cipher) Seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		// the system's random number generator is broken, there is no sane way to continue
+		panic(err)
+	}
+	out := make([]byte, 0, len(encryptedMagic)+len(c.salt)+len(nonce)+len(data)+c.aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, c.salt...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, data, nil)
+}
+
+// Open decrypts the data, unencrypted data is returned as is.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrEncrypted
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < saltSize {
+		return nil, errors.New("truncated encrypted data")
+	}
+	aead, err := c.key(data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("truncated encrypted data")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("error decrypting data, wrong passphrase or key file?")
+	}
+	return plain, nil
+}
+
+// key returns the key of the salt, deriving it once.
+func (c *Cipher) key(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aead, ok := c.keys[string(salt)]; ok {
+		return aead, nil
+	}
+	aead, err := deriveKey(c.secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	c.keys[string(salt)] = aead
+	return aead, nil
+}
@@ -0,0 +1,81 @@
+package insync
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	c, err := NewCipher([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCipher([]byte("other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a cipher with the same secret derives another salt, e.g. after a restart
+	restarted, err := NewCipher([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"node":"node-1"}`)
+	sealed := c.Seal(plain)
+	tests := []struct {
+		name    string
+		cipher  *Cipher
+		data    []byte
+		want    []byte
+		wantErr error
+		fails   bool
+	}{
+		{name: "round trip", cipher: c, data: sealed, want: plain},
+		{name: "other salt", cipher: restarted, data: sealed, want: plain},
+		{name: "wrong key", cipher: other, data: sealed, fails: true},
+		{name: "no key", data: sealed, wantErr: ErrEncrypted, fails: true},
+		{name: "plaintext passthrough", cipher: c, data: plain, want: plain},
+		{name: "plaintext passthrough without key", data: plain, want: plain},
+		{name: "truncated", cipher: c, data: sealed[:len(encryptedMagic)+saltSize/2], fails: true},
+		{name: "tampered", cipher: c, data: append(append([]byte(nil), sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1), fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cipher.Open(tt.data)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCipherSeal(t *testing.T) {
+	c, err := NewCipher([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"node":"node-1"}`)
+	a, b := c.Seal(plain), c.Seal(plain)
+	if !bytes.HasPrefix(a, encryptedMagic) || bytes.Contains(a, plain) {
+		t.Fatalf("got %q, want encrypted data", a)
+	}
+	if bytes.Equal(a, b) {
+		t.Fatal("got the same ciphertext twice, want a fresh nonce")
+	}
+	var none *Cipher
+	if got := none.Seal(plain); !bytes.Equal(got, plain) {
+		t.Fatalf("got %q, want the data unencrypted without a key", got)
+	}
+}
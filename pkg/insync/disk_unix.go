@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package insync
+
+import "syscall"
+
+// diskUsage returns the used space of the filesystem containing path in percent.
+func diskUsage(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	total := st.Blocks * uint64(st.Bsize)
+	if total == 0 {
+		return 0, nil
+	}
+	avail := st.Bavail * uint64(st.Bsize)
+	return float64(total-avail) / float64(total) * 100, nil
+}
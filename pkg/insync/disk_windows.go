@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package insync
+
+import "golang.org/x/sys/windows"
+
+// diskUsage returns the used space of the volume containing path in percent.
+func diskUsage(path string) (float64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, &free); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(total-avail) / float64(total) * 100, nil
+}
@@ -0,0 +1,23 @@
+// Package insync monitors the sync state of geth nodes.
+//
+// A Monitor runs the checks of its nodes, e.g. a SyncCheck, and sends the resulting
+// alerts to a Notifier. Telegram, alertmanager and pagerduty notifiers live in their
+// own packages, so insync can be embedded without any of them:
+//
+//	store, _ := insync.LoadState("")
+//	n := insync.NewNode(insync.NodeConfig{Name: "node-1", URL: "http://localhost:8545"}, store.Incident("node-1"))
+//	cfg := insync.SyncCheckConfig{ReportInterval: insync.Duration(5 * time.Minute)}
+//	cfg.Interval = insync.Duration(15 * time.Second)
+//	if err := cfg.Finalize(); err != nil {
+//		log.Fatal(err)
+//	}
+//	var reconnect insync.ReconnectConfig
+//	_ = reconnect.Finalize()
+//	var scheduler insync.SchedulerConfig
+//	scheduler.Finalize()
+//	m := insync.NewMonitor(myNotifier, reconnect, scheduler)
+//	m.AddNode(n, insync.NewSyncCheck(n, cfg, time.Hour))
+//	m.Run(ctx)
+//
+// Any type with a Send(Alert) error method is a Notifier, Notifiers fans an alert out to several of them.
+package insync
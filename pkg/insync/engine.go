@@ -0,0 +1,115 @@
+package insync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultEngineMethods are the engine api methods the consensus clients expect since prague.
+var DefaultEngineMethods = []string{
+	"engine_newPayloadV4",
+	"engine_forkchoiceUpdatedV3",
+	"engine_getPayloadV4",
+	"engine_getBlobsV1",
+}
+
+// EngineCheck compares the engine api capabilities of the node to the methods the consensus client expects, with
+// engine_exchangeCapabilities. It warns about missing methods ahead of a fork and is critical once the fork passed.
+// Only nodes monitored through the engine api, i.e. with a jwt secret, are checked.
+type EngineCheck struct {
+	n     *Node
+	cfg   EngineCheckConfig
+	retry retryPolicy
+	// alerted are the missing methods alerted last, suffixed if the fork passed. It's empty if none are missing.
+	alerted string
+}
+
+// NewEngineCheck creates the engine api check of the node.
+func NewEngineCheck(n *Node, cfg EngineCheckConfig) *EngineCheck {
+	return &EngineCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg.CheckConfig), alerted: n.checkState("engine")}
+}
+
+func (c *EngineCheck) Name() string { return "engine" }
+
+func (c *EngineCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *EngineCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var supported []string
+	err := n.call(ctx, c.retry, &supported, "engine_exchangeCapabilities", c.cfg.Methods)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error exchanging engine capabilities", "node", n.name, "check", "engine", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("engine", "error", err.Error())
+		n.countCheckError("engine")
+		return
+	}
+	missing := missingMethods(c.cfg.Methods, supported)
+	if len(missing) == 0 {
+		n.recordResult("engine", "ok", fmt.Sprintf("%d methods supported", len(c.cfg.Methods)))
+		if c.alerted != "" {
+			slog.Info("engine api capabilities complete", "node", n.name, "check", "engine")
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "supports the engine api methods again",
+				Name:     "NodeEngineCapabilities",
+				Key:      "engine",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s supports all engine api methods the consensus client expects", n.name),
+			})
+			c.alerted = ""
+			n.setCheckState("engine", "")
+		}
+		return
+	}
+	list := strings.Join(missing, ", ")
+	n.recordResult("engine", "missing", list)
+	alerted, severity, icon, when := list, SeverityWarning, "🟠", ""
+	if fork := c.cfg.ForkTime; !fork.IsZero() {
+		if left := time.Until(fork); left > 0 {
+			when = fmt.Sprintf(", the fork is in %s", FormatDuration(left))
+		} else {
+			// alerted again once the fork passed
+			alerted, severity, icon, when = list+" after the fork", SeverityCritical, "🔴", ", the fork already passed"
+		}
+	}
+	if alerted == c.alerted {
+		return
+	}
+	slog.Warn("engine api methods missing", "node", n.name, "check", "engine", "missing", list)
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "missing engine api methods",
+		Name:     "NodeEngineCapabilities",
+		Key:      "engine",
+		Icon:     icon,
+		Severity: severity,
+		Text:     fmt.Sprintf("%s %s doesn't support the engine api methods %s%s. Upgrade the execution client.", icon, n.name, list, when),
+	})
+	c.alerted = alerted
+	n.setCheckState("engine", alerted)
+}
+
+// missingMethods returns the expected methods which aren't supported, sorted.
+func missingMethods(expected, supported []string) []string {
+	have := make(map[string]bool, len(supported))
+	for _, m := range supported {
+		have[m] = true
+	}
+	var missing []string
+	for _, m := range expected {
+		if !have[m] {
+			missing = append(missing, m)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
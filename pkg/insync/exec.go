@@ -0,0 +1,180 @@
+package insync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxExecOutput is the maximum length of the command output included in an alert.
+const maxExecOutput = 1024
+
+// ExecStatus is the result of an exec check.
+type ExecStatus int
+
+// The exec statuses follow the exit codes of nagios plugins.
+const (
+	ExecOK ExecStatus = iota
+	ExecWarning
+	ExecCritical
+	ExecUnknown
+)
+
+var execStatusNames = map[ExecStatus]string{
+	ExecOK:       "ok",
+	ExecWarning:  "warning",
+	ExecCritical: "critical",
+	ExecUnknown:  "unknown",
+}
+
+func (s ExecStatus) String() string {
+	return execStatusNames[s]
+}
+
+// execResult is the json a command may print instead of relying on its exit code.
+type execResult struct {
+	Status  string `json:"status"`
+	Summary string `json:"summary"`
+	Message string `json:"message"`
+}
+
+// ExecCheck runs an external command and alerts once its result changes.
+//
+// The command gets the name and url of the node in the environment variables INSYNC_NODE and INSYNC_NODE_URL.
+// Its exit code is interpreted like a nagios plugin: 0 ok, 1 warning, 2 critical, anything else unknown.
+// Alternatively, it may print a json object like {"status": "critical", "summary": "head is stale", "message": "..."}.
+type ExecCheck struct {
+	n      *Node
+	cfg    ExecCheckConfig
+	status ExecStatus
+}
+
+// NewExecCheck creates the exec check of the node.
+func NewExecCheck(n *Node, cfg ExecCheckConfig) *ExecCheck {
+	c := &ExecCheck{n: n, cfg: cfg}
+	if prev := n.checkState(c.key()); prev != "" {
+		for status, name := range execStatusNames {
+			if name == prev {
+				c.status = status
+			}
+		}
+	}
+	return c
+}
+
+// key is the alert key of the check.
+func (c *ExecCheck) key() string { return "exec_" + c.cfg.Name }
+
+func (c *ExecCheck) Name() string { return c.cfg.Name }
+
+func (c *ExecCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *ExecCheck) Run(ctx context.Context, nf Notifier) {
+	status, summary, msg := c.exec(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	c.n.recordResult(c.key(), status.String(), summary)
+	if status == ExecUnknown {
+		c.n.countCheckError(c.key())
+	}
+	if status == c.status {
+		return
+	}
+	prev := c.status
+	c.status = status
+	n := c.n
+	if status == ExecOK {
+		n.setCheckState(c.key(), "")
+	} else {
+		n.setCheckState(c.key(), status.String())
+	}
+	slog.Info("check status changed", "node", n.name, "check", c.cfg.Name, "from", prev, "to", status)
+	a := Alert{
+		Node: n.name,
+		Name: "NodeCheckFailed",
+		Key:  c.key(),
+	}
+	switch status {
+	case ExecOK:
+		a.Icon, a.Severity, a.Resolved = "🟢", SeverityInfo, true
+		a.Summary = fmt.Sprintf("passing the %s check again", c.cfg.Name)
+	case ExecCritical:
+		a.Icon, a.Severity = "🔴", SeverityCritical
+	default:
+		a.Icon, a.Severity = "🟠", SeverityWarning
+	}
+	if a.Summary == "" {
+		a.Summary = fmt.Sprintf("failing the %s check", c.cfg.Name)
+		if summary != "" {
+			a.Summary = summary
+		}
+	}
+	a.Text = fmt.Sprintf("%s %s: %s check is %s\n", a.Icon, n.name, c.cfg.Name, status)
+	if summary != "" {
+		a.Text += summary + "\n"
+	}
+	if msg != "" {
+		a.Text += msg + "\n"
+	}
+	sendAlert(nf, a)
+}
+
+// exec runs the command and returns its status, summary and message.
+func (c *ExecCheck) exec(ctx context.Context) (ExecStatus, string, string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.cfg.Timeout))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.cfg.Command[0], c.cfg.Command[1:]...)
+	cmd.Env = append(os.Environ(), "INSYNC_NODE="+c.n.name, "INSYNC_NODE_URL="+c.n.url)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	var res execResult
+	if json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &res) == nil && res.Status != "" {
+		for s, name := range execStatusNames {
+			if strings.EqualFold(res.Status, name) {
+				return s, res.Summary, truncate(res.Message, maxExecOutput)
+			}
+		}
+		return ExecUnknown, res.Summary, fmt.Sprintf("invalid status %q", res.Status)
+	}
+
+	out := strings.TrimSpace(stdout.String())
+	if out == "" {
+		out = strings.TrimSpace(stderr.String())
+	}
+	out = truncate(out, maxExecOutput)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return ExecOK, "", out
+	case ctx.Err() == context.DeadlineExceeded:
+		return ExecUnknown, "", "timed out after " + FormatDuration(time.Duration(c.cfg.Timeout))
+	case errors.As(err, &exitErr):
+		switch exitErr.ExitCode() {
+		case 1:
+			return ExecWarning, "", out
+		case 2:
+			return ExecCritical, "", out
+		}
+		return ExecUnknown, "", out
+	default:
+		return ExecUnknown, "", err.Error()
+	}
+}
+
+// truncate shortens s to at most max bytes.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "…"
+}
@@ -0,0 +1,253 @@
+package insync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Default apis of the explorers.
+const (
+	DefaultEtherscanURL   = "https://api.etherscan.io/v2/api"
+	DefaultBeaconchainURL = "https://beaconcha.in"
+)
+
+// ExplorerCheck cross-checks the self-report of the node against the public view of block explorers: the head block
+// of a node in sync against that of etherscan, and the attestation effectiveness of its validators on beaconcha.in.
+// Each discrepancy is alerted as a warning, the errors of the explorers are only logged.
+type ExplorerCheck struct {
+	n     *Node
+	cfg   ExplorerCheckConfig
+	retry retryPolicy
+	// behind and ineffective are set while the discrepancies are alerted.
+	behind, ineffective bool
+}
+
+// NewExplorerCheck creates the explorer check of the node.
+func NewExplorerCheck(n *Node, cfg ExplorerCheckConfig) *ExplorerCheck {
+	return &ExplorerCheck{
+		n:           n,
+		cfg:         cfg,
+		retry:       newRetryPolicy(cfg.CheckConfig),
+		behind:      n.checkState("explorer_head") == "behind",
+		ineffective: n.checkState("explorer_effectiveness") == "low",
+	}
+}
+
+func (c *ExplorerCheck) Name() string { return "explorer" }
+
+func (c *ExplorerCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *ExplorerCheck) Run(ctx context.Context, nf Notifier) {
+	if c.cfg.Etherscan.APIKey != "" {
+		c.checkHead(ctx, nf)
+	}
+	if c.cfg.Beaconchain.MinEffectiveness > 0 && len(c.n.validators) > 0 {
+		c.checkEffectiveness(ctx, nf)
+	}
+}
+
+// checkHead compares the head block of the node to that of etherscan, while the node considers itself in sync and is
+// on the chain of the explorer.
+func (c *ExplorerCheck) checkHead(ctx context.Context, nf Notifier) {
+	n := c.n
+	es := c.cfg.Etherscan
+	st := n.Status()
+	if (st.State != StateHealthy && st.State != StateDegraded) || st.Chain != ChainName(es.ChainID) {
+		// out of sync is alerted by the sync check
+		return
+	}
+	var head hexutil.Uint64
+	if err := n.call(ctx, c.retry, &head, "eth_blockNumber"); err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("error checking head block", "node", n.name, "check", "explorer", "err", err)
+		}
+		return
+	}
+	public, err := c.etherscanHead(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking the head block of etherscan", "node", n.name, "check", "explorer", "err", err)
+		n.recordResult("explorer", "error", err.Error())
+		return
+	}
+	var behind uint64
+	if public > uint64(head) {
+		behind = public - uint64(head)
+	}
+	status := "ok"
+	if behind > es.MaxLag {
+		status = "behind"
+	}
+	n.record(CheckResult{Check: "explorer", Status: status, Detail: fmt.Sprintf("block %d, etherscan %d", uint64(head), public), Value: float64(behind)})
+	switch {
+	case behind > es.MaxLag && !c.behind:
+		slog.Warn("behind the explorer", "node", n.name, "check", "explorer", "block", uint64(head), "etherscan", public)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "behind the public network",
+			Name:     "NodeExplorerMismatch",
+			Key:      "explorer_head",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text: fmt.Sprintf("🟠 %s reports to be in sync at block %s, but etherscan is %s blocks ahead at %s. Is it on a fork or cut off from its peers?",
+				n.name, FormatNumber(uint64(head)), FormatNumber(behind), FormatNumber(public)),
+		})
+		c.behind = true
+		n.setCheckState("explorer_head", "behind")
+	case behind <= es.MaxLag && c.behind:
+		slog.Info("caught up with the explorer", "node", n.name, "check", "explorer", "block", uint64(head))
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "in line with the public network",
+			Name:     "NodeExplorerMismatch",
+			Key:      "explorer_head",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s is in line with etherscan again at block %s", n.name, FormatNumber(uint64(head))),
+		})
+		c.behind = false
+		n.setCheckState("explorer_head", "")
+	}
+}
+
+// etherscanHead returns the head block of the chain according to etherscan.
+func (c *ExplorerCheck) etherscanHead(ctx context.Context) (uint64, error) {
+	es := c.cfg.Etherscan
+	q := url.Values{
+		"chainid": {strconv.FormatUint(es.ChainID, 10)},
+		"module":  {"proxy"},
+		"action":  {"eth_blockNumber"},
+		"apikey":  {es.APIKey},
+	}
+	var resp struct {
+		Result string `json:"result"`
+	}
+	if err := c.retry.do(ctx, func(ctx context.Context) error {
+		return getJSON(ctx, es.URL+"?"+q.Encode(), "", &resp)
+	}); err != nil {
+		return 0, err
+	}
+	head, err := hexutil.DecodeUint64(resp.Result)
+	if err != nil {
+		// e.g. the error message of an invalid api key
+		return 0, fmt.Errorf("unexpected response %q", resp.Result)
+	}
+	return head, nil
+}
+
+// checkEffectiveness alerts once the attestation effectiveness of a validator of the node on beaconcha.in is below
+// the threshold.
+func (c *ExplorerCheck) checkEffectiveness(ctx context.Context, nf Notifier) {
+	n := c.n
+	bc := c.cfg.Beaconchain
+	effectiveness, err := c.beaconchainEffectiveness(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking the attestation effectiveness on beaconcha.in", "node", n.name, "check", "explorer", "err", err)
+		n.recordResult("explorer", "error", err.Error())
+		return
+	}
+	var low []string
+	lowest := 100.0
+	for v, e := range effectiveness {
+		lowest = min(lowest, e)
+		if e < bc.MinEffectiveness {
+			low = append(low, fmt.Sprintf("validator %s %.1f%%", v, e))
+		}
+	}
+	sort.Strings(low)
+	switch {
+	case len(low) > 0 && !c.ineffective:
+		slog.Warn("low attestation effectiveness", "node", n.name, "check", "explorer", "effectiveness", fmt.Sprintf("%.1f%%", lowest))
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "low attestation effectiveness",
+			Name:     "NodeValidatorEffectiveness",
+			Key:      "explorer_effectiveness",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text: fmt.Sprintf("🟠 %s has a low attestation effectiveness on beaconcha.in: %s (threshold %.0f%%)",
+				n.name, strings.Join(low, ", "), bc.MinEffectiveness),
+		})
+		c.ineffective = true
+		n.setCheckState("explorer_effectiveness", "low")
+	case len(low) == 0 && len(effectiveness) > 0 && c.ineffective:
+		slog.Info("attestation effectiveness recovered", "node", n.name, "check", "explorer")
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "attestation effectiveness recovered",
+			Name:     "NodeValidatorEffectiveness",
+			Key:      "explorer_effectiveness",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s is back at an attestation effectiveness of at least %.1f%% on beaconcha.in", n.name, lowest),
+		})
+		c.ineffective = false
+		n.setCheckState("explorer_effectiveness", "")
+	}
+}
+
+// beaconchainEffectiveness returns the attestation effectiveness of the validators of the node on beaconcha.in in
+// percent, by validator index.
+func (c *ExplorerCheck) beaconchainEffectiveness(ctx context.Context) (map[string]float64, error) {
+	bc := c.cfg.Beaconchain
+	u := fmt.Sprintf("%s/api/v1/validator/%s/attestationeffectiveness", strings.TrimSuffix(bc.URL, "/"), url.PathEscape(strings.Join(c.n.validators, ",")))
+	if bc.APIKey != "" {
+		u += "?apikey=" + url.QueryEscape(bc.APIKey)
+	}
+	var resp struct {
+		Status string `json:"status"`
+		// an object for a single validator, an array otherwise
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.retry.do(ctx, func(ctx context.Context) error {
+		return getJSON(ctx, u, "", &resp)
+	}); err != nil {
+		return nil, err
+	}
+	if resp.Status != "OK" {
+		return nil, fmt.Errorf("status %q", resp.Status)
+	}
+	type validatorEffectiveness struct {
+		ValidatorIndex uint64  `json:"validatorindex"`
+		Effectiveness  float64 `json:"attestation_effectiveness"`
+	}
+	var validators []validatorEffectiveness
+	data := bytes.TrimSpace(resp.Data)
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		if err := json.Unmarshal(data, &validators); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(data, []byte("{")):
+		var v validatorEffectiveness
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		validators = append(validators, v)
+	default:
+		return nil, errors.New("no validators")
+	}
+	effectiveness := make(map[string]float64, len(validators))
+	for _, v := range validators {
+		effectiveness[strconv.FormatUint(v.ValidatorIndex, 10)] = v.Effectiveness
+	}
+	return effectiveness, nil
+}
@@ -0,0 +1,80 @@
+package insync
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Incidents returns the open and closed incidents which started between from and to, oldest first.
+func (s *StateStore) Incidents(from, to time.Time) []IncidentRecord {
+	s.Lock()
+	defer s.Unlock()
+	var records []IncidentRecord
+	in := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	for _, r := range s.data.History {
+		if in(r.Start) {
+			records = append(records, r)
+		}
+	}
+	for node, st := range s.data.Incidents {
+		if in(st.Start) {
+			records = append(records, IncidentRecord{
+				ID:      st.ID,
+				Node:    node,
+				State:   st.State,
+				Start:   st.Start,
+				PeakLag: st.PeakLag,
+				Actions: st.Actions,
+			})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	return records
+}
+
+// ExportFormats are the formats of ExportIncidents.
+var ExportFormats = []string{"csv", "json"}
+
+// ExportIncidents writes the incidents as csv or json. Open incidents have no end and duration.
+func ExportIncidents(w io.Writer, format string, records []IncidentRecord) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if records == nil {
+			records = []IncidentRecord{}
+		}
+		return enc.Encode(records)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "node", "state", "start", "end", "duration_seconds", "peak_lag", "resolved_by", "actions", "catch_up_blocks_per_second"})
+		for _, r := range records {
+			var end, duration string
+			if !r.End.IsZero() {
+				end = r.End.Format(time.RFC3339)
+				duration = strconv.FormatInt(int64(r.End.Sub(r.Start).Seconds()), 10)
+			}
+			actions := make([]string, len(r.Actions))
+			for i, a := range r.Actions {
+				actions[i] = fmt.Sprintf("%s %s by %s", a.Time.Format(time.RFC3339), a.Action, a.User)
+				if a.Detail != "" {
+					actions[i] += " (" + a.Detail + ")"
+				}
+			}
+			_ = cw.Write([]string{
+				r.ID, r.Node, r.State, r.Start.Format(time.RFC3339), end, duration,
+				strconv.FormatUint(r.PeakLag, 10), r.ResolvedBy, strings.Join(actions, "; "),
+				strconv.FormatFloat(r.CatchUpRate, 'f', 1, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(ExportFormats, ", "))
+}
@@ -0,0 +1,187 @@
+package insync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// FeeCheck records the base fee of the head block and the suggested priority fee of the node, for the fee trends
+// of the reports. If configured, it alerts once the network or the node is too congested for the operational
+// transactions: the base fee spikes, the txpool of the node fills up or the transactions of the accounts aren't
+// included in time. The errors are only logged.
+type FeeCheck struct {
+	n     *Node
+	cfg   FeeCheckConfig
+	retry retryPolicy
+	// pending are the accounts with pending transactions, by the address.
+	pending map[common.Address]pendingNonce
+	// congested are the kinds of congestion alerted last, empty if there is none.
+	congested string
+}
+
+// pendingNonce is the nonce of the next transaction of an account to be included, pending since the time.
+type pendingNonce struct {
+	nonce uint64
+	since time.Time
+}
+
+// NewFeeCheck creates the fee check of the node.
+func NewFeeCheck(n *Node, cfg FeeCheckConfig) *FeeCheck {
+	return &FeeCheck{
+		n:         n,
+		cfg:       cfg,
+		retry:     newRetryPolicy(cfg.CheckConfig),
+		pending:   make(map[common.Address]pendingNonce),
+		congested: n.checkState("congestion"),
+	}
+}
+
+func (c *FeeCheck) Name() string { return "fees" }
+
+func (c *FeeCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *FeeCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	if st := n.Status().State; st != StateHealthy && st != StateDegraded {
+		// the head block of a node out of sync is old, so are its fees
+		return
+	}
+	var head *struct {
+		BaseFee *hexutil.Big `json:"baseFeePerGas"`
+	}
+	err := n.call(ctx, c.retry, &head, "eth_getBlockByNumber", "latest", false)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking base fee", "node", n.name, "check", "fees", "err", err)
+		n.recordResult("fees", "error", err.Error())
+		return
+	}
+	var kinds, reasons []string
+	// no base fee before london, or on a chain without eip-1559
+	if head != nil && head.BaseFee != nil {
+		fee := c.recordFees(ctx, head.BaseFee)
+		if c.cfg.MaxBaseFee > 0 && fee > c.cfg.MaxBaseFee {
+			kinds = append(kinds, "base fee")
+			reasons = append(reasons, fmt.Sprintf("the base fee is at %.1f gwei (max %.1f gwei)", fee, c.cfg.MaxBaseFee))
+		}
+	}
+	if c.cfg.MaxPending > 0 {
+		var pool struct {
+			Pending hexutil.Uint64 `json:"pending"`
+		}
+		if err := n.call(ctx, c.retry, &pool, "txpool_status"); err != nil {
+			slog.Warn("error checking the txpool", "node", n.name, "check", "fees", "err", err)
+		} else if uint64(pool.Pending) > c.cfg.MaxPending {
+			kinds = append(kinds, "txpool")
+			reasons = append(reasons, fmt.Sprintf("%s transactions are pending in the txpool (max %s)", FormatNumber(uint64(pool.Pending)), FormatNumber(c.cfg.MaxPending)))
+		}
+	}
+	if stuck := c.stuckAccounts(ctx); len(stuck) > 0 {
+		kinds = append(kinds, "inclusion")
+		reasons = append(reasons, fmt.Sprintf("the transactions of %s weren't included within %s", strings.Join(stuck, ", "), FormatDuration(time.Duration(c.cfg.MaxInclusionDelay))))
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	c.alertCongestion(nf, strings.Join(kinds, ", "), reasons)
+}
+
+// recordFees records the base fee of the head block and the suggested priority fee, it returns the base fee in gwei.
+func (c *FeeCheck) recordFees(ctx context.Context, baseFee *hexutil.Big) float64 {
+	n := c.n
+	r := CheckResult{Check: "fees", Status: "ok", Value: gwei(baseFee)}
+	var tip hexutil.Big
+	if err := n.call(ctx, c.retry, &tip, "eth_maxPriorityFeePerGas"); err != nil {
+		// not every client implements it, the base fee is recorded anyway
+		slog.Debug("error checking priority fee", "node", n.name, "check", "fees", "err", err)
+		r.Detail = fmt.Sprintf("base fee %.2f gwei", r.Value)
+	} else {
+		r.PriorityFee = gwei(&tip)
+		r.Detail = fmt.Sprintf("base fee %.2f gwei, priority fee %.2f gwei", r.Value, r.PriorityFee)
+	}
+	n.record(r)
+	return r.Value
+}
+
+// stuckAccounts returns the accounts whose next transaction is pending for longer than the max inclusion delay.
+// A transaction is pending while the pending nonce of the account is ahead of that of the head block.
+func (c *FeeCheck) stuckAccounts(ctx context.Context) []string {
+	n := c.n
+	var stuck []string
+	for _, account := range c.cfg.Accounts {
+		addr := common.HexToAddress(account)
+		var latest, pending hexutil.Uint64
+		if err := n.call(ctx, c.retry, &latest, "eth_getTransactionCount", addr, "latest"); err != nil {
+			slog.Warn("error checking the nonce", "node", n.name, "check", "fees", "account", account, "err", err)
+			continue
+		}
+		if err := n.call(ctx, c.retry, &pending, "eth_getTransactionCount", addr, "pending"); err != nil {
+			slog.Warn("error checking the pending nonce", "node", n.name, "check", "fees", "account", account, "err", err)
+			continue
+		}
+		if pending <= latest {
+			delete(c.pending, addr)
+			continue
+		}
+		p, ok := c.pending[addr]
+		if !ok || p.nonce != uint64(latest) {
+			// a new transaction is pending, or the last one was included
+			p = pendingNonce{nonce: uint64(latest), since: time.Now()}
+			c.pending[addr] = p
+		}
+		if time.Since(p.since) > time.Duration(c.cfg.MaxInclusionDelay) {
+			stuck = append(stuck, account)
+		}
+	}
+	return stuck
+}
+
+// alertCongestion alerts once the kinds of congestion change, reasons describe them. The kinds are empty if there is
+// no congestion.
+func (c *FeeCheck) alertCongestion(nf Notifier, kinds string, reasons []string) {
+	n := c.n
+	if kinds == c.congested {
+		return
+	}
+	if kinds == "" {
+		slog.Info("congestion cleared", "node", n.name, "check", "fees")
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "no longer congested",
+			Name:     "NodeCongested",
+			Key:      "congestion",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s is no longer congested", n.name),
+		})
+	} else {
+		slog.Warn("congestion detected", "node", n.name, "check", "fees", "congestion", kinds)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "congested",
+			Name:     "NodeCongested",
+			Key:      "congestion",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text:     fmt.Sprintf("🟠 %s is congested, %s. Operational transactions may take a while or need a higher fee.", n.name, strings.Join(reasons, ", ")),
+		})
+	}
+	c.congested = kinds
+	n.setCheckState("congestion", kinds)
+}
+
+// gwei converts the amount of wei to gwei.
+func gwei(wei *hexutil.Big) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(wei.ToInt()), big.NewFloat(1e9)).Float64()
+	return f
+}
@@ -0,0 +1,33 @@
+package insync
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FormatDuration formats a duration in a human friendly way, e.g. 3h or 2h14m.
+func FormatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	d = d.Round(time.Minute)
+	h, m := d/time.Hour, (d%time.Hour)/time.Minute
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh%dm", h, m)
+	}
+}
+
+// FormatNumber formats a number with thousands separators, e.g. 1,240.
+func FormatNumber(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
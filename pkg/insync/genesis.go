@@ -0,0 +1,111 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// genesisHashes are the genesis block hashes of the well known chains by name.
+var genesisHashes = map[string]common.Hash{
+	"mainnet": params.MainnetGenesisHash,
+	"goerli":  params.GoerliGenesisHash,
+	"sepolia": params.SepoliaGenesisHash,
+}
+
+// GenesisCheck compares the genesis block hash of the node to the expected one, the configured genesis or that of its
+// chain if it's well known. A mismatch is critical, the node was e.g. restored from the snapshot of another network,
+// which the chain id alone doesn't tell. Nodes without expected genesis aren't checked.
+type GenesisCheck struct {
+	n     *Node
+	cfg   CheckConfig
+	retry retryPolicy
+	// mismatch is the genesis hash alerted last, empty if it matches.
+	mismatch string
+}
+
+// NewGenesisCheck creates the genesis check of the node.
+func NewGenesisCheck(n *Node, cfg CheckConfig) *GenesisCheck {
+	return &GenesisCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg), mismatch: n.checkState("genesis")}
+}
+
+func (c *GenesisCheck) Name() string { return "genesis" }
+
+func (c *GenesisCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *GenesisCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	expected, chain := n.genesis, n.Status().Chain
+	if expected == (common.Hash{}) {
+		h, ok := genesisHashes[chain]
+		if !ok {
+			// the chain isn't detected yet or its genesis isn't known
+			slog.Debug("no expected genesis hash", "node", n.name, "check", "genesis", "chain", chain)
+			return
+		}
+		expected = h
+	}
+	var genesis *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	err := n.call(ctx, c.retry, &genesis, "eth_getBlockByNumber", "0x0", false)
+	if ctx.Err() != nil {
+		return
+	}
+	if err == nil && genesis == nil {
+		// e.g. a node restored without its ancient blocks
+		err = errors.New("no genesis block")
+	}
+	if err != nil {
+		slog.Warn("error checking the genesis block", "node", n.name, "check", "genesis", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("genesis", "error", err.Error())
+		n.countCheckError("genesis")
+		return
+	}
+	if genesis.Hash == expected {
+		n.recordResult("genesis", "ok", genesis.Hash.Hex())
+		if c.mismatch != "" {
+			slog.Info("genesis hash matches again", "node", n.name, "check", "genesis")
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "back on the expected network",
+				Name:     "NodeWrongNetwork",
+				Key:      "genesis",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s has the expected genesis block again", n.name),
+			})
+			c.mismatch = ""
+			n.setCheckState("genesis", "")
+		}
+		return
+	}
+	got := genesis.Hash.Hex()
+	n.recordResult("genesis", "mismatch", got)
+	if got == c.mismatch {
+		return
+	}
+	want := expected.Hex()
+	if n.genesis == (common.Hash{}) {
+		want += " of " + chain
+	}
+	slog.Error("genesis hash mismatch", "node", n.name, "check", "genesis", "genesis", got, "expected", expected.Hex())
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "on the wrong network",
+		Name:     "NodeWrongNetwork",
+		Key:      "genesis",
+		Icon:     "🔴",
+		Severity: SeverityCritical,
+		Text: fmt.Sprintf("🔴 %s is on the wrong network, its genesis block is %s instead of %s. Was it restored from the wrong snapshot?",
+			n.name, got, want),
+	})
+	c.mismatch = got
+	n.setCheckState("genesis", got)
+}
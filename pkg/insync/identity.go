@@ -0,0 +1,67 @@
+package insync
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// chainNames are the names of the well known chains by chain id.
+var chainNames = map[uint64]string{
+	1:        "mainnet",
+	5:        "goerli",
+	10:       "optimism",
+	56:       "bsc",
+	100:      "gnosis",
+	137:      "polygon",
+	42161:    "arbitrum",
+	11155111: "sepolia",
+}
+
+// ChainName returns the name of the chain, or its id if it isn't well known.
+func ChainName(id uint64) string {
+	if name, ok := chainNames[id]; ok {
+		return name
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// ClientName returns the client type of a web3_clientVersion, e.g. geth for Geth/v1.10.13-stable/linux-amd64/go1.17.
+func ClientName(version string) string {
+	if i := strings.Index(version, "/"); i >= 0 {
+		version = version[:i]
+	}
+	return strings.ToLower(version)
+}
+
+// identify detects the chain and the client type of the node once per connection.
+// The chain isn't detected if it's configured or known already.
+func (n *Node) identify(ctx context.Context, p retryPolicy) {
+	n.status.mu.Lock()
+	identified := n.status.identified
+	n.status.identified = true
+	n.status.mu.Unlock()
+	if identified {
+		return
+	}
+	st := n.Status()
+	if st.Chain == "" {
+		var id hexutil.Uint64
+		if err := n.call(ctx, p, &id, "eth_chainId"); err != nil {
+			slog.Warn("error detecting the chain", "node", n.name, "err", err)
+		} else {
+			n.setIdentity(ChainName(uint64(id)), "")
+		}
+	}
+	if st.Client == "" {
+		var version string
+		if err := n.call(ctx, p, &version, "web3_clientVersion"); err != nil {
+			slog.Warn("error detecting the client", "node", n.name, "err", err)
+		} else {
+			n.setIdentity("", ClientName(version))
+		}
+	}
+}
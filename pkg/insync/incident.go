@@ -0,0 +1,311 @@
+package insync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Incident tracks an ongoing out of sync period, so reminders can be sent until
+// the node recovers or someone acknowledges the alert.
+type Incident struct {
+	sync.Mutex
+	start        time.Time
+	lastReminder time.Time
+	startLag     uint64
+	peakLag      uint64
+	// rateSum and rateSamples average the block import rate while the node catches up.
+	rateSum      float64
+	rateSamples  int
+	acknowledged bool
+	snoozedUntil time.Time
+	// actions is the audit trail of everyone who handled the incident.
+	actions []IncidentAction
+	// state is the latest unhealthy state of the node during the incident.
+	state NodeState
+	// id is a short identifier included in all messages of the incident.
+	// It's kept after the incident is closed, until the next incident is opened.
+	id string
+	// messages are the telegram messages of the first alert per chat, follow ups are sent as replies to them.
+	messages map[int64]int64
+	// resolved is set when the incident is resolved by hand, until the sync check re-arms its state machine.
+	resolved bool
+
+	// name of the node the incident belongs to.
+	name string
+	// store the incident is persisted to.
+	store *StateStore
+}
+
+func (i *Incident) open(start time.Time, lag uint64, state NodeState) {
+	i.Lock()
+	defer i.Unlock()
+	i.start = start
+	i.lastReminder = time.Now()
+	i.startLag = lag
+	i.peakLag = lag
+	i.rateSum, i.rateSamples = 0, 0
+	i.acknowledged = false
+	i.snoozedUntil = time.Time{}
+	i.actions = nil
+	i.state = state
+	i.id = newIncidentID()
+	i.messages = nil
+	i.save()
+}
+
+// newIncidentID returns a random short id, e.g. 3fa9c1.
+func newIncidentID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().Unix()%0xffffff, 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ID returns the id of the current or last incident.
+func (i *Incident) ID() string {
+	i.Lock()
+	defer i.Unlock()
+	return i.id
+}
+
+// RootMessage returns the telegram message in the chat follow ups of the incident should reply to, 0 if there is none yet.
+func (i *Incident) RootMessage(chatID int64) int64 {
+	i.Lock()
+	defer i.Unlock()
+	return i.messages[chatID]
+}
+
+// SetRootMessage records the telegram message of the first alert of the incident in the chat.
+func (i *Incident) SetRootMessage(chatID, id int64) {
+	i.Lock()
+	defer i.Unlock()
+	if i.messages[chatID] != 0 {
+		return
+	}
+	if i.messages == nil {
+		i.messages = make(map[int64]int64)
+	}
+	i.messages[chatID] = id
+	if !i.start.IsZero() {
+		i.save()
+	}
+}
+
+// update records a state change during the ongoing incident.
+func (i *Incident) update(state NodeState) {
+	i.Lock()
+	defer i.Unlock()
+	i.state = state
+	i.save()
+}
+
+// close resolves the incident once the node recovered and returns how long it lasted and the highest lag observed.
+func (i *Incident) close() (time.Duration, uint64) {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return 0, 0
+	}
+	d, peak := time.Since(i.start), i.peakLag
+	i.closeLocked("")
+	return d, peak
+}
+
+// closeLocked archives and closes the incident. The caller must hold the lock.
+func (i *Incident) closeLocked(resolvedBy string) {
+	if err := i.store.archive(IncidentRecord{
+		ID:          i.id,
+		Node:        i.name,
+		State:       i.state.String(),
+		Start:       i.start,
+		End:         time.Now(),
+		PeakLag:     i.peakLag,
+		CatchUpRate: i.catchUpRate(),
+		ResolvedBy:  resolvedBy,
+		Actions:     i.actions,
+	}); err != nil {
+		slog.Error("error saving state", "err", err)
+	}
+	i.start = time.Time{}
+	i.peakLag = 0
+	i.rateSum, i.rateSamples = 0, 0
+	i.actions = nil
+	i.save()
+}
+
+// observeRate records the block import rate during the ongoing incident, to report the average catch-up speed once resolved.
+// The samples aren't persisted, after a restart of insync only the later ones are averaged.
+func (i *Incident) observeRate(rate float64) {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return
+	}
+	i.rateSum += rate
+	i.rateSamples++
+}
+
+// catchUpRate returns the average block import rate of the incident, 0 without samples. The caller must hold the lock.
+func (i *Incident) catchUpRate() float64 {
+	if i.rateSamples == 0 {
+		return 0
+	}
+	return i.rateSum / float64(i.rateSamples)
+}
+
+// observeLag records the lag during the ongoing incident, to report the peak lag once resolved.
+func (i *Incident) observeLag(lag uint64) {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() || lag <= i.peakLag {
+		return
+	}
+	i.peakLag = lag
+	i.save()
+}
+
+// current returns the state of the node according to the incident and since when it's in that state.
+// Without an ongoing incident, the node is considered healthy.
+func (i *Incident) current() (NodeState, time.Time) {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return StateHealthy, time.Now()
+	}
+	return i.state, i.start
+}
+
+// Ongoing reports whether there is an unresolved incident.
+func (i *Incident) Ongoing() bool {
+	i.Lock()
+	defer i.Unlock()
+	return !i.start.IsZero()
+}
+
+// Acknowledge stops the reminders for the ongoing incident.
+// It returns false if there is no ongoing incident.
+func (i *Incident) Acknowledge(user string) bool {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return false
+	}
+	i.acknowledged = true
+	i.record(user, ActionAcknowledged, "")
+	i.save()
+	return true
+}
+
+// Snooze pauses the reminders for the ongoing incident for the given duration.
+// It returns false if there is no ongoing incident.
+func (i *Incident) Snooze(user string, d time.Duration) bool {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return false
+	}
+	i.snoozedUntil = time.Now().Add(d)
+	i.record(user, ActionSnoozed, FormatDuration(d))
+	i.save()
+	return true
+}
+
+// Resolve closes the ongoing incident manually, even if the node didn't recover yet. A node which stays out of sync
+// or unreachable opens a new incident after the report interval. It returns false if there is no ongoing incident.
+func (i *Incident) Resolve(user string) bool {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return false
+	}
+	i.record(user, ActionResolved, "")
+	i.closeLocked(user)
+	i.resolved = true
+	return true
+}
+
+// takeResolved reports whether the incident was resolved by hand since the last call.
+func (i *Incident) takeResolved() bool {
+	i.Lock()
+	defer i.Unlock()
+	resolved := i.resolved
+	i.resolved = false
+	return resolved
+}
+
+// Record adds an entry to the audit trail of the ongoing incident, e.g. an automated restart of the node.
+// It returns false if there is no ongoing incident.
+func (i *Incident) Record(user, action, detail string) bool {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return false
+	}
+	i.record(user, action, detail)
+	i.save()
+	return true
+}
+
+// record adds an entry to the audit trail. The caller must hold the lock.
+func (i *Incident) record(user, action, detail string) {
+	i.actions = append(i.actions, IncidentAction{
+		Time:   time.Now(),
+		User:   user,
+		Action: action,
+		Detail: detail,
+	})
+}
+
+// Snapshot returns the persisted form of the ongoing incident, or false if there is none.
+func (i *Incident) Snapshot() (IncidentRecord, bool) {
+	i.Lock()
+	defer i.Unlock()
+	if i.start.IsZero() {
+		return IncidentRecord{}, false
+	}
+	return IncidentRecord{
+		ID:      i.id,
+		Node:    i.name,
+		State:   i.state.String(),
+		Start:   i.start,
+		PeakLag: i.peakLag,
+		Actions: append([]IncidentAction(nil), i.actions...),
+	}, true
+}
+
+// reminderDue reports whether a reminder should be sent and resets the reminder timer if so.
+func (i *Incident) reminderDue(interval time.Duration) bool {
+	i.Lock()
+	defer i.Unlock()
+	if interval <= 0 || i.start.IsZero() || i.acknowledged || time.Now().Before(i.snoozedUntil) || time.Since(i.lastReminder) < interval {
+		return false
+	}
+	i.lastReminder = time.Now()
+	return true
+}
+
+// save persists the incident. The caller must hold the lock.
+func (i *Incident) save() {
+	var st *incidentState
+	if !i.start.IsZero() {
+		st = &incidentState{
+			Start:        i.start,
+			StartLag:     i.startLag,
+			PeakLag:      i.peakLag,
+			Acknowledged: i.acknowledged,
+			SnoozedUntil: i.snoozedUntil,
+			Actions:      i.actions,
+			State:        i.state.String(),
+			ID:           i.id,
+			Messages:     i.messages,
+		}
+	}
+	if err := i.store.save(i.name, st); err != nil {
+		slog.Error("error saving state", "err", err)
+	}
+}
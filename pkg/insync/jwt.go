@@ -0,0 +1,55 @@
+package insync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// jwtHeader is the encoded header of the tokens, geth only accepts HS256.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// readJWTSecret reads the hex encoded 32 byte secret of geth's --authrpc.jwtsecret file.
+func readJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt secret in %s: %w", path, err)
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("invalid jwt secret in %s: expected 32 bytes, got %d", path, len(secret))
+	}
+	redact.Add(hex.EncodeToString(secret))
+	return secret, nil
+}
+
+// jwtToken returns a token issued at now, signed with the secret.
+func jwtToken(secret []byte, now time.Time) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, now.Unix())))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(jwtHeader + "." + claims))
+	return jwtHeader + "." + claims + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// jwtTransport signs a fresh token for every request, the auth endpoint rejects tokens issued more than a few seconds ago.
+type jwtTransport struct {
+	secret []byte
+	next   http.RoundTripper
+}
+
+func (t jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+jwtToken(t.secret, time.Now()))
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,82 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Modes of a node, see NodeConfig.Mode.
+const (
+	ModeFull  = "full"
+	ModeLight = "light"
+)
+
+// lightTolerance is the number of blocks the finalized head of a light client may be behind that of the reference
+// before it lags, two epochs. The finalized head only moves once per epoch and the two are polled at different times.
+const lightTolerance = 64
+
+// errNoReference is returned for a light client without reference, it can't be checked.
+var errNoReference = errors.New("the light mode requires a reference")
+
+// finalizedBlock is the part of the finalized block a light client is checked with.
+type finalizedBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// SetReference sets the reference the finalized head of a light client is compared to. It has to be set before the
+// checks start.
+func (n *Node) SetReference(ref *Node) {
+	n.reference = ref
+}
+
+// lightProgress checks a light client, e.g. helios or a portal client, whose eth_syncing doesn't tell whether it follows
+// the chain. Its finalized head is compared to that of the reference: the progress is nil while it keeps up, and an
+// error if its finalized block isn't that of the reference, i.e. it follows another chain. If the reference can't be
+// reached, the light client is taken as in sync, it can't be told otherwise.
+func (n *Node) lightProgress(ctx context.Context, p retryPolicy) (*ethereum.SyncProgress, error) {
+	if n.reference == nil {
+		return nil, errNoReference
+	}
+	var head *finalizedBlock
+	start := time.Now()
+	if err := n.call(ctx, p, &head, "eth_getBlockByNumber", "finalized", false); err != nil {
+		return nil, err
+	}
+	n.setLatency(time.Since(start))
+	if head == nil {
+		return nil, errors.New("no finalized block")
+	}
+	ref := n.reference
+	var refHead *finalizedBlock
+	if err := ref.call(ctx, p, &refHead, "eth_getBlockByNumber", "finalized", false); err != nil || refHead == nil {
+		slog.Warn("error checking the finalized head of the reference", "node", n.name, "check", "sync", "reference", ref.name, "err", err)
+		return nil, nil
+	}
+	if head.Number > refHead.Number {
+		// the reference is behind, the block can't be compared yet
+		return nil, nil
+	}
+	canonical := refHead
+	if head.Number < refHead.Number {
+		// into a new block, the decoding would overwrite the finalized head of the reference
+		canonical = nil
+		if err := ref.call(ctx, p, &canonical, "eth_getBlockByNumber", head.Number, false); err != nil || canonical == nil {
+			slog.Warn("error checking the finalized block on the reference", "node", n.name, "check", "sync", "reference", ref.name, "block", uint64(head.Number), "err", err)
+		}
+	}
+	if canonical != nil && canonical.Hash != head.Hash {
+		return nil, fmt.Errorf("not on the canonical chain, finalized block %d is %s instead of %s", uint64(head.Number), head.Hash.Hex(), canonical.Hash.Hex())
+	}
+	if uint64(refHead.Number-head.Number) <= lightTolerance {
+		return nil, nil
+	}
+	return &ethereum.SyncProgress{CurrentBlock: uint64(head.Number), HighestBlock: uint64(refHead.Number)}, nil
+}
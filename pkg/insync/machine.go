@@ -0,0 +1,172 @@
+package insync
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// NodeState is the sync state of a node.
+type NodeState int
+
+const (
+	// StateHealthy means the node is in sync.
+	StateHealthy NodeState = iota
+	// StateDegraded means the node is syncing, but lags behind by no more than the tolerated lag.
+	StateDegraded
+	// StateSyncing means the node is out of sync.
+	StateSyncing
+	// StateUnreachable means the node can't be queried.
+	StateUnreachable
+)
+
+var stateNames = map[NodeState]string{
+	StateHealthy:     "healthy",
+	StateDegraded:    "degraded",
+	StateSyncing:     "syncing",
+	StateUnreachable: "unreachable",
+}
+
+func (s NodeState) String() string {
+	return stateNames[s]
+}
+
+// ParseNodeState is the inverse of NodeState.String.
+func ParseNodeState(s string) (NodeState, bool) {
+	for st, name := range stateNames {
+		if name == s {
+			return st, true
+		}
+	}
+	return StateHealthy, false
+}
+
+// Observation is the result of a single sync check. It's an immutable snapshot,
+// Sync is never modified once the observation was made.
+type Observation struct {
+	Time time.Time
+	Sync *ethereum.SyncProgress
+	Err  error
+
+	// span is the span of the check cycle, or of the evaluation once it's observed.
+	span tracing.SpanContext
+}
+
+// Transition is emitted by the machine whenever the state of a node changes.
+type Transition struct {
+	From, To NodeState
+	// Since is the time the condition leading to the transition was first observed.
+	Since time.Time
+	Obs   Observation
+}
+
+// Machine is the state machine of a single node. It's fed with observations and
+// decides when the node changes its state.
+//
+// To avoid flapping, the machine applies hysteresis:
+//   - an unhealthy condition has to persist for the whole window before it's reported
+//   - recovering to healthy requires recoveryChecks consecutive healthy observations
+type Machine struct {
+	state NodeState
+	// entered is the time the current state was entered.
+	entered time.Time
+
+	// pending is the first observation deviating from the current state towards another unhealthy state,
+	// or of the current state once the machine is rearmed.
+	pending *Observation
+	// healthy counts the consecutive healthy observations while in an unhealthy state.
+	healthy int64
+	// rearmed is set once the unhealthy state is reported again if it persists for the window.
+	rearmed bool
+
+	window         time.Duration
+	recoveryChecks int64
+	maxLag         uint64
+}
+
+// NewMachine creates a machine starting in the given state, entered at the given time.
+func NewMachine(cfg SyncCheckConfig, state NodeState, entered time.Time) *Machine {
+	return &Machine{
+		state:          state,
+		entered:        entered,
+		window:         time.Duration(cfg.ReportInterval),
+		recoveryChecks: cfg.RecoveryChecks,
+		maxLag:         cfg.MaxLag,
+	}
+}
+
+// classify returns the state the observation points to.
+func (m *Machine) classify(o Observation) NodeState {
+	switch {
+	case o.Err != nil:
+		return StateUnreachable
+	case o.Sync == nil:
+		return StateHealthy
+	case m.maxLag > 0 && lag(o.Sync) <= m.maxLag:
+		return StateDegraded
+	default:
+		return StateSyncing
+	}
+}
+
+// Observe feeds an observation to the machine.
+// It returns the transition and true if the observation caused the state to change.
+func (m *Machine) Observe(o Observation) (Transition, bool) {
+	target := m.classify(o)
+	switch {
+	case target == m.state && m.rearmed:
+		m.healthy = 0
+		if m.pending == nil {
+			m.pending = &o
+		}
+		if o.Time.Sub(m.pending.Time) < m.window {
+			return Transition{}, false
+		}
+		return m.enter(target, m.pending.Time, o), true
+
+	case target == m.state:
+		m.pending = nil
+		m.healthy = 0
+		return Transition{}, false
+
+	case target == StateHealthy:
+		m.pending = nil
+		m.healthy++
+		if m.healthy < m.recoveryChecks {
+			return Transition{}, false
+		}
+		return m.enter(target, o.Time, o), true
+
+	default:
+		m.healthy = 0
+		if m.pending == nil {
+			m.pending = &o
+		}
+		if o.Time.Sub(m.pending.Time) < m.window {
+			return Transition{}, false
+		}
+		return m.enter(target, m.pending.Time, o), true
+	}
+}
+
+func (m *Machine) enter(to NodeState, since time.Time, o Observation) Transition {
+	t := Transition{From: m.state, To: to, Since: since, Obs: o}
+	m.state = to
+	m.entered = since
+	m.pending = nil
+	m.healthy = 0
+	m.rearmed = false
+	return t
+}
+
+// Rearm reports the current state again with a transition to itself once it persisted for the whole window, e.g.
+// after its incident was resolved by hand while the node is still out of sync or unreachable. It does nothing in the
+// healthy and degraded state, which don't open incidents.
+func (m *Machine) Rearm() {
+	if m.state != StateSyncing && m.state != StateUnreachable {
+		return
+	}
+	m.rearmed = true
+	m.pending = nil
+}
@@ -0,0 +1,171 @@
+package insync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+var (
+	inSync   = Observation{}
+	behind   = Observation{Sync: &ethereum.SyncProgress{CurrentBlock: 100, HighestBlock: 200}}
+	slightly = Observation{Sync: &ethereum.SyncProgress{CurrentBlock: 198, HighestBlock: 200}}
+	failed   = Observation{Err: errors.New("connection refused")}
+)
+
+func testMachine() *Machine {
+	return NewMachine(SyncCheckConfig{
+		ReportInterval: Duration(time.Minute),
+		RecoveryChecks: 2,
+		MaxLag:         5,
+	}, StateHealthy, time.Time{})
+}
+
+func TestMachineTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		// observations are fed to the machine every 15s
+		observations []Observation
+		want         []NodeState
+	}{
+		{
+			name:         "stays healthy",
+			observations: []Observation{inSync, inSync, inSync},
+		},
+		{
+			name:         "out of sync after window",
+			observations: []Observation{behind, behind, behind, behind, behind},
+			want:         []NodeState{StateSyncing},
+		},
+		{
+			name:         "short hiccup is ignored",
+			observations: []Observation{behind, behind, inSync, behind, behind, behind},
+		},
+		{
+			name:         "unreachable after window",
+			observations: []Observation{failed, failed, failed, failed, failed},
+			want:         []NodeState{StateUnreachable},
+		},
+		{
+			name:         "mixed unhealthy observations report the latest state",
+			observations: []Observation{failed, behind, failed, behind, behind},
+			want:         []NodeState{StateSyncing},
+		},
+		{
+			name:         "small lag is degraded",
+			observations: []Observation{slightly, slightly, slightly, slightly, slightly},
+			want:         []NodeState{StateDegraded},
+		},
+		{
+			name:         "recovery requires consecutive healthy checks",
+			observations: []Observation{behind, behind, behind, behind, behind, inSync, behind, inSync, inSync},
+			want:         []NodeState{StateSyncing, StateHealthy},
+		},
+		{
+			name:         "switches between unhealthy states after window",
+			observations: []Observation{behind, behind, behind, behind, behind, failed, failed, failed, failed, failed},
+			want:         []NodeState{StateSyncing, StateUnreachable},
+		},
+		{
+			name:         "returning to the current state resets the pending transition",
+			observations: []Observation{behind, behind, behind, behind, behind, failed, failed, behind, failed, failed, failed},
+			want:         []NodeState{StateSyncing},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMachine()
+			start := time.Now()
+			var got []NodeState
+			for i, o := range tt.observations {
+				o.Time = start.Add(time.Duration(i) * 15 * time.Second)
+				if tr, ok := m.Observe(o); ok {
+					got = append(got, tr.To)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got transitions %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got transitions %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMachineTransitionSince(t *testing.T) {
+	m := testMachine()
+	start := time.Now()
+	var tr Transition
+	var ok bool
+	for i := 0; !ok && i < 10; i++ {
+		o := behind
+		o.Time = start.Add(time.Duration(i) * 15 * time.Second)
+		tr, ok = m.Observe(o)
+	}
+	if !ok {
+		t.Fatal("expected a transition")
+	}
+	if tr.From != StateHealthy || tr.To != StateSyncing {
+		t.Errorf("got %s -> %s, want healthy -> syncing", tr.From, tr.To)
+	}
+	if !tr.Since.Equal(start) {
+		t.Errorf("got since %s, want %s", tr.Since, start)
+	}
+}
+
+func TestMachineRearm(t *testing.T) {
+	tests := []struct {
+		name string
+		// observations are fed to the machine every 15s, it's rearmed before the observation at rearm
+		observations []Observation
+		rearm        int
+		want         []NodeState
+	}{
+		{
+			name:         "unhealthy state is reported again after window",
+			observations: []Observation{behind, behind, behind, behind, behind, behind, behind, behind, behind, behind},
+			rearm:        5,
+			want:         []NodeState{StateSyncing, StateSyncing},
+		},
+		{
+			name:         "recovery cancels the rearm",
+			observations: []Observation{behind, behind, behind, behind, behind, inSync, inSync, behind, behind},
+			rearm:        5,
+			want:         []NodeState{StateSyncing, StateHealthy},
+		},
+		{
+			name:         "healthy machine isn't rearmed",
+			observations: []Observation{inSync, inSync, inSync, inSync, inSync, inSync},
+			rearm:        1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMachine()
+			start := time.Now()
+			var got []NodeState
+			for i, o := range tt.observations {
+				if i == tt.rearm {
+					m.Rearm()
+				}
+				o.Time = start.Add(time.Duration(i) * 15 * time.Second)
+				if tr, ok := m.Observe(o); ok {
+					got = append(got, tr.To)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got transitions %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got transitions %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package insync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Monitor runs the checks of the nodes and sends their alerts to the notifier.
+type Monitor struct {
+	nf        Notifier
+	reconnect ReconnectConfig
+	scheduler SchedulerConfig
+	recorder  Recorder
+
+	// byName maps the names to the nodes, read when labeling alerts without holding mu.
+	byName sync.Map
+
+	mu     sync.Mutex
+	nodes  []*Node
+	checks []*scheduledCheck
+	// run is the state of the running monitor, nil before Run.
+	run *monitorRun
+}
+
+// monitorRun tracks the goroutines of the running monitor, so nodes can be added and removed at runtime.
+type monitorRun struct {
+	ctx   context.Context
+	wg    sync.WaitGroup
+	sched *scheduler
+	// cancels stop the goroutines of the nodes.
+	cancels map[*Node]context.CancelFunc
+}
+
+// consumer is implemented by checks processing the results of Run in a separate goroutine.
+type consumer interface {
+	consume(ctx context.Context, nf Notifier)
+}
+
+// NewMonitor creates a monitor sending all alerts to the notifier.
+// The alerts of nodes monitored through a fallback endpoint are labeled with the fallback.
+func NewMonitor(nf Notifier, reconnect ReconnectConfig, scheduler SchedulerConfig) *Monitor {
+	m := &Monitor{reconnect: reconnect, scheduler: scheduler}
+	m.nf = &fallbackLabel{nodes: &m.byName, nf: nf}
+	return m
+}
+
+// fallbackLabel adds the fallback endpoint to the alerts of the nodes monitored through one.
+type fallbackLabel struct {
+	nodes *sync.Map
+	nf    Notifier
+}
+
+func (l *fallbackLabel) Send(a Alert) error {
+	if v, ok := l.nodes.Load(a.Node); ok && a.Name != "NodeFallback" {
+		if host, _ := v.(*Node).fallback(); host != "" {
+			a.Text += fmt.Sprintf("\n(monitored through the fallback %s)", host)
+		}
+	}
+	return l.nf.Send(a)
+}
+
+// AddNode adds the node together with its checks. The connection of the node is
+// re-established by the monitor if it breaks. Nodes added while the monitor is running are checked right away.
+func (m *Monitor) AddNode(n *Node, checks ...Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes = append(m.nodes, n)
+	m.byName.Store(n.name, n)
+	added := make([]*scheduledCheck, len(checks))
+	for i, c := range checks {
+		added[i] = &scheduledCheck{check: c, node: n}
+	}
+	m.checks = append(m.checks, added...)
+	if m.run != nil {
+		m.startNode(n, added)
+		m.run.sched.add(m.run.ctx, added)
+	}
+}
+
+// Nodes returns the monitored nodes, including those added at runtime.
+func (m *Monitor) Nodes() []*Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Node(nil), m.nodes...)
+}
+
+// RemoveNode stops the checks of the node and closes its connection. Running checks are finished first.
+func (m *Monitor) RemoveNode(n *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, node := range m.nodes {
+		if node == n {
+			m.nodes = append(m.nodes[:i:i], m.nodes[i+1:]...)
+			m.byName.Delete(n.name)
+			break
+		}
+	}
+	checks := m.checks[:0:0]
+	for _, c := range m.checks {
+		if c.node != n {
+			checks = append(checks, c)
+		}
+	}
+	m.checks = checks
+	if m.run != nil {
+		if cancel, ok := m.run.cancels[n]; ok {
+			cancel()
+			delete(m.run.cancels, n)
+		}
+		m.run.sched.remove(m.run.ctx, n)
+	}
+	n.close()
+}
+
+// SetRecorder records the results of all checks and the state changes of the nodes.
+// It must be called before Run.
+func (m *Monitor) SetRecorder(r Recorder) {
+	m.recorder = r
+}
+
+// AddCheck adds checks which don't belong to a single node, e.g. a ClockCheck.
+// It must be called before Run.
+func (m *Monitor) AddCheck(checks ...Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range checks {
+		m.checks = append(m.checks, &scheduledCheck{check: c})
+	}
+}
+
+// Run runs the checks until the context is done and waits for them to stop.
+func (m *Monitor) Run(ctx context.Context) {
+	cfg := m.scheduler
+	cfg.Finalize()
+	m.mu.Lock()
+	run := &monitorRun{
+		ctx:     ctx,
+		sched:   newScheduler(m.nf, cfg, m.checks),
+		cancels: make(map[*Node]context.CancelFunc),
+	}
+	m.run = run
+	for _, n := range m.nodes {
+		var checks []*scheduledCheck
+		for _, c := range m.checks {
+			if c.node == n {
+				checks = append(checks, c)
+			}
+		}
+		m.startNode(n, checks)
+	}
+	// checks passing their results on to a consumer, see SyncCheck
+	for _, c := range m.checks {
+		if c.node == nil {
+			m.startConsumer(ctx, c)
+		}
+	}
+	run.wg.Add(2)
+	go func() {
+		defer run.wg.Done()
+		Supervise(m.nf, "", "scheduler", func() { run.sched.run(ctx) })
+	}()
+	go func() {
+		// no nodes are started once the monitor stops, so the wait group isn't added to while it's waited for
+		defer run.wg.Done()
+		<-ctx.Done()
+		m.mu.Lock()
+		m.run = nil
+		m.mu.Unlock()
+	}()
+	m.mu.Unlock()
+	run.wg.Wait()
+}
+
+// startNode starts maintaining the connection of the node and the consumers of its checks, until the node is removed.
+// m.mu must be held.
+func (m *Monitor) startNode(n *Node, checks []*scheduledCheck) {
+	n.recorder = m.recorder
+	// the goroutines use the run they belong to, m.run is reset when the monitor stops
+	run := m.run
+	ctx, cancel := context.WithCancel(run.ctx)
+	run.cancels[n] = cancel
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		Supervise(m.nf, n.name, "reconnect", func() { n.maintain(ctx, m.nf, m.reconnect) })
+	}()
+	for _, c := range checks {
+		m.startConsumer(ctx, c)
+	}
+}
+
+// startConsumer starts the consumer of the check, if it's one. m.mu must be held.
+func (m *Monitor) startConsumer(ctx context.Context, c *scheduledCheck) {
+	cons, ok := c.check.(consumer)
+	if !ok {
+		return
+	}
+	var node string
+	if c.node != nil {
+		node = c.node.name
+	}
+	worker := c.check.Name() + " consumer"
+	run := m.run
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		Supervise(m.nf, node, worker, func() { cons.consume(ctx, m.nf) })
+	}()
+}
@@ -0,0 +1,201 @@
+package insync
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Node is a monitored geth node.
+type Node struct {
+	// checked is the unix nano timestamp of the last sync check, accessed atomically.
+	// It's the first field to guarantee 64 bit alignment on 32 bit platforms.
+	checked int64
+	// once is set to 1 after the first sync check, accessed atomically.
+	once int32
+	// succeeded is set to 1 after the first successful sync check, accessed atomically.
+	succeeded int32
+
+	name string
+	url  string
+	// fallbacks are the urls the node is monitored through while the primary url is unreachable.
+	fallbacks []string
+	dataDir   string
+	auth      AuthConfig
+	headers   map[string]string
+	tls       TLSConfig
+	proxy     string
+	// dialControl is the control of the dialer of the endpoints, nil if there's none.
+	dialControl func(network, address string, c syscall.RawConn) error
+	inc         *Incident
+	// recorder records the check results, set by the monitor before the checks start.
+	recorder Recorder
+	status   nodeStatus
+
+	mu     sync.Mutex
+	client *ethclient.Client
+	// rpc is the underlying client of client, used for calls not covered by the ethclient.
+	rpc *rpc.Client
+	// dialErr is the error of the last failed dial, while there is no client.
+	dialErr error
+	// err is the result of the last call.
+	err error
+	// failures is the number of consecutive calls that failed because of the connection.
+	failures int
+	// endpoint is the index of the fallback in use plus one, 0 while connected to the primary url.
+	endpoint int
+	// primaryErr is the error of the primary url while a fallback is in use.
+	primaryErr error
+	// pinned is set while a fallback was chosen with SwitchEndpoint, the primary url isn't restored then.
+	pinned bool
+	// broken is signaled once the connection should be re-established.
+	broken chan struct{}
+
+	// validatorClient is the health endpoint of the validator client, the url is empty if there is none.
+	validatorClient ValidatorClientConfig
+	// beacon is the url of the beacon node api, empty if there is none.
+	beacon string
+	// validators are the indices or public keys of the validators of the beacon node.
+	validators []string
+	// metrics are the prometheus metrics endpoints of the clients.
+	metrics []string
+	// light is set for light clients, their finalized head is compared to that of the reference, see lightProgress.
+	light     bool
+	reference *Node
+	// genesis is the expected genesis block hash, the zero hash if that of the chain is expected.
+	genesis common.Hash
+}
+
+// ParseNodes parses a comma separated list of node urls.
+// Each url may be prefixed with a name, e.g. node-1=http://localhost:8545,
+// otherwise the name is derived from the url later on.
+func ParseNodes(s string) ([]NodeConfig, error) {
+	var cfgs []NodeConfig
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var cfg NodeConfig
+		if i := strings.Index(entry, "="); i > 0 && !strings.Contains(entry[:i], "://") {
+			cfg.Name, cfg.URL = entry[:i], entry[i+1:]
+		} else {
+			cfg.URL = entry
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+// NodeName derives a name from the url, without leaking any credentials it might contain.
+func NodeName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		// ipc paths don't have a host
+		return rawURL
+	}
+	return u.Host
+}
+
+// NewNode creates the node and connects to it. If the node can't be reached,
+// the connection is established later on by maintain.
+func NewNode(cfg NodeConfig, inc *Incident) *Node {
+	n := &Node{
+		name:      cfg.Name,
+		url:       cfg.URL,
+		fallbacks: cfg.Fallbacks,
+		dataDir:   cfg.DataDir,
+		auth:      cfg.Auth,
+		headers:   cfg.Headers,
+		tls:       cfg.TLS,
+		proxy:     cfg.Proxy,
+		inc:       inc,
+
+		dialControl: cfg.DialControl,
+		checked:     time.Now().UnixNano(),
+		broken:      make(chan struct{}, 1),
+
+		validatorClient: cfg.ValidatorClient,
+		beacon:          cfg.Beacon,
+		validators:      cfg.Validators,
+		metrics:         cfg.Metrics,
+		light:           cfg.Mode == ModeLight,
+		genesis:         common.HexToHash(cfg.Genesis),
+	}
+	n.status.status.Peers = -1
+	n.status.status.Chain = cfg.Chain
+	if cfg.TLS.InsecureSkipVerify {
+		slog.Warn("the certificate of the node isn't verified, only use insecure_skip_verify in lab environments", "node", n.name)
+	}
+	if err := n.dial(); err != nil {
+		slog.Warn("error connecting", "node", n.name, "err", err)
+		n.broken <- struct{}{}
+	}
+	return n
+}
+
+// Name returns the name of the node.
+func (n *Node) Name() string {
+	return n.name
+}
+
+// Incident returns the incident of the node.
+func (n *Node) Incident() *Incident {
+	return n.inc
+}
+
+// checkState returns the persisted state of the check of the node.
+func (n *Node) checkState(check string) string {
+	if n.inc == nil || n.inc.store == nil {
+		return ""
+	}
+	return n.inc.store.checkState(n.name, check)
+}
+
+// setCheckState persists the state of the check of the node, so it survives restarts.
+func (n *Node) setCheckState(check, state string) {
+	if n.inc == nil || n.inc.store == nil {
+		return
+	}
+	n.inc.store.setCheckState(n.name, check, state)
+}
+
+// markChecked records that the node was just checked.
+func (n *Node) markChecked() {
+	atomic.StoreInt64(&n.checked, time.Now().UnixNano())
+	atomic.StoreInt32(&n.once, 1)
+}
+
+// markSucceeded records that a check of the node succeeded, the node answered.
+func (n *Node) markSucceeded() {
+	atomic.StoreInt32(&n.succeeded, 1)
+}
+
+// Succeeded reports whether a sync check of the node succeeded at least once, unlike Checked which includes the
+// checks that failed.
+func (n *Node) Succeeded() bool {
+	return atomic.LoadInt32(&n.succeeded) == 1
+}
+
+// Checked reports whether the node was checked at least once.
+func (n *Node) Checked() bool {
+	return atomic.LoadInt32(&n.once) == 1
+}
+
+// LastCheck returns the time of the last sync check. Until the first check it's the time the node was created,
+// so the checks get one interval to run.
+func (n *Node) LastCheck() time.Time {
+	ts := atomic.LoadInt64(&n.checked)
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ts)
+}
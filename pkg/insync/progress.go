@@ -0,0 +1,98 @@
+package insync
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// initialSync tracks a node doing its initial sync. Instead of the out of sync alerts, a single progress message is
+// updated periodically, until the node is healthy or only lags behind by max_lag.
+type initialSync struct {
+	start time.Time
+	// updated is the time of the last progress update, zero until the first one.
+	updated time.Time
+}
+
+// trackInitialSync enters the progress mode once the node lags behind by at least progress_lag blocks,
+// and sends the progress updates while it lasts.
+func (c *SyncCheck) trackInitialSync(nf Notifier, o Observation) {
+	if c.cfg.ProgressLag == 0 || o.Sync == nil {
+		return
+	}
+	if c.initial == nil {
+		if lag(o.Sync) < c.cfg.ProgressLag {
+			return
+		}
+		slog.Info("initial sync detected", "node", c.n.name, "check", "sync", "lag", lag(o.Sync))
+		c.initial = &initialSync{start: o.Time}
+	}
+	if !c.initial.updated.IsZero() && o.Time.Sub(c.initial.updated) < time.Duration(c.cfg.ProgressInterval) {
+		return
+	}
+	c.initial.updated = o.Time
+	sendAlert(nf, c.progressAlert(progressMsg(c.n.name, o.Sync, &c.speed, o.Time.Sub(c.initial.start)), false))
+}
+
+// silent reports whether the state change is left to the progress message. Changes from and to unreachable are
+// alerted as usual.
+func (c *SyncCheck) silent(t Transition) bool {
+	return c.initial != nil && t.From != StateUnreachable && t.To != StateUnreachable
+}
+
+// finishInitialSync leaves the progress mode once the node caught up, the progress message reports the completion.
+func (c *SyncCheck) finishInitialSync(nf Notifier, t Transition) {
+	if c.initial == nil || (t.To != StateHealthy && t.To != StateDegraded) {
+		return
+	}
+	d := t.Obs.Time.Sub(c.initial.start)
+	slog.Info("initial sync finished", "node", c.n.name, "check", "sync", "duration", d)
+	c.initial = nil
+	sendAlert(nf, c.progressAlert(fmt.Sprintf("✅ %s finished its initial sync after %s\n", c.n.name, FormatDuration(d)), true))
+}
+
+func (c *SyncCheck) progressAlert(text string, done bool) Alert {
+	return Alert{
+		Node:     c.n.name,
+		Summary:  "initial sync",
+		Icon:     "⏳",
+		Name:     "NodeInitialSync",
+		Key:      "initial_sync",
+		Severity: SeverityInfo,
+		Text:     text,
+		Resolved: done,
+		Replace:  true,
+	}
+}
+
+// progressMsg renders the progress of the initial sync, e.g. the percentage, the stage, the speed and the ETA.
+func progressMsg(name string, sync *ethereum.SyncProgress, speed *syncSpeed, d time.Duration) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("⏳ %s is doing its initial sync, %.1f%%\n", name, syncPercent(sync)))
+	if sync.KnownStates > 0 && sync.PulledStates < sync.KnownStates {
+		s.WriteString(fmt.Sprintf("Stage: state download, %s of %s entries\n", FormatNumber(sync.PulledStates), FormatNumber(sync.KnownStates)))
+	} else {
+		s.WriteString("Stage: block import\n")
+	}
+	s.WriteString(fmt.Sprintf("Block %s of %s\n", FormatNumber(sync.CurrentBlock), FormatNumber(sync.HighestBlock)))
+	if speed.samples > 0 {
+		s.WriteString(fmt.Sprintf("Importing %.1f blocks/s", speed.importRate))
+		if eta, ok := speed.eta(); ok {
+			s.WriteString(", ETA " + FormatDuration(eta))
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString(fmt.Sprintf("Running for %s, updated %s\n", FormatDuration(d), time.Now().Format("15:04")))
+	return s.String()
+}
+
+// syncPercent returns the share of the chain the node has imported.
+func syncPercent(sync *ethereum.SyncProgress) float64 {
+	if sync.HighestBlock == 0 {
+		return 0
+	}
+	return 100 * float64(sync.CurrentBlock) / float64(sync.HighestBlock)
+}
@@ -0,0 +1,211 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// slotsPerEpoch is the number of slots of an epoch on the beacon chain.
+const slotsPerEpoch = 32
+
+// ProposalCheck watches the proposer duties of the validators of the node and alerts once a slot one of them was
+// scheduled to propose in passed without its block on chain. The duties of the epoch of the head slot are taken from
+// the beacon node of the node. The alert is resolved by the next proposal of the validators.
+type ProposalCheck struct {
+	n     *Node
+	cfg   CheckConfig
+	retry retryPolicy
+	// epoch is the epoch whose duties were fetched last, duties are the proposals of the validators not judged yet.
+	epoch   uint64
+	fetched bool
+	duties  []proposerDuty
+	missed  bool
+}
+
+// proposerDuty is a slot a validator is scheduled to propose the block of.
+type proposerDuty struct {
+	Pubkey         string `json:"pubkey"`
+	ValidatorIndex string `json:"validator_index"`
+	Slot           string `json:"slot"`
+	slot           uint64
+}
+
+// beaconHeader is the part of a block header of the beacon node api the proposal check needs.
+type beaconHeader struct {
+	Data struct {
+		Header struct {
+			Message struct {
+				Slot          string `json:"slot"`
+				ProposerIndex string `json:"proposer_index"`
+			} `json:"message"`
+		} `json:"header"`
+	} `json:"data"`
+}
+
+// NewProposalCheck creates the proposal check of the node, the node must have a beacon node and validators.
+func NewProposalCheck(n *Node, cfg CheckConfig) *ProposalCheck {
+	return &ProposalCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg), missed: n.checkState("proposal") == "missed"}
+}
+
+func (c *ProposalCheck) Name() string { return "proposals" }
+
+func (c *ProposalCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *ProposalCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var head beaconHeader
+	err := n.beaconGet(ctx, c.retry, "/eth/v1/beacon/headers/head", &head)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		c.fail("error checking beacon head", err)
+		return
+	}
+	slot, err := strconv.ParseUint(head.Data.Header.Message.Slot, 10, 64)
+	if err != nil {
+		c.fail("invalid beacon head", err)
+		return
+	}
+	if epoch := slot / slotsPerEpoch; !c.fetched || epoch != c.epoch {
+		if err := c.fetchDuties(ctx, epoch); err != nil {
+			if ctx.Err() == nil {
+				c.fail("error checking proposer duties", err)
+			}
+			return
+		}
+	}
+	pending := c.duties[:0]
+	for _, d := range c.duties {
+		if d.slot > slot {
+			pending = append(pending, d)
+			continue
+		}
+		proposed, err := c.proposed(ctx, d)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// judged in the next run
+			slog.Warn("error checking proposal", "node", n.name, "check", "proposals", "validator", d.ValidatorIndex, "slot", d.slot, "err", err)
+			pending = append(pending, d)
+			continue
+		}
+		c.judge(nf, d, proposed)
+	}
+	c.duties = pending
+}
+
+// fetchDuties fetches the proposer duties of the validators in the epoch.
+func (c *ProposalCheck) fetchDuties(ctx context.Context, epoch uint64) error {
+	n := c.n
+	var resp struct {
+		Data []proposerDuty `json:"data"`
+	}
+	if err := n.beaconGet(ctx, c.retry, fmt.Sprintf("/eth/v1/validator/duties/proposer/%d", epoch), &resp); err != nil {
+		return err
+	}
+	// the duties of the previous epochs not judged yet are kept, e.g. if the head jumped to the next epoch
+	var duties []proposerDuty
+	for _, d := range c.duties {
+		if d.slot/slotsPerEpoch < epoch {
+			duties = append(duties, d)
+		}
+	}
+	for _, d := range resp.Data {
+		if !n.validator(d) {
+			continue
+		}
+		slot, err := strconv.ParseUint(d.Slot, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid slot of the duty of validator %s: %w", d.ValidatorIndex, err)
+		}
+		d.slot = slot
+		duties = append(duties, d)
+		slog.Info("upcoming proposal", "node", n.name, "check", "proposals", "validator", d.ValidatorIndex, "slot", slot)
+	}
+	sort.Slice(duties, func(i, j int) bool { return duties[i].slot < duties[j].slot })
+	c.epoch, c.fetched, c.duties = epoch, true, duties
+	return nil
+}
+
+// validator reports whether the duty is that of one of the validators of the node, by index or public key.
+func (n *Node) validator(d proposerDuty) bool {
+	for _, v := range n.validators {
+		if v == d.ValidatorIndex || strings.EqualFold(v, d.Pubkey) {
+			return true
+		}
+	}
+	return false
+}
+
+// proposed reports whether the block of the slot is on chain and was proposed by the validator of the duty.
+func (c *ProposalCheck) proposed(ctx context.Context, d proposerDuty) (bool, error) {
+	var header beaconHeader
+	err := c.n.beaconGet(ctx, c.retry, fmt.Sprintf("/eth/v1/beacon/headers/%d", d.slot), &header)
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		// no block in the slot
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return header.Data.Header.Message.ProposerIndex == d.ValidatorIndex, nil
+}
+
+// judge records the outcome of the duty, alerts a missed proposal and resolves the alert with the next proposal.
+func (c *ProposalCheck) judge(nf Notifier, d proposerDuty, proposed bool) {
+	n := c.n
+	detail := fmt.Sprintf("validator %s, slot %d", d.ValidatorIndex, d.slot)
+	if proposed {
+		n.record(CheckResult{Check: "proposals", Status: "proposed", Detail: detail})
+		slog.Info("block proposed", "node", n.name, "check", "proposals", "validator", d.ValidatorIndex, "slot", d.slot)
+		if c.missed {
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "proposing blocks again",
+				Name:     "NodeMissedProposal",
+				Key:      "proposal",
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s proposed again, validator %s proposed slot %d", n.name, d.ValidatorIndex, d.slot),
+			})
+			c.missed = false
+			n.setCheckState("proposal", "")
+		}
+		return
+	}
+	n.record(CheckResult{Check: "proposals", Status: "missed", Detail: detail})
+	slog.Warn("missed proposal", "node", n.name, "check", "proposals", "validator", d.ValidatorIndex, "slot", d.slot)
+	// every missed proposal is alerted
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "missed a block proposal",
+		Name:     "NodeMissedProposal",
+		Key:      "proposal",
+		Icon:     "🔴",
+		Severity: SeverityCritical,
+		Text:     fmt.Sprintf("🔴 %s missed a block proposal, validator %s didn't propose slot %d", n.name, d.ValidatorIndex, d.slot),
+	})
+	c.missed = true
+	n.setCheckState("proposal", "missed")
+}
+
+// fail logs and records the error of the check.
+func (c *ProposalCheck) fail(msg string, err error) {
+	n := c.n
+	slog.Warn(msg, "node", n.name, "check", "proposals", "class", ClassifyError(err).String(), "err", err)
+	n.recordResult("proposals", "error", err.Error())
+	n.countCheckError("proposals")
+}
@@ -0,0 +1,88 @@
+package insync
+
+import "time"
+
+// CheckResult is the outcome of a single run of a check.
+type CheckResult struct {
+	Time  time.Time `json:"time"`
+	Node  string    `json:"node"`
+	Check string    `json:"check"`
+	// Status is the state the check observed, e.g. the node state for the sync check or ok and low for the peers check.
+	Status string `json:"status"`
+	// Detail describes the result, e.g. the lag or the error.
+	Detail string `json:"detail,omitempty"`
+	// Value is the measurement of the check, i.e. the lag, the peer count, the disk usage in percent or the base fee in gwei.
+	Value float64 `json:"value,omitempty"`
+	// Latency is the response time of the node, only recorded by the sync check.
+	Latency time.Duration `json:"latency_ns,omitempty"`
+	// Rate is the block import rate in blocks/s while the node is syncing, only recorded by the sync check.
+	Rate float64 `json:"rate,omitempty"`
+	// PriorityFee is the suggested priority fee in gwei, only recorded by the fee check.
+	PriorityFee float64 `json:"priority_fee,omitempty"`
+	// Metric is the rule of the metrics check whose value is recorded, only recorded by the metrics check.
+	Metric string `json:"metric,omitempty"`
+}
+
+// TransitionRecord is a recorded state change of a node.
+type TransitionRecord struct {
+	Time  time.Time `json:"time"`
+	Node  string    `json:"node"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Since time.Time `json:"since"`
+}
+
+// NotificationRecord is a recorded delivery of a notification, e.g. a telegram message.
+type NotificationRecord struct {
+	Time  time.Time `json:"time"`
+	Route string    `json:"route"`
+	// Target is the destination of the route, e.g. the telegram chat or the host of the webhook.
+	Target string `json:"target,omitempty"`
+	// Node and Alert are empty for notifications not caused by an alert, e.g. digests. Grouped alerts are comma separated.
+	Node  string `json:"node,omitempty"`
+	Alert string `json:"alert,omitempty"`
+	// Text is the rendered notification.
+	Text string `json:"text"`
+	// Error is why the delivery failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// NotificationRecorder records every outbound notification, e.g. in a history database.
+type NotificationRecorder interface {
+	RecordNotification(NotificationRecord)
+}
+
+// Recorder records the results of all checks and the state changes of the nodes, e.g. in a history database.
+type Recorder interface {
+	RecordResult(CheckResult)
+	RecordTransition(TransitionRecord)
+}
+
+// recordResult passes the result of the check to the recorder of the node, if there is one.
+func (n *Node) recordResult(check, status, detail string) {
+	n.record(CheckResult{Check: check, Status: status, Detail: detail})
+}
+
+// record passes the result to the recorder of the node, if there is one, stamped with the node and the time.
+func (n *Node) record(r CheckResult) {
+	if n.recorder == nil {
+		return
+	}
+	r.Time, r.Node = time.Now(), n.name
+	n.recorder.RecordResult(r)
+}
+
+// Recorders passes the results and state changes on to all recorders.
+type Recorders []Recorder
+
+func (rs Recorders) RecordResult(r CheckResult) {
+	for _, rec := range rs {
+		rec.RecordResult(r)
+	}
+}
+
+func (rs Recorders) RecordTransition(t TransitionRecord) {
+	for _, rec := range rs {
+		rec.RecordTransition(t)
+	}
+}
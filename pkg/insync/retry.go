@@ -0,0 +1,50 @@
+package insync
+
+import (
+	"context"
+	"time"
+)
+
+// retryPolicy retries calls failing with transient errors, each attempt with its own timeout.
+type retryPolicy struct {
+	// retries is the number of retries after the first attempt.
+	retries int
+	timeout time.Duration
+	backoff backoff
+}
+
+func newRetryPolicy(cfg CheckConfig) retryPolicy {
+	return retryPolicy{
+		retries: cfg.Retries,
+		timeout: time.Duration(cfg.Timeout),
+		backoff: backoff{min: 500 * time.Millisecond, max: 5 * time.Second},
+	}
+}
+
+// do calls f until it succeeds, fails with a permanent error or the retries are exhausted.
+// The error of the last attempt is returned.
+func (p retryPolicy) do(ctx context.Context, f func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		err = f(attemptCtx)
+		cancel()
+		if err == nil || !transient(err) || attempt >= p.retries || ctx.Err() != nil {
+			return err
+		}
+		if !p.backoff.sleep(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// transient reports whether a call failing with the error might succeed if retried.
+// Errors returned by the node itself, like rpc errors, won't go away on their own.
+func transient(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassConnRefused, ErrorClassTimeout, ErrorClassOther:
+		return true
+	default:
+		return false
+	}
+}
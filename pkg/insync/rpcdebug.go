@@ -0,0 +1,82 @@
+package insync
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxLoggedPayload is the number of bytes of a payload that are logged, e.g. of large block responses.
+const maxLoggedPayload = 16 << 10
+
+// debugRPC is set to 1 if the rpc calls are logged, accessed atomically.
+var debugRPC int32
+
+// EnableRPCDebugLog logs the json-rpc payloads and the duration of every call at debug level, for the nodes
+// connected afterwards. The urls and headers aren't logged, they might contain credentials.
+func EnableRPCDebugLog() {
+	atomic.StoreInt32(&debugRPC, 1)
+}
+
+func rpcDebugEnabled() bool {
+	return atomic.LoadInt32(&debugRPC) == 1
+}
+
+// isHTTP reports whether the url is an http endpoint, as opposed to websocket or ipc.
+func isHTTP(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")
+}
+
+// debugTransport logs the raw json-rpc requests and responses.
+type debugTransport struct {
+	node string
+	next http.RoundTripper
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		slog.Debug("rpc call failed", "node", t.node, "request", truncatePayload(reqBody), "duration", time.Since(start), "err", err)
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	slog.Debug("rpc call", "node", t.node, "request", truncatePayload(reqBody), "status", resp.StatusCode,
+		"response", truncatePayload(respBody), "duration", time.Since(start), "err", err)
+	return resp, nil
+}
+
+// logCall logs a call to a websocket or ipc endpoint, whose raw payloads can't be intercepted.
+// The params and the result are logged as json.
+func (n *Node) logCall(method string, params []interface{}, result interface{}, d time.Duration, err error) {
+	if !rpcDebugEnabled() || isHTTP(n.url) {
+		return
+	}
+	p, _ := json.Marshal(params)
+	r, _ := json.Marshal(result)
+	slog.Debug("rpc call", "node", n.name, "method", method, "params", truncatePayload(p), "result", truncatePayload(r), "duration", d, "err", err)
+}
+
+func truncatePayload(p []byte) string {
+	s := strings.TrimSpace(string(p))
+	if len(s) > maxLoggedPayload {
+		return s[:maxLoggedPayload] + "..."
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package insync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrorClass groups rpc errors by their cause, so operators know where to look.
+type ErrorClass int
+
+const (
+	ErrorClassOther ErrorClass = iota
+	ErrorClassConnRefused
+	ErrorClassTimeout
+	ErrorClassAuth
+	ErrorClassMalformed
+	ErrorClassRPC
+)
+
+var errorClassNames = map[ErrorClass]string{
+	ErrorClassOther:       "unknown error",
+	ErrorClassConnRefused: "connection refused",
+	ErrorClassTimeout:     "timeout",
+	ErrorClassAuth:        "unauthorized",
+	ErrorClassMalformed:   "malformed response",
+	ErrorClassRPC:         "rpc error",
+}
+
+func (c ErrorClass) String() string {
+	return errorClassNames[c]
+}
+
+// ClassifyError returns the class of an error returned by the rpc client.
+func ClassifyError(err error) ErrorClass {
+	var (
+		httpErr   rpc.HTTPError
+		rpcErr    rpc.Error
+		netErr    net.Error
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.As(err, &httpErr):
+		if httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden {
+			return ErrorClassAuth
+		}
+		return ErrorClassOther
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, rpc.ErrNoResult):
+		return ErrorClassMalformed
+	case errors.As(err, &rpcErr):
+		return ErrorClassRPC
+	default:
+		return ErrorClassOther
+	}
+}
+
+// errorTracker counts consecutive rpc errors of a check and alerts once they exceed the threshold.
+// A new alert is sent if the class of the errors changes.
+type errorTracker struct {
+	node, check string
+	threshold   int
+
+	class   ErrorClass
+	count   int
+	alerted bool
+}
+
+func newErrorTracker(node, check string, threshold int) *errorTracker {
+	return &errorTracker{node: node, check: check, threshold: threshold}
+}
+
+// observe records the result of a check.
+func (t *errorTracker) observe(nf Notifier, err error) {
+	if err == nil {
+		if t.alerted {
+			slog.Info("check recovered from rpc errors", "node", t.node, "check", t.check)
+			t.send(nf, Alert{
+				Node:     t.node,
+				Summary:  "recovered from rpc errors",
+				Name:     "NodeRPCErrors",
+				Key:      "rpc_" + t.check,
+				Resolved: true,
+				Icon:     "🟢",
+				Severity: SeverityInfo,
+				Text:     fmt.Sprintf("🟢 %s: %s check succeeded again after %d failed attempts", t.node, t.check, t.count),
+			})
+		}
+		t.count, t.alerted = 0, false
+		return
+	}
+
+	class := ClassifyError(err)
+	if class != t.class {
+		t.class, t.count, t.alerted = class, 0, false
+	}
+	t.count++
+	if t.alerted || t.threshold <= 0 || t.count < t.threshold {
+		return
+	}
+	t.alerted = true
+	slog.Error("check keeps failing", "node", t.node, "check", t.check, "failures", t.count, "class", class.String(), "err", err)
+	t.send(nf, Alert{
+		Node:     t.node,
+		Summary:  "failing with " + class.String(),
+		Name:     "NodeRPCErrors",
+		Key:      "rpc_" + t.check,
+		Icon:     "⚠️",
+		Severity: SeverityWarning,
+		Text:     errorMsg(t.node, t.check, class, t.count, err),
+	})
+}
+
+func (t *errorTracker) send(nf Notifier, a Alert) {
+	if err := nf.Send(a); err != nil {
+		slog.Error("error sending message", "node", t.node, "check", t.check, "err", err)
+	}
+}
+
+func errorMsg(node, check string, class ErrorClass, count int, err error) string {
+	hint := ""
+	switch class {
+	case ErrorClassConnRefused:
+		hint = "Is the node running and listening on the configured address?"
+	case ErrorClassTimeout:
+		hint = "The node might be overloaded or the network is slow."
+	case ErrorClassAuth:
+		hint = "Check the credentials of the rpc endpoint."
+	case ErrorClassMalformed:
+		hint = "The node returned a response insync can't understand."
+	}
+	msg := fmt.Sprintf("⚠️ %s: %s check failed %d times in a row (%s)\nLast error: %s\n", node, check, count, class, err)
+	if hint != "" {
+		msg += hint + "\n"
+	}
+	return msg
+}
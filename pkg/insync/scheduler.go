@@ -0,0 +1,235 @@
+package insync
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// scheduledCheck is a check in the schedule of the monitor.
+type scheduledCheck struct {
+	check Check
+	// node is the node of the check, nil if it doesn't belong to a node.
+	node *Node
+	next time.Time
+	// busy is set while the check is queued or running, a check is skipped if it is still busy when it's due again.
+	busy  bool
+	index int
+}
+
+// schedule is a min-heap of the checks ordered by their next run.
+type schedule []*scheduledCheck
+
+func (s schedule) Len() int           { return len(s) }
+func (s schedule) Less(i, j int) bool { return s[i].next.Before(s[j].next) }
+func (s schedule) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+
+func (s *schedule) Push(x interface{}) {
+	c := x.(*scheduledCheck)
+	c.index = len(*s)
+	*s = append(*s, c)
+}
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	c := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return c
+}
+
+// scheduler runs the checks on a bounded pool of workers, with at most perNode checks of a node at the same time.
+// The first run of every check is delayed by a random part of its interval, so the checks don't all hit the nodes at once.
+type scheduler struct {
+	nf      Notifier
+	workers int
+	perNode int
+	// checks are kept up to date with the checks added and removed at runtime, a restarted run schedules them again.
+	checks []*scheduledCheck
+	// added and removed pass the checks of the nodes added and removed at runtime to the running scheduler.
+	added   chan []*scheduledCheck
+	removed chan *Node
+}
+
+func newScheduler(nf Notifier, cfg SchedulerConfig, checks []*scheduledCheck) *scheduler {
+	return &scheduler{
+		nf:      nf,
+		workers: cfg.Workers,
+		perNode: cfg.PerNode,
+		checks:  schedulable(checks),
+		added:   make(chan []*scheduledCheck),
+		removed: make(chan *Node),
+	}
+}
+
+// schedulable returns the checks with an interval, a check without one would be due all the time.
+func schedulable(checks []*scheduledCheck) []*scheduledCheck {
+	kept := make([]*scheduledCheck, 0, len(checks))
+	for _, c := range checks {
+		if c.check.Interval() <= 0 {
+			slog.Warn("not scheduling check without interval", "check", c.check.Name())
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// add schedules the checks, unless the scheduler stopped.
+func (s *scheduler) add(ctx context.Context, checks []*scheduledCheck) {
+	checks = schedulable(checks)
+	select {
+	case s.added <- checks:
+	case <-ctx.Done():
+	}
+}
+
+// remove unschedules the checks of the node, running checks are finished.
+func (s *scheduler) remove(ctx context.Context, n *Node) {
+	select {
+	case s.removed <- n:
+	case <-ctx.Done():
+	}
+}
+
+func (s *scheduler) run(ctx context.Context) {
+	now := time.Now()
+	sched := make(schedule, 0, len(s.checks))
+	for _, c := range s.checks {
+		c.busy = false
+		c.next = now.Add(time.Duration(rand.Int63n(int64(c.check.Interval()))))
+		heap.Push(&sched, c)
+	}
+
+	// every check is busy at most once, so the workers don't block on done unless checks were added at runtime
+	jobs := make(chan *scheduledCheck)
+	done := make(chan *scheduledCheck, len(s.checks))
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				// a panicking check is reported, the worker carries on with the next check
+				var node string
+				if c.node != nil {
+					node = c.node.name
+				}
+				cctx, span := tracing.Start(ctx, "check "+c.check.Name(), tracing.KindInternal)
+				span.SetAttributes("node", node, "check", c.check.Name())
+				if !safeRun(s.nf, node, c.check.Name()+" check", func() { c.check.Run(cctx, s.nf) }) {
+					span.SetError(errors.New("check panicked"))
+				}
+				span.End()
+				select {
+				case done <- c:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	running := make(map[*Node]int)
+	waiting := make(map[*Node][]*scheduledCheck)
+	var ready []*scheduledCheck
+	enqueue := func(c *scheduledCheck) {
+		c.busy = true
+		if running[c.node] >= s.perNode {
+			waiting[c.node] = append(waiting[c.node], c)
+			return
+		}
+		running[c.node]++
+		ready = append(ready, c)
+	}
+
+	for {
+		var due <-chan time.Time
+		var timer *time.Timer
+		if len(sched) > 0 {
+			timer = time.NewTimer(time.Until(sched[0].next))
+			due = timer.C
+		}
+		var send chan<- *scheduledCheck
+		var next *scheduledCheck
+		if len(ready) > 0 {
+			send, next = jobs, ready[0]
+		}
+		select {
+		case <-ctx.Done():
+		case send <- next:
+			ready = ready[1:]
+		case c := <-done:
+			c.busy = false
+			running[c.node]--
+			if w := waiting[c.node]; len(w) > 0 {
+				waiting[c.node] = w[1:]
+				running[c.node]++
+				ready = append(ready, w[0])
+			}
+		case checks := <-s.added:
+			s.checks = append(s.checks, checks...)
+			now := time.Now()
+			for _, c := range checks {
+				// the first run is spread like at the start, but within a few seconds at most
+				c.busy = false
+				c.next = now.Add(time.Duration(rand.Int63n(int64(min(c.check.Interval(), 5*time.Second)))))
+				heap.Push(&sched, c)
+			}
+		case n := <-s.removed:
+			checks := s.checks[:0:0]
+			for _, c := range s.checks {
+				if c.node != n {
+					checks = append(checks, c)
+				}
+			}
+			s.checks = checks
+			kept := sched[:0]
+			for _, c := range sched {
+				if c.node != n {
+					c.index = len(kept)
+					kept = append(kept, c)
+				}
+			}
+			sched = kept
+			heap.Init(&sched)
+			pending := ready[:0:0]
+			for _, c := range ready {
+				if c.node == n {
+					running[n]--
+					continue
+				}
+				pending = append(pending, c)
+			}
+			ready = pending
+			delete(waiting, n)
+		case now := <-due:
+			for len(sched) > 0 && !sched[0].next.After(now) {
+				c := sched[0]
+				if !c.busy {
+					enqueue(c)
+				}
+				c.next = c.next.Add(c.check.Interval())
+				if c.next.Before(now) {
+					c.next = now.Add(c.check.Interval())
+				}
+				heap.Fix(&sched, 0)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package insync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrency tracks the checks running at the same time, per node and in total.
+type concurrency struct {
+	mu               sync.Mutex
+	running, peak    map[*Node]int
+	total, peakTotal int
+}
+
+// busyCheck is a check which takes a while, tracking how many checks run alongside it.
+type busyCheck struct {
+	node *Node
+	c    *concurrency
+}
+
+func (b busyCheck) Name() string { return "busy" }
+
+func (b busyCheck) Interval() time.Duration { return 5 * time.Millisecond }
+
+func (b busyCheck) Run(ctx context.Context, _ Notifier) {
+	c := b.c
+	c.mu.Lock()
+	c.running[b.node]++
+	if c.running[b.node] > c.peak[b.node] {
+		c.peak[b.node] = c.running[b.node]
+	}
+	c.total++
+	if c.total > c.peakTotal {
+		c.peakTotal = c.total
+	}
+	c.mu.Unlock()
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	c.running[b.node]--
+	c.total--
+	c.mu.Unlock()
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		perNode int
+		// checks is the number of checks of each of the two nodes
+		checks int
+		// wantNode and wantTotal are the peaks of the checks running at the same time
+		wantNode  int
+		wantTotal int
+	}{
+		{name: "one check per node", workers: 8, perNode: 1, checks: 4, wantNode: 1, wantTotal: 2},
+		{name: "two checks per node", workers: 8, perNode: 2, checks: 4, wantNode: 2, wantTotal: 4},
+		{name: "workers bound the total", workers: 3, perNode: 2, checks: 4, wantNode: 2, wantTotal: 3},
+		{name: "fewer checks than the limit", workers: 8, perNode: 4, checks: 2, wantNode: 2, wantTotal: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &concurrency{running: make(map[*Node]int), peak: make(map[*Node]int)}
+			nodes := []*Node{{name: "node-1"}, {name: "node-2"}}
+			var checks []*scheduledCheck
+			for _, n := range nodes {
+				for i := 0; i < tt.checks; i++ {
+					checks = append(checks, &scheduledCheck{check: busyCheck{node: n, c: c}, node: n})
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			newScheduler(Notifiers{}, SchedulerConfig{Workers: tt.workers, PerNode: tt.perNode}, checks).run(ctx)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for _, n := range nodes {
+				if c.peak[n] != tt.wantNode {
+					t.Fatalf("got %d checks of %s at the same time, want %d", c.peak[n], n.name, tt.wantNode)
+				}
+			}
+			if c.peakTotal != tt.wantTotal {
+				t.Fatalf("got %d checks at the same time, want %d", c.peakTotal, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// countCheck counts its runs per node.
+type countCheck struct {
+	node     *Node
+	interval time.Duration
+	mu       *sync.Mutex
+	runs     map[*Node]int
+}
+
+func (c countCheck) Name() string { return "count" }
+
+func (c countCheck) Interval() time.Duration { return c.interval }
+
+func (c countCheck) Run(context.Context, Notifier) {
+	c.mu.Lock()
+	c.runs[c.node]++
+	c.mu.Unlock()
+}
+
+func TestSchedulerRuntimeChanges(t *testing.T) {
+	var mu sync.Mutex
+	runs := make(map[*Node]int)
+	check := func(n *Node, interval time.Duration) *scheduledCheck {
+		return &scheduledCheck{check: countCheck{node: n, interval: interval, mu: &mu, runs: runs}, node: n}
+	}
+	removed, added, idle := &Node{name: "removed"}, &Node{name: "added"}, &Node{name: "idle"}
+	s := newScheduler(Notifiers{}, SchedulerConfig{Workers: 2, PerNode: 1}, []*scheduledCheck{check(removed, time.Millisecond), check(idle, 0)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(stopped)
+	}()
+	s.add(ctx, []*scheduledCheck{check(added, time.Millisecond)})
+	s.remove(ctx, removed)
+	cancel()
+	<-stopped
+
+	// a restarted run, e.g. after a panic, schedules the checks as they were changed at runtime
+	mu.Lock()
+	for n := range runs {
+		delete(runs, n)
+	}
+	mu.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runs[added] == 0 {
+		t.Fatal("the check added at runtime didn't run after the restart")
+	}
+	if runs[removed] != 0 {
+		t.Fatalf("the check removed at runtime ran %d times after the restart", runs[removed])
+	}
+	if runs[idle] != 0 {
+		t.Fatalf("the check without interval ran %d times", runs[idle])
+	}
+}
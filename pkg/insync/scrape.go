@@ -0,0 +1,320 @@
+package insync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricRuleConfig derives a check from a metric of the client, e.g. the goroutines of geth.
+type MetricRuleConfig struct {
+	// Name of the rule in the alerts, defaults to the metric.
+	Name   string `yaml:"name"`
+	Metric string `yaml:"metric"`
+	// Labels select the series of the metric, the values of all matching series are summed up.
+	Labels map[string]string `yaml:"labels"`
+	// Rate uses the increase per second between two scrapes instead of the value, e.g. of the head block.
+	Rate bool `yaml:"rate"`
+	// Min and Max are the bounds of the value, an alert is sent once it's outside. At least one is required.
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+}
+
+// MetricsCheckConfig configures the checks derived from the prometheus metrics of the clients.
+type MetricsCheckConfig struct {
+	CheckConfig `yaml:",inline"`
+	Rules       []MetricRuleConfig `yaml:"rules"`
+}
+
+// Finalize applies the defaults and validates the rules.
+func (c *MetricsCheckConfig) Finalize() error {
+	c.CheckConfig.Finalize()
+	names := make(map[string]bool)
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Metric == "" {
+			return fmt.Errorf("metrics rule %d: missing metric", i)
+		}
+		if r.Name == "" {
+			r.Name = r.Metric
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate metrics rule %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Min == nil && r.Max == nil {
+			return fmt.Errorf("metrics rule %s: missing min or max", r.Name)
+		}
+	}
+	if c.Interval > 0 && len(c.Rules) == 0 {
+		return errors.New("the metrics check needs rules")
+	}
+	return nil
+}
+
+// MetricsCheck scrapes the prometheus metrics endpoints of the node's clients, e.g. geth's
+// /debug/metrics/prometheus, and alerts once a rule's value is out of bounds. It covers signals which aren't
+// exposed over json-rpc, like the chaindata size or the goroutines. Every rule's value is recorded.
+type MetricsCheck struct {
+	n     *Node
+	cfg   MetricsCheckConfig
+	retry retryPolicy
+	// prev are the values and times of the previous scrape per rule, for the rates.
+	prev map[string]metricPoint
+	// out are the rules out of bounds.
+	out map[string]bool
+}
+
+type metricPoint struct {
+	value float64
+	time  time.Time
+}
+
+// NewMetricsCheck creates the metrics check of the node, the node must have metrics endpoints.
+func NewMetricsCheck(n *Node, cfg MetricsCheckConfig) *MetricsCheck {
+	c := &MetricsCheck{n: n, cfg: cfg, retry: newRetryPolicy(cfg.CheckConfig), prev: make(map[string]metricPoint), out: make(map[string]bool)}
+	for _, r := range cfg.Rules {
+		c.out[r.Name] = n.checkState("metric:"+r.Name) == "out"
+	}
+	return c
+}
+
+func (c *MetricsCheck) Name() string { return "metrics" }
+
+func (c *MetricsCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *MetricsCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var samples []metricSample
+	for _, u := range n.metrics {
+		var s []metricSample
+		err := c.retry.do(ctx, func(ctx context.Context) error {
+			var err error
+			s, err = scrapeMetrics(ctx, u)
+			return err
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("error scraping metrics", "node", n.name, "check", "metrics", "class", ClassifyError(err).String(), "err", err)
+			n.recordResult("metrics", "error", err.Error())
+			n.countCheckError("metrics")
+			return
+		}
+		samples = append(samples, s...)
+	}
+	now := time.Now()
+	for _, r := range c.cfg.Rules {
+		value, ok := sumSamples(samples, r.Metric, r.Labels)
+		if !ok {
+			slog.Debug("metric not found", "node", n.name, "check", "metrics", "metric", r.Metric)
+			continue
+		}
+		if r.Rate {
+			prev, ok := c.prev[r.Name]
+			c.prev[r.Name] = metricPoint{value: value, time: now}
+			if !ok || value < prev.value {
+				// the first scrape, or the client restarted
+				continue
+			}
+			value = (value - prev.value) / now.Sub(prev.time).Seconds()
+		}
+		c.observe(nf, r, value)
+	}
+}
+
+// observe records the value of the rule and alerts once it leaves or returns within the bounds.
+func (c *MetricsCheck) observe(nf Notifier, r MetricRuleConfig, value float64) {
+	n := c.n
+	var bound string
+	switch {
+	case r.Min != nil && value < *r.Min:
+		bound = fmt.Sprintf("below the minimum of %s", formatMetric(*r.Min))
+	case r.Max != nil && value > *r.Max:
+		bound = fmt.Sprintf("above the maximum of %s", formatMetric(*r.Max))
+	}
+	status := "ok"
+	if bound != "" {
+		status = "out"
+	}
+	n.record(CheckResult{Check: "metrics", Metric: r.Name, Status: status, Detail: fmt.Sprintf("%s %s", r.Name, formatMetric(value)), Value: value})
+	unit := ""
+	if r.Rate {
+		unit = "/s"
+	}
+	switch {
+	case bound != "" && !c.out[r.Name]:
+		slog.Warn("metric out of bounds", "node", n.name, "check", "metrics", "rule", r.Name, "value", value)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  r.Name + " out of bounds",
+			Name:     "NodeMetricOutOfBounds",
+			Key:      "metric:" + r.Name,
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text:     fmt.Sprintf("🟠 %s %s is at %s%s, %s", n.name, r.Name, formatMetric(value), unit, bound),
+		})
+		c.out[r.Name] = true
+		n.setCheckState("metric:"+r.Name, "out")
+	case bound == "" && c.out[r.Name]:
+		slog.Info("metric within bounds", "node", n.name, "check", "metrics", "rule", r.Name, "value", value)
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  r.Name + " within bounds again",
+			Name:     "NodeMetricOutOfBounds",
+			Key:      "metric:" + r.Name,
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 %s %s is back at %s%s", n.name, r.Name, formatMetric(value), unit),
+		})
+		c.out[r.Name] = false
+		n.setCheckState("metric:"+r.Name, "")
+	}
+}
+
+// formatMetric formats the value of a metric, large values like byte sizes rounded with thousands separators.
+func formatMetric(v float64) string {
+	if a := math.Abs(v); a >= 1000 && a < math.MaxInt64 {
+		if v < 0 {
+			return "-" + FormatNumber(uint64(math.Round(a)))
+		}
+		return FormatNumber(uint64(math.Round(a)))
+	}
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// metricSample is a sample of the prometheus text format.
+type metricSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// sumSamples sums up the values of the series of the metric matching the labels, false if there are none.
+func sumSamples(samples []metricSample, metric string, labels map[string]string) (float64, bool) {
+	var sum float64
+	var found bool
+	for _, s := range samples {
+		if s.name != metric {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if s.labels[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			sum += s.value
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// scrapeMetrics requests the metrics endpoint and parses the prometheus text format.
+func scrapeMetrics(ctx context.Context, url string) ([]metricSample, error) {
+	resp, err := httpGet(ctx, url, "text/plain", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return parseMetrics(resp.Body)
+}
+
+// parseMetrics parses the samples of the prometheus text format, the comments and invalid lines are skipped.
+func parseMetrics(r io.Reader) ([]metricSample, error) {
+	var samples []metricSample
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if s, ok := parseSample(line); ok {
+			samples = append(samples, s)
+		}
+	}
+	return samples, sc.Err()
+}
+
+// parseSample parses a line like name{label="value"} 1.5 [timestamp].
+func parseSample(line string) (metricSample, bool) {
+	s := metricSample{labels: make(map[string]string)}
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, false
+	}
+	s.name, line = line[:i], line[i:]
+	if line[0] == '{' {
+		rest, ok := parseLabels(line[1:], s.labels)
+		if !ok {
+			return s, false
+		}
+		line = rest
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return s, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, false
+	}
+	s.value = v
+	return s, true
+}
+
+// parseLabels parses the labels up to the closing brace into labels and returns the rest of the line.
+func parseLabels(s string, labels map[string]string) (string, bool) {
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return "", false
+		}
+		if s[0] == '}' {
+			return s[1:], true
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", false
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s, closed = s[i+1:], true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return "", false
+		}
+		labels[name] = value.String()
+	}
+}
@@ -0,0 +1,83 @@
+package insync
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// speedSmoothing is the weight of the latest sample in the moving average of the sync speed.
+const speedSmoothing = 0.3
+
+// syncSpeed tracks the block import rate and the trend of the lag between checks.
+type syncSpeed struct {
+	last Observation
+	// importRate is the moving average of imported blocks per second.
+	importRate float64
+	// lagRate is the moving average of the lag change per second, negative while catching up.
+	lagRate float64
+	samples int
+}
+
+// observe records an observation. Observations without sync progress reset the tracker.
+func (s *syncSpeed) observe(o Observation) {
+	if o.Sync == nil {
+		*s = syncSpeed{}
+		return
+	}
+	if s.last.Sync != nil && o.Time.After(s.last.Time) {
+		dt := o.Time.Sub(s.last.Time).Seconds()
+		imported := (float64(o.Sync.CurrentBlock) - float64(s.last.Sync.CurrentBlock)) / dt
+		lagChange := (float64(lag(o.Sync)) - float64(lag(s.last.Sync))) / dt
+		if s.samples == 0 {
+			s.importRate, s.lagRate = imported, lagChange
+		} else {
+			s.importRate = speedSmoothing*imported + (1-speedSmoothing)*s.importRate
+			s.lagRate = speedSmoothing*lagChange + (1-speedSmoothing)*s.lagRate
+		}
+		s.samples++
+	}
+	s.last = o
+}
+
+// rate returns the moving average of the block import rate, false while the node isn't syncing or there aren't enough samples.
+func (s *syncSpeed) rate() (float64, bool) {
+	if s.samples == 0 || s.last.Sync == nil {
+		return 0, false
+	}
+	return s.importRate, true
+}
+
+// describe summarizes the speed, e.g. "lag 1,240 blocks, catching up at 8.3 blocks/s, ETA 2h30m".
+// It returns an empty string if there aren't enough samples yet.
+func (s *syncSpeed) describe() string {
+	if s.samples == 0 || s.last.Sync == nil {
+		return ""
+	}
+	l := lag(s.last.Sync)
+	msg := fmt.Sprintf("Lag %s blocks, importing %.1f blocks/s", FormatNumber(l), s.importRate)
+	switch {
+	case s.lagRate < 0:
+		msg += fmt.Sprintf(", catching up at %.1f blocks/s", -s.lagRate)
+		if eta, ok := s.eta(); ok {
+			msg += ", ETA " + FormatDuration(eta)
+		}
+	case s.lagRate > 0:
+		msg += fmt.Sprintf(", falling behind at %.1f blocks/s", s.lagRate)
+	default:
+		msg += ", lag unchanged"
+	}
+	return msg
+}
+
+// eta estimates the time until the node is in sync, based on the current trend of the lag.
+func (s *syncSpeed) eta() (time.Duration, bool) {
+	if s.lagRate >= 0 || s.last.Sync == nil {
+		return 0, false
+	}
+	secs := float64(lag(s.last.Sync)) / -s.lagRate
+	if math.IsInf(secs, 0) || secs > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, false
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
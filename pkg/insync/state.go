@@ -0,0 +1,432 @@
+package insync
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxHistory is the number of closed incidents kept in the state.
+const maxHistory = 50
+
+const (
+	ActionAcknowledged = "acknowledged"
+	ActionSnoozed      = "snoozed"
+	ActionResolved     = "resolved"
+	ActionRemediated   = "remediated"
+)
+
+// incidentState is the persisted form of an incident.
+// It allows insync to pick up an ongoing incident after a restart instead of alerting again.
+type incidentState struct {
+	Start        time.Time        `json:"start"`
+	StartLag     uint64           `json:"start_lag"`
+	PeakLag      uint64           `json:"peak_lag"`
+	Acknowledged bool             `json:"acknowledged"`
+	SnoozedUntil time.Time        `json:"snoozed_until,omitempty"`
+	Actions      []IncidentAction `json:"actions,omitempty"`
+	State        string           `json:"state"`
+	ID           string           `json:"id"`
+	// Messages are the root messages of the incident thread, keyed by chat.
+	Messages map[int64]int64 `json:"messages,omitempty"`
+}
+
+// IncidentAction is an entry of the audit trail of an incident.
+type IncidentAction struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// IncidentRecord describes an open or closed incident.
+type IncidentRecord struct {
+	ID      string    `json:"id"`
+	Node    string    `json:"node"`
+	State   string    `json:"state"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end,omitempty"`
+	PeakLag uint64    `json:"peak_lag"`
+	// CatchUpRate is the average block import rate in blocks/s while the node caught up, 0 for open incidents
+	// and if it wasn't syncing.
+	CatchUpRate float64 `json:"catch_up_rate,omitempty"`
+	// ResolvedBy is the user who resolved the incident manually, empty if the node recovered.
+	ResolvedBy string           `json:"resolved_by,omitempty"`
+	Actions    []IncidentAction `json:"actions,omitempty"`
+}
+
+// StateStore persists the ongoing incidents of all nodes and the recently closed incidents to a single file.
+type StateStore struct {
+	sync.Mutex
+	path string
+	// cipher encrypts the state file, nil if it's unencrypted.
+	cipher *Cipher
+	data   stateData
+}
+
+type stateData struct {
+	Incidents map[string]incidentState `json:"incidents"`
+	History   []IncidentRecord         `json:"history"`
+	// Checks are the last alerted states of the checks, keyed by node and check, so a restart neither
+	// repeats their alerts nor forgets to resolve them.
+	Checks map[string]map[string]string `json:"checks,omitempty"`
+	// Mutes are the muted nodes, AllNodes mutes every node.
+	Mutes map[string]Mute `json:"mutes,omitempty"`
+	// Tenants are the chats which registered their own nodes, keyed by chat.
+	Tenants map[int64]Tenant `json:"tenants,omitempty"`
+	// Paused is the pause of the automated remediation, nil if it isn't paused.
+	Paused *Mute `json:"paused,omitempty"`
+	// Remediations are the times of the remediations of the last day, keyed by node.
+	Remediations map[string][]time.Time `json:"remediations,omitempty"`
+}
+
+// AllNodes is the node name muting all nodes.
+const AllNodes = "all"
+
+// Tenant is a chat which registered its own nodes at runtime, see the tenants of the README.
+type Tenant struct {
+	Chat  int64        `json:"chat"`
+	Nodes []TenantNode `json:"nodes,omitempty"`
+	// QuietHours are the quiet hours of the chat, e.g. 23:00-07:00, none if empty.
+	QuietHours string `json:"quiet_hours,omitempty"`
+}
+
+// TenantNode is a node registered by a tenant.
+type TenantNode struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Chain is the chain the tenant expects the node on, e.g. mainnet, detected if empty.
+	Chain   string    `json:"chain,omitempty"`
+	User    string    `json:"user"`
+	Created time.Time `json:"created"`
+}
+
+// Mute suppresses the alerts of a node.
+type Mute struct {
+	User string `json:"user"`
+	// Until is the end of the mute, zero if the node is muted until it's unmuted.
+	Until time.Time `json:"until,omitempty"`
+}
+
+// LoadState reads the state file. A missing state file results in an empty state.
+// If path is empty, the state is kept in memory only.
+func LoadState(path string) (*StateStore, error) {
+	return LoadEncryptedState(path, nil)
+}
+
+// LoadEncryptedState is like LoadState but encrypts the state file with the cipher.
+// An unencrypted state file is read as well and encrypted with the next change.
+func LoadEncryptedState(path string, c *Cipher) (*StateStore, error) {
+	st := &StateStore{path: path, cipher: c, data: stateData{Incidents: make(map[string]incidentState)}}
+	if path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if data, err = c.Open(data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.data); err != nil {
+		return nil, err
+	}
+	if st.data.Incidents == nil {
+		// state files of older versions only contain the incidents
+		if err := json.Unmarshal(data, &st.data.Incidents); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// Incident returns the incident of the given node, restored from the state.
+func (s *StateStore) Incident(name string) *Incident {
+	s.Lock()
+	defer s.Unlock()
+	inc := &Incident{name: name, store: s}
+	if st, ok := s.data.Incidents[name]; ok {
+		inc.start = st.Start
+		inc.startLag = st.StartLag
+		inc.peakLag = st.PeakLag
+		inc.acknowledged = st.Acknowledged
+		inc.snoozedUntil = st.SnoozedUntil
+		inc.actions = st.Actions
+		inc.id = st.ID
+		inc.messages = st.Messages
+		inc.state = StateSyncing
+		if state, ok := ParseNodeState(st.State); ok {
+			inc.state = state
+		}
+		inc.lastReminder = time.Now()
+	}
+	return inc
+}
+
+// checkState returns the persisted state of the check of the node, empty if there is none.
+func (s *StateStore) checkState(node, check string) string {
+	s.Lock()
+	defer s.Unlock()
+	return s.data.Checks[node][check]
+}
+
+// setCheckState persists the state of the check of the node, an empty state removes it.
+func (s *StateStore) setCheckState(node, check, state string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.data.Checks[node][check] == state {
+		return
+	}
+	if state == "" {
+		delete(s.data.Checks[node], check)
+		if len(s.data.Checks[node]) == 0 {
+			delete(s.data.Checks, node)
+		}
+	} else {
+		if s.data.Checks == nil {
+			s.data.Checks = make(map[string]map[string]string)
+		}
+		if s.data.Checks[node] == nil {
+			s.data.Checks[node] = make(map[string]string)
+		}
+		s.data.Checks[node][check] = state
+	}
+	if err := s.write(); err != nil {
+		slog.Error("error saving state", "err", err)
+	}
+}
+
+// MuteNode suppresses the alerts of the node, or of all nodes with AllNodes, for the given duration.
+// A duration of 0 mutes the node until it's unmuted.
+func (s *StateStore) MuteNode(node, user string, d time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+	m := Mute{User: user}
+	if d > 0 {
+		m.Until = time.Now().Add(d)
+	}
+	if s.data.Mutes == nil {
+		s.data.Mutes = make(map[string]Mute)
+	}
+	s.data.Mutes[node] = m
+	return s.write()
+}
+
+// UnmuteNode removes the mute of the node. It returns false if the node wasn't muted.
+func (s *StateStore) UnmuteNode(node string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.data.Mutes[node]; !ok {
+		return false, nil
+	}
+	delete(s.data.Mutes, node)
+	return true, s.write()
+}
+
+// PauseAutomation pauses the automated remediation for the given duration, until it's resumed with a duration of 0.
+func (s *StateStore) PauseAutomation(user string, d time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+	p := &Mute{User: user}
+	if d > 0 {
+		p.Until = time.Now().Add(d)
+	}
+	s.data.Paused = p
+	return s.write()
+}
+
+// ResumeAutomation ends the pause of the automated remediation. It returns false if it wasn't paused.
+func (s *StateStore) ResumeAutomation() (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.data.Paused == nil {
+		return false, nil
+	}
+	s.data.Paused = nil
+	return true, s.write()
+}
+
+// AutomationPaused returns the pause of the automated remediation, false if it isn't paused.
+func (s *StateStore) AutomationPaused() (Mute, bool) {
+	s.Lock()
+	defer s.Unlock()
+	p := s.data.Paused
+	if p == nil || (!p.Until.IsZero() && time.Now().After(p.Until)) {
+		return Mute{}, false
+	}
+	return *p, true
+}
+
+// remediationWindow is the time the remediations are kept for.
+const remediationWindow = 24 * time.Hour
+
+// RecordRemediation records a remediation of the node, the remediations are kept for a day.
+func (s *StateStore) RecordRemediation(node string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.data.Remediations == nil {
+		s.data.Remediations = make(map[string][]time.Time)
+	}
+	s.data.Remediations[node] = append(s.recentRemediations(node), time.Now())
+	return s.write()
+}
+
+// Remediations returns the number of remediations of the node within the last day.
+func (s *StateStore) Remediations(node string) int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.recentRemediations(node))
+}
+
+// recentRemediations returns the remediations of the node within the last day. s must be locked.
+func (s *StateStore) recentRemediations(node string) []time.Time {
+	var recent []time.Time
+	for _, t := range s.data.Remediations[node] {
+		if time.Since(t) < remediationWindow {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// Muted returns the mute of the node, either its own or the one of all nodes.
+func (s *StateStore) Muted(node string) (Mute, bool) {
+	s.Lock()
+	defer s.Unlock()
+	for _, name := range []string{node, AllNodes} {
+		m, ok := s.data.Mutes[name]
+		if ok && (m.Until.IsZero() || time.Now().Before(m.Until)) {
+			return m, true
+		}
+	}
+	return Mute{}, false
+}
+
+// Mutes returns the active mutes, keyed by node.
+func (s *StateStore) Mutes() map[string]Mute {
+	s.Lock()
+	defer s.Unlock()
+	mutes := make(map[string]Mute, len(s.data.Mutes))
+	for name, m := range s.data.Mutes {
+		if m.Until.IsZero() || time.Now().Before(m.Until) {
+			mutes[name] = m
+		}
+	}
+	return mutes
+}
+
+// Tenants returns the registered tenants.
+func (s *StateStore) Tenants() []Tenant {
+	s.Lock()
+	defer s.Unlock()
+	tenants := make([]Tenant, 0, len(s.data.Tenants))
+	for _, t := range s.data.Tenants {
+		tenants = append(tenants, t)
+	}
+	return tenants
+}
+
+// SaveTenant persists the tenant, a tenant without nodes and preferences is removed.
+func (s *StateStore) SaveTenant(t Tenant) error {
+	s.Lock()
+	defer s.Unlock()
+	if len(t.Nodes) == 0 && t.QuietHours == "" {
+		delete(s.data.Tenants, t.Chat)
+		return s.write()
+	}
+	if s.data.Tenants == nil {
+		s.data.Tenants = make(map[int64]Tenant)
+	}
+	s.data.Tenants[t.Chat] = t
+	return s.write()
+}
+
+// MuteFilter returns a notifier which drops the alerts of muted nodes before passing them on.
+// Resolutions are always passed on, so no alert stays open at the destination.
+func (s *StateStore) MuteFilter(nf Notifier) Notifier {
+	return &muteFilter{store: s, nf: nf}
+}
+
+type muteFilter struct {
+	store *StateStore
+	nf    Notifier
+}
+
+func (f *muteFilter) Send(a Alert) error {
+	if m, ok := f.store.Muted(a.Node); ok && !a.Resolved {
+		slog.Info("dropping muted alert", "node", a.Node, "alert", a.Name, "muted_by", m.User)
+		return nil
+	}
+	return f.nf.Send(a)
+}
+
+// save updates the state of the given node and writes it to disk. A nil state removes the node from the state.
+func (s *StateStore) save(name string, st *incidentState) error {
+	s.Lock()
+	defer s.Unlock()
+	if st == nil {
+		delete(s.data.Incidents, name)
+	} else {
+		s.data.Incidents[name] = *st
+	}
+	return s.write()
+}
+
+// archive adds a closed incident to the history.
+func (s *StateStore) archive(r IncidentRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	s.data.History = append(s.data.History, r)
+	if len(s.data.History) > maxHistory {
+		s.data.History = s.data.History[len(s.data.History)-maxHistory:]
+	}
+	return s.write()
+}
+
+// History returns the most recently closed incidents, newest first.
+func (s *StateStore) History(limit int) []IncidentRecord {
+	s.Lock()
+	defer s.Unlock()
+	var records []IncidentRecord
+	for i := len(s.data.History) - 1; i >= 0 && len(records) < limit; i-- {
+		records = append(records, s.data.History[i])
+	}
+	return records
+}
+
+// write writes the state to disk. The caller must hold the lock.
+func (s *StateStore) write() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, s.cipher.Seal(data))
+}
+
+// writeFileAtomic writes to a temporary file first and renames it afterwards,
+// so a crash never leaves a partially written file behind.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
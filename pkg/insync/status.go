@@ -0,0 +1,148 @@
+package insync
+
+import (
+	"sync"
+	"time"
+)
+
+// NodeStatus is the latest known status of a node, e.g. for metrics.
+type NodeStatus struct {
+	State NodeState
+	// Chain is the configured or detected chain, e.g. mainnet, and Client the client type, e.g. geth.
+	// Both are empty until they are detected.
+	Chain  string
+	Client string
+	// CurrentBlock and HighestBlock are 0 until the first successful sync check.
+	CurrentBlock uint64
+	HighestBlock uint64
+	// Peers is the peer count, -1 if it isn't checked.
+	Peers int64
+	// Latency is the response time of the last successful eth_syncing call, 0 until the first one.
+	Latency time.Duration
+	// Fallback is the host of the fallback endpoint the node is monitored through, empty while the primary is used.
+	Fallback string
+	// DiskUsage is the usage of the disk of the data directory in percent, 0 until the first disk check.
+	DiskUsage float64
+	// CheckErrors counts the failed runs per check.
+	CheckErrors map[string]uint64
+	// Beacon is the sync status of the beacon node, nil until the first beacon sync check.
+	Beacon *BeaconSyncStatus
+}
+
+// BeaconSyncStatus is the sync status of a beacon node as reported by /eth/v1/node/syncing.
+type BeaconSyncStatus struct {
+	HeadSlot     uint64
+	SyncDistance uint64
+	// WallSlot is the slot of the wall clock, for comparison with the head slot.
+	WallSlot uint64
+	// Optimistic is set while the beacon node imports the blocks without the execution payloads being verified.
+	Optimistic bool
+}
+
+// Behind returns the number of slots the head slot is behind the wall-clock slot.
+func (b BeaconSyncStatus) Behind() uint64 {
+	if b.WallSlot > b.HeadSlot {
+		return b.WallSlot - b.HeadSlot
+	}
+	return 0
+}
+
+// nodeStatus is updated by the checks and read by Status.
+type nodeStatus struct {
+	mu     sync.Mutex
+	status NodeStatus
+	// identified is set once the detection of the chain and the client ran on the current connection.
+	identified bool
+}
+
+// Status returns a snapshot of the latest known status of the node.
+func (n *Node) Status() NodeStatus {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	st := n.status.status
+	st.CheckErrors = make(map[string]uint64, len(n.status.status.CheckErrors))
+	for check, count := range n.status.status.CheckErrors {
+		st.CheckErrors[check] = count
+	}
+	st.Fallback, _ = n.fallback()
+	return st
+}
+
+// setState records the state of the node.
+func (n *Node) setState(state NodeState) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.State = state
+}
+
+// setBlocks records the current and the highest block of the node.
+func (n *Node) setBlocks(current, highest uint64) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.CurrentBlock, n.status.status.HighestBlock = current, highest
+}
+
+// setLatency records the response time of the node.
+func (n *Node) setLatency(d time.Duration) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.Latency = d
+}
+
+// latency returns the response time of the last successful eth_syncing call.
+func (n *Node) latency() time.Duration {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	return n.status.status.Latency
+}
+
+// setDiskUsage records the disk usage of the data directory.
+func (n *Node) setDiskUsage(usage float64) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.DiskUsage = usage
+}
+
+// setIdentity records the chain and the client type of the node, empty values are ignored.
+func (n *Node) setIdentity(chain, client string) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	if chain != "" {
+		n.status.status.Chain = chain
+	}
+	if client != "" {
+		n.status.status.Client = client
+	}
+}
+
+// resetIdentity detects the client type again, the node might have been upgraded while it was unreachable.
+func (n *Node) resetIdentity() {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.Client, n.status.identified = "", false
+}
+
+// setBeaconSync records the sync status of the beacon node.
+func (n *Node) setBeaconSync(b BeaconSyncStatus) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	// the snapshots share the pointer, it's replaced instead of modified
+	n.status.status.Beacon = &b
+}
+
+// setPeers records the peer count of the node.
+func (n *Node) setPeers(peers uint64) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	n.status.status.Peers = int64(peers)
+}
+
+// countCheckError counts a failed run of the check.
+func (n *Node) countCheckError(check string) {
+	n.status.mu.Lock()
+	defer n.status.mu.Unlock()
+	if n.status.status.CheckErrors == nil {
+		n.status.status.CheckErrors = make(map[string]uint64)
+	}
+	n.status.status.CheckErrors[check]++
+}
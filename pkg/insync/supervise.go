@@ -0,0 +1,48 @@
+package insync
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// restartDelay is the delay before a crashed worker is restarted, so a worker panicking right away doesn't spin.
+const restartDelay = time.Second
+
+// Supervise runs f and restarts it whenever it panics, until it returns normally.
+// Every panic is logged with its stack and alerted to the notifier.
+// The node is the node the worker belongs to, empty for workers of insync itself.
+func Supervise(nf Notifier, node, worker string, f func()) {
+	for !safeRun(nf, node, worker, f) {
+		time.Sleep(restartDelay)
+	}
+}
+
+// safeRun runs f, recovering a panic. It reports whether f returned normally.
+func safeRun(nf Notifier, node, worker string, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			crashed(nf, node, worker, r)
+		}
+	}()
+	f()
+	return true
+}
+
+// crashed logs and alerts the panic of a worker.
+func crashed(nf Notifier, node, worker string, r interface{}) {
+	slog.Error("worker panicked", "node", node, "worker", worker, "panic", r, "stack", string(debug.Stack()))
+	if node == "" {
+		node = SelfNode
+	}
+	sendAlert(nf, Alert{
+		Node:     node,
+		Summary:  "monitoring worker crashed",
+		Name:     "InsyncWorkerCrashed",
+		Key:      "crash",
+		Icon:     "💥",
+		Severity: SeverityWarning,
+		Text:     fmt.Sprintf("💥 %s: the monitoring bot crashed and restarted its %s worker\nPanic: %v", node, worker, r),
+	})
+}
@@ -0,0 +1,350 @@
+package insync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// SyncCheck tracks the sync state of a node, alerts on state changes and reminds
+// about ongoing incidents.
+//
+// The check is a pipeline: Run polls the node and sends the observation over a channel
+// to the consumer, which alone owns the state machine, the speed tracker and the reminders.
+type SyncCheck struct {
+	n                *Node
+	cfg              SyncCheckConfig
+	reminderInterval time.Duration
+	errs             *errorTracker
+	retry            retryPolicy
+	observations     chan Observation
+
+	// owned by the consumer
+	m     *Machine
+	speed syncSpeed
+	// initial is set while the node is doing its initial sync, see trackInitialSync.
+	initial *initialSync
+}
+
+// NewSyncCheck creates the sync check of the node. Reminders are disabled if the reminder interval is 0.
+func NewSyncCheck(n *Node, cfg SyncCheckConfig, reminderInterval time.Duration) *SyncCheck {
+	// pick up an incident that was ongoing before a restart, so it's neither alerted twice nor resolved without cause
+	state, since := n.inc.current()
+	if state == StateHealthy {
+		// e.g. a degraded node, which doesn't open an incident
+		if s, ok := ParseNodeState(n.checkState("sync")); ok {
+			state = s
+		}
+	}
+	n.setState(state)
+	return &SyncCheck{
+		n:                n,
+		cfg:              cfg,
+		reminderInterval: reminderInterval,
+		m:                NewMachine(cfg, state, since),
+		errs:             newErrorTracker(n.name, "sync", cfg.ErrorThreshold),
+		retry:            newRetryPolicy(cfg.CheckConfig),
+		observations:     make(chan Observation, 1),
+	}
+}
+
+func (c *SyncCheck) Name() string { return "sync" }
+
+func (c *SyncCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+// Run polls the sync progress of the node and passes the observation on to the consumer.
+func (c *SyncCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	if n.LastError() == nil {
+		// before the sync progress, so a failed detection doesn't stick as the last error
+		n.identify(ctx, c.retry)
+	}
+	var sync *ethereum.SyncProgress
+	var err error
+	if n.light {
+		sync, err = n.lightProgress(ctx, c.retry)
+	} else {
+		sync, err = n.syncProgress(ctx, c.retry)
+	}
+	if ctx.Err() != nil {
+		// the check was interrupted by the shutdown, it says nothing about the node
+		return
+	}
+	if err != nil {
+		slog.Warn("error checking sync status", "node", n.name, "check", "sync", "class", ClassifyError(err).String(), "err", err)
+		n.countCheckError("sync")
+	} else if sync != nil {
+		n.setBlocks(sync.CurrentBlock, sync.HighestBlock)
+	} else {
+		// in sync, neither eth_syncing nor the light mode report the head
+		var head hexutil.Uint64
+		if err := n.call(ctx, c.retry, &head, "eth_blockNumber"); err == nil {
+			n.setBlocks(uint64(head), uint64(head))
+		}
+	}
+	if err == nil {
+		st := n.Status()
+		slog.Debug("checked sync status", "node", n.name, "check", "sync", "block", st.CurrentBlock, "highest", st.HighestBlock)
+		n.markSucceeded()
+	}
+	n.markChecked()
+	c.errs.observe(nf, err)
+	select {
+	case c.observations <- Observation{Time: time.Now(), Sync: sync, Err: err, span: tracing.FromContext(ctx).Context()}:
+	case <-ctx.Done():
+	}
+}
+
+// Probe runs the check once and returns the state the observation points to, without the debouncing of the
+// state machine and without alerting, e.g. for check plugins. The error is why the node is unreachable.
+func (c *SyncCheck) Probe(ctx context.Context) (NodeState, error) {
+	c.Run(ctx, Notifiers{})
+	select {
+	case o := <-c.observations:
+		return c.m.classify(o), o.Err
+	default:
+		// interrupted, the context is done
+		return StateUnreachable, ctx.Err()
+	}
+}
+
+// consume feeds the observations to the state machine until the context is done.
+func (c *SyncCheck) consume(ctx context.Context, nf Notifier) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-c.observations:
+			c.observe(nf, o)
+		}
+	}
+}
+
+// observe alerts the state change caused by the observation, or reminds about the ongoing incident.
+func (c *SyncCheck) observe(nf Notifier, o Observation) {
+	n := c.n
+	span := tracing.StartFrom(o.span, "evaluate", tracing.KindInternal)
+	defer span.End()
+	o.span = span.Context()
+	if o.Err == nil {
+		c.speed.observe(o)
+		n.inc.observeLag(lag(o.Sync))
+		if rate, ok := c.speed.rate(); ok {
+			n.inc.observeRate(rate)
+		}
+	}
+	c.trackInitialSync(nf, o)
+	if n.inc.takeResolved() {
+		// the incident was resolved by hand, a node which stays unhealthy opens a new one
+		c.m.Rearm()
+	}
+	t, changed := c.m.Observe(o)
+	span.SetAttributes("node", n.name, "check", "sync", "state", c.m.state.String(), "changed", changed)
+	n.setState(c.m.state)
+	r := CheckResult{Check: "sync", Status: c.m.state.String(), Detail: observationDetail(o)}
+	if o.Err == nil {
+		r.Value, r.Latency = float64(lag(o.Sync)), n.latency()
+		r.Rate, _ = c.speed.rate()
+	}
+	n.record(r)
+	if changed {
+		if c.silent(t) {
+			// the progress message reports the initial sync
+			handleTransition(n, Notifiers{}, t)
+		} else {
+			handleTransition(n, nf, t)
+		}
+		c.finishInitialSync(nf, t)
+		return
+	}
+	if c.initial != nil && c.m.state != StateUnreachable {
+		return
+	}
+	if n.inc.reminderDue(c.reminderInterval) {
+		state := c.m.state
+		slog.Info("node state unchanged", "node", n.name, "check", "sync", "state", state.String())
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "still " + stateSummaries[state],
+			Icon:     "🟠",
+			Name:     stateAlertNames[state],
+			Key:      "sync",
+			Severity: SeverityWarning,
+			Text:     reminderMsg(n.name, state, o, n.inc, c.speed.describe()) + incidentFooter(n.inc.ID()),
+			Incident: n.inc,
+			Span:     o.span,
+		})
+	}
+}
+
+// stateSummaries describe the states in a few words, used for grouping alerts.
+var stateSummaries = map[NodeState]string{
+	StateHealthy:     "back in sync",
+	StateDegraded:    "lagging behind",
+	StateSyncing:     "out of sync",
+	StateUnreachable: "unreachable",
+}
+
+// stateAlertNames are the alert names of the unhealthy states.
+var stateAlertNames = map[NodeState]string{
+	StateDegraded:    "NodeDegraded",
+	StateSyncing:     "NodeOutOfSync",
+	StateUnreachable: "NodeUnreachable",
+}
+
+// handleTransition sends the alert for the state change and keeps track of the incident.
+// An incident is opened once a node is out of sync or unreachable and closed when the node is healthy again.
+func handleTransition(n *Node, nf Notifier, t Transition) {
+	slog.Info("node state changed", "node", n.name, "check", "sync", "from", t.From.String(), "to", t.To.String(), "block", n.Status().CurrentBlock)
+	if n.recorder != nil {
+		n.recorder.RecordTransition(TransitionRecord{Time: time.Now(), Node: n.name, From: t.From.String(), To: t.To.String(), Since: t.Since})
+	}
+	if t.To == StateHealthy {
+		n.setCheckState("sync", "")
+	} else {
+		n.setCheckState("sync", t.To.String())
+	}
+	a := Alert{
+		Node:     n.name,
+		Summary:  stateSummaries[t.To],
+		Name:     stateAlertNames[t.To],
+		Key:      "sync",
+		Resolved: t.To == StateHealthy,
+		Span:     t.Obs.span,
+	}
+	switch t.To {
+	case StateHealthy:
+		ongoing := n.inc.Ongoing()
+		d, peak := n.inc.close()
+		a.Icon, a.Severity, a.Text = "🟢", SeverityInfo, inSyncMsg(n.name, d, peak)
+		if ongoing {
+			a.Incident = n.inc
+		}
+	case StateDegraded:
+		a.Icon, a.Severity, a.Text = "🟡", SeverityWarning, degradedMsg(n.name, t.Obs.Sync)
+		if n.inc.Ongoing() {
+			n.inc.update(t.To)
+			a.Incident = n.inc
+		}
+	case StateSyncing, StateUnreachable:
+		a.Icon, a.Severity = "🔴", SeverityCritical
+		if t.To == StateSyncing {
+			a.Text = outOfSyncMsg(n.name, t.Obs.Sync, time.Since(t.Since))
+		} else {
+			a.Text = unreachableMsg(n.name, t.Obs.Err, time.Since(t.Since))
+			a.Summary = fmt.Sprintf("%s (%s)", a.Summary, ClassifyError(t.Obs.Err))
+		}
+		if n.inc.Ongoing() {
+			n.inc.update(t.To)
+		} else {
+			n.inc.open(t.Since, lag(t.Obs.Sync), t.To)
+		}
+		a.Incident = n.inc
+	}
+	if a.Incident != nil {
+		a.Text += incidentFooter(a.Incident.ID())
+	}
+	if err := nf.Send(a); err != nil {
+		slog.Error("error sending message", "node", n.name, "alert", a.Name, "err", err)
+	}
+}
+
+func incidentFooter(id string) string {
+	return fmt.Sprintf("\nIncident #%s", id)
+}
+
+func outOfSyncMsg(name string, sync *ethereum.SyncProgress, d time.Duration) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("🔴 %s is out of sync since %s\n", name, FormatDuration(d)))
+	writeBlocks(&s, sync)
+	return s.String()
+}
+
+func unreachableMsg(name string, err error, d time.Duration) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("🔴 %s is unreachable since %s (%s)\n", name, FormatDuration(d), ClassifyError(err)))
+	s.WriteString(fmt.Sprintf("Last error: %s\n", err))
+	return s.String()
+}
+
+func degradedMsg(name string, sync *ethereum.SyncProgress) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("🟡 %s is lagging behind by %d blocks\n", name, lag(sync)))
+	writeBlocks(&s, sync)
+	return s.String()
+}
+
+// writeBlocks writes the current and highest block, if the sync progress is known.
+func writeBlocks(s *strings.Builder, sync *ethereum.SyncProgress) {
+	if sync == nil {
+		return
+	}
+	s.WriteString(fmt.Sprintf("Current block: %d\n", sync.CurrentBlock))
+	s.WriteString(fmt.Sprintf("Highest block: %d\n", sync.HighestBlock))
+}
+
+func reminderMsg(name string, state NodeState, o Observation, inc *Incident, speed string) string {
+	inc.Lock()
+	start, startLag := inc.start, inc.startLag
+	inc.Unlock()
+
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("🟠 %s is still %s, %s and counting\n", name, stateSummaries[state], FormatDuration(time.Since(start))))
+	if o.Sync == nil {
+		if o.Err != nil {
+			s.WriteString(fmt.Sprintf("Last error: %s\n", o.Err))
+		}
+		return s.String()
+	}
+	sync := o.Sync
+	current := lag(sync)
+	switch {
+	case current > startLag:
+		s.WriteString(fmt.Sprintf("Lag grew from %d to %d blocks\n", startLag, current))
+	case current < startLag:
+		s.WriteString(fmt.Sprintf("Lag shrank from %d to %d blocks\n", startLag, current))
+	default:
+		s.WriteString(fmt.Sprintf("Lag unchanged at %d blocks\n", current))
+	}
+	if speed != "" {
+		s.WriteString(speed + "\n")
+	}
+	writeBlocks(&s, sync)
+	return s.String()
+}
+
+// observationDetail describes the observation for the history, the error or the lag.
+func observationDetail(o Observation) string {
+	if o.Err != nil {
+		return o.Err.Error()
+	}
+	if o.Sync == nil {
+		return "in sync"
+	}
+	return fmt.Sprintf("lag %d, block %d of %d", lag(o.Sync), o.Sync.CurrentBlock, o.Sync.HighestBlock)
+}
+
+// lag returns the number of blocks the node is behind.
+func lag(sync *ethereum.SyncProgress) uint64 {
+	if sync == nil || sync.HighestBlock < sync.CurrentBlock {
+		return 0
+	}
+	return sync.HighestBlock - sync.CurrentBlock
+}
+
+func inSyncMsg(name string, d time.Duration, peakLag uint64) string {
+	msg := fmt.Sprintf("🟢 %s is back in sync", name)
+	if d > 0 {
+		msg += " after " + FormatDuration(d)
+	}
+	if peakLag > 0 {
+		msg += fmt.Sprintf(", peak lag %s blocks", FormatNumber(peakLag))
+	}
+	return msg
+}
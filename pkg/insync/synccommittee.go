@@ -0,0 +1,243 @@
+package insync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slotsPerSyncPeriod is the number of slots a sync committee serves for, 256 epochs.
+const slotsPerSyncPeriod = 256 * slotsPerEpoch
+
+// SyncCommitteeCheck monitors the participation of the validators of the node while they're in the sync committee,
+// and alerts once the participation of one of them in the last head blocks drops below the threshold. The committee
+// and the head blocks are taken from the beacon node of the node, a validator participated in a block if its bits of
+// the sync aggregate are set.
+type SyncCommitteeCheck struct {
+	n     *Node
+	cfg   SyncCommitteeCheckConfig
+	retry retryPolicy
+	// period is the sync committee period of the committee, positions are those of the validators of the node in it,
+	// by validator index. A validator may have several positions.
+	period    uint64
+	fetched   bool
+	positions map[string][]int
+	// slot is the slot of the last head block, participation the participation of the validators in the last blocks.
+	slot          uint64
+	participation map[string][]bool
+	low           bool
+}
+
+// NewSyncCommitteeCheck creates the sync committee check of the node, the node must have a beacon node and validators.
+func NewSyncCommitteeCheck(n *Node, cfg SyncCommitteeCheckConfig) *SyncCommitteeCheck {
+	return &SyncCommitteeCheck{
+		n:             n,
+		cfg:           cfg,
+		retry:         newRetryPolicy(cfg.CheckConfig),
+		participation: make(map[string][]bool),
+		low:           n.checkState("sync_committee") == "low",
+	}
+}
+
+func (c *SyncCommitteeCheck) Name() string { return "sync_committee" }
+
+func (c *SyncCommitteeCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+// syncAggregateBlock is the part of a signed beacon block the sync committee check needs.
+type syncAggregateBlock struct {
+	Data struct {
+		Message struct {
+			Slot string `json:"slot"`
+			Body struct {
+				SyncAggregate struct {
+					SyncCommitteeBits string `json:"sync_committee_bits"`
+				} `json:"sync_aggregate"`
+			} `json:"body"`
+		} `json:"message"`
+	} `json:"data"`
+}
+
+func (c *SyncCommitteeCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	var block syncAggregateBlock
+	err := n.beaconGet(ctx, c.retry, "/eth/v2/beacon/blocks/head", &block)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		c.fail("error checking beacon head block", err)
+		return
+	}
+	slot, err := strconv.ParseUint(block.Data.Message.Slot, 10, 64)
+	if err != nil {
+		c.fail("invalid beacon head block", err)
+		return
+	}
+	if slot == c.slot {
+		// no new block since the last check
+		return
+	}
+	if period := slot / slotsPerSyncPeriod; !c.fetched || period != c.period {
+		if err := c.fetchCommittee(ctx, period); err != nil {
+			if ctx.Err() == nil {
+				c.fail("error checking the sync committee", err)
+			}
+			return
+		}
+	}
+	c.slot = slot
+	if len(c.positions) == 0 {
+		if c.low {
+			c.resolve(nf, "is no longer in the sync committee")
+		}
+		return
+	}
+	bits, err := hex.DecodeString(strings.TrimPrefix(block.Data.Message.Body.SyncAggregate.SyncCommitteeBits, "0x"))
+	if err != nil {
+		c.fail("invalid sync aggregate", err)
+		return
+	}
+	for v, positions := range c.positions {
+		participated := true
+		for _, p := range positions {
+			if p/8 >= len(bits) || bits[p/8]&(1<<(p%8)) == 0 {
+				participated = false
+			}
+		}
+		window := append(c.participation[v], participated)
+		if len(window) > c.cfg.Window {
+			window = window[len(window)-c.cfg.Window:]
+		}
+		c.participation[v] = window
+	}
+	c.evaluate(nf, slot)
+}
+
+// fetchCommittee fetches the sync committee of the period and the positions of the validators of the node in it.
+// Validators configured by their public key are looked up by it.
+func (c *SyncCommitteeCheck) fetchCommittee(ctx context.Context, period uint64) error {
+	n := c.n
+	var committee struct {
+		Data struct {
+			Validators []string `json:"validators"`
+		} `json:"data"`
+	}
+	epoch := period * slotsPerSyncPeriod / slotsPerEpoch
+	if err := n.beaconGet(ctx, c.retry, fmt.Sprintf("/eth/v1/beacon/states/head/sync_committees?epoch=%d", epoch), &committee); err != nil {
+		return err
+	}
+	indices := make(map[string]bool)
+	for _, v := range n.validators {
+		if !strings.HasPrefix(v, "0x") {
+			indices[v] = true
+			continue
+		}
+		var validator struct {
+			Data struct {
+				Index string `json:"index"`
+			} `json:"data"`
+		}
+		if err := n.beaconGet(ctx, c.retry, "/eth/v1/beacon/states/head/validators/"+v, &validator); err != nil {
+			return fmt.Errorf("validator %s: %w", v, err)
+		}
+		indices[validator.Data.Index] = true
+	}
+	positions := make(map[string][]int)
+	for i, v := range committee.Data.Validators {
+		if indices[v] {
+			positions[v] = append(positions[v], i)
+		}
+	}
+	if len(positions) > 0 {
+		slog.Info("validators in the sync committee", "node", n.name, "check", "sync_committee", "period", period, "validators", len(positions))
+	}
+	c.period, c.fetched, c.positions = period, true, positions
+	c.participation = make(map[string][]bool)
+	return nil
+}
+
+// evaluate records the lowest participation of the validators and alerts once one of them is below the threshold.
+// The validators are only judged once their window is full.
+func (c *SyncCommitteeCheck) evaluate(nf Notifier, slot uint64) {
+	n := c.n
+	lowest := 100.0
+	var low []string
+	judged := false
+	for v, window := range c.participation {
+		if len(window) < c.cfg.Window {
+			continue
+		}
+		judged = true
+		var participated int
+		for _, ok := range window {
+			if ok {
+				participated++
+			}
+		}
+		rate := 100 * float64(participated) / float64(len(window))
+		if rate < lowest {
+			lowest = rate
+		}
+		if rate < c.cfg.MinParticipation {
+			low = append(low, fmt.Sprintf("validator %s %.0f%%", v, rate))
+		}
+	}
+	if !judged {
+		return
+	}
+	sort.Strings(low)
+	status := "ok"
+	if len(low) > 0 {
+		status = "low"
+	}
+	n.record(CheckResult{Check: "sync_committee", Status: status, Detail: fmt.Sprintf("slot %d, lowest participation %.1f%%", slot, lowest), Value: lowest})
+	switch {
+	case len(low) > 0 && !c.low:
+		slog.Warn("low sync committee participation", "node", n.name, "check", "sync_committee", "participation", fmt.Sprintf("%.1f%%", lowest))
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "low sync committee participation",
+			Name:     "NodeSyncCommitteeParticipation",
+			Key:      "sync_committee",
+			Icon:     "🟠",
+			Severity: SeverityWarning,
+			Text: fmt.Sprintf("🟠 %s has a low sync committee participation in the last %d blocks: %s (threshold %.0f%%). The penalties add up quickly.",
+				n.name, c.cfg.Window, strings.Join(low, ", "), c.cfg.MinParticipation),
+		})
+		c.low = true
+		n.setCheckState("sync_committee", "low")
+	case len(low) == 0 && c.low:
+		c.resolve(nf, fmt.Sprintf("participates in the sync committee again, %.1f%% in the last %d blocks", lowest, c.cfg.Window))
+	}
+}
+
+// resolve resolves the alert of the low participation, msg says why.
+func (c *SyncCommitteeCheck) resolve(nf Notifier, msg string) {
+	n := c.n
+	slog.Info("sync committee participation recovered", "node", n.name, "check", "sync_committee")
+	sendAlert(nf, Alert{
+		Node:     n.name,
+		Summary:  "sync committee participation recovered",
+		Name:     "NodeSyncCommitteeParticipation",
+		Key:      "sync_committee",
+		Resolved: true,
+		Icon:     "🟢",
+		Severity: SeverityInfo,
+		Text:     fmt.Sprintf("🟢 %s %s", n.name, msg),
+	})
+	c.low = false
+	n.setCheckState("sync_committee", "")
+}
+
+// fail logs and records the error of the check.
+func (c *SyncCommitteeCheck) fail(msg string, err error) {
+	n := c.n
+	slog.Warn(msg, "node", n.name, "check", "sync_committee", "class", ClassifyError(err).String(), "err", err)
+	n.recordResult("sync_committee", "error", err.Error())
+	n.countCheckError("sync_committee")
+}
@@ -0,0 +1,80 @@
+package insync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig configures the tls connection to the rpc endpoint of a node, e.g. for nodes behind a proxy terminating mutual tls.
+type TLSConfig struct {
+	// CertFile and KeyFile are the pem encoded client certificate and its key.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName is the name the server certificate is verified against, defaults to the host of the url.
+	ServerName string `yaml:"server_name"`
+	// MinVersion is the minimum tls version, 1.2 or 1.3, defaults to 1.2.
+	MinVersion string `yaml:"min_version"`
+	// CAFile is a pem bundle of the certificate authorities the server certificate is verified with,
+	// e.g. of an internal ca. The system roots are used if empty.
+	CAFile string `yaml:"ca_file"`
+	// InsecureSkipVerify disables the verification of the server certificate, which makes the connection
+	// vulnerable to man in the middle attacks. Only meant for lab environments.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// isZero reports whether the defaults of the tls package are used.
+func (c TLSConfig) isZero() bool {
+	return c == TLSConfig{}
+}
+
+// validate loads the certificates, so a broken config is caught on startup rather than on the first connection.
+func (c TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("tls: cert_file and key_file must be set together")
+	}
+	if c.InsecureSkipVerify && (c.CAFile != "" || c.ServerName != "") {
+		return errors.New("tls: ca_file and server_name have no effect with insecure_skip_verify")
+	}
+	_, err := c.load()
+	return err
+}
+
+// load builds the tls config, the certificates are read on every call so renewed certificates are used on reconnect.
+func (c TLSConfig) load() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	switch c.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls: invalid min_version %q, expected 1.2 or 1.3", c.MinVersion)
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificate found in %s", c.CAFile)
+		}
+	}
+	cfg.InsecureSkipVerify = c.InsecureSkipVerify
+	return cfg, nil
+}
+
+// isTLS reports whether the url is an https or wss endpoint.
+func isTLS(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "https://") || strings.HasPrefix(rawURL, "wss://")
+}
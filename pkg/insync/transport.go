@@ -0,0 +1,241 @@
+package insync
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// wsBufferSize is the size of the read and write buffers of websocket connections, like the default of the rpc package.
+const wsBufferSize = 1024
+
+// AuthConfig configures the authentication at the rpc endpoint of a node, instead of embedding the credentials in the url.
+type AuthConfig struct {
+	// Username and Password are sent with basic auth.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// BearerToken is sent as bearer token, only supported for http endpoints.
+	BearerToken string `yaml:"bearer_token"`
+	// JWTSecretFile is the hex encoded secret of geth's --authrpc.jwtsecret, to monitor the auth endpoint.
+	// A token is signed for every request, only supported for http endpoints.
+	JWTSecretFile string `yaml:"jwt_secret_file"`
+}
+
+// Finalize validates the node config.
+func (c *NodeConfig) Finalize() error {
+	methods := 0
+	for _, set := range []bool{c.Auth.Username != "" || c.Auth.Password != "", c.Auth.BearerToken != "", c.Auth.JWTSecretFile != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return errors.New("basic auth, bearer token and jwt secret are mutually exclusive")
+	}
+	if c.Auth.JWTSecretFile != "" {
+		if _, err := readJWTSecret(c.Auth.JWTSecretFile); err != nil {
+			return err
+		}
+	}
+	switch c.Mode {
+	case "":
+		c.Mode = ModeFull
+	case ModeFull, ModeLight:
+	default:
+		return fmt.Errorf("invalid mode %q, must be full or light", c.Mode)
+	}
+	if c.Genesis != "" {
+		if b, err := hexutil.Decode(c.Genesis); err != nil || len(b) != common.HashLength {
+			return fmt.Errorf("genesis: invalid block hash %q", c.Genesis)
+		}
+	}
+	if err := c.ValidatorClient.Finalize(); err != nil {
+		return err
+	}
+	if c.Beacon != "" && !isHTTP(c.Beacon) {
+		return errors.New("beacon: only http endpoints are supported")
+	}
+	if len(c.Validators) > 0 && c.Beacon == "" {
+		return errors.New("validators: missing beacon")
+	}
+	for _, u := range c.Metrics {
+		if !isHTTP(u) {
+			return errors.New("metrics: only http endpoints are supported")
+		}
+	}
+	if !c.TLS.isZero() {
+		if err := c.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	// the fallbacks share the settings of the url, so they have to support them as well
+	if err := c.validateEndpoint(c.URL); err != nil {
+		return err
+	}
+	for _, u := range c.Fallbacks {
+		if u == "" {
+			return errors.New("empty fallback url")
+		}
+		if err := c.validateEndpoint(u); err != nil {
+			return fmt.Errorf("fallback %s: %w", NodeName(u), err)
+		}
+	}
+	return nil
+}
+
+// validateEndpoint checks that the endpoint supports the authentication, headers, proxy and tls of the node.
+func (c *NodeConfig) validateEndpoint(rawURL string) error {
+	if !isHTTP(rawURL) && (c.Auth.BearerToken != "" || c.Auth.JWTSecretFile != "" || len(c.Headers) > 0) {
+		return errors.New("bearer tokens, jwt secrets and headers are only supported for http endpoints")
+	}
+	if !isHTTP(rawURL) && !isWebsocket(rawURL) && c.Auth.Username != "" {
+		return errors.New("basic auth is only supported for http and websocket endpoints")
+	}
+	if c.Proxy != "" {
+		u, err := ParseProxy(c.Proxy)
+		if err != nil {
+			return err
+		}
+		if isWebsocket(rawURL) && u.Scheme != "http" && u.Scheme != "socks5" {
+			return errors.New("websocket endpoints only support http and socks5 proxies")
+		}
+		if !isHTTP(rawURL) && !isWebsocket(rawURL) {
+			return errors.New("proxies are only supported for http and websocket endpoints")
+		}
+	}
+	if !c.TLS.isZero() && !isTLS(rawURL) {
+		return errors.New("tls is only supported for https and wss endpoints")
+	}
+	return nil
+}
+
+// isWebsocket reports whether the url is a websocket endpoint.
+func isWebsocket(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "ws://") || strings.HasPrefix(rawURL, "wss://")
+}
+
+// dialRPC connects to the rpc endpoint of the node, the primary url or a fallback, with the configured authentication.
+func (n *Node) dialRPC(ctx context.Context, rawURL string) (*rpc.Client, error) {
+	var tlsConfig *tls.Config
+	if !n.tls.isZero() {
+		var err error
+		if tlsConfig, err = n.tls.load(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case isHTTP(rawURL):
+		var secret []byte
+		if n.auth.JWTSecretFile != "" {
+			// read on every dial, so a rotated secret is picked up on reconnect
+			var err error
+			if secret, err = readJWTSecret(n.auth.JWTSecretFile); err != nil {
+				return nil, err
+			}
+		}
+		rt, err := n.httpTransport(tlsConfig, secret)
+		if err != nil {
+			return nil, err
+		}
+		return rpc.DialHTTPWithClient(rawURL, &http.Client{Transport: rt})
+	case isWebsocket(rawURL):
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if n.auth.Username != "" {
+			// the websocket client sends the user info of the url with basic auth
+			u.User = url.UserPassword(n.auth.Username, n.auth.Password)
+		}
+		dialer := websocket.Dialer{
+			ReadBufferSize:  wsBufferSize,
+			WriteBufferSize: wsBufferSize,
+			TLSClientConfig: tlsConfig,
+		}
+		if n.proxy != "" {
+			p, err := ParseProxy(n.proxy)
+			if err != nil {
+				return nil, err
+			}
+			dialer.Proxy = http.ProxyURL(p)
+		}
+		if n.dialControl != nil {
+			dialer.NetDialContext = n.netDialer().DialContext
+		}
+		return rpc.DialWebsocketWithDialer(ctx, u.String(), "", dialer)
+	default:
+		return rpc.DialContext(ctx, rawURL)
+	}
+}
+
+// httpTransport returns the transport of http endpoints, adding the headers and, if there is a jwt secret,
+// a signed token to every request.
+func (n *Node) httpTransport(tlsConfig *tls.Config, jwtSecret []byte) (http.RoundTripper, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		base.TLSClientConfig = tlsConfig
+	}
+	proxy, err := ProxyFunc(n.proxy)
+	if err != nil {
+		return nil, err
+	}
+	base.Proxy = proxy
+	if n.dialControl != nil {
+		base.DialContext = n.netDialer().DialContext
+	}
+	var rt http.RoundTripper = base
+	header := make(http.Header, len(n.headers)+1)
+	for k, v := range n.headers {
+		header.Set(k, v)
+	}
+	switch {
+	case n.auth.BearerToken != "":
+		header.Set("Authorization", "Bearer "+n.auth.BearerToken)
+	case n.auth.Username != "":
+		req := http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(n.auth.Username, n.auth.Password)
+		header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+	if len(header) > 0 {
+		rt = headerTransport{header: header, next: rt}
+	}
+	if jwtSecret != nil {
+		rt = jwtTransport{secret: jwtSecret, next: rt}
+	}
+	if rpcDebugEnabled() {
+		// outermost, so the credentials in the headers aren't logged
+		rt = debugTransport{node: n.name, next: rt}
+	}
+	return rt, nil
+}
+
+// netDialer returns the dialer of the endpoints with the dial control of the node, like that of the default transport.
+func (n *Node) netDialer() *net.Dialer {
+	return &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: n.dialControl}
+}
+
+// headerTransport adds the headers to every request.
+type headerTransport struct {
+	header http.Header
+	next   http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a round tripper must not modify the request
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	return t.next.RoundTrip(req)
+}
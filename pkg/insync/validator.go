@@ -0,0 +1,119 @@
+package insync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// ValidatorClientConfig is the health endpoint of the validator client running with the node, e.g. lighthouse's
+// http://localhost:5062/lighthouse/health or the /eth/v1/keystores endpoint of the keymanager api.
+type ValidatorClientConfig struct {
+	URL string `yaml:"url"`
+	// BearerToken is sent as bearer token, e.g. the api token of the validator client.
+	BearerToken string `yaml:"bearer_token"`
+	// TokenFile is read on every check instead, e.g. lighthouse's api-token.txt.
+	TokenFile string `yaml:"token_file"`
+}
+
+// Finalize validates the config of the validator client.
+func (c *ValidatorClientConfig) Finalize() error {
+	if c.URL == "" {
+		if c.BearerToken != "" || c.TokenFile != "" {
+			return errors.New("validator client: missing url")
+		}
+		return nil
+	}
+	if !isHTTP(c.URL) {
+		return errors.New("validator client: only http endpoints are supported")
+	}
+	if c.BearerToken != "" && c.TokenFile != "" {
+		return errors.New("validator client: bearer token and token file are mutually exclusive")
+	}
+	return nil
+}
+
+// ValidatorClientCheck alerts if the health endpoint of the validator client fails, so a dead validator client
+// is caught even while the node itself is healthy.
+type ValidatorClientCheck struct {
+	n     *Node
+	cfg   CheckConfig
+	retry retryPolicy
+	down  bool
+}
+
+// NewValidatorClientCheck creates the check of the validator client of the node, the node must have one.
+func NewValidatorClientCheck(n *Node, cfg CheckConfig) *ValidatorClientCheck {
+	return &ValidatorClientCheck{
+		n:     n,
+		cfg:   cfg,
+		retry: newRetryPolicy(cfg),
+		down:  n.checkState("validator_client") == "down",
+	}
+}
+
+func (c *ValidatorClientCheck) Name() string { return "validator_client" }
+
+func (c *ValidatorClientCheck) Interval() time.Duration { return time.Duration(c.cfg.Interval) }
+
+func (c *ValidatorClientCheck) Run(ctx context.Context, nf Notifier) {
+	n := c.n
+	err := c.retry.do(ctx, c.probe)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("validator client unhealthy", "node", n.name, "check", "validator_client", "class", ClassifyError(err).String(), "err", err)
+		n.recordResult("validator_client", "down", err.Error())
+		n.countCheckError("validator_client")
+		if !c.down {
+			sendAlert(nf, Alert{
+				Node:     n.name,
+				Summary:  "validator client down",
+				Name:     "ValidatorClientDown",
+				Key:      "validator_client",
+				Icon:     "🔴",
+				Severity: SeverityCritical,
+				Text:     fmt.Sprintf("🔴 the validator client of %s is down: %s", n.name, err),
+			})
+			c.down = true
+			n.setCheckState("validator_client", "down")
+		}
+		return
+	}
+	n.recordResult("validator_client", "ok", "")
+	if c.down {
+		slog.Info("validator client recovered", "node", n.name, "check", "validator_client")
+		sendAlert(nf, Alert{
+			Node:     n.name,
+			Summary:  "validator client healthy again",
+			Name:     "ValidatorClientDown",
+			Key:      "validator_client",
+			Resolved: true,
+			Icon:     "🟢",
+			Severity: SeverityInfo,
+			Text:     fmt.Sprintf("🟢 the validator client of %s is healthy again", n.name),
+		})
+		c.down = false
+		n.setCheckState("validator_client", "")
+	}
+}
+
+// probe requests the health endpoint, any status but 2xx counts as failure.
+func (c *ValidatorClientCheck) probe(ctx context.Context) error {
+	vc := c.n.validatorClient
+	token := vc.BearerToken
+	if vc.TokenFile != "" {
+		// read on every check, the validator client might recreate it on restart
+		data, err := os.ReadFile(vc.TokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	return getJSON(ctx, vc.URL, token, nil)
+}
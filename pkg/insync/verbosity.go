@@ -0,0 +1,82 @@
+package insync
+
+import (
+	"strings"
+	"sync"
+)
+
+// Verbosity is the level of detail of the alerts a destination receives.
+type Verbosity int
+
+const (
+	// VerbosityAll delivers every alert, including the progress of syncing nodes.
+	VerbosityAll Verbosity = iota
+	// VerbosityWarning delivers the warnings, the critical alerts and their recoveries.
+	VerbosityWarning
+	// VerbosityCritical delivers the critical alerts and their recoveries.
+	VerbosityCritical
+)
+
+var verbosityNames = map[Verbosity]string{
+	VerbosityAll:      "all",
+	VerbosityWarning:  "warning",
+	VerbosityCritical: "critical",
+}
+
+func (v Verbosity) String() string {
+	return verbosityNames[v]
+}
+
+// ParseVerbosity parses a verbosity name like critical, ignoring the case.
+func ParseVerbosity(s string) (Verbosity, bool) {
+	for v, name := range verbosityNames {
+		if strings.EqualFold(s, name) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// minSeverity returns the least severe alert delivered at the verbosity.
+func (v Verbosity) minSeverity() Severity {
+	switch v {
+	case VerbosityWarning:
+		return SeverityWarning
+	case VerbosityCritical:
+		return SeverityCritical
+	}
+	return SeverityInfo
+}
+
+// VerbosityGate decides which alerts are delivered at a verbosity. The recovery of an alert which was held back is
+// held back as well, so a destination isn't told about the recovery of an alert it never received.
+// The zero value is ready to use.
+type VerbosityGate struct {
+	mu sync.Mutex
+	// dropped are the alerts held back, by node and key.
+	dropped map[string]bool
+}
+
+// Pass reports whether the alert is delivered at the verbosity.
+func (g *VerbosityGate) Pass(v Verbosity, a Alert) bool {
+	key := a.Node + "/" + a.Key
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a.Resolved {
+		if g.dropped[key] {
+			delete(g.dropped, key)
+			return false
+		}
+		return true
+	}
+	if a.Severity >= v.minSeverity() {
+		// e.g. a warning escalated to critical, its recovery is delivered
+		delete(g.dropped, key)
+		return true
+	}
+	if g.dropped == nil {
+		g.dropped = make(map[string]bool)
+	}
+	g.dropped[key] = true
+	return false
+}
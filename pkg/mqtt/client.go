@@ -0,0 +1,243 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The packet types of mqtt 3.1.1 used by the client.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// keepAlive is the keep alive interval announced to the broker, the client pings it twice as often.
+const keepAlive = 60 * time.Second
+
+// message is a message to publish, it's always sent with qos 0.
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// client is a minimal mqtt 3.1.1 client, which only publishes.
+type client struct {
+	conn net.Conn
+	// mu serializes the writes.
+	mu sync.Mutex
+	// done is closed once the connection breaks, err is why.
+	done chan struct{}
+	err  error
+}
+
+// dial connects to the broker, mqtt:// (or tcp://) is plain tcp on port 1883 by default, mqtts:// (or ssl://) tls on 8883.
+// The will is published by the broker if the connection breaks.
+func dial(ctx context.Context, broker, clientID, username, password string, will message) (*client, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	host, useTLS := u.Host, false
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "mqtts", "ssl", "tls":
+		useTLS = true
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected mqtt or mqtts", u.Scheme)
+	}
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if useTLS {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}).DialContext(ctx, "tcp", host)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &client{conn: conn, done: make(chan struct{})}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(connectPacket(clientID, username, password, will)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading connack: %w", err)
+	}
+	if typ != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected packet %d instead of connack", typ)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("the broker refused the connection: %s", connackError(code))
+	}
+	_ = conn.SetDeadline(time.Time{})
+	go c.read(r)
+	return c, nil
+}
+
+// read consumes the packets of the broker until the connection breaks, the client doesn't subscribe,
+// so these are only the ping responses.
+func (c *client) read(r *bufio.Reader) {
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(keepAlive + keepAlive/2))
+		if _, _, err := readPacket(r); err != nil {
+			c.err = err
+			close(c.done)
+			return
+		}
+	}
+}
+
+func (c *client) publish(m message) error {
+	return c.write(publishPacket(m))
+}
+
+func (c *client) ping() error {
+	return c.write([]byte{packetPingreq << 4, 0})
+}
+
+func (c *client) write(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// close disconnects cleanly, so the broker doesn't publish the will.
+func (c *client) close() error {
+	_ = c.write([]byte{packetDisconnect << 4, 0})
+	return c.conn.Close()
+}
+
+func connectPacket(clientID, username, password string, will message) []byte {
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = appendString(payload, clientID)
+	if will.topic != "" {
+		flags |= 0x04
+		if will.retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, will.topic)
+		payload = appendString(payload, string(will.payload))
+	}
+	if username != "" {
+		flags |= 0x80
+		payload = appendString(payload, username)
+		if password != "" {
+			flags |= 0x40
+			payload = appendString(payload, password)
+		}
+	}
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	return packet(packetConnect<<4, append(body, payload...))
+}
+
+func publishPacket(m message) []byte {
+	header := byte(packetPublish << 4)
+	if m.retain {
+		header |= 0x01
+	}
+	return packet(header, append(appendString(nil, m.topic), m.payload...))
+}
+
+// packet prepends the fixed header to the body.
+func packet(header byte, body []byte) []byte {
+	p := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+var errMalformed = errors.New("malformed packet")
+
+// readPacket reads a packet and returns its type and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > 1<<20 {
+		return 0, nil, errMalformed
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func connackError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client id rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
@@ -0,0 +1,304 @@
+// Package mqtt publishes the state transitions and the status of the nodes to an mqtt broker,
+// including the discovery payloads of home assistant, so the nodes show up as devices there.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Config configures the mqtt publisher, it's disabled if the broker is empty.
+type Config struct {
+	// Broker is the url of the broker, e.g. mqtt://localhost:1883 or mqtts://broker:8883.
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// ClientID defaults to insync.
+	ClientID string `yaml:"client_id"`
+	// Topic is the prefix of the topics, defaults to insync.
+	Topic string `yaml:"topic"`
+	// Discovery publishes the home assistant discovery payloads to DiscoveryPrefix, which defaults to homeassistant.
+	Discovery       bool   `yaml:"discovery"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// Interval is the time between the status updates, defaults to 1m.
+	Interval insync.Duration `yaml:"interval"`
+}
+
+func (c *Config) Finalize() error {
+	if c.Broker == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid mqtt broker: %w", err)
+	}
+	switch u.Scheme {
+	case "mqtt", "tcp", "mqtts", "ssl", "tls":
+	default:
+		return fmt.Errorf("invalid mqtt broker %q, expected mqtt:// or mqtts://", c.Broker)
+	}
+	if c.ClientID == "" {
+		c.ClientID = "insync"
+	}
+	if c.Topic == "" {
+		c.Topic = "insync"
+	}
+	if c.DiscoveryPrefix == "" {
+		c.DiscoveryPrefix = "homeassistant"
+	}
+	if c.Interval <= 0 {
+		c.Interval = insync.Duration(time.Minute)
+	}
+	return nil
+}
+
+// Publisher publishes to the broker, it's passed the state transitions as insync.Recorder.
+//
+// The topics below the prefix are:
+//
+//	status            online or offline, the availability of insync
+//	<node>/state      the state of the node, e.g. healthy
+//	<node>/attributes the status of the node as json, e.g. the lag and the peers
+//	<node>/transition every state transition as json
+//
+// The states and attributes are retained, so new subscribers get them right away.
+type Publisher struct {
+	cfg         Config
+	nodes       []*insync.Node
+	transitions chan insync.TransitionRecord
+}
+
+// New creates the publisher of the nodes.
+func New(cfg Config, nodes []*insync.Node) *Publisher {
+	return &Publisher{cfg: cfg, nodes: nodes, transitions: make(chan insync.TransitionRecord, 64)}
+}
+
+func (p *Publisher) RecordResult(insync.CheckResult) {}
+
+func (p *Publisher) RecordTransition(t insync.TransitionRecord) {
+	select {
+	case p.transitions <- t:
+	default:
+		slog.Warn("dropping mqtt state transition, the broker is too slow", "node", t.Node)
+	}
+}
+
+// Run keeps the connection to the broker until the context is done, reconnecting with backoff.
+func (p *Publisher) Run(ctx context.Context) {
+	delay := time.Second
+	for {
+		start := time.Now()
+		err := p.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			// the connection was up for a while, the broker is back
+			delay = time.Second
+		}
+		slog.Warn("mqtt connection lost, reconnecting", "broker", p.cfg.Broker, "in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// session connects, announces the nodes and publishes until the connection breaks or the context is done.
+func (p *Publisher) session(ctx context.Context) error {
+	status := p.cfg.Topic + "/status"
+	c, err := dial(ctx, p.cfg.Broker, p.cfg.ClientID, p.cfg.Username, p.cfg.Password, message{topic: status, payload: []byte("offline"), retain: true})
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	slog.Info("connected to mqtt broker", "broker", p.cfg.Broker)
+	if p.cfg.Discovery {
+		for _, n := range p.nodes {
+			for _, m := range p.discovery(n) {
+				if err := c.publish(m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := c.publish(message{topic: status, payload: []byte("online"), retain: true}); err != nil {
+		return err
+	}
+	if err := p.publishStatus(c); err != nil {
+		return err
+	}
+
+	update := time.NewTicker(time.Duration(p.cfg.Interval))
+	defer update.Stop()
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// the will isn't published on a clean disconnect
+			return c.publish(message{topic: status, payload: []byte("offline"), retain: true})
+		case <-c.done:
+			return c.err
+		case <-ping.C:
+			err = c.ping()
+		case <-update.C:
+			err = p.publishStatus(c)
+		case t := <-p.transitions:
+			err = p.publishTransition(c, t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// publishStatus publishes the state and the attributes of the checked nodes.
+func (p *Publisher) publishStatus(c *client) error {
+	for _, n := range p.nodes {
+		if !n.Checked() {
+			continue
+		}
+		attrs := newAttributes(n)
+		payload, err := json.Marshal(attrs)
+		if err != nil {
+			return err
+		}
+		base := p.cfg.Topic + "/" + topicName(n.Name())
+		if err := c.publish(message{topic: base + "/state", payload: []byte(attrs.State), retain: true}); err != nil {
+			return err
+		}
+		if err := c.publish(message{topic: base + "/attributes", payload: payload, retain: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) publishTransition(c *client, t insync.TransitionRecord) error {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	base := p.cfg.Topic + "/" + topicName(t.Node)
+	if err := c.publish(message{topic: base + "/transition", payload: payload}); err != nil {
+		return err
+	}
+	return c.publish(message{topic: base + "/state", payload: []byte(t.To), retain: true})
+}
+
+// attributes is the status of a node published to <node>/attributes.
+type attributes struct {
+	State          string  `json:"state"`
+	Up             bool    `json:"up"`
+	Chain          string  `json:"chain,omitempty"`
+	Client         string  `json:"client,omitempty"`
+	CurrentBlock   uint64  `json:"current_block"`
+	HighestBlock   uint64  `json:"highest_block"`
+	Lag            uint64  `json:"lag"`
+	Peers          *int64  `json:"peers,omitempty"`
+	LatencySeconds float64 `json:"latency_seconds,omitempty"`
+}
+
+func newAttributes(n *insync.Node) attributes {
+	st := n.Status()
+	a := attributes{
+		State:          st.State.String(),
+		Up:             n.LastError() == nil,
+		Chain:          st.Chain,
+		Client:         st.Client,
+		CurrentBlock:   st.CurrentBlock,
+		HighestBlock:   st.HighestBlock,
+		LatencySeconds: st.Latency.Seconds(),
+	}
+	if !a.Up {
+		a.State = insync.StateUnreachable.String()
+	}
+	if st.HighestBlock > st.CurrentBlock {
+		a.Lag = st.HighestBlock - st.CurrentBlock
+	}
+	if st.Peers >= 0 {
+		a.Peers = &st.Peers
+	}
+	return a
+}
+
+// discovery returns the home assistant discovery payloads of the node: a sensor with the state,
+// sensors with the lag and the peers and a problem binary sensor, grouped as a device.
+func (p *Publisher) discovery(n *insync.Node) []message {
+	name := topicName(n.Name())
+	base := p.cfg.Topic + "/" + name
+	id := topicName(p.cfg.ClientID) + "_" + name
+	device := map[string]any{
+		"identifiers":  []string{id},
+		"name":         n.Name(),
+		"manufacturer": "insync",
+		"model":        "ethereum node",
+	}
+	entities := []struct {
+		component, object string
+		config            map[string]any
+	}{
+		{"sensor", "state", map[string]any{
+			"name":                  "state",
+			"state_topic":           base + "/state",
+			"json_attributes_topic": base + "/attributes",
+			"icon":                  "mdi:ethereum",
+		}},
+		{"sensor", "lag", map[string]any{
+			"name":                "lag",
+			"state_topic":         base + "/attributes",
+			"value_template":      "{{ value_json.lag }}",
+			"unit_of_measurement": "blocks",
+			"state_class":         "measurement",
+		}},
+		{"sensor", "peers", map[string]any{
+			"name":           "peers",
+			"state_topic":    base + "/attributes",
+			"value_template": "{{ value_json.peers | default(0) }}",
+			"state_class":    "measurement",
+		}},
+		{"binary_sensor", "problem", map[string]any{
+			"name":           "problem",
+			"state_topic":    base + "/state",
+			"value_template": "{{ 'OFF' if value == 'healthy' else 'ON' }}",
+			"device_class":   "problem",
+		}},
+	}
+	msgs := make([]message, 0, len(entities))
+	for _, e := range entities {
+		e.config["unique_id"] = id + "_" + e.object
+		e.config["availability_topic"] = p.cfg.Topic + "/status"
+		e.config["device"] = device
+		payload, err := json.Marshal(e.config)
+		if err != nil {
+			// the configs only contain strings
+			panic(err)
+		}
+		msgs = append(msgs, message{
+			topic:   fmt.Sprintf("%s/%s/%s/%s/config", p.cfg.DiscoveryPrefix, e.component, id, e.object),
+			payload: payload,
+			retain:  true,
+		})
+	}
+	return msgs
+}
+
+// topicRe matches the characters that aren't allowed in the topics and ids, mqtt wildcards and separators among others.
+var topicRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// topicName turns the name of a node into a topic level.
+func topicName(name string) string {
+	return topicRe.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,105 @@
+// Package pagerduty sends insync alerts to pagerduty using the events api v2.
+package pagerduty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Client sends alerts to a pagerduty service using the events api v2.
+// Alerts of the same node and key share a dedup key, so follow ups update the pagerduty incident
+// and recovery alerts resolve it.
+type Client struct {
+	url        string
+	routingKey string
+	client     *http.Client
+}
+
+// pdEvent is the event format of the events api v2.
+type pdEvent struct {
+	RoutingKey  string     `json:"routing_key"`
+	EventAction string     `json:"event_action"`
+	DedupKey    string     `json:"dedup_key"`
+	Payload     *pdPayload `json:"payload,omitempty"`
+}
+
+type pdPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// New creates a client sending events with the configured routing key.
+func New(cfg Config) *Client {
+	return &Client{
+		url:        pagerDutyURL,
+		routingKey: cfg.RoutingKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send triggers or resolves the pagerduty incident of the alert.
+func (pd *Client) Send(a insync.Alert) error {
+	key := a.Key
+	if key == "" {
+		key = a.Name
+	}
+	e := pdEvent{
+		RoutingKey:  pd.routingKey,
+		EventAction: "trigger",
+		DedupKey:    a.Node + "/" + key,
+	}
+	if a.Resolved {
+		e.EventAction = "resolve"
+	} else {
+		e.Payload = &pdPayload{
+			Summary:       fmt.Sprintf("%s %s", a.Node, a.Summary),
+			Source:        a.Node,
+			Severity:      a.Severity.String(),
+			Component:     key,
+			Class:         a.Name,
+			CustomDetails: map[string]string{"description": strings.TrimSpace(a.Text)},
+		}
+	}
+	return pd.post(e)
+}
+
+func (pd *Client) post(e pdEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pd.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pd.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := pd.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Config configures a pagerduty service using the events api v2.
+type Config struct {
+	RoutingKey string `yaml:"routing_key"`
+}
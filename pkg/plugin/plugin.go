@@ -0,0 +1,133 @@
+// Package plugin implements notifiers delivering the alerts as json to external commands or webhooks,
+// so exotic notification targets can be added without changing insync.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// defaultTimeout is the timeout of a plugin if none is configured.
+const defaultTimeout = 10 * time.Second
+
+// ExecConfig configures a command which receives every alert as json on stdin.
+type ExecConfig struct {
+	// Command is the command and its arguments.
+	Command []string        `yaml:"command"`
+	Timeout insync.Duration `yaml:"timeout"`
+}
+
+// WebhookConfig configures a url every alert is posted to as json.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout insync.Duration   `yaml:"timeout"`
+}
+
+// Exec runs a command for every alert, passing the alert as json on stdin.
+// The alert is also available in the environment variables INSYNC_NODE, INSYNC_ALERT, INSYNC_SEVERITY and INSYNC_RESOLVED.
+// A non-zero exit code counts as failed delivery.
+type Exec struct {
+	command []string
+	timeout time.Duration
+}
+
+// NewExec creates the exec notifier.
+func NewExec(cfg ExecConfig) *Exec {
+	return &Exec{command: cfg.Command, timeout: timeout(cfg.Timeout)}
+}
+
+// Target returns the command.
+func (e *Exec) Target() string {
+	return e.command[0]
+}
+
+// Send runs the command for the alert.
+func (e *Exec) Send(a insync.Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"INSYNC_NODE="+a.Node,
+		"INSYNC_ALERT="+a.Name,
+		"INSYNC_SEVERITY="+a.Severity.String(),
+		fmt.Sprintf("INSYNC_RESOLVED=%t", a.Resolved),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", e.command[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", e.command[0], err)
+	}
+	return nil
+}
+
+// Webhook posts every alert as json to a url.
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhook creates the webhook notifier.
+func NewWebhook(cfg WebhookConfig) *Webhook {
+	return &Webhook{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: timeout(cfg.Timeout)},
+	}
+}
+
+// Target returns the host of the url, without credentials it might contain.
+func (w *Webhook) Target() string {
+	return insync.NodeName(w.url)
+}
+
+// Send posts the alert.
+func (w *Webhook) Send(a insync.Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func timeout(d insync.Duration) time.Duration {
+	if d <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(d)
+}
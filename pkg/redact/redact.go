@@ -0,0 +1,137 @@
+// Package redact removes secrets, e.g. the bot token or the credentials of the nodes, from logs and error messages.
+// The secrets are registered once the config is read, every text leaving insync is passed through String.
+package redact
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces the secrets.
+const Placeholder = "[redacted]"
+
+// minLength is the length of the shortest secret, shorter ones would mangle the texts.
+const minLength = 4
+
+var (
+	mu       sync.RWMutex
+	secrets  = make(map[string]bool)
+	replacer *strings.Replacer
+)
+
+// Add registers secrets, empty and very short ones are ignored.
+func Add(s ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, secret := range s {
+		if len(secret) < minLength {
+			continue
+		}
+		// secrets in urls are escaped, e.g. the password of a proxy
+		secrets[secret] = true
+		secrets[url.QueryEscape(secret)] = true
+		secrets[url.PathEscape(secret)] = true
+		secrets[strings.TrimPrefix(url.UserPassword("", secret).String(), ":")] = true
+	}
+	list := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		list = append(list, secret)
+	}
+	// longest first, so a secret containing another one is replaced completely
+	sort.Slice(list, func(i, j int) bool { return len(list[i]) > len(list[j]) })
+	pairs := make([]string, 0, 2*len(list))
+	for _, secret := range list {
+		pairs = append(pairs, secret, Placeholder)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// URL registers the password of the user info of the url.
+func URL(s string) {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return
+	}
+	if p, ok := u.User.Password(); ok {
+		Add(p)
+		// the password as written in the url, it might be escaped differently
+		if _, rest, ok := strings.Cut(s, "://"); ok {
+			if userinfo, _, ok := strings.Cut(rest, "@"); ok {
+				if _, raw, ok := strings.Cut(userinfo, ":"); ok {
+					Add(raw)
+				}
+			}
+		}
+	}
+}
+
+// String replaces the registered secrets in s.
+func String(s string) string {
+	mu.RLock()
+	r := replacer
+	mu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// Error returns the redacted message of the error.
+func Error(err error) string {
+	return String(err.Error())
+}
+
+// Handler wraps the handler, redacting the messages and attributes of the records.
+func Handler(h slog.Handler) slog.Handler {
+	return handler{h}
+}
+
+type handler struct {
+	slog.Handler
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(attr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = attr(a)
+	}
+	return handler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.Handler.WithGroup(name)}
+}
+
+// attr redacts the strings, errors and groups of the attribute.
+func attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, g := range group {
+			redacted[i] = attr(g)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Error(err))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
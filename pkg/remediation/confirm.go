@@ -0,0 +1,153 @@
+package remediation
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// The kinds of the actions offered for confirmation, appended to the id of the offer.
+const (
+	offerRun    = "run"
+	offerSwitch = "switch"
+)
+
+// offer is an action waiting for confirmation. It's withdrawn once the condition it was offered for is over.
+type offer struct {
+	id string
+	tg *target
+	ev event
+}
+
+var errNotOffered = errors.New("the remediation isn't offered anymore, the node recovered or someone else confirmed it")
+
+// offer sends the alert offering the action, and switching the endpoint if the node has fallbacks.
+func (r *Remediator) offer(tg *target, ev event) {
+	r.mu.Lock()
+	r.seq++
+	o := &offer{id: strconv.Itoa(r.seq), tg: tg, ev: ev}
+	r.offers[o.id] = o
+	tg.offer = o
+	r.mu.Unlock()
+	slog.Info("offering remediation", "node", ev.Node, "remediation", tg.cfg.Name, "condition", ev.Condition, "since", ev.Since)
+
+	a := newAlert(tg, ev)
+	a.Summary = "remediation waiting for confirmation"
+	a.Icon, a.Severity = "🛠", insync.SeverityWarning
+	a.Text = fmt.Sprintf("🛠 remediation %s of %s is waiting for confirmation\n%s was %s for %s: %s",
+		tg.cfg.Name, ev.Node, ev.Node, ev.what(), ev.Duration, tg.action.describe(ev))
+	a.Actions = []insync.AlertAction{{Label: "Run " + tg.cfg.Name, ID: o.id + "/" + offerRun}}
+	if tg.node.HasFallbacks() {
+		a.Actions = append(a.Actions, insync.AlertAction{Label: "Switch endpoint", ID: o.id + "/" + offerSwitch})
+	}
+	r.send(a, ev)
+}
+
+// expire withdraws the offer of the target once its condition is over. r.mu must be held.
+func (r *Remediator) expire(tg *target) {
+	if tg.offer == nil {
+		return
+	}
+	if ev, ok := tg.current(); ok && ev.id == tg.offer.ev.id {
+		return
+	}
+	slog.Info("withdrawing remediation offer", "node", tg.offer.ev.Node, "remediation", tg.cfg.Name)
+	delete(r.offers, tg.offer.id)
+	tg.offer = nil
+}
+
+// lookup returns the offer and the kind of the action with the id. r.mu must be held.
+func (r *Remediator) lookup(id string) (*offer, string, error) {
+	oid, kind, _ := strings.Cut(id, "/")
+	o, ok := r.offers[oid]
+	if !ok || (kind != offerRun && kind != offerSwitch) {
+		return nil, "", errNotOffered
+	}
+	return o, kind, nil
+}
+
+// Action describes the offered action with the id and returns the telegram usernames allowed to confirm it,
+// empty if the admins of the chat may.
+func (r *Remediator) Action(id string) (string, []string, error) {
+	if strings.HasPrefix(id, resyncPrefix) {
+		return r.resyncAction(id)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, kind, err := r.lookup(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind == offerSwitch {
+		return "switch the endpoint of " + o.ev.Node, o.tg.cfg.Approvers, nil
+	}
+	return fmt.Sprintf("run %s on %s: %s", o.tg.cfg.Name, o.ev.Node, o.tg.action.describe(o.ev)), o.tg.cfg.Approvers, nil
+}
+
+// Confirm runs the offered action with the id on behalf of the user, the outcome is reported like the automated runs.
+// The caller has to check that the user may confirm it. The limits apply, the pause of the automation doesn't.
+func (r *Remediator) Confirm(id, user string) error {
+	if strings.HasPrefix(id, resyncPrefix) {
+		return r.confirmResync(id, user)
+	}
+	r.mu.Lock()
+	o, kind, err := r.lookup(id)
+	ctx := r.ctx
+	switch {
+	case err != nil:
+	case ctx == nil || ctx.Err() != nil:
+		err = errors.New("the remediation isn't running")
+	case r.running[o.ev.Node]:
+		err = fmt.Errorf("an action is running on %s already", o.ev.Node)
+	case r.resyncOf(o.ev.Node) != nil:
+		err = fmt.Errorf("%s is being resynced", o.ev.Node)
+	default:
+		if reason := r.exceeded(o.ev.Node); reason != "" {
+			err = errors.New(reason)
+		}
+	}
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	// either action of the offer runs at most once
+	delete(r.offers, o.id)
+	o.tg.offer = nil
+	r.start(o.ev.Node)
+	r.mu.Unlock()
+
+	slog.Info("remediation confirmed", "node", o.ev.Node, "remediation", o.tg.cfg.Name, "action", kind, "user", user)
+	if kind == offerSwitch {
+		go r.switchEndpoint(o, user)
+		return nil
+	}
+	go r.remediate(ctx, o.tg, o.ev, user)
+	return nil
+}
+
+// switchEndpoint switches the node of the offer to its next endpoint and reports the outcome.
+func (r *Remediator) switchEndpoint(o *offer, user string) {
+	defer r.finish(o.ev.Node)
+	host, err := o.tg.node.SwitchEndpoint()
+	if o.ev.Incident != "" {
+		detail := "switch endpoint"
+		if err != nil {
+			detail += " (failed)"
+		}
+		o.tg.node.Incident().Record(user, insync.ActionRemediated, detail)
+	}
+	a := newAlert(o.tg, o.ev)
+	if err != nil {
+		slog.Error("switching endpoint failed", "node", o.ev.Node, "err", err)
+		a.Icon, a.Severity = "❌", insync.SeverityCritical
+		a.Text = fmt.Sprintf("❌ switching the endpoint of %s failed, confirmed by %s: %v", o.ev.Node, user, err)
+	} else {
+		a.Icon, a.Severity = "🔀", insync.SeverityWarning
+		a.Text = fmt.Sprintf("🔀 %s is monitored through %s now, switched by %s", o.ev.Node, host, user)
+	}
+	r.send(a, o.ev)
+}
@@ -0,0 +1,306 @@
+package remediation
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The message types of d-bus.
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+)
+
+// The header fields of d-bus messages.
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+)
+
+// dbusMessage is a decoded d-bus message. Only the header fields used by the client are kept.
+type dbusMessage struct {
+	typ         byte
+	serial      uint32
+	replySerial uint32
+	iface       string
+	member      string
+	errorName   string
+	signature   string
+	body        []byte
+}
+
+// dbusConn is a minimal d-bus client, just enough to call the methods of systemd with string arguments.
+type dbusConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dialDBus connects to the bus at the unix socket and authenticates with the uid of insync.
+func dialDBus(ctx context.Context, socket string) (*dbusConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	c := &dbusConn{conn: conn, r: bufio.NewReader(conn)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error authenticating: %w", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		conn.Close()
+		return nil, fmt.Errorf("the bus rejected the authentication: %s", strings.TrimSpace(line))
+	}
+	if _, err := conn.Write([]byte("BEGIN\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *dbusConn) close() error {
+	return c.conn.Close()
+}
+
+// call calls the method with the string arguments and returns the body of the reply, an error reply is an error.
+// The signals received meanwhile are dropped.
+func (c *dbusConn) call(dest, path, iface, member string, args ...string) (*dbusMessage, error) {
+	serial, err := c.send(dest, path, iface, member, args...)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		m, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if m.replySerial != serial || (m.typ != dbusMethodReturn && m.typ != dbusError) {
+			continue
+		}
+		if m.typ == dbusError {
+			msg, _ := m.strings()
+			return nil, fmt.Errorf("%s: %s", m.errorName, strings.Join(msg, " "))
+		}
+		return m, nil
+	}
+}
+
+func (c *dbusConn) send(dest, path, iface, member string, args ...string) (uint32, error) {
+	c.serial++
+	var body []byte
+	for _, a := range args {
+		body = dbusAppendString(body, a)
+	}
+	b := []byte{'l', dbusMethodCall, 0, 1}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+	b = binary.LittleEndian.AppendUint32(b, c.serial)
+	var fields []byte
+	field := func(code byte, sig string, value string) {
+		fields = dbusPad(fields, 8)
+		fields = append(fields, code, 1, sig[0], 0)
+		if sig == "g" {
+			fields = append(fields, byte(len(value)))
+			fields = append(append(fields, value...), 0)
+			return
+		}
+		fields = dbusAppendString(fields, value)
+	}
+	field(dbusFieldPath, "o", path)
+	field(dbusFieldInterface, "s", iface)
+	field(dbusFieldMember, "s", member)
+	field(dbusFieldDestination, "s", dest)
+	if len(args) > 0 {
+		field(dbusFieldSignature, "g", strings.Repeat("s", len(args)))
+	}
+	// the fields are aligned relative to the start of the message, which is aligned to 8 after the array length
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(fields)))
+	b = append(b, fields...)
+	b = dbusPad(b, 8)
+	_, err := c.conn.Write(append(b, body...))
+	return c.serial, err
+}
+
+var errDBusMalformed = errors.New("malformed d-bus message")
+
+func (c *dbusConn) read() (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return nil, err
+	}
+	if fixed[0] != 'l' {
+		return nil, errors.New("unsupported big endian d-bus message")
+	}
+	bodyLen := binary.LittleEndian.Uint32(fixed[4:])
+	fieldsLen := binary.LittleEndian.Uint32(fixed[12:])
+	if bodyLen > 1<<20 || fieldsLen > 1<<16 {
+		return nil, errDBusMalformed
+	}
+	// the fields are followed by the padding to 8
+	rest := make([]byte, int(fieldsLen+7)/8*8+int(bodyLen))
+	if _, err := io.ReadFull(c.r, rest); err != nil {
+		return nil, err
+	}
+	m := &dbusMessage{typ: fixed[1], serial: binary.LittleEndian.Uint32(fixed[8:]), body: rest[len(rest)-int(bodyLen):]}
+	// offsets are relative to the start of the message, the fields start at 16
+	d := dbusDecoder{b: append(fixed, rest[:fieldsLen]...), off: 16}
+	for d.off < len(d.b) {
+		d.align(8)
+		code, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		var s string
+		var u uint32
+		switch sig {
+		case "s", "o":
+			s, err = d.string()
+		case "g":
+			s, err = d.signature()
+		case "u":
+			u, err = d.uint32()
+		default:
+			return nil, errDBusMalformed
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case dbusFieldInterface:
+			m.iface = s
+		case dbusFieldMember:
+			m.member = s
+		case dbusFieldErrorName:
+			m.errorName = s
+		case dbusFieldReplySerial:
+			m.replySerial = u
+		case dbusFieldSignature:
+			m.signature = s
+		}
+	}
+	return m, nil
+}
+
+// strings decodes a body of the basic types, the strings and object paths are returned, the numbers skipped.
+func (m *dbusMessage) strings() ([]string, error) {
+	d := dbusDecoder{b: m.body}
+	var out []string
+	for _, t := range m.signature {
+		switch t {
+		case 's', 'o':
+			s, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		case 'u':
+			if _, err := d.uint32(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported d-bus type %q", t)
+		}
+	}
+	return out, nil
+}
+
+// dbusDecoder decodes the basic types, aligned relative to the start of b.
+type dbusDecoder struct {
+	b   []byte
+	off int
+}
+
+func (d *dbusDecoder) align(n int) {
+	d.off = (d.off + n - 1) / n * n
+}
+
+func (d *dbusDecoder) byte() (byte, error) {
+	if d.off >= len(d.b) {
+		return 0, errDBusMalformed
+	}
+	d.off++
+	return d.b[d.off-1], nil
+}
+
+func (d *dbusDecoder) uint32() (uint32, error) {
+	d.align(4)
+	if d.off+4 > len(d.b) {
+		return 0, errDBusMalformed
+	}
+	d.off += 4
+	return binary.LittleEndian.Uint32(d.b[d.off-4:]), nil
+}
+
+func (d *dbusDecoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	if d.off+int(n)+1 > len(d.b) {
+		return "", errDBusMalformed
+	}
+	s := string(d.b[d.off : d.off+int(n)])
+	d.off += int(n) + 1
+	return s, nil
+}
+
+func (d *dbusDecoder) signature() (string, error) {
+	n, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	if d.off+int(n)+1 > len(d.b) {
+		return "", errDBusMalformed
+	}
+	s := string(d.b[d.off : d.off+int(n)])
+	d.off += int(n) + 1
+	return s, nil
+}
+
+func dbusAppendString(b []byte, s string) []byte {
+	b = dbusPad(b, 4)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	return append(append(b, s...), 0)
+}
+
+// dbusPad pads b with zeros to a multiple of n. The encoded parts are aligned relative to their own start,
+// which is aligned to 8 in the message.
+func dbusPad(b []byte, n int) []byte {
+	for len(b)%n != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
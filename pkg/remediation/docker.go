@@ -0,0 +1,104 @@
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// DockerConfig configures the restart of the container of the node through the docker api.
+type DockerConfig struct {
+	// Host is the docker daemon, e.g. unix:///var/run/docker.sock (the default) or tcp://10.0.0.5:2375.
+	Host      string `yaml:"host"`
+	Container string `yaml:"container"`
+	// Action is restart (the default), stop or start.
+	Action string `yaml:"action"`
+	// StopTimeout is the time the container has to stop before it's killed, defaults to 30s.
+	StopTimeout insync.Duration `yaml:"stop_timeout"`
+}
+
+func (c *DockerConfig) finalize() error {
+	if c.Container == "" {
+		return errors.New("missing docker container")
+	}
+	if c.Host == "" {
+		c.Host = "unix:///var/run/docker.sock"
+	}
+	u, err := url.Parse(c.Host)
+	if err != nil {
+		return fmt.Errorf("invalid docker host: %w", err)
+	}
+	if u.Scheme != "unix" && u.Scheme != "tcp" {
+		return fmt.Errorf("invalid docker host %q, expected unix:// or tcp://", c.Host)
+	}
+	if c.StopTimeout <= 0 {
+		c.StopTimeout = insync.Duration(30 * time.Second)
+	}
+	if c.Action = strings.ToLower(c.Action); c.Action == "" {
+		c.Action = unitRestart
+	}
+	if !unitActions[c.Action] {
+		return fmt.Errorf("invalid docker action %q, expected restart, stop or start", c.Action)
+	}
+	return nil
+}
+
+// dockerAction restarts, stops or starts the container.
+type dockerAction struct {
+	cfg    DockerConfig
+	base   string
+	client *http.Client
+}
+
+func newDocker(cfg DockerConfig) (*dockerAction, error) {
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{}
+	base := "http://" + u.Host
+	if u.Scheme == "unix" {
+		// the host of the requests is ignored, every connection goes to the socket
+		var d net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", u.Path)
+		}
+		base = "http://docker"
+	}
+	return &dockerAction{cfg: cfg, base: base, client: &http.Client{Transport: transport}}, nil
+}
+
+func (a *dockerAction) describe(event) string {
+	return fmt.Sprintf("docker %s %s on %s", a.cfg.Action, a.cfg.Container, a.cfg.Host)
+}
+
+func (a *dockerAction) run(ctx context.Context, _ event) (string, error) {
+	u := a.base + "/containers/" + url.PathEscape(a.cfg.Container) + "/" + a.cfg.Action
+	if a.cfg.Action != unitStart {
+		u += "?" + url.Values{"t": {strconv.Itoa(int(time.Duration(a.cfg.StopTimeout) / time.Second))}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	// not modified if the container is stopped or started already
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return "", nil
+}
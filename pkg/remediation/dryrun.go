@@ -0,0 +1,29 @@
+package remediation
+
+import (
+	"context"
+	"log/slog"
+)
+
+// dryRunAction logs the action instead of running it.
+type dryRunAction struct {
+	action
+}
+
+func (a dryRunAction) run(_ context.Context, ev event) (string, error) {
+	slog.Info("dry run, would run action", "node", ev.Node, "condition", ev.Condition, "action", a.describe(ev))
+	return "dry run, the action wasn't run", nil
+}
+
+// SetDryRun logs the actions of the remediations and the steps of the resyncs instead of running them, e.g. the
+// restarts and hooks. It must be called before Run.
+func (r *Remediator) SetDryRun() {
+	for _, tg := range r.targets {
+		tg.action = dryRunAction{tg.action}
+	}
+	for _, rc := range r.recipes {
+		for i, s := range rc.steps {
+			rc.steps[i] = dryRunAction{s}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package remediation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// ExecConfig configures a hook command. The arguments are templates of the event, e.g. {{.Node}} or {{.Duration}},
+// and the event is passed as json on stdin.
+type ExecConfig struct {
+	// Command is the command and its arguments.
+	Command []string `yaml:"command"`
+
+	args []*template.Template
+}
+
+func (c *ExecConfig) finalize() error {
+	if len(c.Command) == 0 {
+		return errors.New("missing command")
+	}
+	c.args = make([]*template.Template, len(c.Command))
+	for i, arg := range c.Command {
+		t, err := parseTemplate(arg)
+		if err != nil {
+			return fmt.Errorf("invalid argument %q: %w", arg, err)
+		}
+		c.args[i] = t
+	}
+	return nil
+}
+
+// WebhookConfig configures a hook url the event is posted to. The url and the body are templates of the event,
+// the body defaults to the event as json.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Body    string            `yaml:"body"`
+	Headers map[string]string `yaml:"headers"`
+
+	url, body *template.Template
+}
+
+func (c *WebhookConfig) finalize() error {
+	if c.URL == "" {
+		return errors.New("missing webhook url")
+	}
+	var err error
+	if c.url, err = parseTemplate(c.URL); err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if c.Body != "" {
+		if c.body, err = parseTemplate(c.Body); err != nil {
+			return fmt.Errorf("invalid webhook body: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseTemplate parses the template and executes it once, so unknown fields are reported right away.
+func parseTemplate(s string) (*template.Template, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, event{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func render(t *template.Template, ev event) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, ev); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// execAction runs the hook command, a non-zero exit code is an error. Its output is reported.
+type execAction struct {
+	cfg ExecConfig
+}
+
+func (a *execAction) args(ev event) ([]string, error) {
+	args := make([]string, len(a.cfg.args))
+	for i, t := range a.cfg.args {
+		arg, err := render(t, ev)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+func (a *execAction) describe(ev event) string {
+	args, err := a.args(ev)
+	if err != nil {
+		return strings.Join(a.cfg.Command, " ")
+	}
+	return strings.Join(args, " ")
+}
+
+func (a *execAction) run(ctx context.Context, ev event) (string, error) {
+	args, err := a.args(ev)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "INSYNC_NODE="+ev.Node, "INSYNC_CONDITION="+ev.Condition, "INSYNC_INCIDENT="+ev.Incident)
+	out, err := cmd.CombinedOutput()
+	return string(out), ctxErr(ctx, err)
+}
+
+// webhookAction posts the event to the hook url, any status but 2xx is an error. The response is reported.
+type webhookAction struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func newWebhook(cfg WebhookConfig) *webhookAction {
+	return &webhookAction{cfg: cfg, client: &http.Client{}}
+}
+
+func (a *webhookAction) describe(ev event) string {
+	u, err := render(a.cfg.url, ev)
+	if err != nil {
+		return "webhook"
+	}
+	// only the host, the url might contain credentials
+	return "webhook " + insync.NodeName(u)
+}
+
+func (a *webhookAction) run(ctx context.Context, ev event) (string, error) {
+	u, err := render(a.cfg.url, ev)
+	if err != nil {
+		return "", err
+	}
+	var body []byte
+	contentType := "application/json"
+	if a.cfg.body != nil {
+		s, err := render(a.cfg.body, ev)
+		if err != nil {
+			return "", err
+		}
+		body, contentType = []byte(s), "text/plain; charset=utf-8"
+	} else if body, err = json.Marshal(ev); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range a.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput+1))
+	if resp.StatusCode/100 != 2 {
+		return string(out), fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,90 @@
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// AddPeersConfig configures the peers the node is asked to connect to with admin_addPeer, e.g. the static nodes or bootnodes.
+type AddPeersConfig struct {
+	Enodes []string `yaml:"enodes"`
+	// Wait is the time the node has to connect to the peers before the peer count is reported, defaults to 1m.
+	Wait insync.Duration `yaml:"wait"`
+}
+
+func (c *AddPeersConfig) finalize() error {
+	if len(c.Enodes) == 0 {
+		return errors.New("missing enodes")
+	}
+	for _, e := range c.Enodes {
+		if !strings.HasPrefix(e, "enode://") {
+			return fmt.Errorf("invalid enode %q, expected enode://<id>@<host>:<port>", e)
+		}
+	}
+	if c.Wait <= 0 {
+		c.Wait = insync.Duration(time.Minute)
+	}
+	return nil
+}
+
+// peersAction adds the peers to the node, it fails if the peer count doesn't recover.
+type peersAction struct {
+	cfg  AddPeersConfig
+	node *insync.Node
+	// min is the peer count the node has to reach, 0 if the action doesn't run for the peer count.
+	min int64
+}
+
+func (a *peersAction) describe(event) string {
+	return fmt.Sprintf("admin_addPeer with %d enodes", len(a.cfg.Enodes))
+}
+
+func (a *peersAction) run(ctx context.Context, _ event) (string, error) {
+	var out strings.Builder
+	var added int
+	for _, e := range a.cfg.Enodes {
+		if err := a.node.AddPeer(ctx, e); err != nil {
+			if ctx.Err() != nil {
+				return out.String(), ctx.Err()
+			}
+			// only the id, the rest of the enode is the address of the peer
+			fmt.Fprintf(&out, "error adding %s: %v\n", enodeID(e), err)
+			continue
+		}
+		added++
+	}
+	if added == 0 {
+		return out.String(), errors.New("no peer could be added")
+	}
+	select {
+	case <-ctx.Done():
+		return out.String(), ctx.Err()
+	case <-time.After(time.Duration(a.cfg.Wait)):
+	}
+	peers, err := a.node.PeerCount(ctx)
+	if err != nil {
+		return out.String(), fmt.Errorf("added %d of %d peers, error getting the peer count: %w", added, len(a.cfg.Enodes), err)
+	}
+	fmt.Fprintf(&out, "added %d of %d peers, %d peers after %s", added, len(a.cfg.Enodes), peers, insync.FormatDuration(time.Duration(a.cfg.Wait)))
+	if int64(peers) < a.min {
+		return out.String(), fmt.Errorf("the peer count didn't recover, %d peers (minimum %d)", peers, a.min)
+	}
+	return out.String(), nil
+}
+
+// enodeID returns the shortened node id of the enode url.
+func enodeID(enode string) string {
+	id := strings.TrimPrefix(enode, "enode://")
+	if i := strings.IndexByte(id, '@'); i >= 0 {
+		id = id[:i]
+	}
+	if len(id) > 16 {
+		id = id[:16] + "…"
+	}
+	return id
+}
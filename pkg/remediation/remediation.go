@@ -0,0 +1,577 @@
+// Package remediation repairs stuck nodes automatically, e.g. by restarting them over ssh,
+// and reports the outcome of every attempt as alert.
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Config configures a remediation action. It runs once per incident, after the node is stuck in one of the states for a while,
+// once the disk usage of the node reaches Disk or once its peer count stays below Peers.
+type Config struct {
+	Name string `yaml:"name"`
+	// Nodes limits the action to the nodes with these names, it runs for all nodes if empty.
+	Nodes []string `yaml:"nodes"`
+	// After is the time the node has to be stuck before the action runs, defaults to 30m, 10m for the peer count
+	// and 0 for the disk usage.
+	After insync.Duration `yaml:"after"`
+	// States are the states the action runs for, defaults to syncing and unreachable.
+	States []string `yaml:"states"`
+	// Disk runs the action once the disk usage of the node reaches the percentage instead, e.g. 95. It requires the disk check.
+	Disk float64 `yaml:"disk"`
+	// Peers runs the action once the peer count of the node stays below the number instead. It requires the peers check.
+	Peers int64 `yaml:"peers"`
+	// Timeout bounds the action, defaults to 5m.
+	Timeout insync.Duration `yaml:"timeout"`
+	// Cooldown is the minimum time between two runs of the action for the same node, defaults to 1h.
+	// It keeps the action from looping on a node which breaks again right after it recovered.
+	Cooldown insync.Duration `yaml:"cooldown"`
+	// Confirm offers the action with buttons on telegram instead of running it, it runs once a user confirms.
+	Confirm bool `yaml:"confirm"`
+	// Approvers are the telegram usernames or numeric user ids allowed to confirm the action, the admins of the chat
+	// if empty.
+	Approvers []string `yaml:"approvers"`
+
+	SSH      *SSHConfig      `yaml:"ssh"`
+	Docker   *DockerConfig   `yaml:"docker"`
+	Systemd  *SystemdConfig  `yaml:"systemd"`
+	Exec     *ExecConfig     `yaml:"exec"`
+	Webhook  *WebhookConfig  `yaml:"webhook"`
+	AddPeers *AddPeersConfig `yaml:"add_peers"`
+
+	states map[insync.NodeState]bool
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *Config) Finalize() error {
+	if c.Name == "" {
+		return errors.New("remediation: missing name")
+	}
+	if c.Disk < 0 || c.Disk > 100 {
+		return fmt.Errorf("remediation %s: disk usage must be between 0 and 100", c.Name)
+	}
+	if c.Peers < 0 {
+		return fmt.Errorf("remediation %s: peers must not be negative", c.Name)
+	}
+	var conditions int
+	for _, set := range []bool{len(c.States) > 0, c.Disk > 0, c.Peers > 0} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions > 1 {
+		return fmt.Errorf("remediation %s: only one of states, disk or peers can be set", c.Name)
+	}
+	if c.After <= 0 {
+		switch {
+		case c.Peers > 0:
+			c.After = insync.Duration(10 * time.Minute)
+		case c.Disk == 0:
+			c.After = insync.Duration(30 * time.Minute)
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = insync.Duration(5 * time.Minute)
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = insync.Duration(time.Hour)
+	}
+	if len(c.Approvers) > 0 && !c.Confirm {
+		return fmt.Errorf("remediation %s: approvers require confirm", c.Name)
+	}
+	normalizeApprovers(c.Approvers)
+	if conditions == 0 {
+		c.States = []string{insync.StateSyncing.String(), insync.StateUnreachable.String()}
+	}
+	c.states = make(map[insync.NodeState]bool, len(c.States))
+	for _, s := range c.States {
+		st, ok := insync.ParseNodeState(s)
+		if !ok || st == insync.StateHealthy || st == insync.StateDegraded {
+			return fmt.Errorf("remediation %s: invalid state %q, expected syncing or unreachable", c.Name, s)
+		}
+		c.states[st] = true
+	}
+	var n int
+	var err error
+	if c.SSH != nil {
+		n++
+		err = c.SSH.finalize()
+	}
+	if c.Docker != nil {
+		n++
+		err = c.Docker.finalize()
+	}
+	if c.Systemd != nil {
+		n++
+		err = c.Systemd.finalize()
+	}
+	if c.Exec != nil {
+		n++
+		err = c.Exec.finalize()
+	}
+	if c.Webhook != nil {
+		n++
+		err = c.Webhook.finalize()
+	}
+	if c.AddPeers != nil {
+		n++
+		err = c.AddPeers.finalize()
+	}
+	if n != 1 {
+		return fmt.Errorf("remediation %s: exactly one of ssh, docker, systemd, exec, webhook or add_peers must be set", c.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("remediation %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// normalizeApprovers prefixes the usernames of the approvers with @, the user ids are kept.
+func normalizeApprovers(approvers []string) {
+	for i, u := range approvers {
+		if _, err := strconv.ParseInt(u, 10, 64); err != nil && !strings.HasPrefix(u, "@") {
+			approvers[i] = "@" + u
+		}
+	}
+}
+
+// Limits are the guardrails of all actions.
+type Limits struct {
+	// PerNode is the maximum number of actions run for a node within 24 hours, 0 for no limit.
+	PerNode int `yaml:"per_node"`
+	// Nodes is the maximum number of nodes acted on at the same time, 0 for no limit.
+	Nodes int `yaml:"nodes"`
+}
+
+// Finalize validates the limits.
+func (l *Limits) Finalize() error {
+	if l.PerNode < 0 || l.Nodes < 0 {
+		return errors.New("remediation limits must not be negative")
+	}
+	return nil
+}
+
+// Runs reports whether the action runs for the node with the given name.
+func (c *Config) Runs(node string) bool {
+	return runs(c.Nodes, node)
+}
+
+// runs reports whether the node is one of the nodes, or the nodes are empty.
+func runs(nodes []string, node string) bool {
+	if len(nodes) == 0 {
+		return true
+	}
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// event is the condition an action runs for, the hooks get it as json and as data of their templates.
+type event struct {
+	Node        string `json:"node"`
+	Remediation string `json:"remediation"`
+	// Condition is the state of the node, syncing or unreachable, disk or peers.
+	Condition string    `json:"condition"`
+	Since     time.Time `json:"since"`
+	// Duration is the time since the condition started, e.g. 1h 5m.
+	Duration string `json:"duration"`
+	// Incident is the id of the ongoing incident, empty for the disk usage and the peer count.
+	Incident     string  `json:"incident,omitempty"`
+	CurrentBlock uint64  `json:"current_block"`
+	HighestBlock uint64  `json:"highest_block"`
+	Lag          uint64  `json:"lag"`
+	Peers        int64   `json:"peers"`
+	DiskUsage    float64 `json:"disk_usage,omitempty"`
+
+	// id identifies the occurrence of the condition, the action runs once per occurrence.
+	id string
+}
+
+const (
+	conditionDisk  = "disk"
+	conditionPeers = "peers"
+)
+
+// what describes the condition, e.g. syncing, at 96.1% disk usage or at 2 peers.
+func (e event) what() string {
+	switch e.Condition {
+	case conditionDisk:
+		return fmt.Sprintf("at %.1f%% disk usage", e.DiskUsage)
+	case conditionPeers:
+		return fmt.Sprintf("at %d peers", e.Peers)
+	}
+	return e.Condition
+}
+
+// action repairs the node, it returns the output to report.
+type action interface {
+	// describe returns a short description of the action, e.g. the command.
+	describe(ev event) string
+	run(ctx context.Context, ev event) (string, error)
+}
+
+// auditUser is the user of the automated actions in the audit trail of the incidents.
+const auditUser = "insync"
+
+// maxOutput is the number of bytes of the output included in the report.
+const maxOutput = 1000
+
+// target is an action bound to a node.
+type target struct {
+	cfg    *Config
+	node   *insync.Node
+	action action
+	// ran is the id of the last occurrence the action ran for, last when it ran.
+	ran  string
+	last time.Time
+	// held is the id of the last occurrence it was reported for that the action is held back.
+	held string
+	// crossed is the time the disk usage or the peer count was first seen beyond the threshold, zero while it isn't.
+	crossed time.Time
+	// offer is the offer of the action waiting for confirmation, nil if there is none.
+	offer *offer
+}
+
+// Remediator runs the actions of the stuck nodes and the guided resyncs.
+type Remediator struct {
+	targets []*target
+	recipes []*recipe
+	limits  Limits
+	st      *insync.StateStore
+	nf      insync.Notifier
+
+	// mu guards the state of the targets, the offers, the resyncs and the running actions, the actions run without
+	// holding it.
+	mu sync.Mutex
+	// ctx is the context of Run, the confirmed actions run with it.
+	ctx     context.Context
+	offers  map[string]*offer
+	resyncs map[string]*resync
+	seq     int
+	// running are the nodes with an action running.
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// New creates the remediator of the nodes within the limits, with the recipes of the guided resyncs. The outcome of
+// the actions is sent to the notifier. The pause of the automation and the actions of the last day are kept in the
+// state store.
+func New(cfgs []Config, resyncs []ResyncConfig, limits Limits, nodes []*insync.Node, st *insync.StateStore, nf insync.Notifier) (*Remediator, error) {
+	r := &Remediator{
+		limits:  limits,
+		st:      st,
+		nf:      nf,
+		offers:  make(map[string]*offer),
+		resyncs: make(map[string]*resync),
+		running: make(map[string]bool),
+	}
+	for i := range cfgs {
+		c := &cfgs[i]
+		for _, n := range nodes {
+			if !c.Runs(n.Name()) {
+				continue
+			}
+			a, err := newAction(c, n)
+			if err != nil {
+				return nil, fmt.Errorf("remediation %s: %w", c.Name, err)
+			}
+			r.targets = append(r.targets, &target{cfg: c, node: n, action: a})
+		}
+	}
+	var err error
+	if r.recipes, err = newRecipes(resyncs, nodes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newAction(c *Config, n *insync.Node) (action, error) {
+	switch {
+	case c.SSH != nil:
+		return newSSH(*c.SSH)
+	case c.Docker != nil:
+		return newDocker(*c.Docker)
+	case c.Systemd != nil:
+		return &systemdAction{cfg: *c.Systemd}, nil
+	case c.Exec != nil:
+		return &execAction{cfg: *c.Exec}, nil
+	case c.Webhook != nil:
+		return newWebhook(*c.Webhook), nil
+	case c.AddPeers != nil:
+		return &peersAction{cfg: *c.AddPeers, node: n, min: c.Peers}, nil
+	}
+	return nil, errors.New("no action configured")
+}
+
+// Run checks the nodes and the resyncs every interval until the context is done, and waits for the running actions.
+func (r *Remediator) Run(ctx context.Context, interval time.Duration) {
+	r.mu.Lock()
+	r.ctx = ctx
+	r.mu.Unlock()
+	defer r.wg.Wait()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, tg := range r.targets {
+				r.check(ctx, tg)
+			}
+			r.watchResyncs()
+		}
+	}
+}
+
+// check starts the action of the target or offers it, if it's due and within the limits.
+func (r *Remediator) check(ctx context.Context, tg *target) {
+	r.mu.Lock()
+	r.expire(tg)
+	ev, ok := r.due(tg)
+	if !ok || r.running[ev.Node] || r.resyncOf(ev.Node) != nil {
+		// the action runs once the current one or the resync is done, if it's still due
+		r.mu.Unlock()
+		return
+	}
+	if tg.cfg.Confirm {
+		tg.ran = ev.id
+		r.mu.Unlock()
+		r.offer(tg, ev)
+		return
+	}
+	if p, ok := r.st.AutomationPaused(); ok {
+		r.mu.Unlock()
+		slog.Debug("skipping remediation while the automation is paused", "node", ev.Node, "remediation", tg.cfg.Name, "paused_by", p.User)
+		return
+	}
+	if reason := r.exceeded(ev.Node); reason != "" {
+		if tg.held != ev.id {
+			tg.held = ev.id
+			r.reportHeld(tg, ev, reason)
+		}
+		r.mu.Unlock()
+		return
+	}
+	tg.ran = ev.id
+	r.start(ev.Node)
+	r.mu.Unlock()
+	go r.remediate(ctx, tg, ev, auditUser)
+}
+
+// exceeded returns why acting on the node exceeds the limits, empty if it doesn't. r.mu must be held.
+func (r *Remediator) exceeded(node string) string {
+	if n := r.st.Remediations(node); r.limits.PerNode > 0 && n >= r.limits.PerNode {
+		return fmt.Sprintf("%d actions ran for %s within 24h already (limit %d)", n, node, r.limits.PerNode)
+	}
+	if r.limits.Nodes > 0 && len(r.running) >= r.limits.Nodes {
+		return fmt.Sprintf("already remediating %d nodes at the same time (limit %d)", len(r.running), r.limits.Nodes)
+	}
+	return ""
+}
+
+// start marks the node as acted on and counts the action towards its limit. r.mu must be held.
+func (r *Remediator) start(node string) {
+	r.running[node] = true
+	r.wg.Add(1)
+	if err := r.st.RecordRemediation(node); err != nil {
+		slog.Error("error saving state", "err", err)
+	}
+}
+
+func (r *Remediator) finish(node string) {
+	r.mu.Lock()
+	delete(r.running, node)
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+// current returns the condition of the node the action runs for, or false if there is none.
+func (tg *target) current() (event, bool) {
+	st := tg.node.Status()
+	ev := event{
+		Node:         tg.node.Name(),
+		Remediation:  tg.cfg.Name,
+		CurrentBlock: st.CurrentBlock,
+		HighestBlock: st.HighestBlock,
+		Peers:        st.Peers,
+		DiskUsage:    st.DiskUsage,
+	}
+	if st.HighestBlock > st.CurrentBlock {
+		ev.Lag = st.HighestBlock - st.CurrentBlock
+	}
+	switch {
+	case tg.cfg.Disk > 0:
+		if !tg.cross(st.DiskUsage >= tg.cfg.Disk) {
+			return event{}, false
+		}
+		ev.Condition, ev.Since = conditionDisk, tg.crossed
+		ev.id = fmt.Sprintf("disk_%d", tg.crossed.UnixNano())
+	case tg.cfg.Peers > 0:
+		// -1 until the peers check ran
+		if !tg.cross(st.Peers >= 0 && st.Peers < tg.cfg.Peers) {
+			return event{}, false
+		}
+		ev.Condition, ev.Since = conditionPeers, tg.crossed
+		ev.id = fmt.Sprintf("peers_%d", tg.crossed.UnixNano())
+	default:
+		inc, ok := tg.node.Incident().Snapshot()
+		if !ok {
+			return event{}, false
+		}
+		if st, _ := insync.ParseNodeState(inc.State); !tg.cfg.states[st] {
+			return event{}, false
+		}
+		if inc.ID != tg.ran && ranFor(inc, tg.cfg.Name) {
+			// the action ran before insync restarted
+			tg.ran = inc.ID
+		}
+		ev.Condition, ev.Since, ev.Incident, ev.id = inc.State, inc.Start, inc.ID, inc.ID
+	}
+	ev.Duration = insync.FormatDuration(time.Since(ev.Since))
+	return ev, true
+}
+
+// cross tracks since when the threshold is crossed and reports whether it is.
+func (tg *target) cross(crossed bool) bool {
+	if !crossed {
+		tg.crossed = time.Time{}
+		return false
+	}
+	if tg.crossed.IsZero() {
+		tg.crossed = time.Now()
+	}
+	return true
+}
+
+// due returns the condition of the node if it lasts long enough and the action didn't run for it or during the cooldown yet.
+// Muted nodes are skipped, they're likely in maintenance. r.mu must be held.
+func (r *Remediator) due(tg *target) (event, bool) {
+	ev, ok := tg.current()
+	if !ok || ev.id == tg.ran || time.Since(ev.Since) < time.Duration(tg.cfg.After) {
+		return event{}, false
+	}
+	if m, ok := r.st.Muted(ev.Node); ok {
+		slog.Debug("skipping remediation of muted node", "node", ev.Node, "remediation", tg.cfg.Name, "muted_by", m.User)
+		return event{}, false
+	}
+	if since := time.Since(tg.last); since < time.Duration(tg.cfg.Cooldown) {
+		if tg.held != ev.id {
+			tg.held = ev.id
+			wait := time.Duration(tg.cfg.Cooldown) - since
+			slog.Warn("holding back remediation during cooldown", "node", ev.Node, "remediation", tg.cfg.Name, "last", since, "wait", wait)
+			r.reportHeld(tg, ev, fmt.Sprintf("it already ran %s ago. It runs again in %s if %s is still %s",
+				insync.FormatDuration(since), insync.FormatDuration(wait), ev.Node, ev.what()))
+		}
+		return event{}, false
+	}
+	return ev, true
+}
+
+// ranFor reports whether the audit trail of the incident contains a run of the action.
+func ranFor(inc insync.IncidentRecord, name string) bool {
+	for _, a := range inc.Actions {
+		if a.Action == insync.ActionRemediated && (a.Detail == name || strings.HasPrefix(a.Detail, name+" ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportHeld tells the routes that the action is held back and why, so nobody waits for it.
+func (r *Remediator) reportHeld(tg *target, ev event, reason string) {
+	slog.Warn("holding back remediation", "node", ev.Node, "remediation", tg.cfg.Name, "reason", reason)
+	a := newAlert(tg, ev)
+	a.Icon, a.Severity = "⏸", insync.SeverityWarning
+	a.Text = fmt.Sprintf("⏸ remediation %s of %s is held back, %s.", tg.cfg.Name, ev.Node, reason)
+	r.send(a, ev)
+}
+
+// remediate runs the action on behalf of the user, auditUser unless it was confirmed, and reports the outcome.
+// The node has to be started.
+func (r *Remediator) remediate(ctx context.Context, tg *target, ev event, user string) {
+	defer r.finish(ev.Node)
+	r.mu.Lock()
+	tg.last = time.Now()
+	r.mu.Unlock()
+	slog.Info("remediating node", "node", ev.Node, "remediation", tg.cfg.Name, "condition", ev.Condition, "since", ev.Since, "user", user)
+	actx, cancel := context.WithTimeout(ctx, time.Duration(tg.cfg.Timeout))
+	out, err := tg.action.run(actx, ev)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	out = truncate(strings.TrimSpace(out), maxOutput)
+	if ev.Incident != "" {
+		// every automated run is added to the audit trail of the incident, e.g. for the postmortem
+		detail := tg.cfg.Name
+		if err != nil {
+			detail += " (failed)"
+		}
+		tg.node.Incident().Record(user, insync.ActionRemediated, detail)
+	}
+
+	var by string
+	if user != auditUser {
+		by = ", confirmed by " + user
+	}
+	a := newAlert(tg, ev)
+	if err != nil {
+		slog.Error("remediation failed", "node", ev.Node, "remediation", tg.cfg.Name, "err", err)
+		a.Icon, a.Severity = "❌", insync.SeverityCritical
+		a.Text = fmt.Sprintf("❌ remediation %s of %s failed%s: %v\n", tg.cfg.Name, ev.Node, by, err)
+	} else {
+		slog.Info("remediation succeeded", "node", ev.Node, "remediation", tg.cfg.Name)
+		a.Icon, a.Severity = "🔧", insync.SeverityWarning
+		a.Text = fmt.Sprintf("🔧 ran remediation %s of %s%s\n", tg.cfg.Name, ev.Node, by)
+	}
+	a.Text += fmt.Sprintf("%s was %s for %s: %s", ev.Node, ev.what(), ev.Duration, tg.action.describe(ev))
+	if out != "" {
+		a.Text += "\n" + out
+	}
+	r.send(a, ev)
+}
+
+// send delivers the alert, with the footer of the incident if there is one.
+func (r *Remediator) send(a insync.Alert, ev event) {
+	if a.Incident != nil {
+		a.Text += "\nIncident #" + ev.Incident
+	}
+	if err := r.nf.Send(a); err != nil {
+		slog.Error("error sending message", "node", a.Node, "alert", a.Name, "err", err)
+	}
+}
+
+// newAlert returns the alert reporting the outcome of the action, without icon, severity and text.
+func newAlert(tg *target, ev event) insync.Alert {
+	a := insync.Alert{
+		Node:    ev.Node,
+		Name:    "NodeRemediation",
+		Key:     "remediation_" + tg.cfg.Name,
+		Summary: "remediated",
+	}
+	if ev.Incident != "" {
+		a.Incident = tg.node.Incident()
+	}
+	return a
+}
+
+// truncate shortens s to at most max bytes.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "…"
+}
@@ -0,0 +1,474 @@
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// ResyncConfig configures a guided resync, a recipe of steps walked through with /resync on telegram, e.g. stopping
+// the client, clearing its data and starting it again. Every step runs once a user confirms it. After the last step,
+// the progress of the node is reported until it's in sync again.
+type ResyncConfig struct {
+	Name string `yaml:"name"`
+	// Nodes limits the recipe to the nodes with these names, it applies to all nodes if empty.
+	Nodes []string `yaml:"nodes"`
+	// Approvers are the telegram usernames or numeric user ids allowed to run the recipe, the admins of the chat if empty.
+	Approvers []string `yaml:"approvers"`
+	// Progress is the interval the progress of the node is reported at after the last step, defaults to 1h.
+	Progress insync.Duration `yaml:"progress"`
+	Steps    []StepConfig    `yaml:"steps"`
+}
+
+// StepConfig configures a step of a guided resync, exactly one of the actions must be set.
+type StepConfig struct {
+	Name string `yaml:"name"`
+	// Timeout bounds the step, defaults to 5m.
+	Timeout insync.Duration `yaml:"timeout"`
+
+	SSH     *SSHConfig     `yaml:"ssh"`
+	Docker  *DockerConfig  `yaml:"docker"`
+	Systemd *SystemdConfig `yaml:"systemd"`
+	Exec    *ExecConfig    `yaml:"exec"`
+	Webhook *WebhookConfig `yaml:"webhook"`
+}
+
+// Finalize applies the defaults and validates the config.
+func (c *ResyncConfig) Finalize() error {
+	if c.Name == "" {
+		return errors.New("resync: missing name")
+	}
+	if len(c.Steps) == 0 {
+		return fmt.Errorf("resync %s: missing steps", c.Name)
+	}
+	if c.Progress <= 0 {
+		c.Progress = insync.Duration(time.Hour)
+	}
+	normalizeApprovers(c.Approvers)
+	for i := range c.Steps {
+		s := &c.Steps[i]
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if err := s.finalize(); err != nil {
+			return fmt.Errorf("resync %s: %s: %w", c.Name, s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *StepConfig) finalize() error {
+	if s.Timeout <= 0 {
+		s.Timeout = insync.Duration(5 * time.Minute)
+	}
+	var n int
+	var err error
+	if s.SSH != nil {
+		n++
+		err = s.SSH.finalize()
+	}
+	if s.Docker != nil {
+		n++
+		err = s.Docker.finalize()
+	}
+	if s.Systemd != nil {
+		n++
+		err = s.Systemd.finalize()
+	}
+	if s.Exec != nil {
+		n++
+		err = s.Exec.finalize()
+	}
+	if s.Webhook != nil {
+		n++
+		err = s.Webhook.finalize()
+	}
+	if n != 1 {
+		return errors.New("exactly one of ssh, docker, systemd, exec or webhook must be set")
+	}
+	return err
+}
+
+// Runs reports whether the recipe applies to the node with the given name.
+func (c *ResyncConfig) Runs(node string) bool {
+	return runs(c.Nodes, node)
+}
+
+func (s *StepConfig) newAction() (action, error) {
+	switch {
+	case s.SSH != nil:
+		return newSSH(*s.SSH)
+	case s.Docker != nil:
+		return newDocker(*s.Docker)
+	case s.Systemd != nil:
+		return &systemdAction{cfg: *s.Systemd}, nil
+	case s.Exec != nil:
+		return &execAction{cfg: *s.Exec}, nil
+	case s.Webhook != nil:
+		return newWebhook(*s.Webhook), nil
+	}
+	return nil, errors.New("no action configured")
+}
+
+// conditionResync is the condition of the events of the steps of a guided resync.
+const conditionResync = "resync"
+
+// The id of a guided resync starts with resyncPrefix, the ids of its actions are followed by the index of the step or
+// by resyncAbort.
+const (
+	resyncPrefix = "r"
+	resyncAbort  = "abort"
+)
+
+var errStepNotOffered = errors.New("the step isn't offered anymore, it ran already or the resync was aborted")
+
+// recipe is a guided resync bound to a node.
+type recipe struct {
+	cfg   *ResyncConfig
+	node  *insync.Node
+	steps []action
+}
+
+// resync is a guided resync in progress.
+type resync struct {
+	id string
+	*recipe
+	start time.Time
+	// next is the index of the next step, the number of steps once they all ran. running is set while a step runs.
+	next    int
+	running bool
+	// done is the time the last step ran, reported when the progress was reported last.
+	done, reported time.Time
+	// left is set once the node was seen out of sync or unreachable during the resync.
+	left bool
+}
+
+// finished reports whether all steps ran, the resync waits for the node to be in sync then.
+func (s *resync) finished() bool {
+	return s.next == len(s.steps)
+}
+
+// newRecipes binds the recipes to the nodes they apply to.
+func newRecipes(cfgs []ResyncConfig, nodes []*insync.Node) ([]*recipe, error) {
+	var recipes []*recipe
+	for i := range cfgs {
+		c := &cfgs[i]
+		for _, n := range nodes {
+			if !c.Runs(n.Name()) {
+				continue
+			}
+			rc := &recipe{cfg: c, node: n}
+			for _, s := range c.Steps {
+				a, err := s.newAction()
+				if err != nil {
+					return nil, fmt.Errorf("resync %s: %s: %w", c.Name, s.Name, err)
+				}
+				rc.steps = append(rc.steps, a)
+			}
+			recipes = append(recipes, rc)
+		}
+	}
+	return recipes, nil
+}
+
+// recipe returns the recipe with the name for the node, or the first one of the node if the name is empty.
+func (r *Remediator) recipe(node, name string) (*recipe, error) {
+	for _, rc := range r.recipes {
+		if rc.node.Name() == node && (name == "" || rc.cfg.Name == name) {
+			return rc, nil
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("there is no resync %s for %s", name, node)
+	}
+	return nil, fmt.Errorf("there is no resync for %s", node)
+}
+
+// Recipe describes the steps of the guided resync of the node, the one with the name or the first one of the node if
+// the name is empty, and returns the telegram usernames allowed to run it, empty if the admins of the chat may.
+func (r *Remediator) Recipe(node, name string) (string, []string, error) {
+	rc, err := r.recipe(node, name)
+	if err != nil {
+		return "", nil, err
+	}
+	ev := event{Node: node, Remediation: rc.cfg.Name, Condition: conditionResync}
+	lines := []string{fmt.Sprintf("resync %s of %s:", rc.cfg.Name, node)}
+	for i, a := range rc.steps {
+		lines = append(lines, fmt.Sprintf("%d. %s: %s", i+1, rc.cfg.Steps[i].Name, a.describe(ev)))
+	}
+	return strings.Join(lines, "\n"), rc.cfg.Approvers, nil
+}
+
+// Resync starts the guided resync of the node on behalf of the user and returns the action running its first step.
+// A resync of the node which is waiting for the next step or for the node to be in sync is replaced. The automated
+// remediation of the node is held back until the resync is over.
+func (r *Remediator) Resync(node, name, user string) (insync.AlertAction, error) {
+	rc, err := r.recipe(node, name)
+	if err != nil {
+		return insync.AlertAction{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx == nil || r.ctx.Err() != nil {
+		return insync.AlertAction{}, errors.New("the remediation isn't running")
+	}
+	if r.running[node] {
+		return insync.AlertAction{}, fmt.Errorf("an action is running on %s already", node)
+	}
+	if s := r.resyncOf(node); s != nil {
+		slog.Info("replacing resync", "node", node, "resync", s.cfg.Name, "step", s.next, "user", user)
+		delete(r.resyncs, s.id)
+	}
+	r.seq++
+	s := &resync{id: resyncPrefix + strconv.Itoa(r.seq), recipe: rc, start: time.Now()}
+	r.resyncs[s.id] = s
+	slog.Info("starting resync", "node", node, "resync", rc.cfg.Name, "user", user)
+	return s.stepAction(), nil
+}
+
+// resyncOf returns the resync of the node, nil if there is none. r.mu must be held.
+func (r *Remediator) resyncOf(node string) *resync {
+	for _, s := range r.resyncs {
+		if s.node.Name() == node {
+			return s
+		}
+	}
+	return nil
+}
+
+// stepAction returns the action running the next step.
+func (s *resync) stepAction() insync.AlertAction {
+	return insync.AlertAction{
+		Label: fmt.Sprintf("Run %d/%d: %s", s.next+1, len(s.steps), s.cfg.Steps[s.next].Name),
+		ID:    s.id + "/" + strconv.Itoa(s.next),
+	}
+}
+
+// abortAction returns the action aborting the resync.
+func (s *resync) abortAction() insync.AlertAction {
+	return insync.AlertAction{Label: "Abort resync", ID: s.id + "/" + resyncAbort}
+}
+
+// lookupResync returns the resync and the step of the action with the id, -1 to abort it. r.mu must be held.
+func (r *Remediator) lookupResync(id string) (*resync, int, error) {
+	sid, kind, _ := strings.Cut(id, "/")
+	s, ok := r.resyncs[sid]
+	if !ok {
+		return nil, 0, errStepNotOffered
+	}
+	if kind == resyncAbort {
+		return s, -1, nil
+	}
+	if step, err := strconv.Atoi(kind); err != nil || step != s.next || s.finished() {
+		return nil, 0, errStepNotOffered
+	}
+	return s, s.next, nil
+}
+
+// resyncAction describes the action of the resync with the id and returns the usernames allowed to confirm it.
+func (r *Remediator) resyncAction(id string) (string, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, step, err := r.lookupResync(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if step < 0 {
+		return fmt.Sprintf("abort the resync %s of %s", s.cfg.Name, s.node.Name()), s.cfg.Approvers, nil
+	}
+	return fmt.Sprintf("run step %d/%d (%s) of the resync %s of %s: %s", step+1, len(s.steps), s.cfg.Steps[step].Name,
+		s.cfg.Name, s.node.Name(), s.steps[step].describe(s.event())), s.cfg.Approvers, nil
+}
+
+// confirmResync runs the step of the resync with the id, or aborts it, on behalf of the user.
+func (r *Remediator) confirmResync(id, user string) error {
+	r.mu.Lock()
+	s, step, err := r.lookupResync(id)
+	ctx := r.ctx
+	switch {
+	case err != nil:
+	case ctx == nil || ctx.Err() != nil:
+		err = errors.New("the remediation isn't running")
+	case s.running:
+		err = fmt.Errorf("a step of the resync of %s is running already", s.node.Name())
+	case step >= 0 && r.running[s.node.Name()]:
+		err = fmt.Errorf("an action is running on %s already", s.node.Name())
+	}
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	if step < 0 {
+		delete(r.resyncs, s.id)
+		r.mu.Unlock()
+		slog.Info("resync aborted", "node", s.node.Name(), "resync", s.cfg.Name, "step", s.next, "user", user)
+		ev := s.event()
+		a := newResyncAlert(s, ev)
+		a.Icon, a.Severity = "⏹", insync.SeverityWarning
+		a.Text = fmt.Sprintf("⏹ %s aborted the resync %s of %s after %d of %d steps", user, s.cfg.Name, s.node.Name(), s.next, len(s.steps))
+		r.send(a, ev)
+		return nil
+	}
+	// the steps don't count towards the limits, every one of them is confirmed
+	s.running = true
+	r.running[s.node.Name()] = true
+	r.wg.Add(1)
+	r.mu.Unlock()
+	go r.runStep(ctx, s, step, user)
+	return nil
+}
+
+// runStep runs the step of the resync on behalf of the user and reports the outcome, offering the next step.
+// The node has to be marked as running.
+func (r *Remediator) runStep(ctx context.Context, s *resync, step int, user string) {
+	defer r.finish(s.node.Name())
+	cfg := s.cfg.Steps[step]
+	ev := s.event()
+	slog.Info("running resync step", "node", ev.Node, "resync", s.cfg.Name, "step", cfg.Name, "user", user)
+	actx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	out, err := s.steps[step].run(actx, ev)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	out = truncate(strings.TrimSpace(out), maxOutput)
+	if ev.Incident != "" {
+		detail := fmt.Sprintf("resync %s: %s", s.cfg.Name, cfg.Name)
+		if err != nil {
+			detail += " (failed)"
+		}
+		s.node.Incident().Record(user, insync.ActionRemediated, detail)
+	}
+
+	r.mu.Lock()
+	s.running = false
+	if err == nil {
+		s.next++
+	}
+	if s.finished() {
+		s.done, s.reported = time.Now(), time.Now()
+	}
+	a := newResyncAlert(s, ev)
+	switch {
+	case err != nil:
+		a.Actions = []insync.AlertAction{{Label: "Retry " + cfg.Name, ID: s.stepAction().ID}, s.abortAction()}
+	case !s.finished():
+		a.Actions = []insync.AlertAction{s.stepAction(), s.abortAction()}
+	}
+	r.mu.Unlock()
+
+	what := fmt.Sprintf("step %d/%d (%s) of the resync %s of %s", step+1, len(s.steps), cfg.Name, s.cfg.Name, ev.Node)
+	if err != nil {
+		slog.Error("resync step failed", "node", ev.Node, "resync", s.cfg.Name, "step", cfg.Name, "err", err)
+		a.Icon, a.Severity = "❌", insync.SeverityCritical
+		a.Text = fmt.Sprintf("❌ %s failed, confirmed by %s: %v\n%s", what, user, err, s.steps[step].describe(ev))
+	} else {
+		slog.Info("resync step succeeded", "node", ev.Node, "resync", s.cfg.Name, "step", cfg.Name)
+		a.Icon, a.Severity = "🔁", insync.SeverityWarning
+		a.Text = fmt.Sprintf("🔁 ran %s, confirmed by %s\n%s", what, user, s.steps[step].describe(ev))
+	}
+	if out != "" {
+		a.Text += "\n" + out
+	}
+	if err == nil && s.finished() {
+		a.Text += fmt.Sprintf("\nAll steps ran, %s %s. The progress is reported every %s until it's in sync again.",
+			ev.Node, progress(s.node.Status()), insync.FormatDuration(time.Duration(s.cfg.Progress)))
+	}
+	r.send(a, ev)
+}
+
+// watchResyncs tracks the nodes of the resyncs, and reports the progress of those whose steps all ran until they're in
+// sync again. A node which wasn't seen out of sync since the start of its resync is in sync once the progress interval
+// passed, the resync may have been quick.
+func (r *Remediator) watchResyncs() {
+	var alerts []insync.Alert
+	var events []event
+	r.mu.Lock()
+	for id, s := range r.resyncs {
+		st := s.node.Status()
+		if st.State != insync.StateHealthy && st.State != insync.StateDegraded {
+			s.left = true
+		}
+		if !s.finished() || s.running {
+			continue
+		}
+		ev := s.event()
+		a := newResyncAlert(s, ev)
+		switch {
+		case st.State == insync.StateHealthy && (s.left || time.Since(s.done) >= time.Duration(s.cfg.Progress)):
+			delete(r.resyncs, id)
+			slog.Info("resync done", "node", ev.Node, "resync", s.cfg.Name, "took", time.Since(s.start))
+			a.Resolved = true
+			a.Icon, a.Severity = "🟢", insync.SeverityInfo
+			a.Text = fmt.Sprintf("🟢 %s is in sync again at block %s, the resync %s took %s",
+				ev.Node, insync.FormatNumber(st.CurrentBlock), s.cfg.Name, insync.FormatDuration(time.Since(s.start)))
+		case time.Since(s.reported) >= time.Duration(s.cfg.Progress):
+			s.reported = time.Now()
+			a.Icon, a.Severity = "🔁", insync.SeverityInfo
+			a.Text = fmt.Sprintf("🔁 resync %s of %s for %s: %s %s", s.cfg.Name, ev.Node, insync.FormatDuration(time.Since(s.start)), ev.Node, progress(st))
+			a.Actions = []insync.AlertAction{s.abortAction()}
+		default:
+			continue
+		}
+		alerts, events = append(alerts, a), append(events, ev)
+	}
+	r.mu.Unlock()
+	for i, a := range alerts {
+		r.send(a, events[i])
+	}
+}
+
+// progress describes the sync progress of the node, e.g. is syncing at block 100 of 120.
+func progress(st insync.NodeStatus) string {
+	switch st.State {
+	case insync.StateSyncing:
+		return fmt.Sprintf("is syncing at block %s of %s, %s blocks behind", insync.FormatNumber(st.CurrentBlock),
+			insync.FormatNumber(st.HighestBlock), insync.FormatNumber(st.HighestBlock-min(st.CurrentBlock, st.HighestBlock)))
+	case insync.StateUnreachable:
+		return "is unreachable"
+	}
+	return fmt.Sprintf("is %s at block %s", st.State, insync.FormatNumber(st.CurrentBlock))
+}
+
+// event returns the event of the steps of the resync, the hooks get it like those of the remediation.
+func (s *resync) event() event {
+	st := s.node.Status()
+	ev := event{
+		Node:         s.node.Name(),
+		Remediation:  s.cfg.Name,
+		Condition:    conditionResync,
+		Since:        s.start,
+		Duration:     insync.FormatDuration(time.Since(s.start)),
+		CurrentBlock: st.CurrentBlock,
+		HighestBlock: st.HighestBlock,
+		Peers:        st.Peers,
+		DiskUsage:    st.DiskUsage,
+	}
+	if st.HighestBlock > st.CurrentBlock {
+		ev.Lag = st.HighestBlock - st.CurrentBlock
+	}
+	if inc, ok := s.node.Incident().Snapshot(); ok {
+		ev.Incident = inc.ID
+	}
+	return ev
+}
+
+// newResyncAlert returns the alert reporting the resync, without icon, severity and text.
+func newResyncAlert(s *resync, ev event) insync.Alert {
+	a := insync.Alert{
+		Node:    ev.Node,
+		Name:    "NodeResync",
+		Key:     "resync_" + s.cfg.Name,
+		Summary: "resync",
+	}
+	if ev.Incident != "" {
+		a.Incident = s.node.Incident()
+	}
+	return a
+}
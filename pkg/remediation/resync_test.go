@@ -0,0 +1,22 @@
+package remediation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResyncApprovers(t *testing.T) {
+	c := ResyncConfig{
+		Name:      "fresh-sync",
+		Approvers: []string{"alice", "@bob", "123456789"},
+		Steps:     []StepConfig{{Exec: &ExecConfig{Command: []string{"true"}}}},
+	}
+	if err := c.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	// the usernames are matched with their @, the user ids as they are
+	want := "@alice,@bob,123456789"
+	if got := strings.Join(c.Approvers, ","); got != want {
+		t.Fatalf("got approvers %s, want %s", got, want)
+	}
+}
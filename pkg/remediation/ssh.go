@@ -0,0 +1,117 @@
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig configures a command run on the host of the node over ssh, e.g. systemctl restart geth.
+type SSHConfig struct {
+	// Host is the host and optionally the port, e.g. node-1 or node-1:2222.
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	// KeyFile is the private key, it must not be encrypted.
+	KeyFile string `yaml:"key_file"`
+	// KnownHosts is the known hosts file the host key is verified against, defaults to ~/.ssh/known_hosts.
+	KnownHosts string `yaml:"known_hosts"`
+	Command    string `yaml:"command"`
+}
+
+func (c *SSHConfig) finalize() error {
+	if c.Host == "" {
+		return errors.New("missing ssh host")
+	}
+	if _, _, err := net.SplitHostPort(c.Host); err != nil {
+		c.Host = net.JoinHostPort(c.Host, "22")
+	}
+	if c.User == "" {
+		return errors.New("missing ssh user")
+	}
+	if c.KeyFile == "" {
+		return errors.New("missing ssh key file")
+	}
+	if c.Command == "" {
+		return errors.New("missing ssh command")
+	}
+	if c.KnownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("missing ssh known hosts: %w", err)
+		}
+		c.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return nil
+}
+
+// sshAction runs the command over ssh. The host key is always verified.
+type sshAction struct {
+	cfg    SSHConfig
+	client *ssh.ClientConfig
+}
+
+func newSSH(cfg SSHConfig) (*sshAction, error) {
+	key, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ssh key: %w", err)
+	}
+	hostKeys, err := knownhosts.New(cfg.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading known hosts: %w", err)
+	}
+	return &sshAction{cfg: cfg, client: &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         10 * time.Second,
+	}}, nil
+}
+
+func (a *sshAction) describe(event) string {
+	return fmt.Sprintf("ssh %s@%s %s", a.cfg.User, a.cfg.Host, a.cfg.Command)
+}
+
+// run runs the command and returns its combined output, a non-zero exit status is an error.
+func (a *sshAction) run(ctx context.Context, _ event) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", a.cfg.Host)
+	if err != nil {
+		return "", err
+	}
+	// the ssh package doesn't take a context, closing the connection aborts the handshake and the command
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, chans, reqs, err := ssh.NewClientConn(conn, a.cfg.Host, a.client)
+	if err != nil {
+		conn.Close()
+		return "", ctxErr(ctx, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+	s, err := client.NewSession()
+	if err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	defer s.Close()
+	out, err := s.CombinedOutput(a.cfg.Command)
+	return string(out), ctxErr(ctx, err)
+}
+
+// ctxErr returns the error of the context if it's done, the errors of the closed connection are meaningless.
+func ctxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
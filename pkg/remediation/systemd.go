@@ -0,0 +1,108 @@
+package remediation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SystemdConfig configures the restart of a systemd unit on the host of insync, through the system bus.
+type SystemdConfig struct {
+	Unit string `yaml:"unit"`
+	// Action is restart (the default), stop or start.
+	Action string `yaml:"action"`
+	// Socket is the system bus, defaults to /run/dbus/system_bus_socket.
+	Socket string `yaml:"socket"`
+}
+
+func (c *SystemdConfig) finalize() error {
+	if c.Unit == "" {
+		return errors.New("missing systemd unit")
+	}
+	if !strings.Contains(c.Unit, ".") {
+		c.Unit += ".service"
+	}
+	if c.Socket == "" {
+		c.Socket = "/run/dbus/system_bus_socket"
+	}
+	if c.Action = strings.ToLower(c.Action); c.Action == "" {
+		c.Action = unitRestart
+	}
+	if !unitActions[c.Action] {
+		return fmt.Errorf("invalid systemd action %q, expected restart, stop or start", c.Action)
+	}
+	return nil
+}
+
+// The actions of the docker containers and the systemd units.
+const (
+	unitRestart = "restart"
+	unitStop    = "stop"
+	unitStart   = "start"
+)
+
+var unitActions = map[string]bool{unitRestart: true, unitStop: true, unitStart: true}
+
+// unitMethods are the methods of the systemd manager by action.
+var unitMethods = map[string]string{unitRestart: "RestartUnit", unitStop: "StopUnit", unitStart: "StartUnit"}
+
+// systemdAction restarts, stops or starts a systemd unit through the system bus.
+type systemdAction struct {
+	cfg SystemdConfig
+}
+
+func (a *systemdAction) describe(event) string {
+	return "systemctl " + a.cfg.Action + " " + a.cfg.Unit
+}
+
+// run restarts, stops or starts the unit and waits until the job finished.
+func (a *systemdAction) run(ctx context.Context, _ event) (string, error) {
+	c, err := dialDBus(ctx, a.cfg.Socket)
+	if err != nil {
+		return "", err
+	}
+	defer c.close()
+	stop := context.AfterFunc(ctx, func() { c.close() })
+	defer stop()
+	const (
+		dest    = "org.freedesktop.systemd1"
+		path    = "/org/freedesktop/systemd1"
+		manager = "org.freedesktop.systemd1.Manager"
+	)
+	// subscribe before starting the job, it might finish right away
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch",
+		"type='signal',sender='"+dest+"',interface='"+manager+"',member='JobRemoved'"); err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	if _, err := c.call(dest, path, manager, "Subscribe"); err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	method := unitMethods[a.cfg.Action]
+	reply, err := c.call(dest, path, manager, method, a.cfg.Unit, "replace")
+	if err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	job, err := reply.strings()
+	if err != nil || len(job) != 1 {
+		return "", fmt.Errorf("unexpected reply to %s: %v", method, err)
+	}
+	for {
+		m, err := c.read()
+		if err != nil {
+			return "", ctxErr(ctx, err)
+		}
+		if m.typ != dbusSignal || m.iface != manager || m.member != "JobRemoved" {
+			continue
+		}
+		// id, job, unit and result
+		args, err := m.strings()
+		if err != nil || len(args) != 3 || args[0] != job[0] {
+			continue
+		}
+		if result := args[2]; result != "done" {
+			return "", fmt.Errorf("the %s job of %s finished with %s", a.cfg.Action, a.cfg.Unit, result)
+		}
+		return "", nil
+	}
+}
@@ -0,0 +1,173 @@
+// Package report renders the monthly availability report of the nodes as html, with a chart of the daily uptime and
+// a timeline of the outages per node, e.g. for client-facing sla reporting. It can be converted to pdf by an external command.
+package report
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+//go:embed monthly.html
+var monthlyHTML string
+
+var monthlyTemplate = template.Must(template.New("monthly").Funcs(template.FuncMap{
+	"duration": insync.FormatDuration,
+	"percent":  func(f float64) string { return fmt.Sprintf("%.3f%%", f) },
+	// replaced with the timezone of the month when the report is rendered
+	"time": func(t time.Time) string { return t.Format("Jan 2 15:04") },
+}).Parse(monthlyHTML))
+
+// The size of the charts in svg units.
+const (
+	chartWidth   = 700
+	chartHeight  = 120
+	timelineRows = 24
+)
+
+// monthly is the data of the template.
+type monthly struct {
+	Month     time.Time
+	Generated time.Time
+	Nodes     []nodeReport
+	Width     int
+	Height    int
+	Timeline  int
+}
+
+type nodeReport struct {
+	history.SLA
+	// AxisMin is the uptime at the bottom of the chart of the daily uptime.
+	AxisMin float64
+	Days    []bar
+	Outages []bar
+	// Records are the incidents which started during the month.
+	Records []insync.IncidentRecord
+}
+
+// bar is a rectangle of a chart.
+type bar struct {
+	X, Y, Width, Height float64
+	// Class colors the bar, Title is its tooltip.
+	Class string
+	Title string
+}
+
+// Monthly renders the availability report of the nodes during the month of the given time. The uptime and the outages
+// are taken from the history, the incidents from the state. The times are shown in the timezone of month.
+func Monthly(h *history.Store, st *insync.StateStore, nodes []string, month time.Time) ([]byte, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	to := from.AddDate(0, 1, 0)
+	if now := time.Now(); to.After(now) {
+		// the current month so far
+		to = now
+	}
+	incidents := st.Incidents(from, to)
+	data := monthly{Month: from, Generated: time.Now(), Width: chartWidth, Height: chartHeight, Timeline: timelineRows}
+	for _, name := range nodes {
+		nr, err := nodeMonth(h, name, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, r := range incidents {
+			if r.Node == name {
+				nr.Records = append(nr.Records, r)
+			}
+		}
+		data.Nodes = append(data.Nodes, nr)
+	}
+	tmpl, err := monthlyTemplate.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// the recorded times keep the offset they were recorded with
+	tmpl.Funcs(template.FuncMap{"time": func(t time.Time) string { return t.In(from.Location()).Format("Jan 2 15:04") }})
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// nodeMonth computes the availability of the node and lays out its charts.
+func nodeMonth(h *history.Store, name string, from, to time.Time) (nodeReport, error) {
+	sla, err := h.SLA(name, from, to)
+	if err != nil {
+		return nodeReport{}, err
+	}
+	nr := nodeReport{SLA: sla}
+
+	var days []history.SLA
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		if end.After(to) {
+			end = to
+		}
+		d, err := h.SLA(name, day, end)
+		if err != nil {
+			return nr, err
+		}
+		days = append(days, d)
+	}
+	// the axis starts at the worst day rounded down to a whole percent, so small outages are still visible
+	nr.AxisMin = 99
+	for _, d := range days {
+		nr.AxisMin = math.Min(nr.AxisMin, math.Floor(d.Uptime))
+	}
+	daysInMonth := from.AddDate(0, 1, -1).Day()
+	w := float64(chartWidth) / float64(daysInMonth)
+	for i, d := range days {
+		height := chartHeight * (d.Uptime - nr.AxisMin) / (100 - nr.AxisMin)
+		class := "up"
+		if d.Incidents > 0 {
+			class = "down"
+		}
+		nr.Days = append(nr.Days, bar{
+			X: float64(i)*w + 1, Y: chartHeight - height, Width: math.Max(w-2, 1), Height: height,
+			Class: class, Title: fmt.Sprintf("%s: %.3f%%", d.From.Format("Jan 2"), d.Uptime),
+		})
+	}
+
+	outages, err := h.Outages(name, from, to)
+	if err != nil {
+		return nr, err
+	}
+	month := from.AddDate(0, 1, 0).Sub(from)
+	for _, o := range outages {
+		x := chartWidth * float64(o.Start.Sub(from)) / float64(month)
+		nr.Outages = append(nr.Outages, bar{
+			X: x, Width: math.Max(chartWidth*float64(o.End.Sub(o.Start))/float64(month), 1), Height: timelineRows,
+			Class: o.State.String(), Title: fmt.Sprintf("%s %s for %s", o.State, o.Start.In(from.Location()).Format("Jan 2 15:04"), insync.FormatDuration(o.End.Sub(o.Start))),
+		})
+	}
+	return nr, nil
+}
+
+// PDF converts the html report to pdf with the command, which reads the html on stdin and writes the pdf to stdout,
+// e.g. wkhtmltopdf - -.
+func PDF(ctx context.Context, command []string, html []byte) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, errors.New("missing pdf command")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(html)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
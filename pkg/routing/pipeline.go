@@ -0,0 +1,359 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+	"github.com/jon4hz/insync/pkg/tracing"
+)
+
+// latencySmoothing is the weight of the latest send in the moving average of the latency.
+const latencySmoothing = 0.2
+
+// retryDelay is the delay before the first retry of a failed send, it doubles with every retry up to maxRetryDelay.
+const retryDelay = 250 * time.Millisecond
+
+// maxRetryDelay caps the delay between the retries of a failed send.
+const maxRetryDelay = 30 * time.Second
+
+// retryQueueSize is the number of alerts queued by a route while it retries a failed send, the oldest are dropped.
+const retryQueueSize = 100
+
+// QueueReporter is implemented by routes holding alerts back, e.g. while grouping.
+type QueueReporter interface {
+	QueueDepth() int
+}
+
+// DeliveryReporter is implemented by routes delivering in the background, they track the result of their api calls themselves.
+type DeliveryReporter interface {
+	ConsecutiveFailures() int
+	APILatency() time.Duration
+}
+
+// Auditing is implemented by routes recording their notifications themselves, e.g. because they render or
+// deliver them in the background.
+type Auditing interface {
+	SetAuditor(rec insync.NotificationRecorder, route string)
+}
+
+// Verbose is implemented by routes filtering the alerts by verbosity themselves, e.g. because their users can change it.
+type Verbose interface {
+	SetVerbosity(v insync.Verbosity)
+}
+
+// Targeter is implemented by routes describing their destination, e.g. the host of a webhook.
+type Targeter interface {
+	Target() string
+}
+
+// Stats are the metrics of a route.
+type Stats struct {
+	Route string `json:"route"`
+	// Sent and Failed count the alerts, Retries the repeated attempts.
+	Sent    int64 `json:"sent"`
+	Failed  int64 `json:"failed"`
+	Retries int64 `json:"retries"`
+	// ConsecutiveFailures is the number of failed deliveries since the last successful one.
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	// Latency is the moving average of the time a delivery takes.
+	Latency    time.Duration `json:"latency_ns"`
+	QueueDepth int           `json:"queue_depth"`
+}
+
+// meteredRoute retries failed sends and tracks the stats of a route. The retries run in the background, so a failing
+// route doesn't hold back the checks sending the alerts, the alerts sent meanwhile are queued to keep their order.
+type meteredRoute struct {
+	name    string
+	nf      insync.Notifier
+	retries int
+	// done is closed once the router is closed, the retries stop waiting then. wg tracks the retries.
+	done <-chan struct{}
+	wg   *sync.WaitGroup
+	// audit records the deliveries, nil if they aren't recorded or the route records them itself.
+	audit insync.NotificationRecorder
+	// verbosity drops the alerts below the level of detail of the route, unless it filters them itself.
+	verbosity insync.Verbosity
+	gate      insync.VerbosityGate
+
+	mu    sync.Mutex
+	stats Stats
+	// retrying is set while a failed send is retried, queue holds the alerts sent meanwhile.
+	retrying bool
+	queue    []insync.Alert
+}
+
+func (m *meteredRoute) Send(a insync.Alert) error {
+	if !m.gate.Pass(m.verbosity, a) {
+		return nil
+	}
+	m.mu.Lock()
+	if m.retrying {
+		// e.g. the recovery of the alert being retried mustn't overtake it
+		if len(m.queue) == retryQueueSize {
+			slog.Error("dropping alert, too many alerts queued while retrying", "route", m.name, "node", m.queue[0].Node, "alert", m.queue[0].Name)
+			m.queue = m.queue[1:]
+		}
+		m.queue = append(m.queue, a)
+		m.mu.Unlock()
+		return nil
+	}
+	m.mu.Unlock()
+	span := m.startSpan(a)
+	err := m.attempt(a)
+	if err == nil || m.retries == 0 || m.closed() {
+		m.finish(a, span, 1, err)
+		return err
+	}
+	// the alert counts as delivered for now, the retries log and record the result
+	m.mu.Lock()
+	m.retrying = true
+	m.mu.Unlock()
+	m.wg.Add(1)
+	go m.retry(a, span, err)
+	return nil
+}
+
+// retry retries the failed send of the alert in the background and then delivers the alerts queued meanwhile, in order.
+func (m *meteredRoute) retry(a insync.Alert, span *tracing.Span, err error) {
+	defer m.wg.Done()
+	attempts, err := m.resend(a, err)
+	for {
+		if err != nil {
+			slog.Error("error sending alert", "route", m.name, "node", a.Node, "alert", a.Name, "attempts", attempts, "err", err)
+		}
+		m.finish(a, span, attempts, err)
+		var ok bool
+		if a, ok = m.dequeue(); !ok {
+			return
+		}
+		span = m.startSpan(a)
+		attempts, err = m.resend(a, m.attempt(a))
+	}
+}
+
+// resend retries the send of the alert after a growing delay while it fails with err. It returns the number of
+// attempts, including the first one, and the error of the last attempt. The retries stop once the router is closed.
+func (m *meteredRoute) resend(a insync.Alert, err error) (int, error) {
+	attempts := 1
+	for ; err != nil && attempts <= m.retries && m.wait(attempts); attempts++ {
+		m.mu.Lock()
+		m.stats.Retries++
+		m.mu.Unlock()
+		err = m.attempt(a)
+	}
+	return attempts, err
+}
+
+// dequeue returns the next alert queued while retrying, or clears retrying if there is none.
+func (m *meteredRoute) dequeue() (insync.Alert, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == 0 {
+		m.retrying = false
+		return insync.Alert{}, false
+	}
+	a := m.queue[0]
+	m.queue = m.queue[1:]
+	return a, true
+}
+
+// wait waits before the retry, it returns false if the router was closed meanwhile.
+func (m *meteredRoute) wait(retry int) bool {
+	delay := maxRetryDelay
+	if retry <= 8 {
+		delay = min(retryDelay<<(retry-1), maxRetryDelay)
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// closed reports whether the router was closed.
+func (m *meteredRoute) closed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// attempt sends the alert once and tracks the result.
+func (m *meteredRoute) attempt(a insync.Alert) error {
+	start := time.Now()
+	err := m.nf.Send(a)
+	m.observe(time.Since(start), err)
+	return err
+}
+
+func (m *meteredRoute) startSpan(a insync.Alert) *tracing.Span {
+	span := tracing.StartFrom(a.Span, "notify "+m.name, tracing.KindClient)
+	span.SetAttributes("route", m.name, "node", a.Node, "alert", a.Name, "resolved", a.Resolved)
+	return span
+}
+
+// finish ends the span of the delivery and records its result, after all attempts.
+func (m *meteredRoute) finish(a insync.Alert, span *tracing.Span, attempts int, err error) {
+	span.SetAttributes("attempts", attempts)
+	if err != nil {
+		span.SetError(err)
+	}
+	span.End()
+	m.record(a, err)
+}
+
+// record passes the result of the delivery, after all retries, to the auditor.
+func (m *meteredRoute) record(a insync.Alert, err error) {
+	if m.audit == nil {
+		return
+	}
+	rec := insync.NotificationRecord{Time: time.Now(), Route: m.name, Node: a.Node, Alert: a.Name, Text: a.Text}
+	if t, ok := m.nf.(Targeter); ok {
+		rec.Target = t.Target()
+	}
+	if err != nil {
+		rec.Error = redact.Error(err)
+	}
+	m.audit.RecordNotification(rec)
+}
+
+// observe records the result of a single attempt.
+func (m *meteredRoute) observe(latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats.Sent+m.stats.Failed == 0 {
+		m.stats.Latency = latency
+	} else {
+		m.stats.Latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(m.stats.Latency))
+	}
+	if err != nil {
+		m.stats.Failed++
+		m.stats.ConsecutiveFailures++
+		m.stats.LastError = redact.Error(err)
+		return
+	}
+	m.stats.Sent++
+	m.stats.ConsecutiveFailures = 0
+}
+
+// snapshot returns the stats, including those reported by the route itself.
+func (m *meteredRoute) snapshot() Stats {
+	m.mu.Lock()
+	st := m.stats
+	m.mu.Unlock()
+	st.Route = m.name
+	if q, ok := m.nf.(QueueReporter); ok {
+		st.QueueDepth = q.QueueDepth()
+	}
+	if d, ok := m.nf.(DeliveryReporter); ok {
+		if f := d.ConsecutiveFailures(); f > st.ConsecutiveFailures {
+			st.ConsecutiveFailures = f
+		}
+		if l := d.APILatency(); l > 0 {
+			st.Latency = l
+		}
+	}
+	return st
+}
+
+// Stats returns the metrics of all routes, sorted by name.
+func (r *Router) Stats() []Stats {
+	stats := make([]Stats, 0, len(r.routes))
+	for _, m := range r.routes {
+		stats = append(stats, m.snapshot())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// SetAuditor records every notification sent through the routes.
+func (r *Router) SetAuditor(rec insync.NotificationRecorder) {
+	for name, m := range r.routes {
+		if a, ok := m.nf.(Auditing); ok {
+			a.SetAuditor(rec, name)
+			continue
+		}
+		m.audit = rec
+	}
+}
+
+// SetVerbosity sets the level of detail of the alerts of the route, all by default.
+func (r *Router) SetVerbosity(route string, v insync.Verbosity) error {
+	m, ok := r.routes[route]
+	if !ok {
+		return fmt.Errorf("unknown route %s", route)
+	}
+	if f, ok := m.nf.(Verbose); ok {
+		f.SetVerbosity(v)
+		return nil
+	}
+	m.verbosity = v
+	return nil
+}
+
+// SetFallback sends an alert through the fallback route once another route failed the given number of times in a row.
+func (r *Router) SetFallback(route string, threshold int) error {
+	if _, ok := r.routes[route]; !ok {
+		return fmt.Errorf("unknown fallback route %s", route)
+	}
+	r.fallback, r.threshold = route, threshold
+	return nil
+}
+
+// Run watches the routes until the context is done and alerts through the fallback route if one keeps failing.
+func (r *Router) Run(ctx context.Context, interval time.Duration) {
+	if r.fallback == "" {
+		return
+	}
+	failing := make(map[string]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, st := range r.Stats() {
+			if st.Route == r.fallback {
+				continue
+			}
+			down := st.ConsecutiveFailures >= r.threshold
+			if down == failing[st.Route] {
+				continue
+			}
+			failing[st.Route] = down
+			a := insync.Alert{
+				Node:     insync.SelfNode,
+				Name:     "InsyncRouteFailing",
+				Key:      "route_" + st.Route,
+				Summary:  "route failing",
+				Icon:     "📵",
+				Severity: insync.SeverityCritical,
+				Text:     fmt.Sprintf("📵 insync failed to deliver %d alerts in a row to route %s\nLast error: %s", st.ConsecutiveFailures, st.Route, st.LastError),
+			}
+			if down {
+				slog.Error("route failing", "route", st.Route, "failures", st.ConsecutiveFailures, "err", st.LastError)
+			} else {
+				slog.Info("route recovered", "route", st.Route)
+				a.Resolved, a.Icon, a.Severity, a.Summary = true, "🟢", insync.SeverityInfo, "route delivering again"
+				a.Text = fmt.Sprintf("🟢 insync delivers alerts to route %s again", st.Route)
+			}
+			if err := r.routes[r.fallback].Send(a); err != nil {
+				slog.Error("error sending alert to fallback route", "route", r.fallback, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package routing decides which notifiers an alert is sent to, based on configurable rules.
+package routing
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// rule is a compiled routing rule.
+type rule struct {
+	node, alert string
+	severity    func(insync.Severity) bool
+	routes      []string
+	next        bool
+}
+
+// compileRule validates the rule and parses its severity condition.
+func compileRule(cfg RuleConfig) (rule, error) {
+	r := rule{
+		node:   cfg.Match.Node,
+		alert:  cfg.Match.Alert,
+		routes: cfg.Routes,
+		next:   cfg.Continue,
+	}
+	for _, pattern := range []string{r.node, r.alert} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return rule{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	sev, err := parseSeverityCondition(cfg.Match.Severity)
+	if err != nil {
+		return rule{}, err
+	}
+	r.severity = sev
+	return r, nil
+}
+
+// Validate checks the conditions of the rule.
+func (cfg RuleConfig) Validate() error {
+	_, err := compileRule(cfg)
+	return err
+}
+
+// parseSeverityCondition parses conditions like critical, >=warning or <critical.
+// An empty condition matches all severities.
+func parseSeverityCondition(s string) (func(insync.Severity) bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return func(insync.Severity) bool { return true }, nil
+	}
+	op := strings.TrimRight(s, "abcdefghijklmnopqrstuvwxyz")
+	name := strings.TrimSpace(s[len(op):])
+	want, ok := insync.ParseSeverity(name)
+	if !ok {
+		return nil, fmt.Errorf("invalid severity %q", name)
+	}
+	switch strings.TrimSpace(op) {
+	case "", "=", "==":
+		return func(s insync.Severity) bool { return s == want }, nil
+	case "!=":
+		return func(s insync.Severity) bool { return s != want }, nil
+	case ">=":
+		return func(s insync.Severity) bool { return s >= want }, nil
+	case ">":
+		return func(s insync.Severity) bool { return s > want }, nil
+	case "<=":
+		return func(s insync.Severity) bool { return s <= want }, nil
+	case "<":
+		return func(s insync.Severity) bool { return s < want }, nil
+	}
+	return nil, fmt.Errorf("invalid severity condition %q", s)
+}
+
+func (r rule) matches(a insync.Alert) bool {
+	return glob(r.node, a.Node) && glob(r.alert, a.Name) && r.severity(a.Severity)
+}
+
+// glob reports whether the name matches the pattern, an empty pattern matches everything.
+func glob(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// Router sends every alert to the routes selected by the rules.
+// Failed sends are retried and the metrics of every route are tracked.
+type Router struct {
+	routes map[string]*meteredRoute
+	rules  []rule
+	// defaults are the routes of the alerts no rule matches.
+	defaults []string
+	// fallback is the route alerted once another route failed threshold times in a row.
+	fallback  string
+	threshold int
+	// done is closed by Close, wg tracks the retries of the routes.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a router for the named routes, retrying failed sends the given number of times.
+// The routes referenced by the rules must exist.
+func New(routes map[string]insync.Notifier, cfgs []RuleConfig, retries int) (*Router, error) {
+	r := &Router{routes: make(map[string]*meteredRoute, len(routes)), done: make(chan struct{})}
+	for name, nf := range routes {
+		r.routes[name] = &meteredRoute{name: name, nf: nf, retries: retries, done: r.done, wg: &r.wg}
+	}
+	for _, cfg := range cfgs {
+		rl, err := compileRule(cfg)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rl)
+	}
+	return r, nil
+}
+
+// Close stops the retries of the failed sends and waits for the routes to deliver the alerts queued meanwhile, they're
+// tried once more. The alerts sent after Close aren't retried.
+func (r *Router) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// SetDefault sends the alerts no rule matches to the routes, instead of dropping them.
+func (r *Router) SetDefault(routes []string) error {
+	for _, name := range routes {
+		if _, ok := r.routes[name]; !ok {
+			return fmt.Errorf("unknown default route %s", name)
+		}
+	}
+	r.defaults = routes
+	return nil
+}
+
+// Send delivers the alert to each selected route once.
+func (r *Router) Send(a insync.Alert) error {
+	a.Text = redact.String(a.Text)
+	names := r.match(a)
+	if len(names) == 0 {
+		slog.Warn("no rule matches the alert, it isn't sent", "node", a.Node, "alert", a.Name, "severity", a.Severity.String())
+		return nil
+	}
+	var nf insync.Notifiers
+	for _, name := range names {
+		nf = append(nf, r.routes[name])
+	}
+	return nf.Send(a)
+}
+
+// match returns the names of the routes the alert is sent to.
+// Without rules, the alert is sent to all routes, if no rule matches to the default routes.
+func (r *Router) match(a insync.Alert) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(r.rules) == 0 {
+		for name := range r.routes {
+			add(name)
+		}
+		return names
+	}
+	matched := false
+	for _, rl := range r.rules {
+		if !rl.matches(a) {
+			continue
+		}
+		matched = true
+		for _, name := range rl.routes {
+			add(name)
+		}
+		if !rl.next {
+			break
+		}
+	}
+	if !matched {
+		for _, name := range r.defaults {
+			add(name)
+		}
+	}
+	return names
+}
+
+// RuleConfig sends the alerts matching all conditions to the routes.
+// The rules are evaluated in order and the first matching rule wins, unless it's marked with continue.
+type RuleConfig struct {
+	Match    MatchConfig `yaml:"match"`
+	Routes   []string    `yaml:"routes"`
+	Continue bool        `yaml:"continue"`
+}
+
+// MatchConfig holds the conditions of a rule, empty conditions match every alert.
+type MatchConfig struct {
+	// Node and Alert are glob patterns matched against the node and alert name, e.g. validator-*.
+	Node  string `yaml:"node"`
+	Alert string `yaml:"alert"`
+	// Severity is a severity, optionally prefixed by a comparison, e.g. >=warning.
+	Severity string `yaml:"severity"`
+}
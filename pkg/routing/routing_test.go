@@ -0,0 +1,142 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+func testRouter(t *testing.T, rules []RuleConfig, defaults ...string) *Router {
+	t.Helper()
+	routes := map[string]insync.Notifier{"chat": insync.Notifiers{}, "pager": insync.Notifiers{}, "log": insync.Notifiers{}}
+	r, err := New(routes, rules, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetDefault(defaults); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRouterMatch(t *testing.T) {
+	validators := RuleConfig{Match: MatchConfig{Node: "validator-*"}, Routes: []string{"pager"}}
+	critical := RuleConfig{Match: MatchConfig{Severity: ">=critical"}, Routes: []string{"pager"}}
+	tests := []struct {
+		name     string
+		rules    []RuleConfig
+		defaults []string
+		alert    insync.Alert
+		want     []string
+	}{
+		{
+			name:  "no rules sends to all routes",
+			alert: insync.Alert{Node: "node-1"},
+			want:  []string{"chat", "log", "pager"},
+		},
+		{
+			name:  "node glob matches",
+			rules: []RuleConfig{validators},
+			alert: insync.Alert{Node: "validator-1"},
+			want:  []string{"pager"},
+		},
+		{
+			name:  "node glob doesn't match",
+			rules: []RuleConfig{validators},
+			alert: insync.Alert{Node: "node-1"},
+		},
+		{
+			name:  "alert glob matches",
+			rules: []RuleConfig{{Match: MatchConfig{Alert: "Node*Sync"}, Routes: []string{"chat"}}},
+			alert: insync.Alert{Node: "node-1", Name: "NodeOutOfSync"},
+			want:  []string{"chat"},
+		},
+		{
+			name:  "all conditions must match",
+			rules: []RuleConfig{{Match: MatchConfig{Node: "validator-*", Severity: "critical"}, Routes: []string{"pager"}}},
+			alert: insync.Alert{Node: "validator-1", Severity: insync.SeverityWarning},
+		},
+		{
+			name:  "severity comparison matches",
+			rules: []RuleConfig{critical},
+			alert: insync.Alert{Node: "node-1", Severity: insync.SeverityCritical},
+			want:  []string{"pager"},
+		},
+		{
+			name:  "severity comparison doesn't match",
+			rules: []RuleConfig{critical},
+			alert: insync.Alert{Node: "node-1", Severity: insync.SeverityWarning},
+		},
+		{
+			name:  "severity below",
+			rules: []RuleConfig{{Match: MatchConfig{Severity: "<critical"}, Routes: []string{"log"}}},
+			alert: insync.Alert{Node: "node-1", Severity: insync.SeverityInfo},
+			want:  []string{"log"},
+		},
+		{
+			name:  "severity not equal",
+			rules: []RuleConfig{{Match: MatchConfig{Severity: "!=info"}, Routes: []string{"chat"}}},
+			alert: insync.Alert{Node: "node-1", Severity: insync.SeverityInfo},
+		},
+		{
+			name:  "first matching rule wins",
+			rules: []RuleConfig{validators, {Routes: []string{"chat"}}},
+			alert: insync.Alert{Node: "validator-1"},
+			want:  []string{"pager"},
+		},
+		{
+			name:  "continue evaluates the following rules",
+			rules: []RuleConfig{{Match: MatchConfig{Node: "validator-*"}, Routes: []string{"pager"}, Continue: true}, {Routes: []string{"chat", "pager"}}},
+			alert: insync.Alert{Node: "validator-1"},
+			want:  []string{"chat", "pager"},
+		},
+		{
+			name:     "unmatched alert goes to the default routes",
+			rules:    []RuleConfig{validators},
+			defaults: []string{"log", "chat"},
+			alert:    insync.Alert{Node: "node-1"},
+			want:     []string{"chat", "log"},
+		},
+		{
+			name:     "matched alert skips the default routes",
+			rules:    []RuleConfig{validators},
+			defaults: []string{"log"},
+			alert:    insync.Alert{Node: "validator-1"},
+			want:     []string{"pager"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testRouter(t, tt.rules, tt.defaults...).match(tt.alert)
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got routes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		match MatchConfig
+		ok    bool
+	}{
+		{name: "empty", ok: true},
+		{name: "glob", match: MatchConfig{Node: "validator-[0-9]*", Alert: "Node*"}, ok: true},
+		{name: "severity with comparison", match: MatchConfig{Severity: ">= warning"}, ok: true},
+		{name: "invalid glob", match: MatchConfig{Node: "validator-["}},
+		{name: "unknown severity", match: MatchConfig{Severity: "fatal"}},
+		{name: "invalid comparison", match: MatchConfig{Severity: "=>warning"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RuleConfig{Match: tt.match, Routes: []string{"chat"}}.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package telegram
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// callback data prefixes of the buttons of the actions offered with the alerts, followed by the id of the action.
+// Tapping the action asks for confirmation first.
+const (
+	runCallback     = "run:"
+	confirmCallback = "confirm:"
+	cancelCallback  = "cancel:"
+)
+
+// Actions runs the actions offered with the alerts, e.g. the remediations waiting for confirmation.
+type Actions interface {
+	// Action describes the action and returns the usernames or user ids allowed to confirm it, empty if the admins of
+	// the chat may.
+	// It returns an error if the action isn't offered anymore.
+	Action(id string) (string, []string, error)
+	// Confirm runs the action on behalf of the user.
+	Confirm(id, user string) error
+}
+
+// actionButtons are the buttons of the actions offered with the alert, in a row of their own.
+func actionButtons(a insync.Alert) [][]gotgbot.InlineKeyboardButton {
+	if len(a.Actions) == 0 {
+		return nil
+	}
+	row := make([]gotgbot.InlineKeyboardButton, len(a.Actions))
+	for i, act := range a.Actions {
+		row[i] = gotgbot.InlineKeyboardButton{Text: act.Label, CallbackData: runCallback + act.ID}
+	}
+	return [][]gotgbot.InlineKeyboardButton{row}
+}
+
+// mayConfirm reports whether the user is one of the approvers, or an admin of the chat if there are none.
+// The approvers are usernames like @alice or numeric user ids. The first name isn't unique and anyone can pick
+// @alice as theirs, so users without a username are only matched by their id.
+func mayConfirm(b *gotgbot.Bot, chat gotgbot.Chat, user gotgbot.User, approvers []string) (bool, error) {
+	if len(approvers) == 0 {
+		return isAdmin(b, chat, user.Id)
+	}
+	id := strconv.FormatInt(user.Id, 10)
+	for _, a := range approvers {
+		if a == id || user.Username != "" && strings.EqualFold(a, "@"+user.Username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// actionHandler handles the buttons of the offered actions. Tapping an action replaces its button with confirm and cancel,
+// confirming runs it. Only the configured chats can run actions.
+func (bt *bot) actionHandler(callback string) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		cq := ctx.CallbackQuery
+		if cq.Message == nil || !bt.chats[cq.Message.Chat.Id] || bt.actions == nil {
+			_, err := cq.Answer(b, nil)
+			return err
+		}
+		id := strings.TrimPrefix(cq.Data, callback)
+		if callback == cancelCallback {
+			return bt.editActions(b, cq, eachButton(func(btn gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton {
+				switch btn.CallbackData {
+				case confirmCallback + id:
+					return []gotgbot.InlineKeyboardButton{{Text: strings.TrimPrefix(btn.Text, "✅ "), CallbackData: runCallback + id}}
+				case cancelCallback + id:
+					return nil
+				}
+				return []gotgbot.InlineKeyboardButton{btn}
+			}), "cancelled")
+		}
+		desc, approvers, err := bt.actions.Action(id)
+		if err != nil {
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: err.Error()})
+			return err
+		}
+		if ok, err := mayConfirm(b, cq.Message.Chat, cq.From, approvers); err != nil || !ok {
+			if err != nil {
+				slog.Error("error checking the permissions", "chat", cq.Message.Chat.Id, "err", err)
+			}
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "you aren't allowed to confirm this action"})
+			return err
+		}
+		if callback == runCallback {
+			return bt.editActions(b, cq, eachButton(func(btn gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton {
+				if btn.CallbackData != runCallback+id {
+					return []gotgbot.InlineKeyboardButton{btn}
+				}
+				return []gotgbot.InlineKeyboardButton{
+					{Text: "✅ " + btn.Text, CallbackData: confirmCallback + id},
+					{Text: "Cancel", CallbackData: cancelCallback + id},
+				}
+			}), "confirm to "+desc)
+		}
+
+		user := userName(cq.From)
+		if err := bt.actions.Confirm(id, user); err != nil {
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: err.Error()})
+			return err
+		}
+		// the other actions of the row were offered for the same condition
+		if err := bt.editActions(b, cq, func(row []gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton {
+			for _, btn := range row {
+				if btn.CallbackData == confirmCallback+id {
+					return nil
+				}
+			}
+			return row
+		}, "done"); err != nil {
+			return err
+		}
+		_, err = b.SendMessage(cq.Message.Chat.Id, "🔧 "+user+" confirmed to "+desc, &gotgbot.SendMessageOpts{
+			ReplyToMessageId:         cq.Message.MessageId,
+			AllowSendingWithoutReply: true,
+		})
+		return err
+	}
+}
+
+// editActions answers the callback and replaces every row of buttons of the message with the row returned by f.
+func (bt *bot) editActions(b *gotgbot.Bot, cq *gotgbot.CallbackQuery, f func([]gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton, answer string) error {
+	if _, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: answer}); err != nil {
+		return err
+	}
+	rows := [][]gotgbot.InlineKeyboardButton{}
+	if cq.Message.ReplyMarkup != nil {
+		for _, row := range cq.Message.ReplyMarkup.InlineKeyboard {
+			if row = f(row); len(row) > 0 {
+				rows = append(rows, row)
+			}
+		}
+	}
+	_, err := cq.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows},
+	})
+	return err
+}
+
+// eachButton replaces every button of a row with the buttons returned by f.
+func eachButton(f func(gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton) func([]gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton {
+	return func(row []gotgbot.InlineKeyboardButton) []gotgbot.InlineKeyboardButton {
+		var buttons []gotgbot.InlineKeyboardButton
+		for _, btn := range row {
+			buttons = append(buttons, f(btn)...)
+		}
+		return buttons
+	}
+}
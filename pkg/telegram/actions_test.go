@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestMayConfirm(t *testing.T) {
+	approvers := []string{"@alice", "123456789"}
+	tests := []struct {
+		name string
+		user gotgbot.User
+		want bool
+	}{
+		{name: "username", user: gotgbot.User{Id: 1, Username: "alice", FirstName: "Alice"}, want: true},
+		{name: "username in another case", user: gotgbot.User{Id: 1, Username: "Alice"}, want: true},
+		{name: "other username", user: gotgbot.User{Id: 2, Username: "mallory", FirstName: "@alice"}},
+		{name: "first name only", user: gotgbot.User{Id: 2, FirstName: "@alice"}},
+		{name: "user id", user: gotgbot.User{Id: 123456789, FirstName: "Bob"}, want: true},
+		{name: "other user id", user: gotgbot.User{Id: 987654321, FirstName: "123456789"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := mayConfirm(nil, gotgbot.Chat{Id: -1}, tt.user, approvers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
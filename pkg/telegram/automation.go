@@ -0,0 +1,66 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// pauseAutomation handles /pause-automation [duration], which holds back the automated remediation.
+// Without duration it stays paused until /resume-automation. Confirming the offered actions is still possible.
+func (bt *bot) pauseAutomation(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	if bt.actions == nil {
+		_, err := msg.Reply(b, "there is no remediation configured", nil)
+		return err
+	}
+	args := strings.Fields(msg.Text)[1:]
+	var d time.Duration
+	if len(args) > 0 {
+		var err error
+		if d, err = time.ParseDuration(args[0]); err != nil || d <= 0 {
+			_, err := msg.Reply(b, fmt.Sprintf("invalid duration %q", args[0]), nil)
+			return err
+		}
+	}
+	user := userName(*ctx.EffectiveUser)
+	if err := bt.store.PauseAutomation(user, d); err != nil {
+		return err
+	}
+	text := fmt.Sprintf("⏸ %s paused the automated remediation until it's resumed", user)
+	if d > 0 {
+		text = fmt.Sprintf("⏸ %s paused the automated remediation for %s", user, insync.FormatDuration(d))
+	}
+	slog.Info("automation paused", "user", user, "for", d)
+	_, err := msg.Reply(b, text, nil)
+	return err
+}
+
+// resumeAutomation handles /resume-automation.
+func (bt *bot) resumeAutomation(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	ok, err := bt.store.ResumeAutomation()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err := msg.Reply(b, "the automated remediation isn't paused", nil)
+		return err
+	}
+	user := userName(*ctx.EffectiveUser)
+	slog.Info("automation resumed", "user", user)
+	_, err = msg.Reply(b, fmt.Sprintf("▶️ %s resumed the automated remediation", user), nil)
+	return err
+}
@@ -0,0 +1,403 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/inlinequery"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// callback data prefixes of the incident buttons, followed by the node name.
+const (
+	ackCallback     = "ack:"
+	snoozeCallback  = "snooze:"
+	resolveCallback = "resolve:"
+)
+
+// defaultSnooze is the snooze duration of the snooze button and the /snooze command without duration.
+const defaultSnooze = time.Hour
+
+// bot handles the interactions with the alerts.
+type bot struct {
+	// chats the alerts are routed to, the bot ignores all other chats.
+	chats map[int64]bool
+	nodes []*insync.Node
+	store *insync.StateStore
+	// history is nil if the history is disabled.
+	history *history.Store
+	// prefs are the settings of the chats, nil if the history is disabled.
+	prefs *Preferences
+	// nf is the routing, used for test alerts.
+	nf insync.Notifier
+	// tenants are the chats with their own nodes, nil if the multi-tenant mode is disabled.
+	tenants Tenants
+	// actions runs the actions offered with the alerts, nil if there are none.
+	actions Actions
+	// resyncs starts the guided resyncs, nil if there are none.
+	resyncs Resyncs
+	// reference is the endpoint the head blocks of the nodes are compared to, nil if there is none.
+	reference *insync.Node
+	// loc is the timezone of the times in the replies.
+	loc *time.Location
+
+	// wizardMu guards the running setup wizards.
+	wizardMu sync.Mutex
+	wizards  map[wizardKey]*wizard
+	// memberMu guards the members of the configured chats, with the time their membership was checked, who may
+	// query the status of the nodes inline.
+	memberMu sync.Mutex
+	members  map[int64]time.Time
+}
+
+// StartBot starts polling for updates, so users can interact with the alerts.
+// The history is optional, it's required for /sla, /report and /history. So are the preferences, the settings of the
+// chats changed with /settings, which are stored in the history. The test alerts of /test are sent to nf.
+// With tenants, the other chats can register their own nodes with /setup and handle their incidents.
+// The actions offered with the alerts are run by actions once a user confirms them, it may be nil. So are the steps
+// of the guided resyncs started with /resync, resyncs may be nil as well.
+// The head blocks of the nodes are compared to the reference, it may be nil too. The times in the replies are shown in
+// the timezone loc.
+func StartBot(b *gotgbot.Bot, nodes []*insync.Node, store *insync.StateStore, hist *history.Store, prefs *Preferences, nf insync.Notifier, chats []int64, tenants Tenants, actions Actions, resyncs Resyncs, ref *insync.Node, loc *time.Location) (*ext.Updater, error) {
+	bt := &bot{
+		chats:     make(map[int64]bool),
+		nodes:     nodes,
+		store:     store,
+		history:   hist,
+		prefs:     prefs,
+		nf:        nf,
+		tenants:   tenants,
+		actions:   actions,
+		resyncs:   resyncs,
+		reference: ref,
+		loc:       loc,
+		wizards:   make(map[wizardKey]*wizard),
+		members:   make(map[int64]time.Time),
+	}
+	for _, c := range chats {
+		bt.chats[c] = true
+	}
+	updater := ext.NewUpdater(&ext.UpdaterOpts{
+		DispatcherOpts: ext.DispatcherOpts{
+			Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+				slog.Error("error handling update", "err", err)
+				return ext.DispatcherActionNoop
+			},
+		},
+	})
+	d := updater.Dispatcher
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(ackCallback), bt.callbackHandler(ackCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(snoozeCallback), bt.callbackHandler(snoozeCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(resolveCallback), bt.callbackHandler(resolveCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(runCallback), bt.actionHandler(runCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(confirmCallback), bt.actionHandler(confirmCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(cancelCallback), bt.actionHandler(cancelCallback)))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(setupCallback), bt.wizardCallback))
+	d.AddHandler(handlers.NewCallback(callbackquery.Prefix(settingsCallback), bt.settingsCallback))
+	d.AddHandler(handlers.NewCommand("ack", bt.commandHandler(ackCallback)))
+	d.AddHandler(handlers.NewCommand("snooze", bt.commandHandler(snoozeCallback)))
+	d.AddHandler(handlers.NewCommand("resolve", bt.commandHandler(resolveCallback)))
+	d.AddHandler(handlers.NewCommand("incidents", bt.incidents))
+	d.AddHandler(handlers.NewCommand("mute", bt.mute))
+	d.AddHandler(handlers.NewCommand("unmute", bt.unmute))
+	d.AddHandler(handlers.NewCommand("mutes", bt.mutes))
+	// telegram only links commands up to the dash, the underscore variants can be tapped
+	for _, cmd := range []string{"pause-automation", "pause_automation"} {
+		d.AddHandler(handlers.NewCommand(cmd, bt.pauseAutomation))
+	}
+	for _, cmd := range []string{"resume-automation", "resume_automation"} {
+		d.AddHandler(handlers.NewCommand(cmd, bt.resumeAutomation))
+	}
+	d.AddHandler(handlers.NewCommand("sla", bt.sla))
+	d.AddHandler(handlers.NewCommand("report", bt.report))
+	d.AddHandler(handlers.NewCommand("status", bt.status))
+	d.AddHandler(handlers.NewCommand("history", bt.syncHistory))
+	d.AddHandler(handlers.NewCommand("resync", bt.resync))
+	d.AddHandler(handlers.NewCommand("export", bt.export))
+	d.AddHandler(handlers.NewCommand("test", bt.test))
+	d.AddHandler(handlers.NewCommand("setup", bt.setup))
+	d.AddHandler(handlers.NewCommand("settings", bt.settings))
+	d.AddHandler(handlers.NewInlineQuery(inlinequery.All, bt.inlineQuery))
+	// the answers to the setup wizard, after the commands
+	d.AddHandler(handlers.NewMessage(bt.wizardAnswer, bt.wizardReply))
+	return &updater, updater.StartPolling(b, &ext.PollingOpts{DropPendingUpdates: true})
+}
+
+// incidentButtons are attached to the alerts of an ongoing incident.
+func incidentButtons(name string) []gotgbot.InlineKeyboardButton {
+	return []gotgbot.InlineKeyboardButton{
+		{Text: "Acknowledge", CallbackData: ackCallback + name},
+		{Text: "Snooze " + insync.FormatDuration(defaultSnooze), CallbackData: snoozeCallback + name},
+		{Text: "Resolve", CallbackData: resolveCallback + name},
+	}
+}
+
+// alertButtons returns the incident buttons of the alert, only alerts of ongoing incidents have them.
+func alertButtons(a insync.Alert) []gotgbot.InlineKeyboardButton {
+	if !escalates(a) {
+		return nil
+	}
+	return incidentButtons(a.Node)
+}
+
+// nodesOf returns the nodes whose incidents the chat handles, false if the bot ignores the chat.
+func (bt *bot) nodesOf(chat int64) ([]*insync.Node, bool) {
+	if bt.chats[chat] {
+		return bt.nodes, true
+	}
+	if bt.tenants != nil {
+		if _, ok := bt.tenants.Tenant(chat); ok {
+			return bt.tenants.Nodes(chat), true
+		}
+	}
+	return nil, false
+}
+
+// find returns the incident of the node with the given name or the ongoing incident with the given id.
+func find(nodes []*insync.Node, ref string) (*insync.Incident, string) {
+	ref = strings.TrimPrefix(ref, "#")
+	for _, n := range nodes {
+		if n.Name() == ref || (n.Incident().Ongoing() && n.Incident().ID() == ref) {
+			return n.Incident(), n.Name()
+		}
+	}
+	return nil, ""
+}
+
+// apply runs the action on the incident and returns the confirmation for the chat.
+func (bt *bot) apply(inc *insync.Incident, name, action, user string, snooze time.Duration) (string, bool) {
+	id := inc.ID()
+	var text string
+	switch action {
+	case ackCallback:
+		if inc.Acknowledge(user) {
+			text = fmt.Sprintf("👀 %s acknowledged incident #%s on %s", user, id, name)
+		}
+	case snoozeCallback:
+		if inc.Snooze(user, snooze) {
+			text = fmt.Sprintf("😴 %s snoozed incident #%s on %s for %s", user, id, name, insync.FormatDuration(snooze))
+		}
+	case resolveCallback:
+		if inc.Resolve(user) {
+			text = fmt.Sprintf("✅ %s resolved incident #%s on %s", user, id, name)
+		}
+	}
+	if text == "" {
+		return "", false
+	}
+	slog.Info("incident updated", "node", name, "incident", id, "action", strings.TrimSuffix(action, ":"), "user", user)
+	return text, true
+}
+
+func (bt *bot) callbackHandler(action string) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		cq := ctx.CallbackQuery
+		var nodes []*insync.Node
+		ok := cq.Message != nil
+		if ok {
+			nodes, ok = bt.nodesOf(cq.Message.Chat.Id)
+		}
+		if !ok {
+			_, err := cq.Answer(b, nil)
+			return err
+		}
+		inc, name := find(nodes, strings.TrimPrefix(cq.Data, action))
+		var msg string
+		ok = inc != nil
+		if ok {
+			msg, ok = bt.apply(inc, name, action, userName(cq.From), defaultSnooze)
+		}
+		if !ok {
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "there is no ongoing incident"})
+			return err
+		}
+		if _, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "done"}); err != nil {
+			return err
+		}
+		if action != snoozeCallback {
+			if _, err := cq.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: withoutNode(cq.Message.ReplyMarkup, name, action)},
+			}); err != nil {
+				return err
+			}
+		}
+		_, err := b.SendMessage(cq.Message.Chat.Id, msg, &gotgbot.SendMessageOpts{
+			ReplyToMessageId:         cq.Message.MessageId,
+			AllowSendingWithoutReply: true,
+		})
+		return err
+	}
+}
+
+// commandHandler handles /ack, /snooze and /resolve. Each expects a node name or incident id,
+// /snooze accepts an optional duration.
+func (bt *bot) commandHandler(action string) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		msg := ctx.EffectiveMessage
+		nodes, ok := bt.nodesOf(msg.Chat.Id)
+		if !ok || ctx.EffectiveUser == nil {
+			return nil
+		}
+		args := strings.Fields(msg.Text)[1:]
+		if len(args) == 0 {
+			_, err := msg.Reply(b, "usage: "+strings.Fields(msg.Text)[0]+" <node or incident id>", nil)
+			return err
+		}
+		snooze := defaultSnooze
+		if action == snoozeCallback && len(args) > 1 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				_, err := msg.Reply(b, fmt.Sprintf("invalid duration %q", args[1]), nil)
+				return err
+			}
+			snooze = d
+		}
+		inc, name := find(nodes, args[0])
+		var text string
+		ok = inc != nil
+		if ok {
+			text, ok = bt.apply(inc, name, action, userName(*ctx.EffectiveUser), snooze)
+		}
+		if !ok {
+			_, err := msg.Reply(b, "there is no ongoing incident for "+args[0], nil)
+			return err
+		}
+		_, err := msg.Reply(b, text, nil)
+		return err
+	}
+}
+
+// test handles /test [severity] [node], which sends a test alert through the routing.
+func (bt *bot) test(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	severity, node := insync.SeverityWarning, ""
+	for _, arg := range strings.Fields(msg.Text)[1:] {
+		if s, ok := insync.ParseSeverity(arg); ok {
+			severity = s
+			continue
+		}
+		if !bt.isNode(arg) || arg == insync.AllNodes {
+			_, err := msg.Reply(b, "usage: /test [info|warning|critical] [node]", nil)
+			return err
+		}
+		node = arg
+	}
+	user := userName(*ctx.EffectiveUser)
+	slog.Info("test alert sent", "user", user)
+	text := "🧪 test alert sent"
+	if err := bt.nf.Send(insync.TestAlert(node, user, severity)); err != nil {
+		text = "🧪 test alert failed: " + redact.Error(err)
+	}
+	_, err := msg.Reply(b, text, nil)
+	return err
+}
+
+// incidents lists the open and the recently closed incidents, together with who handled them.
+func (bt *bot) incidents(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	var open []insync.IncidentRecord
+	for _, n := range bt.nodes {
+		if r, ok := n.Incident().Snapshot(); ok {
+			open = append(open, r)
+		}
+	}
+	_, err := msg.Reply(b, incidentsMsg(open, bt.store.History(10), bt.loc), nil)
+	return err
+}
+
+func incidentsMsg(open, closed []insync.IncidentRecord, loc *time.Location) string {
+	var s strings.Builder
+	s.WriteString("📋 Open incidents\n")
+	if len(open) == 0 {
+		s.WriteString("none\n")
+	}
+	for _, r := range open {
+		s.WriteString(fmt.Sprintf("#%s %s %s for %s%s\n", r.ID, r.Node, r.State, insync.FormatDuration(time.Since(r.Start)), handledBy(r.Actions)))
+	}
+	s.WriteString("\nRecently closed\n")
+	if len(closed) == 0 {
+		s.WriteString("none\n")
+	}
+	for _, r := range closed {
+		by := "recovered"
+		if r.ResolvedBy != "" {
+			by = "resolved by " + r.ResolvedBy
+		}
+		s.WriteString(fmt.Sprintf("#%s %s %s, %s after %s%s\n", r.ID, r.Node, r.Start.In(loc).Format("Jan 2 15:04"), by, insync.FormatDuration(r.End.Sub(r.Start)), handledBy(r.Actions)))
+	}
+	return s.String()
+}
+
+// handledBy summarizes the audit trail, e.g. " (acknowledged by @alice, snoozed 1h by @bob)".
+func handledBy(actions []insync.IncidentAction) string {
+	var parts []string
+	for _, a := range actions {
+		if a.Action == insync.ActionResolved {
+			continue
+		}
+		part := a.Action
+		if a.Detail != "" {
+			part += " " + a.Detail
+		}
+		parts = append(parts, part+" by "+a.User)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// userName returns the telegram username, or the first name if the user doesn't have one.
+func userName(u gotgbot.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return u.FirstName
+}
+
+// withoutNode returns the keyboard without the incident buttons of the given node.
+// Acknowledging only removes the acknowledge button, resolving removes all buttons of the node.
+func withoutNode(kb *gotgbot.InlineKeyboardMarkup, name, action string) [][]gotgbot.InlineKeyboardButton {
+	rows := [][]gotgbot.InlineKeyboardButton{}
+	if kb == nil {
+		return rows
+	}
+	for _, row := range kb.InlineKeyboard {
+		var buttons []gotgbot.InlineKeyboardButton
+		for _, btn := range row {
+			if btn.CallbackData == action+name || (action == resolveCallback && isIncidentButton(btn.CallbackData, name)) {
+				continue
+			}
+			buttons = append(buttons, btn)
+		}
+		if len(buttons) > 0 {
+			rows = append(rows, buttons)
+		}
+	}
+	return rows
+}
+
+func isIncidentButton(data, name string) bool {
+	for _, prefix := range []string{ackCallback, snoozeCallback, resolveCallback} {
+		if data == prefix+name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Config configures a telegram chat alerts are sent to.
+type Config struct {
+	Chat       int64           `yaml:"chat"`
+	QuietHours string          `yaml:"quiet_hours"`
+	GroupWait  insync.Duration `yaml:"group_wait"`
+	// OnCall is the name of the schedule whose user on call is mentioned in the alerts of ongoing incidents.
+	OnCall string `yaml:"on_call"`
+	// Timezone of the chat, e.g. Europe/Zurich. The quiet hours and the time of day of the reports are
+	// in this timezone, defaults to that of insync.
+	Timezone string `yaml:"timezone"`
+}
+
+// ScheduleConfig configures a rotating on-call schedule.
+type ScheduleConfig struct {
+	// Users are the telegram usernames in the order of the rotation.
+	Users []string `yaml:"users"`
+	// Start is the beginning of the first shift, e.g. 2024-01-01T09:00:00+01:00.
+	Start     string           `yaml:"start"`
+	Shift     insync.Duration  `yaml:"shift"`
+	Overrides []OverrideConfig `yaml:"overrides"`
+}
+
+// OverrideConfig puts a user on call during the hours on the days, e.g. on weekends. Empty days or hours match always.
+type OverrideConfig struct {
+	Days  []string `yaml:"days"`
+	Hours string   `yaml:"hours"`
+	User  string   `yaml:"user"`
+}
@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// defaultExportWindow is the window of /export without argument.
+const defaultExportWindow = 30 * 24 * time.Hour
+
+// export handles /export [window] [csv|json], which sends the incidents of the window as file, e.g. /export 7d json.
+func (bt *bot) export(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	window, format := defaultExportWindow, "csv"
+	for _, arg := range strings.Fields(msg.Text)[1:] {
+		if arg == "csv" || arg == "json" {
+			format = arg
+			continue
+		}
+		d, err := ParseWindow(arg)
+		if err != nil {
+			_, err := msg.Reply(b, "usage: /export [window] [csv|json], e.g. /export 7d json", nil)
+			return err
+		}
+		window = d
+	}
+	to := time.Now()
+	records := bt.store.Incidents(to.Add(-window), to)
+	var buf bytes.Buffer
+	if err := insync.ExportIncidents(&buf, format, records); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("incidents-%s.%s", to.Format("2006-01-02"), format)
+	_, err := b.SendDocument(msg.Chat.Id, gotgbot.NamedFile{File: &buf, FileName: name}, &gotgbot.SendDocumentOpts{
+		Caption:          fmt.Sprintf("📋 %d incident(s) of the last %s", len(records), insync.FormatDuration(window)),
+		ReplyToMessageId: msg.MessageId,
+	})
+	return err
+}
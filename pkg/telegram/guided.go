@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Resyncs starts the guided resyncs of the nodes, their steps are run as actions once a user confirms them.
+type Resyncs interface {
+	// Recipe describes the steps of the guided resync of the node, the one with the name or the first one of the node
+	// if the name is empty, and returns the usernames allowed to run it, empty if the admins of the chat may.
+	// It returns an error if the node has no such resync.
+	Recipe(node, name string) (string, []string, error)
+	// Resync starts the guided resync on behalf of the user and returns the action running its first step.
+	Resync(node, name, user string) (insync.AlertAction, error)
+}
+
+// resync handles /resync <node> [recipe], which starts the guided resync of the node. The steps are offered one at a
+// time, each runs once confirmed with its button and offers the next step with its outcome.
+func (bt *bot) resync(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	if bt.resyncs == nil {
+		_, err := msg.Reply(b, "there is no resync configured", nil)
+		return err
+	}
+	args := strings.Fields(msg.Text)[1:]
+	if len(args) == 0 || len(args) > 2 {
+		_, err := msg.Reply(b, "usage: /resync <node> [recipe], e.g. /resync node-1", nil)
+		return err
+	}
+	var name string
+	if len(args) == 2 {
+		name = args[1]
+	}
+	desc, approvers, err := bt.resyncs.Recipe(args[0], name)
+	if err != nil {
+		_, err := msg.Reply(b, err.Error(), nil)
+		return err
+	}
+	if ok, err := mayConfirm(b, msg.Chat, *ctx.EffectiveUser, approvers); err != nil || !ok {
+		if err != nil {
+			slog.Error("error checking the permissions", "chat", msg.Chat.Id, "err", err)
+		}
+		_, err := msg.Reply(b, "you aren't allowed to resync "+args[0], nil)
+		return err
+	}
+	user := userName(*ctx.EffectiveUser)
+	act, err := bt.resyncs.Resync(args[0], name, user)
+	if err != nil {
+		_, err := msg.Reply(b, err.Error(), nil)
+		return err
+	}
+	_, err = msg.Reply(b, "🔁 "+user+" started the "+desc+"\nEvery step runs once it's confirmed.", &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: actionButtons(insync.Alert{Actions: []insync.AlertAction{act}})},
+	})
+	return err
+}
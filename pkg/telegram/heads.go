@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// behindTolerance is the number of blocks a node may be behind the pack before it's highlighted,
+// the head blocks of the nodes are polled at different times.
+const behindTolerance = 3
+
+var stateIcons = map[insync.NodeState]string{
+	insync.StateHealthy:     "🟢",
+	insync.StateDegraded:    "🟡",
+	insync.StateSyncing:     "🔴",
+	insync.StateUnreachable: "🔴",
+}
+
+// status handles /status, which compares the head blocks of the nodes of the chat and the reference.
+func (bt *bot) status(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	nodes, ok := bt.nodesOf(msg.Chat.Id)
+	if !ok {
+		return nil
+	}
+	if len(nodes) == 0 {
+		_, err := msg.Reply(b, "no nodes are monitored", nil)
+		return err
+	}
+	_, err := msg.Reply(b, HeadTable(nodes, bt.reference), nil)
+	return err
+}
+
+// HeadTable compares the head blocks of the nodes and the reference, which may be nil. The nodes are compared per chain,
+// the reference with the nodes of its chain or all of them if it has none. Nodes behind the best head are highlighted.
+func HeadTable(nodes []*insync.Node, ref *insync.Node) string {
+	var chains []string
+	byChain := make(map[string][]*insync.Node)
+	for _, n := range nodes {
+		chain := n.Status().Chain
+		if _, ok := byChain[chain]; !ok {
+			chains = append(chains, chain)
+		}
+		byChain[chain] = append(byChain[chain], n)
+	}
+	sort.Strings(chains)
+
+	var s strings.Builder
+	s.WriteString("📊 Head blocks\n")
+	for _, chain := range chains {
+		pack := byChain[chain]
+		var refHead uint64
+		if ref != nil {
+			if st := ref.Status(); st.Chain == "" || st.Chain == chain {
+				refHead = head(st)
+			}
+		}
+		best := refHead
+		for _, n := range pack {
+			if h := head(n.Status()); h > best {
+				best = h
+			}
+		}
+		if len(chains) > 1 {
+			name := chain
+			if name == "" {
+				name = "unknown chain"
+			}
+			s.WriteString("\n" + name + "\n")
+		}
+		if ref != nil && refHead > 0 {
+			s.WriteString(fmt.Sprintf("📌 %s %s\n", ref.Name(), insync.FormatNumber(refHead)))
+		}
+		for _, n := range pack {
+			st := n.Status()
+			h := head(st)
+			if h == 0 {
+				s.WriteString(fmt.Sprintf("⚪ %s unknown\n", n.Name()))
+			} else {
+				s.WriteString(fmt.Sprintf("%s %s %s", stateIcons[st.State], n.Name(), insync.FormatNumber(h)))
+				if best-h > behindTolerance {
+					s.WriteString(fmt.Sprintf(", ⚠️ %s behind", insync.FormatNumber(best-h)))
+				}
+				s.WriteString("\n")
+			}
+			if st.Beacon != nil {
+				s.WriteString("   beacon: " + insync.BeaconSyncDetail(*st.Beacon) + "\n")
+			}
+		}
+	}
+	return s.String()
+}
+
+// head returns the head block of the status, 0 if it's unknown.
+func head(st insync.NodeStatus) uint64 {
+	if st.State == insync.StateUnreachable {
+		return 0
+	}
+	return st.CurrentBlock
+}
@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// memberTTL is how long the membership of a user in the configured chats is trusted before it's checked again.
+const memberTTL = 10 * time.Minute
+
+// inlineCacheTime is how long telegram caches the results of an inline query, in seconds.
+const inlineCacheTime = 10
+
+// maxInlineResults is the maximum number of results of an inline query.
+const maxInlineResults = 50
+
+// inlineQuery handles the inline queries, e.g. @insyncbot status node-1, which return the status cards of the nodes
+// whose names start with the query, so they can be shared into any chat. Only the members of the configured chats
+// get results, an empty query also returns the head blocks of all nodes.
+func (bt *bot) inlineQuery(b *gotgbot.Bot, ctx *ext.Context) error {
+	iq := ctx.InlineQuery
+	opts := &gotgbot.AnswerInlineQueryOpts{CacheTime: inlineCacheTime, IsPersonal: true}
+	if ok, err := bt.isMember(b, iq.From.Id); err != nil || !ok {
+		if err != nil {
+			slog.Error("error checking the membership", "user", userName(iq.From), "err", err)
+		}
+		_, err := iq.Answer(b, []gotgbot.InlineQueryResult{}, opts)
+		return err
+	}
+	query := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(iq.Query), "status"))
+	var results []gotgbot.InlineQueryResult
+	if query == "" && len(bt.nodes) > 0 {
+		results = append(results, gotgbot.InlineQueryResultArticle{
+			Id:                  "heads",
+			Title:               "📊 Head blocks",
+			Description:         fmt.Sprintf("%d nodes", len(bt.nodes)),
+			InputMessageContent: gotgbot.InputTextMessageContent{MessageText: HeadTable(bt.nodes, bt.reference)},
+		})
+	}
+	for i, n := range bt.nodes {
+		if len(results) == maxInlineResults {
+			break
+		}
+		if !strings.HasPrefix(strings.ToLower(n.Name()), strings.ToLower(query)) {
+			continue
+		}
+		icon, desc := nodeSummary(n)
+		results = append(results, gotgbot.InlineQueryResultArticle{
+			// the ids are limited to 64 bytes, the names aren't
+			Id:                  fmt.Sprintf("node:%d", i),
+			Title:               icon + " " + n.Name(),
+			Description:         desc,
+			InputMessageContent: gotgbot.InputTextMessageContent{MessageText: statusCard(n, bt.store, bt.loc)},
+		})
+	}
+	_, err := iq.Answer(b, results, opts)
+	return err
+}
+
+// isMember reports whether the user is a member of one of the configured chats.
+func (bt *bot) isMember(b *gotgbot.Bot, user int64) (bool, error) {
+	bt.memberMu.Lock()
+	checked, ok := bt.members[user]
+	bt.memberMu.Unlock()
+	if ok && time.Since(checked) < memberTTL {
+		return true, nil
+	}
+	var lastErr error
+	for chat := range bt.chats {
+		if chat == user {
+			// the private chat with the user
+			return bt.addMember(user), nil
+		}
+		if chat > 0 {
+			continue
+		}
+		m, err := b.GetChatMember(chat, user)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch m.GetStatus() {
+		case "creator", "administrator", "member", "restricted":
+			return bt.addMember(user), nil
+		}
+	}
+	return false, lastErr
+}
+
+// addMember remembers the membership of the user, it returns true.
+func (bt *bot) addMember(user int64) bool {
+	bt.memberMu.Lock()
+	defer bt.memberMu.Unlock()
+	bt.members[user] = time.Now()
+	return true
+}
+
+// nodeSummary returns the icon and a short description of the state of the node, e.g. healthy at block 16,000,000.
+func nodeSummary(n *insync.Node) (string, string) {
+	if !n.Checked() {
+		return "⚪", "not checked yet"
+	}
+	st := n.Status()
+	if st.State == insync.StateUnreachable {
+		return stateIcons[st.State], st.State.String()
+	}
+	return stateIcons[st.State], fmt.Sprintf("%s at block %s", st.State, insync.FormatNumber(st.CurrentBlock))
+}
+
+// statusCard describes the current status of the node, its incident and mute. It's shared into other chats, so it
+// leaves out the endpoints and the errors of the node.
+func statusCard(n *insync.Node, store *insync.StateStore, loc *time.Location) string {
+	icon, desc := nodeSummary(n)
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s %s is %s\n", icon, n.Name(), desc)
+	if !n.Checked() {
+		return strings.TrimSpace(s.String())
+	}
+	st := n.Status()
+	switch {
+	case st.Client != "" && st.Chain != "":
+		fmt.Fprintf(&s, "%s on %s\n", st.Client, st.Chain)
+	case st.Chain != "":
+		fmt.Fprintf(&s, "on %s\n", st.Chain)
+	case st.Client != "":
+		fmt.Fprintf(&s, "%s\n", st.Client)
+	}
+	if st.State != insync.StateUnreachable {
+		if st.HighestBlock > st.CurrentBlock {
+			fmt.Fprintf(&s, "%s blocks behind the highest block %s\n", insync.FormatNumber(st.HighestBlock-st.CurrentBlock), insync.FormatNumber(st.HighestBlock))
+		}
+		if st.Peers >= 0 {
+			fmt.Fprintf(&s, "peers: %d\n", st.Peers)
+		}
+		if st.Latency > 0 {
+			fmt.Fprintf(&s, "latency: %s\n", st.Latency.Round(time.Millisecond))
+		}
+		if st.DiskUsage > 0 {
+			fmt.Fprintf(&s, "disk: %.1f%%\n", st.DiskUsage)
+		}
+	}
+	if st.Beacon != nil {
+		fmt.Fprintf(&s, "beacon: %s\n", insync.BeaconSyncDetail(*st.Beacon))
+	}
+	if r, ok := n.Incident().Snapshot(); ok {
+		fmt.Fprintf(&s, "incident #%s: %s for %s%s\n", r.ID, r.State, insync.FormatDuration(time.Since(r.Start)), handledBy(r.Actions))
+	}
+	if m, ok := store.Muted(n.Name()); ok {
+		if m.Until.IsZero() {
+			fmt.Fprintf(&s, "🔇 muted by %s\n", m.User)
+		} else {
+			fmt.Fprintf(&s, "🔇 muted by %s for %s\n", m.User, insync.FormatDuration(time.Until(m.Until)))
+		}
+	}
+	fmt.Fprintf(&s, "as of %s", time.Now().In(loc).Format("Jan 2 15:04 MST"))
+	return s.String()
+}
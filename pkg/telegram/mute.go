@@ -0,0 +1,122 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// mute handles /mute <node or all> [duration], which suppresses the alerts of the node.
+// Without duration the node stays muted until /unmute.
+func (bt *bot) mute(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	args := strings.Fields(msg.Text)[1:]
+	if len(args) == 0 {
+		_, err := msg.Reply(b, "usage: /mute <node or all> [duration]", nil)
+		return err
+	}
+	name := args[0]
+	if !bt.isNode(name) {
+		_, err := msg.Reply(b, "unknown node "+name, nil)
+		return err
+	}
+	var d time.Duration
+	if len(args) > 1 {
+		var err error
+		if d, err = time.ParseDuration(args[1]); err != nil || d <= 0 {
+			_, err := msg.Reply(b, fmt.Sprintf("invalid duration %q", args[1]), nil)
+			return err
+		}
+	}
+	user := userName(*ctx.EffectiveUser)
+	if err := bt.store.MuteNode(name, user, d); err != nil {
+		return err
+	}
+	text := fmt.Sprintf("🔇 %s muted %s until unmuted", user, name)
+	if d > 0 {
+		text = fmt.Sprintf("🔇 %s muted %s for %s", user, name, insync.FormatDuration(d))
+	}
+	slog.Info("node muted", "node", name, "user", user, "for", d)
+	_, err := msg.Reply(b, text, nil)
+	return err
+}
+
+// unmute handles /unmute <node or all>.
+func (bt *bot) unmute(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	args := strings.Fields(msg.Text)[1:]
+	if len(args) == 0 {
+		_, err := msg.Reply(b, "usage: /unmute <node or all>", nil)
+		return err
+	}
+	ok, err := bt.store.UnmuteNode(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err := msg.Reply(b, args[0]+" isn't muted", nil)
+		return err
+	}
+	text := fmt.Sprintf("🔈 %s unmuted %s", userName(*ctx.EffectiveUser), args[0])
+	slog.Info("node unmuted", "node", args[0], "user", userName(*ctx.EffectiveUser))
+	_, err = msg.Reply(b, text, nil)
+	return err
+}
+
+// mutes handles /mutes, which lists the muted nodes.
+func (bt *bot) mutes(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	_, err := msg.Reply(b, mutesMsg(bt.store.Mutes()), nil)
+	return err
+}
+
+func mutesMsg(mutes map[string]insync.Mute) string {
+	if len(mutes) == 0 {
+		return "🔈 no node is muted"
+	}
+	names := make([]string, 0, len(mutes))
+	for name := range mutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var s strings.Builder
+	s.WriteString("🔇 Muted nodes\n")
+	for _, name := range names {
+		m := mutes[name]
+		until := "until unmuted"
+		if !m.Until.IsZero() {
+			until = "for another " + insync.FormatDuration(time.Until(m.Until))
+		}
+		s.WriteString(fmt.Sprintf("%s %s, by %s\n", name, until, m.User))
+	}
+	return s.String()
+}
+
+// isNode reports whether the name is a monitored node or insync.AllNodes.
+func (bt *bot) isNode(name string) bool {
+	if name == insync.AllNodes {
+		return true
+	}
+	for _, n := range bt.nodes {
+		if n.Name() == name {
+			return true
+		}
+	}
+	return false
+}
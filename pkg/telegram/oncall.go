@@ -0,0 +1,113 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// Schedule is a rotating on-call schedule. The users take turns, each for one shift,
+// starting with the first user at start. Overrides take precedence over the rotation.
+type Schedule struct {
+	users     []string
+	start     time.Time
+	shift     time.Duration
+	overrides []override
+}
+
+// override assigns a user during a daily time window on the given weekdays, e.g. weekend days.
+type override struct {
+	days   map[time.Weekday]bool
+	window *QuietHours
+	user   string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// NewSchedule validates the config and creates the schedule.
+func NewSchedule(cfg ScheduleConfig) (*Schedule, error) {
+	if len(cfg.Users) == 0 {
+		return nil, errors.New("no users")
+	}
+	if cfg.Shift <= 0 {
+		return nil, errors.New("shift must be greater than 0")
+	}
+	start, err := time.Parse(time.RFC3339, cfg.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	s := &Schedule{users: cfg.Users, start: start, shift: time.Duration(cfg.Shift)}
+	for i, oc := range cfg.Overrides {
+		if oc.User == "" {
+			return nil, fmt.Errorf("override %d: missing user", i)
+		}
+		o := override{user: oc.User}
+		if len(oc.Days) > 0 {
+			o.days = make(map[time.Weekday]bool)
+		}
+		for _, d := range oc.Days {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return nil, fmt.Errorf("override %d: invalid day %q", i, d)
+			}
+			o.days[wd] = true
+		}
+		if oc.Hours != "" {
+			if o.window, err = ParseQuietHours(oc.Hours); err != nil {
+				return nil, fmt.Errorf("override %d: %w", i, err)
+			}
+		}
+		s.overrides = append(s.overrides, o)
+	}
+	return s, nil
+}
+
+// MustNewSchedule is like NewSchedule but panics if the config is invalid.
+func MustNewSchedule(cfg ScheduleConfig) *Schedule {
+	s, err := NewSchedule(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// onCall returns the user on call at the given time.
+func (s *Schedule) onCall(t time.Time) string {
+	for _, o := range s.overrides {
+		if (o.days == nil || o.days[t.Weekday()]) && (o.window == nil || o.window.contains(t)) {
+			return o.user
+		}
+	}
+	shifts := int64(t.Sub(s.start) / s.shift)
+	n := int64(len(s.users))
+	return s.users[((shifts%n)+n)%n]
+}
+
+// mention returns the mention of the user on call, empty without a schedule.
+func (s *Schedule) mention(t time.Time) string {
+	if s == nil {
+		return ""
+	}
+	user := s.onCall(t)
+	if !strings.HasPrefix(user, "@") {
+		user = "@" + user
+	}
+	return "\nOn call: " + user
+}
+
+// escalates reports whether the user on call is mentioned in the alert,
+// which is the case for all alerts of an ongoing incident.
+func escalates(a insync.Alert) bool {
+	return !a.Resolved && a.Incident != nil && a.Incident.Ongoing()
+}
@@ -0,0 +1,97 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// defaultResyncWindow is the window of /history without argument.
+const defaultResyncWindow = 30 * 24 * time.Hour
+
+// syncHistory handles /history [node] [window], which reports the resyncs of the nodes: how long the last one took
+// and how fast the nodes caught up after restarts, e.g. /history node-1 7d.
+func (bt *bot) syncHistory(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	if bt.history == nil {
+		_, err := msg.Reply(b, "the history is disabled, the resyncs can't be reported", nil)
+		return err
+	}
+	nodes, window := bt.nodes, defaultResyncWindow
+	for _, arg := range strings.Fields(msg.Text)[1:] {
+		if n := bt.node(arg); n != nil {
+			nodes = []*insync.Node{n}
+			continue
+		}
+		d, err := ParseWindow(arg)
+		if err != nil {
+			_, err := msg.Reply(b, "usage: /history [node] [window], e.g. /history node-1 7d", nil)
+			return err
+		}
+		window = d
+	}
+	to := time.Now()
+	entries := make([]string, len(nodes))
+	for i, n := range nodes {
+		resyncs, err := bt.history.Resyncs(n.Name(), to.Add(-window), to)
+		if err != nil {
+			return err
+		}
+		entries[i] = resyncEntry(n.Name(), resyncs, bt.loc)
+	}
+	for _, text := range splitMsgs(fmt.Sprintf("🔁 Resyncs of the last %s\n", insync.FormatDuration(window)), entries) {
+		if _, err := msg.Reply(b, text, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resyncEntry describes the last resync of the node and the average of those after restarts, with the times in the
+// timezone.
+func resyncEntry(node string, resyncs []history.Resync, loc *time.Location) string {
+	if len(resyncs) == 0 {
+		return fmt.Sprintf("\n%s: no resyncs\n", node)
+	}
+	var s strings.Builder
+	last := resyncs[len(resyncs)-1]
+	s.WriteString(fmt.Sprintf("\n%s: %d resync(s), the last took %s and ended %s\n",
+		node, len(resyncs), insync.FormatDuration(last.Duration()), last.End.In(loc).Format("Jan 2 15:04")))
+	s.WriteString(fmt.Sprintf("peak lag %s blocks", insync.FormatNumber(last.PeakLag)))
+	if last.Rate > 0 {
+		s.WriteString(fmt.Sprintf(", importing %.1f blocks/s", last.Rate))
+	}
+	s.WriteString("\n")
+
+	var restarts, sampled int
+	var d time.Duration
+	var rate float64
+	for _, r := range resyncs {
+		if !r.Restart {
+			continue
+		}
+		restarts++
+		d += r.Duration()
+		if r.Rate > 0 {
+			rate += r.Rate
+			sampled++
+		}
+	}
+	if restarts > 0 {
+		s.WriteString(fmt.Sprintf("after %d restart(s) it caught up in %s on average", restarts, insync.FormatDuration(d/time.Duration(restarts))))
+		if sampled > 0 {
+			s.WriteString(fmt.Sprintf(", at %.1f blocks/s", rate/float64(sampled)))
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
@@ -0,0 +1,441 @@
+// Package telegram delivers insync alerts to telegram chats and lets users handle the incidents with the bot.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// maxMessageLength is the maximum length of a telegram message.
+const maxMessageLength = 4096
+
+// Route delivers alerts to a telegram chat.
+// During quiet hours, warnings are held back and delivered as a digest once the quiet hours are over.
+// If groupWait is set, alerts firing within that window are grouped into a single message.
+type Route struct {
+	sync.Mutex
+	b          *gotgbot.Bot
+	chatID     int64
+	quietHours *QuietHours
+	held       []heldAlert
+	groupWait  time.Duration
+	pending    []insync.Alert
+	groupTimer *time.Timer
+	// onCall is the schedule whose user on call is mentioned in escalations, might be nil.
+	onCall *Schedule
+	// replaced are the messages updated by later alerts with the same key, by node and key.
+	replaced map[string]int64
+	// loc is the timezone of the chat, nil for the local time.
+	loc *time.Location
+	// prefs are the settings of the chat changed with /settings, nil if there are none.
+	prefs *Preferences
+	// verbosity is the configured level of detail of the alerts, the settings of the chat may change it.
+	verbosity insync.Verbosity
+	gate      insync.VerbosityGate
+
+	api apiStats
+	// audit records the messages as notifications of the route name, nil if they aren't recorded.
+	audit insync.NotificationRecorder
+	name  string
+}
+
+type heldAlert struct {
+	time time.Time
+	text string
+}
+
+// QuietHours is a daily time window, stored as offsets since midnight.
+// The window may wrap around midnight, e.g. 23:00-07:00.
+type QuietHours struct {
+	start, end time.Duration
+}
+
+// NewRoute creates a route to the chat. Quiet hours and the on-call schedule are optional.
+// The quiet hours are in the timezone of the chat, the local time if loc is nil.
+func NewRoute(b *gotgbot.Bot, chatID int64, q *QuietHours, groupWait time.Duration, onCall *Schedule, loc *time.Location) *Route {
+	return &Route{
+		b:          b,
+		chatID:     chatID,
+		quietHours: q,
+		groupWait:  groupWait,
+		onCall:     onCall,
+		loc:        loc,
+	}
+}
+
+// Location returns the timezone of the chat, e.g. for the time of day of the reports.
+func (r *Route) Location() *time.Location {
+	if r.loc == nil {
+		return time.Local
+	}
+	return r.loc
+}
+
+// SetPreferences applies the settings of the chat changed with /settings, e.g. its quiet hours. It must be called
+// before the route is used.
+func (r *Route) SetPreferences(p *Preferences) {
+	r.prefs = p
+}
+
+// SetVerbosity sets the level of detail of the alerts of the chat, unless the chat changed it with /settings.
+// It must be called before the route is used.
+func (r *Route) SetVerbosity(v insync.Verbosity) {
+	r.verbosity = v
+}
+
+// quiet returns the quiet hours of the chat, those of its settings if it has any.
+func (r *Route) quiet(cp chatPrefs) *QuietHours {
+	if cp.quietSet {
+		return cp.quiet
+	}
+	return r.quietHours
+}
+
+// Send sends the alert, unless it's held back because of quiet hours or grouping, or dropped because of the settings
+// of the chat.
+func (r *Route) Send(a insync.Alert) error {
+	now := time.Now().In(r.Location())
+	cp := r.prefs.get(r.chatID)
+	v := r.verbosity
+	if cp.settings.Verbosity != "" {
+		v = cp.verbosity
+	}
+	if !cp.subscribed(a.Node) || !r.gate.Pass(v, a) {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	if a.Replace {
+		return r.replace(a)
+	}
+	if r.holds(cp, a, now) {
+		r.held = append(r.held, heldAlert{time: now, text: a.Text})
+		return nil
+	}
+	if r.groupWait <= 0 {
+		return r.deliver([]insync.Alert{a})
+	}
+	r.pending = append(r.pending, a)
+	if r.groupTimer == nil {
+		r.groupTimer = time.AfterFunc(r.groupWait, r.flushGroups)
+	}
+	return nil
+}
+
+// holds reports whether the alert is held back for the digest. Only warnings are held during quiet hours: critical
+// alerts page right away, and the resolved and info alerts, e.g. the recovery of a page, follow them.
+func (r *Route) holds(cp chatPrefs, a insync.Alert, now time.Time) bool {
+	return a.Severity == insync.SeverityWarning && r.quiet(cp).contains(now)
+}
+
+// replace edits the message of the previous alert with the same key, or sends a new one if there is none.
+// The edits don't notify, so they bypass quiet hours and grouping. The caller must hold the lock.
+func (r *Route) replace(a insync.Alert) error {
+	key := a.Node + "/" + a.Key
+	if id, ok := r.replaced[key]; ok {
+		err := r.editMessage(id, a.Text, a)
+		if err == nil {
+			if a.Resolved {
+				delete(r.replaced, key)
+			}
+			return nil
+		}
+		// e.g. the message was deleted
+		slog.Warn("error editing message, sending a new one", "chat", r.chatID, "node", a.Node, "err", err)
+	}
+	msg, err := r.sendMessage(a.Text, nil, a)
+	if err != nil {
+		return err
+	}
+	if a.Resolved {
+		delete(r.replaced, key)
+		return nil
+	}
+	if r.replaced == nil {
+		r.replaced = make(map[string]int64)
+	}
+	r.replaced[key] = msg.MessageId
+	return nil
+}
+
+// flushGroups delivers the pending alerts, one message per group. They're delivered after the lock is released,
+// so the alerts sent meanwhile aren't held up by the telegram api.
+func (r *Route) flushGroups() {
+	r.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.groupTimer = nil
+	r.Unlock()
+
+	for _, group := range groupAlerts(pending) {
+		if err := r.deliver(group); err != nil {
+			slog.Error("error sending message", "chat", r.chatID, "err", err)
+		}
+	}
+}
+
+// groupAlerts groups the alerts by summary, in the order of their first alert. Every node is listed once per group
+// with its latest alert, e.g. if it fired twice within the group wait.
+func groupAlerts(alerts []insync.Alert) [][]insync.Alert {
+	var groups [][]insync.Alert
+	bySummary := make(map[string]int)
+	// byNode is the index of the alert of the node in its group, by summary and node
+	byNode := make(map[[2]string]int)
+	for _, a := range alerts {
+		g, ok := bySummary[a.Summary]
+		if !ok {
+			g = len(groups)
+			bySummary[a.Summary] = g
+			groups = append(groups, nil)
+		}
+		key := [2]string{a.Summary, a.Node}
+		if i, ok := byNode[key]; ok {
+			groups[g][i] = a
+			continue
+		}
+		byNode[key] = len(groups[g])
+		groups[g] = append(groups[g], a)
+	}
+	return groups
+}
+
+// deliver sends a group of alerts as a single message. It doesn't need the lock, the alerts sent right away are
+// delivered under the lock to keep their order.
+func (r *Route) deliver(group []insync.Alert) error {
+	if len(group) == 1 {
+		a := group[0]
+		opts := sendOpts(alertButtons(a), actionButtons(a))
+		if a.Incident != nil {
+			if root := a.Incident.RootMessage(r.chatID); root != 0 {
+				opts.ReplyToMessageId = root
+				opts.AllowSendingWithoutReply = true
+			}
+		}
+		msg, err := r.sendMessage(a.Text, opts, a)
+		if err != nil {
+			return err
+		}
+		if a.Incident != nil {
+			a.Incident.SetRootMessage(r.chatID, msg.MessageId)
+		}
+		return nil
+	}
+	msgs, keyboard := groupMsgs(group)
+	for i, text := range msgs {
+		var kb [][]gotgbot.InlineKeyboardButton
+		if i == len(msgs)-1 {
+			kb = keyboard
+		}
+		msg, err := r.sendMessage(text, sendOpts(nil, kb), group...)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			continue
+		}
+		// the group message becomes the thread of incidents without one
+		for _, a := range group {
+			if a.Incident != nil {
+				a.Incident.SetRootMessage(r.chatID, msg.MessageId)
+			}
+		}
+	}
+	return nil
+}
+
+// groupMsgs renders a summary of the grouped alerts, followed by the individual alerts.
+// The buttons of each alert are placed in separate rows, labeled with the node name.
+func groupMsgs(group []insync.Alert) ([]string, [][]gotgbot.InlineKeyboardButton) {
+	names := make([]string, len(group))
+	entries := make([]string, len(group))
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	for i, a := range group {
+		names[i] = a.Node
+		entries[i] = "\n" + strings.TrimSpace(a.Text) + "\n"
+		rows := actionButtons(a)
+		if buttons := alertButtons(a); len(buttons) > 0 {
+			rows = append(rows, buttons)
+		}
+		for _, buttons := range rows {
+			row := make([]gotgbot.InlineKeyboardButton, len(buttons))
+			for j, btn := range buttons {
+				btn.Text = fmt.Sprintf("%s %s", btn.Text, a.Node)
+				row[j] = btn
+			}
+			keyboard = append(keyboard, row)
+		}
+	}
+	header := fmt.Sprintf("%s %d nodes %s: %s\n", group[0].Icon, len(group), group[0].Summary, strings.Join(names, ", "))
+	return splitMsgs(header, entries), keyboard
+}
+
+func sendOpts(buttons []gotgbot.InlineKeyboardButton, keyboard [][]gotgbot.InlineKeyboardButton) *gotgbot.SendMessageOpts {
+	if len(buttons) > 0 {
+		keyboard = append(keyboard, buttons)
+	}
+	if len(keyboard) == 0 {
+		return &gotgbot.SendMessageOpts{}
+	}
+	return &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}
+}
+
+// RunDigest periodically delivers the held alerts once the quiet hours are over.
+func (r *Route) RunDigest(ctx context.Context, interval time.Duration) {
+	// the settings of the chat may add quiet hours at any time
+	if r.quietHours == nil && r.prefs == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.flushDigest(false); err != nil {
+			slog.Error("error sending digest", "chat", r.chatID, "err", err)
+		}
+	}
+}
+
+// flushDigest delivers the held alerts once the quiet hours are over, or right away if forced.
+func (r *Route) flushDigest(force bool) error {
+	cp := r.prefs.get(r.chatID)
+	if !force && r.quiet(cp).contains(time.Now().In(r.Location())) {
+		return nil
+	}
+	r.Lock()
+	held := r.held
+	r.held = nil
+	r.Unlock()
+	if len(held) == 0 {
+		return nil
+	}
+	for _, msg := range digestMsgs(held, cp.settings.Language) {
+		if _, err := r.sendMessage(msg, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close delivers the alerts still waiting to be grouped and the held alerts, so none are lost on shutdown.
+func (r *Route) Close() error {
+	r.Lock()
+	if r.groupTimer != nil {
+		r.groupTimer.Stop()
+	}
+	r.Unlock()
+	r.flushGroups()
+	return r.flushDigest(true)
+}
+
+// Notice sends a message about insync itself, bypassing quiet hours and grouping.
+func (r *Route) Notice(text string) error {
+	_, err := r.sendMessage(text, nil)
+	return err
+}
+
+// Document sends a file about insync itself, e.g. a report, bypassing quiet hours and grouping.
+func (r *Route) Document(name string, data []byte, caption string) error {
+	start := time.Now()
+	_, err := r.b.SendDocument(r.chatID, gotgbot.NamedFile{File: bytes.NewReader(data), FileName: name}, &gotgbot.SendDocumentOpts{Caption: caption})
+	r.api.observe(time.Since(start), err)
+	r.record(caption, nil, err)
+	return err
+}
+
+// digestMsgs renders the held alerts, the header in the language.
+func digestMsgs(held []heldAlert, lang string) []string {
+	entries := make([]string, len(held))
+	for i, h := range held {
+		entries[i] = fmt.Sprintf("\n[%s]\n%s\n", h.time.Format("15:04"), strings.TrimSpace(h.text))
+	}
+	return splitMsgs(fmt.Sprintf(translate(lang, "🌙 %d alert(s) were held during quiet hours\n"), len(held)), entries)
+}
+
+// splitMsgs joins the header and entries, split into multiple messages if they exceed the telegram message limit.
+func splitMsgs(header string, entries []string) []string {
+	var msgs []string
+	var s strings.Builder
+	s.WriteString(header)
+	for _, entry := range entries {
+		if s.Len()+len(entry) > maxMessageLength && s.Len() > 0 {
+			msgs = append(msgs, s.String())
+			s.Reset()
+		}
+		s.WriteString(entry)
+	}
+	return append(msgs, s.String())
+}
+
+// MustLoadLocation loads the timezone, e.g. Europe/Zurich. It returns nil if s is empty.
+func MustLoadLocation(s string) *time.Location {
+	if s == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func MustParseQuietHours(s string) *QuietHours {
+	if s == "" {
+		return nil
+	}
+	q, err := ParseQuietHours(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// ParseQuietHours parses a time window like 23:00-07:00.
+func ParseQuietHours(s string) (*QuietHours, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid quiet hours %q: expected format HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", s, err)
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", s, err)
+	}
+	return &QuietHours{start: start, end: end}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (q *QuietHours) contains(t time.Time) bool {
+	if q == nil || q.start == q.end {
+		return false
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.start < q.end {
+		return offset >= q.start && offset < q.end
+	}
+	return offset >= q.start || offset < q.end
+}
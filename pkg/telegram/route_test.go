@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours string
+		ok    bool
+		// quiet and loud are times of day inside and outside of the quiet hours
+		quiet, loud []string
+	}{
+		{name: "same day", hours: "12:00-14:00", ok: true, quiet: []string{"12:00", "13:59"}, loud: []string{"11:59", "14:00", "00:00"}},
+		{name: "wraps around midnight", hours: "23:00-07:00", ok: true, quiet: []string{"23:00", "00:00", "06:59"}, loud: []string{"07:00", "12:00", "22:59"}},
+		{name: "spaces around the times", hours: " 22:30 - 06:15 ", ok: true, quiet: []string{"22:30", "06:14"}, loud: []string{"06:15", "22:29"}},
+		{name: "empty window", hours: "08:00-08:00", ok: true, loud: []string{"08:00", "20:00"}},
+		{name: "missing end", hours: "23:00"},
+		{name: "too many parts", hours: "23:00-01:00-07:00"},
+		{name: "invalid time", hours: "25:00-07:00"},
+		{name: "not a time", hours: "night-morning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuietHours(tt.hours)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			for _, clock := range tt.quiet {
+				if !q.contains(at(t, clock)) {
+					t.Errorf("%s isn't within the quiet hours %s", clock, tt.hours)
+				}
+			}
+			for _, clock := range tt.loud {
+				if q.contains(at(t, clock)) {
+					t.Errorf("%s is within the quiet hours %s", clock, tt.hours)
+				}
+			}
+		})
+	}
+}
+
+func TestMustParseQuietHours(t *testing.T) {
+	if q := MustParseQuietHours(""); q != nil || q.contains(time.Now()) {
+		t.Fatalf("got quiet hours %v, want none", q)
+	}
+}
+
+// at returns the time of day on some day.
+func at(t *testing.T, clock string) time.Time {
+	t.Helper()
+	c, err := time.Parse("15:04", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Date(2023, 3, 14, c.Hour(), c.Minute(), 0, 0, time.UTC)
+}
+
+func TestRouteHolds(t *testing.T) {
+	r := NewRoute(nil, 1, MustParseQuietHours("23:00-07:00"), 0, nil, nil)
+	tests := []struct {
+		name  string
+		alert insync.Alert
+		clock string
+		want  bool
+	}{
+		{name: "warning during quiet hours", alert: insync.Alert{Severity: insync.SeverityWarning}, clock: "02:00", want: true},
+		{name: "warning outside of quiet hours", alert: insync.Alert{Severity: insync.SeverityWarning}, clock: "12:00"},
+		{name: "critical during quiet hours", alert: insync.Alert{Severity: insync.SeverityCritical}, clock: "02:00"},
+		{name: "recovery of a page during quiet hours", alert: insync.Alert{Severity: insync.SeverityInfo, Resolved: true}, clock: "02:00"},
+		{name: "info during quiet hours", alert: insync.Alert{Severity: insync.SeverityInfo}, clock: "02:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.holds(chatPrefs{}, tt.alert, at(t, tt.clock)); got != tt.want {
+				t.Fatalf("got held %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
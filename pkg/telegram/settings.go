@@ -0,0 +1,439 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// settingsCallback is the callback data prefix of the buttons of /settings, followed by the setting and its value,
+// e.g. settings:verbosity:critical. The setting menu opens the menu of the setting in the value, the main one if empty.
+const settingsCallback = "settings:"
+
+// quietPresets are the quiet hours offered with buttons, others are set with /settings quiet.
+var quietPresets = []string{"22:00-07:00", "23:00-07:00", "00:00-08:00"}
+
+// Preferences are the settings of the chats, changed with /settings and stored in the history.
+// They apply to the routes of the chats on top of their configuration.
+type Preferences struct {
+	hist  *history.Store
+	mu    sync.Mutex
+	chats map[int64]chatPrefs
+}
+
+// chatPrefs are the parsed settings of a chat, the zero value keeps the configuration of the route.
+type chatPrefs struct {
+	settings  history.ChatSettings
+	verbosity insync.Verbosity
+	// quiet replaces the quiet hours of the route if quietSet, nil disables them.
+	quiet    *QuietHours
+	quietSet bool
+	// nodes are the nodes the chat is subscribed to, all if empty.
+	nodes map[string]bool
+}
+
+// LoadPreferences loads the settings of the chats from the history.
+func LoadPreferences(hist *history.Store) (*Preferences, error) {
+	settings, err := hist.Settings()
+	if err != nil {
+		return nil, err
+	}
+	p := &Preferences{hist: hist, chats: make(map[int64]chatPrefs, len(settings))}
+	for _, cs := range settings {
+		cp, err := newChatPrefs(cs)
+		if err != nil {
+			return nil, fmt.Errorf("settings of chat %d: %w", cs.Chat, err)
+		}
+		p.chats[cs.Chat] = cp
+	}
+	return p, nil
+}
+
+func newChatPrefs(cs history.ChatSettings) (chatPrefs, error) {
+	cp := chatPrefs{settings: cs}
+	if cs.Verbosity != "" {
+		v, ok := insync.ParseVerbosity(cs.Verbosity)
+		if !ok {
+			return cp, fmt.Errorf("invalid verbosity %q", cs.Verbosity)
+		}
+		cp.verbosity = v
+	}
+	if cs.QuietHours != "" {
+		cp.quietSet = true
+		if cs.QuietHours != "off" {
+			q, err := ParseQuietHours(cs.QuietHours)
+			if err != nil {
+				return cp, err
+			}
+			cp.quiet = q
+		}
+	}
+	if len(cs.Nodes) > 0 {
+		cp.nodes = make(map[string]bool, len(cs.Nodes))
+		for _, n := range cs.Nodes {
+			cp.nodes[n] = true
+		}
+	}
+	return cp, nil
+}
+
+// get returns the settings of the chat, p may be nil.
+func (p *Preferences) get(chat int64) chatPrefs {
+	if p == nil {
+		return chatPrefs{settings: history.ChatSettings{Chat: chat}}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cp, ok := p.chats[chat]
+	if !ok {
+		cp.settings.Chat = chat
+	}
+	return cp
+}
+
+// save stores the settings of the chat.
+func (p *Preferences) save(cs history.ChatSettings) error {
+	cp, err := newChatPrefs(cs)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.hist.SaveSettings(cs); err != nil {
+		return err
+	}
+	p.chats[cs.Chat] = cp
+	return nil
+}
+
+// subscribed reports whether the chat receives the alerts of the node, the alerts about insync itself have none.
+func (cp chatPrefs) subscribed(node string) bool {
+	return len(cp.nodes) == 0 || node == "" || cp.nodes[node]
+}
+
+// settings handles /settings, which shows the settings of the chat with buttons to change them.
+// /settings <setting> <value> changes one right away, e.g. /settings quiet 23:00-07:00.
+func (bt *bot) settings(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	if bt.prefs == nil {
+		_, err := msg.Reply(b, "the settings are stored in the history, which is disabled", nil)
+		return err
+	}
+	cs := bt.prefs.get(msg.Chat.Id).settings
+	args := strings.Fields(msg.Text)[1:]
+	switch len(args) {
+	case 0:
+	case 2:
+		if ok, err := isAdmin(b, msg.Chat, ctx.EffectiveUser.Id); err != nil || !ok {
+			if err == nil {
+				_, err = msg.Reply(b, translate(cs.Language, "only the admins of the chat can change the settings"), nil)
+			}
+			return err
+		}
+		if err := bt.changeSetting(&cs, args[0], args[1], userName(*ctx.EffectiveUser)); err != nil {
+			_, err := msg.Reply(b, "❌ "+err.Error(), nil)
+			return err
+		}
+	default:
+		_, err := msg.Reply(b, "usage: /settings [language|verbosity|quiet|nodes <value>], e.g. /settings quiet 23:00-07:00", nil)
+		return err
+	}
+	text, keyboard := bt.settingsMenu(cs, "")
+	_, err := msg.Reply(b, text, &gotgbot.SendMessageOpts{ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard}})
+	return err
+}
+
+// settingsCallback handles the buttons of /settings, only the admins of the chat can change the settings with them.
+func (bt *bot) settingsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	if cq.Message == nil || bt.prefs == nil || !bt.chats[cq.Message.Chat.Id] {
+		_, err := cq.Answer(b, nil)
+		return err
+	}
+	chat := cq.Message.Chat
+	cs := bt.prefs.get(chat.Id).settings
+	setting, value, _ := strings.Cut(strings.TrimPrefix(cq.Data, settingsCallback), ":")
+	menu := value
+	if setting != "menu" {
+		if ok, err := isAdmin(b, chat, cq.From.Id); err != nil || !ok {
+			if err != nil {
+				slog.Error("error checking the permissions", "chat", chat.Id, "err", err)
+			}
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: translate(cs.Language, "only the admins of the chat can change the settings")})
+			return err
+		}
+		if err := bt.changeSetting(&cs, setting, value, userName(cq.From)); err != nil {
+			_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: err.Error()})
+			return err
+		}
+		// the nodes are toggled one by one
+		menu = ""
+		if setting == "node" {
+			menu = "nodes"
+		}
+	}
+	if _, err := cq.Answer(b, nil); err != nil {
+		return err
+	}
+	text, keyboard := bt.settingsMenu(cs, menu)
+	_, err := cq.Message.EditText(b, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard}})
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		// e.g. the same value tapped twice
+		return nil
+	}
+	return err
+}
+
+// changeSetting changes the setting of the chat to the value on behalf of the user and stores it.
+// The errors are shown to the user.
+func (bt *bot) changeSetting(cs *history.ChatSettings, setting, value, user string) error {
+	switch setting {
+	case "language":
+		if _, ok := languages[value]; !ok {
+			return fmt.Errorf("unknown language %q, the languages are %s", value, strings.Join(languageCodes(), ", "))
+		}
+		cs.Language = value
+	case "verbosity":
+		if value == "default" || value == "" {
+			cs.Verbosity = ""
+			break
+		}
+		v, ok := insync.ParseVerbosity(value)
+		if !ok {
+			return fmt.Errorf("unknown verbosity %q, the verbosities are all, warning and critical", value)
+		}
+		cs.Verbosity = v.String()
+	case "quiet":
+		if value == "default" {
+			value = ""
+		} else if value != "" && value != "off" {
+			if _, err := ParseQuietHours(value); err != nil {
+				return err
+			}
+		}
+		cs.QuietHours = value
+	case "nodes":
+		var nodes []string
+		if value != "" && value != insync.AllNodes {
+			for _, n := range strings.Split(value, ",") {
+				if !bt.knownNode(n) {
+					return fmt.Errorf("unknown node %s", n)
+				}
+				nodes = append(nodes, n)
+			}
+		}
+		cs.Nodes = bt.subscription(nodes)
+	case "node":
+		if !bt.knownNode(value) {
+			return fmt.Errorf("unknown node %s", value)
+		}
+		cp, _ := newChatPrefs(*cs)
+		var nodes []string
+		for _, n := range bt.nodes {
+			if subscribed := cp.subscribed(n.Name()); (n.Name() == value) != subscribed {
+				nodes = append(nodes, n.Name())
+			}
+		}
+		if len(nodes) == 0 {
+			return errors.New("the chat has to receive the alerts of a node at least")
+		}
+		cs.Nodes = bt.subscription(nodes)
+	default:
+		return fmt.Errorf("unknown setting %s, the settings are language, verbosity, quiet and nodes", setting)
+	}
+	cs.User, cs.Updated = user, time.Now()
+	if err := bt.prefs.save(*cs); err != nil {
+		slog.Error("error saving the settings", "chat", cs.Chat, "err", err)
+		return errors.New("the settings can't be saved")
+	}
+	slog.Info("chat settings changed", "chat", cs.Chat, "setting", setting, "value", value, "user", user)
+	return nil
+}
+
+func (bt *bot) knownNode(name string) bool {
+	for _, n := range bt.nodes {
+		if n.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription returns the subscribed nodes to store, none if they're all subscribed, so new nodes are as well.
+func (bt *bot) subscription(nodes []string) []string {
+	if len(nodes) >= len(bt.nodes) {
+		return nil
+	}
+	return nodes
+}
+
+// settingsMenu renders the settings of the chat and the buttons of the menu, the main one if menu is empty.
+func (bt *bot) settingsMenu(cs history.ChatSettings, menu string) (string, [][]gotgbot.InlineKeyboardButton) {
+	lang := cs.Language
+	tr := func(msg string) string { return translate(lang, msg) }
+	var s strings.Builder
+	s.WriteString(tr("⚙️ settings of this chat") + "\n")
+	language := languages["en"]
+	if name, ok := languages[lang]; ok {
+		language = name
+	}
+	fmt.Fprintf(&s, "%s: %s\n", tr("language"), language)
+	verbosity := tr("as configured")
+	if v, ok := insync.ParseVerbosity(cs.Verbosity); ok {
+		verbosity = tr(v.String()) + ", " + tr(verbosityDescriptions[v])
+	}
+	fmt.Fprintf(&s, "%s: %s\n", tr("verbosity"), verbosity)
+	quiet := tr("as configured")
+	switch cs.QuietHours {
+	case "":
+	case "off":
+		quiet = tr("none")
+	default:
+		quiet = cs.QuietHours
+	}
+	fmt.Fprintf(&s, "%s: %s\n", tr("quiet hours"), quiet)
+	nodes := tr("all")
+	if len(cs.Nodes) > 0 {
+		nodes = strings.Join(cs.Nodes, ", ")
+	}
+	fmt.Fprintf(&s, "%s: %s", tr("nodes"), nodes)
+
+	back := []gotgbot.InlineKeyboardButton{{Text: tr("Back"), CallbackData: settingsCallback + "menu:"}}
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	switch menu {
+	case "language":
+		s.WriteString("\n\n" + tr("Choose the language of the messages of the bot, the alerts are in english."))
+		var row []gotgbot.InlineKeyboardButton
+		for _, code := range languageCodes() {
+			row = append(row, gotgbot.InlineKeyboardButton{Text: languages[code], CallbackData: settingsCallback + "language:" + code})
+		}
+		keyboard = append(keyboard, row)
+	case "verbosity":
+		s.WriteString("\n\n" + tr("Choose the alerts this chat receives."))
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{Text: tr("As configured"), CallbackData: settingsCallback + "verbosity:"}})
+		for _, v := range []insync.Verbosity{insync.VerbosityAll, insync.VerbosityWarning, insync.VerbosityCritical} {
+			keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+				{Text: tr(v.String()) + ": " + tr(verbosityDescriptions[v]), CallbackData: settingsCallback + "verbosity:" + v.String()},
+			})
+		}
+	case "quiet":
+		s.WriteString("\n\n" + tr("Choose the quiet hours, the alerts which aren't critical are held back until they're over. Others are set with /settings quiet HH:MM-HH:MM."))
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: tr("As configured"), CallbackData: settingsCallback + "quiet:"},
+			{Text: tr("Off"), CallbackData: settingsCallback + "quiet:off"},
+		})
+		var row []gotgbot.InlineKeyboardButton
+		for _, q := range quietPresets {
+			row = append(row, gotgbot.InlineKeyboardButton{Text: q, CallbackData: settingsCallback + "quiet:" + q})
+		}
+		keyboard = append(keyboard, row)
+	case "nodes":
+		s.WriteString("\n\n" + tr("Tap the nodes to receive their alerts or not."))
+		cp, _ := newChatPrefs(cs)
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{Text: tr("All nodes"), CallbackData: settingsCallback + "nodes:"}})
+		var row []gotgbot.InlineKeyboardButton
+		for _, n := range bt.nodes {
+			icon := "▫️ "
+			if cp.subscribed(n.Name()) {
+				icon = "✅ "
+			}
+			row = append(row, gotgbot.InlineKeyboardButton{Text: icon + n.Name(), CallbackData: settingsCallback + "node:" + n.Name()})
+			if len(row) == 2 {
+				keyboard = append(keyboard, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			keyboard = append(keyboard, row)
+		}
+	default:
+		return s.String(), [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "🌐 " + tr("Language"), CallbackData: settingsCallback + "menu:language"},
+				{Text: "📣 " + tr("Verbosity"), CallbackData: settingsCallback + "menu:verbosity"},
+			},
+			{
+				{Text: "🌙 " + tr("Quiet hours"), CallbackData: settingsCallback + "menu:quiet"},
+				{Text: "🖥 " + tr("Nodes"), CallbackData: settingsCallback + "menu:nodes"},
+			},
+		}
+	}
+	return s.String(), append(keyboard, back)
+}
+
+// verbosityDescriptions describe the alerts delivered at the verbosities.
+var verbosityDescriptions = map[insync.Verbosity]string{
+	insync.VerbosityAll:      "every alert, including the progress",
+	insync.VerbosityWarning:  "warnings, critical alerts and recoveries",
+	insync.VerbosityCritical: "critical alerts and recoveries",
+}
+
+// languages are the languages of the messages of the bot, by code.
+var languages = map[string]string{
+	"en": "English",
+	"de": "Deutsch",
+}
+
+// translations are the messages of the bot in the languages other than english, by the english message.
+var translations = map[string]map[string]string{
+	"de": {
+		"⚙️ settings of this chat":            "⚙️ Einstellungen dieses Chats",
+		"language":                            "Sprache",
+		"verbosity":                           "Ausführlichkeit",
+		"quiet hours":                         "Ruhezeit",
+		"nodes":                               "Nodes",
+		"all":                                 "alle",
+		"warning":                             "Warnung",
+		"critical":                            "kritisch",
+		"as configured":                       "wie konfiguriert",
+		"none":                                "keine",
+		"every alert, including the progress": "jeder Alarm, inklusive Fortschritt",
+		"warnings, critical alerts and recoveries": "Warnungen, kritische Alarme und Entwarnungen",
+		"critical alerts and recoveries":           "kritische Alarme und Entwarnungen",
+		"Language":                                 "Sprache",
+		"Verbosity":                                "Ausführlichkeit",
+		"Quiet hours":                              "Ruhezeit",
+		"Nodes":                                    "Nodes",
+		"Back":                                     "Zurück",
+		"All nodes":                                "Alle Nodes",
+		"As configured":                            "Wie konfiguriert",
+		"Off":                                      "Aus",
+		"Choose the language of the messages of the bot, the alerts are in english.": "Wähle die Sprache der Nachrichten des Bots, die Alarme sind auf Englisch.",
+		"Choose the alerts this chat receives.":                                      "Wähle die Alarme, die dieser Chat erhält.",
+		"Choose the quiet hours, the alerts which aren't critical are held back until they're over. Others are set with /settings quiet HH:MM-HH:MM.": "Wähle die Ruhezeit, die nicht kritischen Alarme werden bis zu ihrem Ende zurückgehalten. Andere setzt /settings quiet HH:MM-HH:MM.",
+		"Tap the nodes to receive their alerts or not.":       "Tippe auf die Nodes, um ihre Alarme zu erhalten oder nicht.",
+		"only the admins of the chat can change the settings": "nur die Admins des Chats können die Einstellungen ändern",
+		"🌙 %d alert(s) were held during quiet hours\n":        "🌙 %d Alarm(e) wurden während der Ruhezeit zurückgehalten\n",
+	},
+}
+
+// translate returns the message in the language, the english one if it isn't translated.
+func translate(lang, msg string) string {
+	if t, ok := translations[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// languageCodes returns the codes of the languages, sorted.
+func languageCodes() []string {
+	codes := make([]string, 0, len(languages))
+	for code := range languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
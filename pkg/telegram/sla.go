@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// defaultSLAWindows are the windows of /sla without argument.
+var defaultSLAWindows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// sla handles /sla [window], which reports the uptime of the nodes, e.g. /sla 7d.
+func (bt *bot) sla(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	if bt.history == nil {
+		_, err := msg.Reply(b, "the history is disabled, uptime can't be reported", nil)
+		return err
+	}
+	windows := defaultSLAWindows
+	if args := strings.Fields(msg.Text)[1:]; len(args) > 0 {
+		d, err := ParseWindow(args[0])
+		if err != nil {
+			_, err := msg.Reply(b, fmt.Sprintf("invalid window %q", args[0]), nil)
+			return err
+		}
+		windows = []time.Duration{d}
+	}
+	var s strings.Builder
+	for i, w := range windows {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		text, err := SLAReport(bt.history, bt.nodes, w)
+		if err != nil {
+			return err
+		}
+		s.WriteString(text)
+	}
+	_, err := msg.Reply(b, s.String(), nil)
+	return err
+}
+
+// SLAReport renders the uptime of the nodes during the last window.
+func SLAReport(h *history.Store, nodes []*insync.Node, window time.Duration) (string, error) {
+	to := time.Now()
+	from := to.Add(-window)
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("📈 Uptime of the last %s\n", insync.FormatDuration(window)))
+	for _, n := range nodes {
+		sla, err := h.SLA(n.Name(), from, to)
+		if err != nil {
+			return "", err
+		}
+		s.WriteString(fmt.Sprintf("%s %.3f%%", n.Name(), sla.Uptime))
+		if sla.Incidents > 0 {
+			s.WriteString(fmt.Sprintf(", %d incident(s), longest outage %s", sla.Incidents, insync.FormatDuration(sla.LongestOutage)))
+		}
+		if sla.MTTR > 0 {
+			s.WriteString(", MTTR " + insync.FormatDuration(sla.MTTR))
+		}
+		s.WriteString("\n")
+	}
+	return s.String(), nil
+}
+
+// ParseWindow parses a duration which may also be given in days, e.g. 7d or 36h.
+func ParseWindow(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return d, nil
+}
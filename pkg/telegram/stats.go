@@ -0,0 +1,108 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// latencySmoothing is the weight of the latest call in the moving average of the api latency.
+const latencySmoothing = 0.2
+
+// apiStats tracks the calls to the telegram api, including those made in the background, e.g. for grouped alerts.
+type apiStats struct {
+	mu          sync.Mutex
+	calls       int64
+	consecutive int
+	latency     time.Duration
+}
+
+func (s *apiStats) observe(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == 0 {
+		s.latency = latency
+	} else {
+		s.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(s.latency))
+	}
+	s.calls++
+	if err != nil {
+		s.consecutive++
+		return
+	}
+	s.consecutive = 0
+}
+
+// sendMessage sends a message to the chat of the route and tracks the result. The alerts are those rendered in the message.
+func (r *Route) sendMessage(text string, opts *gotgbot.SendMessageOpts, alerts ...insync.Alert) (*gotgbot.Message, error) {
+	start := time.Now()
+	msg, err := r.b.SendMessage(r.chatID, text, opts)
+	r.api.observe(time.Since(start), err)
+	r.record(text, alerts, err)
+	return msg, err
+}
+
+// editMessage replaces the text of a message of the chat and tracks the result like sendMessage.
+func (r *Route) editMessage(id int64, text string, alerts ...insync.Alert) error {
+	start := time.Now()
+	_, err := r.b.EditMessageText(text, &gotgbot.EditMessageTextOpts{ChatId: r.chatID, MessageId: id})
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		err = nil
+	}
+	r.api.observe(time.Since(start), err)
+	r.record(text, alerts, err)
+	return err
+}
+
+// SetAuditor records every message sent to the chat, including digests and notices, as notification of the route.
+// It must be called before the route is used.
+func (r *Route) SetAuditor(rec insync.NotificationRecorder, route string) {
+	r.audit, r.name = rec, route
+}
+
+func (r *Route) record(text string, alerts []insync.Alert, err error) {
+	if r.audit == nil {
+		return
+	}
+	rec := insync.NotificationRecord{Time: time.Now(), Route: r.name, Target: strconv.FormatInt(r.chatID, 10), Text: text}
+	nodes := make([]string, len(alerts))
+	names := make([]string, 0, len(alerts))
+	for i, a := range alerts {
+		nodes[i] = a.Node
+		if len(names) == 0 || names[len(names)-1] != a.Name {
+			names = append(names, a.Name)
+		}
+	}
+	rec.Node, rec.Alert = strings.Join(nodes, ","), strings.Join(names, ",")
+	if err != nil {
+		rec.Error = redact.Error(err)
+	}
+	r.audit.RecordNotification(rec)
+}
+
+// QueueDepth returns the number of alerts waiting to be grouped or held during quiet hours.
+func (r *Route) QueueDepth() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.pending) + len(r.held)
+}
+
+// ConsecutiveFailures returns the number of failed telegram api calls since the last successful one.
+func (r *Route) ConsecutiveFailures() int {
+	r.api.mu.Lock()
+	defer r.api.mu.Unlock()
+	return r.api.consecutive
+}
+
+// APILatency returns the moving average of the telegram api latency.
+func (r *Route) APILatency() time.Duration {
+	r.api.mu.Lock()
+	defer r.api.mu.Unlock()
+	return r.api.latency
+}
@@ -0,0 +1,226 @@
+package telegram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// report handles /report [node] [window], which sends the daily summary for any window right away, by default that of
+// all nodes during the last day, e.g. /report node-1 7d.
+func (bt *bot) report(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !bt.chats[msg.Chat.Id] {
+		return nil
+	}
+	if bt.history == nil {
+		_, err := msg.Reply(b, "the history is disabled, no report can be generated", nil)
+		return err
+	}
+	nodes, window := bt.nodes, 24*time.Hour
+	for _, arg := range strings.Fields(msg.Text)[1:] {
+		if n := bt.node(arg); n != nil {
+			nodes = []*insync.Node{n}
+			continue
+		}
+		d, err := ParseWindow(arg)
+		if err != nil {
+			_, err := msg.Reply(b, "usage: /report [node] [window], e.g. /report node-1 7d", nil)
+			return err
+		}
+		window = d
+	}
+	msgs, err := DailySummary(bt.history, nodes, bt.reference, window)
+	if err != nil {
+		return err
+	}
+	for _, text := range msgs {
+		if _, err := msg.Reply(b, text, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// node returns the node with the name, nil if there is none.
+func (bt *bot) node(name string) *insync.Node {
+	for _, n := range bt.nodes {
+		if n.Name() == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// growthWindow is the window the growth of the disk usage is computed over, regardless of that of the report.
+const growthWindow = 7 * 24 * time.Hour
+
+// DailySummary renders the summary of every node during the last window, split into multiple messages if needed.
+// It's posted even if nothing happened, so a quiet day confirms the bot is alive. It ends with the fee trends of the
+// chains, if the fees are checked, and the current head blocks of the nodes compared to the reference, which may be nil.
+func DailySummary(h *history.Store, nodes []*insync.Node, ref *insync.Node, window time.Duration) ([]string, error) {
+	to := time.Now()
+	from := to.Add(-window)
+	entries := make([]string, len(nodes))
+	for i, n := range nodes {
+		sum, err := h.Summary(n.Name(), from, to)
+		if err != nil {
+			return nil, err
+		}
+		growth, err := h.DiskGrowth(n.Name(), to.Add(-growthWindow), to)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = summaryEntry(n.Name(), sum, growth)
+	}
+	fees, err := feeTrends(h, nodes, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if fees != "" {
+		entries = append(entries, "\n"+fees)
+	}
+	entries = append(entries, "\n"+HeadTable(nodes, ref))
+	return splitMsgs(fmt.Sprintf("📋 Summary of the last %s\n", insync.FormatDuration(window)), entries), nil
+}
+
+// summaryEntry renders the summary of a node, leaving out the checks which didn't run.
+func summaryEntry(node string, sum history.Summary, growth history.Growth) string {
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("\n%s\nuptime %.3f%%, %d incident(s)\n", node, sum.Uptime, sum.Incidents))
+	if sum.LatencyP50 > 0 {
+		s.WriteString(fmt.Sprintf("average lag %.1f blocks\n", sum.Lag))
+		s.WriteString(fmt.Sprintf("rpc latency p50 %s, p90 %s, p99 %s\n",
+			sum.LatencyP50.Round(time.Millisecond), sum.LatencyP90.Round(time.Millisecond), sum.LatencyP99.Round(time.Millisecond)))
+	}
+	if sum.Peers {
+		s.WriteString(fmt.Sprintf("peers %d to %d\n", sum.MinPeers, sum.MaxPeers))
+	}
+	if sum.Disk {
+		s.WriteString(fmt.Sprintf("disk %.1f%% used (%+.1f%%)", sum.DiskTo, sum.DiskTo-sum.DiskFrom))
+		if growth.OK {
+			s.WriteString(", " + growthText(growth))
+		}
+		s.WriteString("\n")
+	}
+	if sum.BlobChecks > 0 {
+		s.WriteString(fmt.Sprintf("%.1f blobs per block, %d failed data availability check(s)\n", sum.Blobs, sum.Unavailable))
+	}
+	return s.String()
+}
+
+// feeTrends renders the range of the base and priority fees per chain, empty if no fees were recorded.
+func feeTrends(h *history.Store, nodes []*insync.Node, from, to time.Time) (string, error) {
+	var chains []string
+	byChain := make(map[string][]string)
+	for _, n := range nodes {
+		chain := n.Status().Chain
+		if _, ok := byChain[chain]; !ok {
+			chains = append(chains, chain)
+		}
+		byChain[chain] = append(byChain[chain], n.Name())
+	}
+	sort.Strings(chains)
+
+	var s strings.Builder
+	for _, chain := range chains {
+		fees, err := h.Fees(byChain[chain], from, to)
+		if err != nil {
+			return "", err
+		}
+		if fees.BaseFee.Samples == 0 {
+			continue
+		}
+		if len(chains) > 1 {
+			name := chain
+			if name == "" {
+				name = "unknown chain"
+			}
+			s.WriteString(name + "\n")
+		}
+		s.WriteString("base fee " + feeRange(fees.BaseFee) + "\n")
+		if fees.PriorityFee.Samples > 0 {
+			s.WriteString("priority fee " + feeRange(fees.PriorityFee) + "\n")
+		}
+	}
+	if s.Len() == 0 {
+		return "", nil
+	}
+	return "⛽ Fees in gwei, min / avg / max\n" + s.String(), nil
+}
+
+func feeRange(r history.FeeRange) string {
+	return fmt.Sprintf("%.2f / %.2f / %.2f", r.Min, r.Avg, r.Max)
+}
+
+// FleetDigest renders the comparison of all nodes during the last window, the least available nodes first. Nodes with
+// the disk check also show the growth of their disk usage during the last week.
+func FleetDigest(h *history.Store, nodes []*insync.Node, window time.Duration) ([]string, error) {
+	to := time.Now()
+	from := to.Add(-window)
+	sums := make([]history.Summary, len(nodes))
+	var uptime float64
+	var incidents int
+	var worst history.Summary
+	for i, n := range nodes {
+		sum, err := h.Summary(n.Name(), from, to)
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = sum
+		uptime += sum.Uptime
+		incidents += sum.Incidents
+		if sum.MaxLag > worst.MaxLag {
+			worst = sum
+		}
+	}
+	sort.SliceStable(sums, func(i, j int) bool {
+		if sums[i].Uptime != sums[j].Uptime {
+			return sums[i].Uptime < sums[j].Uptime
+		}
+		return sums[i].Incidents > sums[j].Incidents
+	})
+
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("🗓 Fleet health of the last %s\n", insync.FormatDuration(window)))
+	if len(nodes) > 0 {
+		header.WriteString(fmt.Sprintf("%d node(s), average uptime %.3f%%, %d incident(s)", len(nodes), uptime/float64(len(nodes)), incidents))
+		if worst.MaxLag > 0 {
+			header.WriteString(fmt.Sprintf(", worst lag %s blocks on %s", insync.FormatNumber(worst.MaxLag), worst.Node))
+		}
+		header.WriteString("\n")
+	}
+	entries := make([]string, len(sums))
+	for i, sum := range sums {
+		entries[i] = fmt.Sprintf("\n%s %.3f%%, %d incident(s), worst lag %s blocks", sum.Node, sum.Uptime, sum.Incidents, insync.FormatNumber(sum.MaxLag))
+		growth, err := h.DiskGrowth(sum.Node, to.Add(-growthWindow), to)
+		if err != nil {
+			return nil, err
+		}
+		if growth.OK {
+			entries[i] += fmt.Sprintf(", disk %.1f%% %s", growth.Usage, growthText(growth))
+		}
+	}
+	return splitMsgs(header.String(), entries), nil
+}
+
+// growthText renders the weekly growth of the disk usage and when the disk is projected to be full, e.g.
+// +1.4% per week, full in ~140 days.
+func growthText(g history.Growth) string {
+	s := fmt.Sprintf("%+.1f%% per week", g.PerWeek)
+	switch days := int(g.Full.Hours() / 24); {
+	case g.Full == 0:
+	case days < 2:
+		s += ", full in ~" + insync.FormatDuration(g.Full)
+	default:
+		s += fmt.Sprintf(", full in ~%d days", days)
+	}
+	return s
+}
@@ -0,0 +1,144 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// Tenants manages the nodes registered by the chats with /setup, nil if the multi-tenant mode is disabled.
+// The errors of its methods are shown to the users.
+type Tenants interface {
+	// Tenant returns the tenant of the chat, false if it didn't register anything.
+	Tenant(chat int64) (insync.Tenant, bool)
+	// Nodes returns the nodes of the chat.
+	Nodes(chat int64) []*insync.Node
+	// Probe connects to the node at the url once, it returns an error if it can't be registered or reached.
+	Probe(url string) (insync.NodeStatus, error)
+	// Register registers the node of the chat, the chain it's expected on is detected if empty.
+	Register(chat int64, user, name, url, chain string) error
+	Unregister(chat int64, name string) error
+	// SetQuietHours sets the quiet hours of the chat, none if empty.
+	SetQuietHours(chat int64, hours string) error
+}
+
+const setupUsage = `usage:
+/setup new walks you through registering a node
+/setup add <name> <url> [chain] registers a node of this chat
+/setup remove <name> removes it
+/setup quiet <HH:MM-HH:MM|off> holds the alerts back during the quiet hours`
+
+// setup handles /setup, which lets the admins of chats other than the configured ones register their own nodes.
+// Without arguments, a chat without nodes is walked through the registration of its first one.
+func (bt *bot) setup(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if bt.tenants == nil || bt.chats[msg.Chat.Id] || ctx.EffectiveUser == nil {
+		return nil
+	}
+	if ok, err := isAdmin(b, msg.Chat, ctx.EffectiveUser.Id); err != nil || !ok {
+		if err == nil {
+			_, err = msg.Reply(b, "only the admins of the chat can change the setup", nil)
+		}
+		return err
+	}
+	args := strings.Fields(msg.Text)[1:]
+	chat, user := msg.Chat.Id, userName(*ctx.EffectiveUser)
+	var text string
+	var err error
+	switch {
+	case len(args) == 0 && len(bt.tenants.Nodes(chat)) == 0, len(args) == 1 && args[0] == "new":
+		return bt.startWizard(b, msg, *ctx.EffectiveUser)
+	case len(args) == 1 && args[0] == "cancel":
+		text = "there is no setup to cancel"
+		if bt.endWizard(chat, ctx.EffectiveUser.Id) {
+			text = "🧙 setup cancelled"
+		}
+	case len(args) == 0:
+		text = tenantMsg(bt.tenants, chat)
+	case args[0] == "add" && (len(args) == 3 || len(args) == 4):
+		var chain string
+		if len(args) == 4 {
+			chain = strings.ToLower(args[3])
+		}
+		if err = bt.tenants.Register(chat, user, args[1], args[2], chain); err == nil {
+			text = fmt.Sprintf("✅ %s added %s, the first check runs in a few seconds", user, args[1])
+			slog.Info("tenant node added", "chat", chat, "node", args[1], "user", user)
+		}
+	case args[0] == "remove" && len(args) == 2:
+		if err = bt.tenants.Unregister(chat, args[1]); err == nil {
+			text = fmt.Sprintf("🗑 %s removed %s", user, args[1])
+			slog.Info("tenant node removed", "chat", chat, "node", args[1], "user", user)
+		}
+	case args[0] == "quiet" && len(args) == 2:
+		hours := args[1]
+		if hours == "off" {
+			hours = ""
+		}
+		if err = bt.tenants.SetQuietHours(chat, hours); err == nil {
+			text = "🌙 quiet hours disabled"
+			if hours != "" {
+				text = "🌙 quiet hours set to " + hours
+			}
+		}
+	default:
+		text = setupUsage
+	}
+	if err != nil {
+		text = "❌ " + redact.Error(err)
+	}
+	_, err = msg.Reply(b, text, nil)
+	return err
+}
+
+// isAdmin reports whether the user may change the setup of the chat, everyone may in private chats.
+func isAdmin(b *gotgbot.Bot, chat gotgbot.Chat, user int64) (bool, error) {
+	if chat.Type == "private" {
+		return true, nil
+	}
+	m, err := b.GetChatMember(chat.Id, user)
+	if err != nil {
+		return false, err
+	}
+	status := m.GetStatus()
+	return status == "creator" || status == "administrator", nil
+}
+
+// tenantMsg describes the nodes and preferences of the chat.
+func tenantMsg(tenants Tenants, chat int64) string {
+	t, ok := tenants.Tenant(chat)
+	if !ok {
+		return "this chat didn't register any node yet\n\n" + setupUsage
+	}
+	var s strings.Builder
+	s.WriteString("🛠 nodes of this chat\n")
+	nodes := tenants.Nodes(chat)
+	for _, tn := range t.Nodes {
+		status := "not checked yet"
+		for _, n := range nodes {
+			if n.Name() != tn.Name {
+				continue
+			}
+			if err := n.LastError(); err != nil {
+				status = "unreachable"
+			} else if n.Checked() {
+				status = n.Status().State.String()
+			}
+		}
+		host := insync.NodeName(tn.URL)
+		if tn.Chain != "" {
+			host += " on " + tn.Chain
+		}
+		fmt.Fprintf(&s, "- %s (%s), added by %s: %s\n", tn.Name, host, tn.User, status)
+	}
+	if t.QuietHours != "" {
+		fmt.Fprintf(&s, "quiet hours: %s\n", t.QuietHours)
+	}
+	s.WriteString("\n" + setupUsage)
+	return s.String()
+}
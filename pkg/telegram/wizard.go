@@ -0,0 +1,261 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+// setupCallback is the callback data prefix of the buttons of the setup wizard, followed by the kind of the answer
+// and the answer, e.g. setup:chain:mainnet.
+const setupCallback = "setup:"
+
+// wizardTimeout is the time the setup wizard waits for an answer before it's abandoned.
+const wizardTimeout = 10 * time.Minute
+
+// The steps of the setup wizard, in order.
+const (
+	wizardURL = iota
+	wizardChain
+	wizardName
+	wizardQuiet
+	wizardConfirm
+)
+
+// wizard is the conversation registering a node of a chat step by step, with the user who started it.
+type wizard struct {
+	// mu serializes the answers.
+	mu   sync.Mutex
+	step int
+	// detected is the chain the node is on, chain the chain the user expects.
+	url, detected, chain, name string
+	quiet                      string
+	// last is the time of the last answer, guarded by the wizardMu of the bot.
+	last time.Time
+}
+
+// wizardKey identifies the wizard of a user in a chat.
+type wizardKey struct {
+	chat, user int64
+}
+
+// startWizard starts the setup wizard of the user in the chat of the message, replacing the one running.
+func (bt *bot) startWizard(b *gotgbot.Bot, msg *gotgbot.Message, user gotgbot.User) error {
+	w := &wizard{step: wizardURL, last: time.Now()}
+	if t, ok := bt.tenants.Tenant(msg.Chat.Id); ok {
+		w.quiet = t.QuietHours
+	}
+	bt.wizardMu.Lock()
+	bt.wizards[wizardKey{msg.Chat.Id, user.Id}] = w
+	bt.wizardMu.Unlock()
+	slog.Info("setup wizard started", "chat", msg.Chat.Id, "user", userName(user))
+	return bt.ask(b, msg, "🧙 Let's register your node, "+userName(user)+".\n"+
+		"Reply with the rpc url of your node, e.g. https://rpc.example.com or wss://rpc.example.com. "+
+		"Only public endpoints are supported. /setup cancel stops the setup.", nil)
+}
+
+// wizardOf returns the running wizard of the user in the chat, nil if there is none or it was abandoned.
+func (bt *bot) wizardOf(chat, user int64) *wizard {
+	bt.wizardMu.Lock()
+	defer bt.wizardMu.Unlock()
+	k := wizardKey{chat, user}
+	w := bt.wizards[k]
+	if w != nil && time.Since(w.last) > wizardTimeout {
+		delete(bt.wizards, k)
+		return nil
+	}
+	return w
+}
+
+// endWizard ends the wizard of the user in the chat, false if there is none.
+func (bt *bot) endWizard(chat, user int64) bool {
+	bt.wizardMu.Lock()
+	defer bt.wizardMu.Unlock()
+	k := wizardKey{chat, user}
+	_, ok := bt.wizards[k]
+	delete(bt.wizards, k)
+	return ok
+}
+
+// wizardAnswer matches the text messages answering a running wizard.
+func (bt *bot) wizardAnswer(msg *gotgbot.Message) bool {
+	if bt.tenants == nil || msg.From == nil || msg.Text == "" || strings.HasPrefix(msg.Text, "/") {
+		return false
+	}
+	return bt.wizardOf(msg.Chat.Id, msg.From.Id) != nil
+}
+
+// wizardReply handles the text answers of the wizard.
+func (bt *bot) wizardReply(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	w := bt.wizardOf(msg.Chat.Id, msg.From.Id)
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if bt.wizardOf(msg.Chat.Id, msg.From.Id) != w {
+		// ended while waiting for the previous answer
+		return nil
+	}
+	if w.step == wizardConfirm {
+		// only the button adds the node
+		return bt.ask(b, msg, wizardSummary(w), []gotgbot.InlineKeyboardButton{{Text: "✅ Add node", CallbackData: setupCallback + "confirm:"}})
+	}
+	return bt.answer(b, msg, *msg.From, w, strings.TrimSpace(msg.Text))
+}
+
+// wizardCallback handles the buttons of the wizard, only the user who started it can tap them.
+func (bt *bot) wizardCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	if cq.Message == nil || bt.tenants == nil {
+		_, err := cq.Answer(b, nil)
+		return err
+	}
+	w := bt.wizardOf(cq.Message.Chat.Id, cq.From.Id)
+	kind, value, _ := strings.Cut(strings.TrimPrefix(cq.Data, setupCallback), ":")
+	var step int
+	switch kind {
+	case "chain":
+		step = wizardChain
+	case "quiet":
+		step = wizardQuiet
+	case "confirm":
+		step = wizardConfirm
+	case "cancel":
+		step = -1
+	}
+	if w != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+	if w == nil || bt.wizardOf(cq.Message.Chat.Id, cq.From.Id) != w || (step >= 0 && step != w.step) {
+		_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "this setup is over, or someone else started it"})
+		return err
+	}
+	if _, err := cq.Answer(b, nil); err != nil {
+		return err
+	}
+	// the buttons are answered once
+	if _, err := cq.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{}},
+	}); err != nil {
+		slog.Warn("error removing the buttons of the setup", "chat", cq.Message.Chat.Id, "err", err)
+	}
+	if step < 0 {
+		bt.endWizard(cq.Message.Chat.Id, cq.From.Id)
+		_, err := b.SendMessage(cq.Message.Chat.Id, "🧙 setup cancelled", nil)
+		return err
+	}
+	return bt.answer(b, cq.Message, cq.From, w, value)
+}
+
+// answer takes the answer of the user to the current step of the wizard and asks the next question. msg is the
+// message the next question replies to. w.mu must be held.
+func (bt *bot) answer(b *gotgbot.Bot, msg *gotgbot.Message, user gotgbot.User, w *wizard, answer string) error {
+	chat := msg.Chat.Id
+	bt.wizardMu.Lock()
+	w.last = time.Now()
+	bt.wizardMu.Unlock()
+	switch w.step {
+	case wizardURL:
+		// the url may contain an api key, the message is removed if the bot may
+		if msg.From != nil && msg.From.Id == user.Id {
+			if _, err := msg.Delete(b); err != nil {
+				slog.Debug("error deleting the url of the setup", "chat", chat, "err", err)
+			}
+		}
+		status, err := bt.tenants.Probe(answer)
+		if err != nil {
+			return bt.ask(b, msg, fmt.Sprintf("❌ %s can't be registered: %s\nReply with another url.", insync.NodeName(answer), redact.Error(err)), nil)
+		}
+		w.url, w.detected, w.step = answer, status.Chain, wizardChain
+		text := fmt.Sprintf("✅ %s is reachable", insync.NodeName(answer))
+		if status.Client != "" {
+			text += ", it's " + status.Client
+		}
+		if status.Chain == "" {
+			// the expected chain is taken as it is
+			text += fmt.Sprintf(", %s at block %s. Its chain can't be detected.\n", status.State, insync.FormatNumber(status.CurrentBlock))
+			return bt.ask(b, msg, text+"Which chain do you expect the node on? Reply with its name, e.g. mainnet or sepolia.", nil)
+		}
+		text += fmt.Sprintf(" on %s, %s at block %s.\n", status.Chain, status.State, insync.FormatNumber(status.CurrentBlock))
+		return bt.ask(b, msg, text+"Which chain do you expect the node on? Tap the chain or reply with its name, e.g. mainnet or sepolia.",
+			[]gotgbot.InlineKeyboardButton{{Text: "✅ " + status.Chain, CallbackData: setupCallback + "chain:" + status.Chain}})
+	case wizardChain:
+		chain := strings.ToLower(answer)
+		if w.detected != "" && chain != w.detected {
+			return bt.ask(b, msg, fmt.Sprintf("❌ the node is on %s, not on %s. Check the url and start over with /setup new, or reply with %s.",
+				w.detected, chain, w.detected), nil)
+		}
+		w.chain, w.step = chain, wizardName
+		return bt.ask(b, msg, "How should the node be called in the alerts? Reply with a name of letters, digits, dots, dashes and underscores, e.g. my-node.", nil)
+	case wizardName:
+		w.name, w.step = answer, wizardQuiet
+		var buttons []gotgbot.InlineKeyboardButton
+		if w.quiet != "" {
+			buttons = append(buttons, gotgbot.InlineKeyboardButton{Text: "Keep " + w.quiet, CallbackData: setupCallback + "quiet:" + w.quiet})
+		}
+		buttons = append(buttons, gotgbot.InlineKeyboardButton{Text: "No quiet hours", CallbackData: setupCallback + "quiet:off"})
+		return bt.ask(b, msg, "Should the alerts of this chat be held back at night? Reply with the quiet hours, e.g. 23:00-07:00, or tap a button.", buttons)
+	case wizardQuiet:
+		quiet := answer
+		if quiet == "off" {
+			quiet = ""
+		} else if _, err := ParseQuietHours(quiet); err != nil {
+			return bt.ask(b, msg, "❌ "+err.Error()+"\nReply with the quiet hours, e.g. 23:00-07:00, or off.", nil)
+		}
+		w.quiet, w.step = quiet, wizardConfirm
+		return bt.ask(b, msg, wizardSummary(w), []gotgbot.InlineKeyboardButton{{Text: "✅ Add node", CallbackData: setupCallback + "confirm:"}})
+	case wizardConfirm:
+		name := userName(user)
+		if err := bt.tenants.Register(chat, name, w.name, w.url, w.chain); err != nil {
+			w.step = wizardName
+			return bt.ask(b, msg, "❌ "+redact.Error(err)+"\nReply with another name, or stop with /setup cancel.", nil)
+		}
+		slog.Info("tenant node added", "chat", chat, "node", w.name, "user", name)
+		bt.endWizard(chat, user.Id)
+		text := fmt.Sprintf("✅ %s added %s, the first check runs in a few seconds. /setup lists the nodes of this chat.", name, w.name)
+		if t, _ := bt.tenants.Tenant(chat); t.QuietHours != w.quiet {
+			if err := bt.tenants.SetQuietHours(chat, w.quiet); err != nil {
+				text += "\n❌ the quiet hours weren't saved: " + redact.Error(err)
+			}
+		}
+		_, err := b.SendMessage(chat, text, nil)
+		return err
+	}
+	return nil
+}
+
+// wizardSummary describes the node the wizard is about to register.
+func wizardSummary(w *wizard) string {
+	quiet := "none"
+	if w.quiet != "" {
+		quiet = w.quiet
+	}
+	return fmt.Sprintf("🧙 Ready to add the node\nname: %s\nurl: %s\nchain: %s\nquiet hours: %s", w.name, insync.NodeName(w.url), w.chain, quiet)
+}
+
+// ask sends the next question of the wizard in reply to the message. Without buttons, the reply to the question is
+// forced, so the bot receives it in groups as well, only from the user if the message is theirs. There's always a
+// button to cancel otherwise.
+func (bt *bot) ask(b *gotgbot.Bot, msg *gotgbot.Message, text string, buttons []gotgbot.InlineKeyboardButton) error {
+	opts := &gotgbot.SendMessageOpts{ReplyToMessageId: msg.MessageId, AllowSendingWithoutReply: true}
+	if len(buttons) == 0 {
+		opts.ReplyMarkup = gotgbot.ForceReply{ForceReply: true, Selective: msg.From != nil && !msg.From.IsBot}
+	} else {
+		opts.ReplyMarkup = gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			buttons, {{Text: "Cancel", CallbackData: setupCallback + "cancel:"}},
+		}}
+	}
+	_, err := b.SendMessage(msg.Chat.Id, text, opts)
+	return err
+}
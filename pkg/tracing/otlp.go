@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/redact"
+)
+
+const (
+	// batchSize is the maximum number of spans per export request.
+	batchSize = 512
+	// batchInterval is the time the spans are collected before they are exported.
+	batchInterval = 5 * time.Second
+	// queueSize is the number of ended spans waiting for the export, more spans are dropped.
+	queueSize = 4096
+)
+
+// Config configures the otlp exporter, tracing is disabled if the endpoint is empty.
+type Config struct {
+	// Endpoint is the base url of the otlp http receiver, e.g. http://localhost:4318.
+	// The spans are posted to /v1/traces.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are added to the export requests, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+	// ServiceName is the service.name of the spans, defaults to insync.
+	ServiceName string `yaml:"service_name"`
+}
+
+// Exporter exports the ended spans with otlp over http, json encoded.
+type Exporter struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+	spans   chan *Span
+}
+
+// Enable starts collecting the spans for the exporter, they are exported once it runs.
+func Enable(cfg Config) *Exporter {
+	e := &Exporter{
+		url:     strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		headers: cfg.Headers,
+		service: cfg.ServiceName,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		spans:   make(chan *Span, queueSize),
+	}
+	if e.service == "" {
+		e.service = "insync"
+	}
+	exporter.Store(e)
+	return e
+}
+
+func (e *Exporter) enqueue(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		// the receiver can't keep up, tracing must not slow down the checks
+	}
+}
+
+// Run exports the spans in batches until the context is done, the pending spans are exported before it returns.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			slog.Error("error exporting spans", "spans", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// export posts the spans, see the otlp/http json encoding of the ExportTraceServiceRequest.
+func (e *Exporter) export(spans []*Span) error {
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: []keyValue{{Key: "service.name", Value: anyValue{StringValue: &e.service}}}},
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: "github.com/jon4hz/insync"},
+			Spans: make([]otlpSpan, 0, len(spans)),
+		}},
+	}}}
+	for _, s := range spans {
+		req.ResourceSpans[0].ScopeSpans[0].Spans = append(req.ResourceSpans[0].ScopeSpans[0].Spans, s.otlp())
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		r.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := otlpSpan{
+		TraceID:           hex.EncodeToString(s.ctx.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.ctx.SpanID[:]),
+		Name:              s.name,
+		Kind:              int(s.kind),
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        make([]keyValue, 0, len(s.attrs)),
+	}
+	if s.parent != [8]byte{} {
+		o.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attrs {
+		o.Attributes = append(o.Attributes, keyValue{Key: a.key, Value: newAnyValue(a.value)})
+	}
+	if s.err != nil {
+		o.Status = &status{Code: 2, Message: redact.Error(s.err)}
+	}
+	return o
+}
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue has exactly one of its fields set, the 64 bit integers are encoded as strings.
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newAnyValue(v interface{}) anyValue {
+	var i int64
+	switch v := v.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	case int:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint64:
+		i = int64(v)
+	default:
+		s := fmt.Sprint(v)
+		return anyValue{StringValue: &s}
+	}
+	s := strconv.FormatInt(i, 10)
+	return anyValue{IntValue: &s}
+}
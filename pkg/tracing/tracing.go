@@ -0,0 +1,137 @@
+// Package tracing records the spans of the check cycles and the notifications and exports them with otlp,
+// to find out where the time goes when a check takes longer than expected.
+//
+// Tracing is disabled until an exporter is started, the spans are nil then and all operations on them are no-ops.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind is the kind of a span.
+type Kind int
+
+// the values of the otlp span kinds
+const (
+	KindInternal Kind = 1
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span, e.g. to continue a trace in another goroutine.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid reports whether the span context belongs to a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{}
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+	ctx    SpanContext
+	parent [8]byte
+	name   string
+	kind   Kind
+	start  time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []attribute
+	err   error
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// exporter receives the ended spans, nil while tracing is disabled.
+var exporter atomic.Value
+
+func currentExporter() *Exporter {
+	e, _ := exporter.Load().(*Exporter)
+	return e
+}
+
+// Start starts a span, a child of the span of the context if there is one.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := StartFrom(FromContext(ctx).Context(), name, kind)
+	if s == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartFrom starts a child of the given span, or a new trace if the span context is invalid.
+func StartFrom(parent SpanContext, name string, kind Kind) *Span {
+	if currentExporter() == nil {
+		return nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	if parent.IsValid() {
+		s.ctx.TraceID, s.parent = parent.TraceID, parent.SpanID
+	} else {
+		_, _ = rand.Read(s.ctx.TraceID[:])
+	}
+	_, _ = rand.Read(s.ctx.SpanID[:])
+	return s
+}
+
+// FromContext returns the span of the context, nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Context returns the span context, the zero value for a nil span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttributes sets the attributes, given as pairs of keys and values.
+// The values are strings, bools, integers or floats, other values are formatted with fmt.
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		s.attrs = append(s.attrs, attribute{key: fmt.Sprint(kv[i]), value: kv[i+1]})
+	}
+}
+
+// SetError marks the span as failed, nil errors are ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// End ends the span and hands it to the exporter.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+	if e := currentExporter(); e != nil {
+		e.enqueue(s)
+	}
+}
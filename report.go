@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/history"
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/report"
+	"github.com/jon4hz/insync/pkg/telegram"
+)
+
+// slaReportWindows are the windows of the daily sla report.
+var slaReportWindows = []time.Duration{24 * time.Hour, 30 * 24 * time.Hour}
+
+// runSLAReport posts the uptime of the nodes to the telegram routes every day at the given time of day in the timezone,
+// e.g. 09:00.
+func runSLAReport(ctx context.Context, at string, loc *time.Location, hist *history.Store, nodes []*insync.Node, routes map[string]insync.Notifier) {
+	for waitDaily(ctx, at, loc) {
+		for _, w := range slaReportWindows {
+			text, err := telegram.SLAReport(hist, nodes, w)
+			if err != nil {
+				slog.Error("error creating sla report", "err", err)
+				break
+			}
+			postNotice(routes, "sla report", text)
+		}
+	}
+}
+
+// runDailySummary posts the summary of the last day of every node to the telegram routes every day at the given time
+// of day in the timezone.
+func runDailySummary(ctx context.Context, at string, loc *time.Location, hist *history.Store, nodes []*insync.Node, ref *insync.Node, routes map[string]insync.Notifier) {
+	for waitDaily(ctx, at, loc) {
+		msgs, err := telegram.DailySummary(hist, nodes, ref, 24*time.Hour)
+		if err != nil {
+			slog.Error("error creating daily summary", "err", err)
+			continue
+		}
+		for _, text := range msgs {
+			postNotice(routes, "daily summary", text)
+		}
+	}
+}
+
+// runFleetDigest posts the comparison of all nodes during the last week to the telegram routes every week,
+// at the given day and time of day in the timezone, e.g. Mon 09:00.
+func runFleetDigest(ctx context.Context, at string, loc *time.Location, hist *history.Store, nodes []*insync.Node, routes map[string]insync.Notifier) {
+	for waitWeekly(ctx, at, loc) {
+		msgs, err := telegram.FleetDigest(hist, nodes, 7*24*time.Hour)
+		if err != nil {
+			slog.Error("error creating fleet digest", "err", err)
+			continue
+		}
+		for _, text := range msgs {
+			postNotice(routes, "fleet digest", text)
+		}
+	}
+}
+
+// timezone are the telegram routes of a timezone, their reports are scheduled in the local time of the chats.
+type timezone struct {
+	loc    *time.Location
+	routes map[string]insync.Notifier
+}
+
+// timezones groups the telegram routes by their timezone.
+func timezones(routes map[string]insync.Notifier) []timezone {
+	var zones []timezone
+	index := make(map[string]int)
+	for name, r := range routes {
+		tr, ok := r.(*telegram.Route)
+		if !ok {
+			continue
+		}
+		loc := tr.Location()
+		i, ok := index[loc.String()]
+		if !ok {
+			i = len(zones)
+			index[loc.String()] = i
+			zones = append(zones, timezone{loc: loc, routes: make(map[string]insync.Notifier)})
+		}
+		zones[i].routes[name] = r
+	}
+	return zones
+}
+
+// runMonthlyReport creates the availability report of the previous month on the first day of every month,
+// writes it to the path and sends it to the telegram routes. The months are those of the timezone, the report
+// is the same for all routes.
+func runMonthlyReport(ctx context.Context, cfg monthlyReportConfig, loc *time.Location, hist *history.Store, st *insync.StateStore, nodes []*insync.Node, routes map[string]insync.Notifier) {
+	for waitMonthly(ctx, cfg.At, loc) {
+		// the first day of the month, so the month before is never skipped
+		month := time.Now().In(loc).AddDate(0, -1, 0)
+		if err := monthlyReport(ctx, cfg, hist, st, nodes, routes, month); err != nil {
+			slog.Error("error creating monthly report", "err", err)
+		}
+	}
+}
+
+// monthlyReport creates the report of the month, converted to pdf if there is a pdf command.
+func monthlyReport(ctx context.Context, cfg monthlyReportConfig, hist *history.Store, st *insync.StateStore, nodes []*insync.Node, routes map[string]insync.Notifier, month time.Time) error {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name()
+	}
+	html, err := report.Monthly(hist, st, names, month)
+	if err != nil {
+		return err
+	}
+	base := "availability-" + month.Format("2006-01")
+	files := map[string][]byte{base + ".html": html}
+	send := base + ".html"
+	if len(cfg.PDFCommand) > 0 {
+		pdf, err := report.PDF(ctx, cfg.PDFCommand, html)
+		if err != nil {
+			// the html report is delivered anyway
+			slog.Error("error converting monthly report to pdf", "err", err)
+		} else {
+			files[base+".pdf"], send = pdf, base+".pdf"
+		}
+	}
+	if cfg.Path != "" {
+		if err := os.MkdirAll(cfg.Path, 0o750); err != nil {
+			return err
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(cfg.Path, name), data, 0o640); err != nil {
+				return err
+			}
+		}
+		slog.Info("monthly report written", "path", cfg.Path, "month", month.Format("2006-01"))
+	}
+	if cfg.Telegram {
+		caption := "📄 Availability report of " + month.Format("January 2006")
+		for name, r := range routes {
+			if tr, ok := r.(*telegram.Route); ok {
+				if err := tr.Document(send, files[send], caption); err != nil {
+					slog.Error("error sending monthly report", "route", name, "err", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// waitMonthly waits until the time of day in the timezone on the first day of the next month, or of this month if it's
+// still ahead.
+func waitMonthly(ctx context.Context, at string, loc *time.Location) bool {
+	clock, _ := time.Parse("15:04", at)
+	now := time.Now().In(loc)
+	next := time.Date(now.Year(), now.Month(), 1, clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 1, 0)
+	}
+	return sleepUntil(ctx, next)
+}
+
+// waitDaily waits until the next occurrence of the time of day in the timezone, it returns false if the context is done first.
+func waitDaily(ctx context.Context, at string, loc *time.Location) bool {
+	clock, _ := time.Parse("15:04", at)
+	now := time.Now().In(loc)
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return sleepUntil(ctx, next)
+}
+
+// waitWeekly waits until the next occurrence of the day and time of day in the timezone, e.g. Mon 09:00.
+func waitWeekly(ctx context.Context, at string, loc *time.Location) bool {
+	clock, _ := time.Parse("Mon 15:04", at)
+	now := time.Now().In(loc)
+	days := (int(clock.Weekday()) - int(now.Weekday()) + 7) % 7
+	next := time.Date(now.Year(), now.Month(), now.Day()+days, clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return sleepUntil(ctx, next)
+}
+
+// sleepUntil waits until the time, it returns false if the context is done first.
+func sleepUntil(ctx context.Context, next time.Time) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(time.Until(next)):
+		return true
+	}
+}
+
+// postNotice posts the text to all telegram routes.
+func postNotice(routes map[string]insync.Notifier, what, text string) {
+	for name, r := range routes {
+		if tr, ok := r.(*telegram.Route); ok {
+			if err := tr.Notice(text); err != nil {
+				slog.Error("error sending "+what, "route", name, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/telegram"
+)
+
+// sendTestCommand sends a test alert through the configured routing and exits once it's delivered.
+func sendTestCommand(args []string) error {
+	fs := flag.NewFlagSet("send-test", flag.ExitOnError)
+	node := fs.String("node", "", "the node the alert is sent for, which selects the routing rules, insync itself if empty")
+	severity := fs.String("severity", "warning", "the severity of the alert, info, warning or critical")
+	resolve := fs.Bool("resolve", false, "send the resolution of the test alert afterwards")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sev, ok := insync.ParseSeverity(*severity)
+	if !ok {
+		return fmt.Errorf("invalid severity %q", *severity)
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	b, err := createTelegramBot(cfg.BotToken, cfg.Proxy.Telegram)
+	if err != nil {
+		return fmt.Errorf("error creating telegram bot: %w", err)
+	}
+	routes, _, _ := createRoutes(b, cfg, nil)
+	router, err := newRouter(routes, cfg)
+	if err != nil {
+		return err
+	}
+	sender, _ := os.Hostname()
+	a := insync.TestAlert(*node, "send-test on "+sender, sev)
+	sendErr := router.Send(a)
+	if sendErr == nil && *resolve {
+		a.Resolved, a.Icon, a.Severity = true, "🟢", insync.SeverityInfo
+		a.Text = "🟢 test alert resolved"
+		sendErr = router.Send(a)
+	}
+	// wait for the retries, their failures are counted in the stats
+	router.Close()
+	// deliver the alerts held back by grouping or quiet hours
+	for name, r := range routes {
+		if tr, ok := r.(*telegram.Route); ok {
+			if err := tr.Close(); err != nil {
+				slog.Error("error draining route", "route", name, "err", err)
+			}
+		}
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	var failed []string
+	for _, st := range router.Stats() {
+		slog.Info("route stats", "route", st.Route, "sent", st.Sent, "failed", st.Failed)
+		if st.ConsecutiveFailures > 0 {
+			failed = append(failed, st.Route)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error sending the test alert to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
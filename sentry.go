@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentryDedupWindow is the time an error with the same message isn't reported again.
+const sentryDedupWindow = 5 * time.Minute
+
+// sentryConfig configures the error reporting to sentry, it's disabled if the dsn is empty.
+type sentryConfig struct {
+	DSN         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+}
+
+// sentry reports the errors logged by insync, e.g. panics of workers, repeated rpc failures and failed
+// notifications, to sentry. The attributes of the log record are added as context, node and check as tags.
+type sentry struct {
+	endpoint    string
+	auth        string
+	dsn         string
+	environment string
+	client      *http.Client
+	events      chan sentryEvent
+
+	mu       sync.Mutex
+	reported map[string]time.Time
+}
+
+func newSentry(cfg sentryConfig) (*sentry, error) {
+	u, err := url.Parse(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	if u.User == nil || project == "" {
+		return nil, fmt.Errorf("invalid sentry dsn, expected https://<key>@<host>/<project>")
+	}
+	return &sentry{
+		endpoint:    fmt.Sprintf("%s://%s/api/%s/envelope/", u.Scheme, u.Host, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=insync, sentry_key=%s", u.User.Username()),
+		dsn:         cfg.DSN,
+		environment: cfg.Environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		events:      make(chan sentryEvent, 64),
+		reported:    make(map[string]time.Time),
+	}, nil
+}
+
+// sentryEvent is the subset of the sentry event payload insync uses.
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     string                 `json:"message"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// capture queues the log record, dropping it if the same error was reported recently or the queue is full.
+// Errors are the same if their message and tags match.
+func (s *sentry) capture(r slog.Record, attrs []slog.Attr) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	host, _ := os.Hostname()
+	ev := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   r.Time.UTC(),
+		Level:       "error",
+		Logger:      "insync",
+		Platform:    "go",
+		ServerName:  host,
+		Environment: s.environment,
+		Message:     r.Message,
+		Tags:        make(map[string]string),
+		Extra:       make(map[string]interface{}),
+	}
+	add := func(a slog.Attr) {
+		switch a.Key {
+		case "node", "check", "route", "worker":
+			ev.Tags[a.Key] = a.Value.String()
+		}
+		ev.Extra[a.Key] = a.Value.String()
+	}
+	for _, a := range attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(a)
+		return true
+	})
+
+	key := r.Message
+	for _, tag := range []string{"node", "check", "route", "worker"} {
+		key += "\x00" + ev.Tags[tag]
+	}
+	s.mu.Lock()
+	if last, ok := s.reported[key]; ok && r.Time.Sub(last) < sentryDedupWindow {
+		s.mu.Unlock()
+		return
+	}
+	s.reported[key] = r.Time
+	s.mu.Unlock()
+
+	select {
+	case s.events <- ev:
+	default:
+	}
+}
+
+// run sends the events until the context is done, the queued events are sent before it returns.
+func (s *sentry) run(ctx context.Context) {
+	for {
+		select {
+		case ev := <-s.events:
+			s.send(ev)
+		case <-ctx.Done():
+			for {
+				select {
+				case ev := <-s.events:
+					s.send(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts the event as envelope, errors are written to stderr as logging them would report them again.
+func (s *sentry) send(ev sentryEvent) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	_ = enc.Encode(map[string]interface{}{"event_id": ev.EventID, "dsn": s.dsn, "sent_at": time.Now().UTC()})
+	_ = enc.Encode(map[string]string{"type": "event"})
+	if err := enc.Encode(ev); err != nil {
+		fmt.Fprintf(os.Stderr, "error encoding sentry event: %s\n", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reporting to sentry: %s\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reporting to sentry: %s\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		fmt.Fprintf(os.Stderr, "error reporting to sentry: unexpected status %s\n", resp.Status)
+	}
+}
+
+// sentryHandler passes the log records to the wrapped handler and reports the errors to sentry.
+type sentryHandler struct {
+	slog.Handler
+	s     *sentry
+	attrs []slog.Attr
+}
+
+func (h *sentryHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		h.s.capture(r, h.attrs)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sentryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sentryHandler{Handler: h.Handler.WithAttrs(attrs), s: h.s, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *sentryHandler) WithGroup(name string) slog.Handler {
+	return &sentryHandler{Handler: h.Handler.WithGroup(name), s: h.s, attrs: h.attrs}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startServer starts the http server in the background.
+func startServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("http server listening", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("error running http server", "err", err)
+		}
+	}()
+	return srv
+}
+
+// finalize resolves the listen address and parses the allowlist.
+func (c *httpConfig) finalize() error {
+	if c.Listen == "" {
+		return nil
+	}
+	addr, err := resolveListen(c.Listen)
+	if err != nil {
+		return err
+	}
+	c.Listen = addr
+	for _, s := range c.Allow {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid http allowlist entry %q, expected an ip or cidr", s)
+		}
+		c.allow = append(c.allow, n)
+	}
+	if c.Auth.Username != "" && c.Auth.Password == "" {
+		return errors.New("the http basic auth requires a password")
+	}
+	return nil
+}
+
+// resolveListen replaces the name of a network interface in the host of the listen address
+// with the first address of the interface, e.g. eth0:8080.
+func resolveListen(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid http listen address %q: %w", addr, err)
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	iface, err := net.InterfaceByName(host)
+	if err != nil {
+		// a hostname like localhost
+		return addr, nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("error reading the addresses of %s: %w", host, err)
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			return net.JoinHostPort(n.IP.String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("the interface %s has no address", host)
+}
+
+// protect restricts the access to the handler to the allowlist of the config and,
+// except for the probes and the rest api with its own token, to the basic auth credentials.
+func protect(cfg httpConfig, next http.Handler) http.Handler {
+	if len(cfg.allow) == 0 && cfg.Auth.Username == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.allow) > 0 && !allowed(cfg.allow, r.RemoteAddr) {
+			slog.Debug("rejected http request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if cfg.Auth.Username != "" && !isProbe(r.URL.Path) && !(cfg.APIToken != "" && isAPI(r.URL.Path)) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(cfg.Auth.Username)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(cfg.Auth.Password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="insync"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isProbe reports whether the path is one of the health endpoints.
+func isProbe(path string) bool {
+	return path == "/livez" || path == "/healthz" || path == "/readyz"
+}
+
+// allowed reports whether the remote address is in one of the networks.
+func allowed(networks []*net.IPNet, remote string) bool {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
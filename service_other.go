@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// runService runs insync in the foreground, services are only supported on windows.
+func runService(run func(ctx context.Context)) {
+	run(context.Background())
+}
+
+func serviceCommand(cmd string) error {
+	return errors.New("services are only supported on windows, use systemd or docker instead")
+}
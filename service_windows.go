@@ -0,0 +1,215 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name of the windows service and the source of its event log entries.
+const serviceName = "insync"
+
+// runService runs insync as windows service if it was started by the service manager
+// and in the foreground otherwise.
+func runService(run func(ctx context.Context)) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		fatal("error detecting windows service", "err", err)
+	}
+	if !isService {
+		run(context.Background())
+		return
+	}
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		fatal("error opening event log", "err", err)
+	}
+	defer elog.Close()
+	setupLogging(eventLogWriter{elog}, "text")
+	if err := svc.Run(serviceName, &service{run: run}); err != nil {
+		fatal("error running service", "err", err)
+	}
+}
+
+// service implements svc.Handler.
+type service struct {
+	run func(ctx context.Context)
+}
+
+func (s *service) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// eventLogWriter writes the log to the windows event log, with the level of the log record.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch {
+	case strings.Contains(msg, "level=ERROR"), strings.Contains(msg, `"level":"ERROR"`):
+		err = w.elog.Error(1, msg)
+	case strings.Contains(msg, "level=WARN"), strings.Contains(msg, `"level":"WARN"`):
+		err = w.elog.Warning(1, msg)
+	default:
+		err = w.elog.Info(1, msg)
+	}
+	return len(p), err
+}
+
+// serviceCommand manages the windows service.
+func serviceCommand(cmd string) error {
+	switch cmd {
+	case "install":
+		return installService()
+	case "uninstall":
+		return uninstallService()
+	case "start":
+		return startService()
+	case "stop":
+		return stopService()
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// installService installs insync as service started automatically, using the config file passed with -config.
+// The environment variables aren't passed to the service, so the config file is required.
+func installService() error {
+	if *configFile == "" {
+		return fmt.Errorf("a config file is required, pass it with -config")
+	}
+	cfgFile, err := filepath.Abs(*configFile)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "insync",
+		Description: "Monitors the sync status of ethereum nodes",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", cfgFile)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		_ = s.Delete()
+		return fmt.Errorf("error installing event log source: %w", err)
+	}
+	slog.Info("installed service", "service", serviceName)
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	if err := eventlog.Remove(serviceName); err != nil {
+		return fmt.Errorf("error removing event log source: %w", err)
+	}
+	slog.Info("uninstalled service", "service", serviceName)
+	return nil
+}
+
+func startService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+// stopService stops the service and waits until it stopped.
+func stopService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+	// the shutdown drains the notifiers, which may take a while
+	timeout := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(timeout) {
+			return fmt.Errorf("timeout waiting for service %s to stop", serviceName)
+		}
+		time.Sleep(500 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+// systemd reports the state of insync to systemd if it runs as a Type=notify service.
+//
+// READY=1 is sent once every node was checked once and a check succeeded, WATCHDOG=1 keepalives are only sent
+// while the checks keep running, so systemd restarts insync if it wedges (WatchdogSec=).
+type systemd struct {
+	socket string
+	// watchdog is the watchdog timeout of the service, 0 if the watchdog is disabled.
+	watchdog time.Duration
+	// maxAge is the maximum time since the last check of a node.
+	maxAge time.Duration
+	nodes  []*insync.Node
+}
+
+// newSystemd returns nil if insync doesn't run under systemd.
+func newSystemd(checkInterval time.Duration, nodes []*insync.Node) *systemd {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	s := &systemd{socket: socket, maxAge: 3 * checkInterval, nodes: nodes}
+	if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+		if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+			s.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return s
+}
+
+func (s *systemd) run(ctx context.Context) {
+	interval := time.Second
+	if s.watchdog > 0 && s.watchdog/2 < interval {
+		interval = s.watchdog / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var ready bool
+	var lastWatchdog time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			s.notify("STOPPING=1\nSTATUS=shutting down")
+			return
+		case <-ticker.C:
+		}
+		if !ready && s.started() {
+			ready = true
+			s.notify(fmt.Sprintf("READY=1\nSTATUS=monitoring %d node(s)", len(s.nodes)))
+		}
+		if s.watchdog == 0 || time.Since(lastWatchdog) < s.watchdog/2 {
+			continue
+		}
+		// the start timeout of systemd covers the time until the first checks ran
+		if ready {
+			if err := checksRecent(s.nodes, s.maxAge); err != nil {
+				slog.Warn("insync is unhealthy, skipping the systemd watchdog keepalive", "err", err)
+				s.notify("STATUS=unhealthy: " + err.Error())
+				continue
+			}
+		}
+		s.notify("WATCHDOG=1")
+		lastWatchdog = time.Now()
+	}
+}
+
+// started reports whether every node was checked at least once and the check of a node succeeded. A failed check
+// alone doesn't make insync ready, e.g. if it can't reach the network yet, but a node which is down doesn't hold back
+// the start either, alerting it is what insync is for.
+func (s *systemd) started() bool {
+	succeeded := len(s.nodes) == 0
+	for _, n := range s.nodes {
+		if !n.Checked() {
+			return false
+		}
+		succeeded = succeeded || n.Succeeded()
+	}
+	return succeeded
+}
+
+// notify sends the state to the notify socket of systemd, see sd_notify(3).
+func (s *systemd) notify(state string) {
+	addr := s.socket
+	if strings.HasPrefix(addr, "@") {
+		// abstract socket
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		slog.Error("error notifying systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Error("error notifying systemd", "err", err)
+	}
+}
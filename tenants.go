@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/jon4hz/insync/pkg/insync"
+	"github.com/jon4hz/insync/pkg/redact"
+	"github.com/jon4hz/insync/pkg/telegram"
+)
+
+// tenantsConfig configures the multi-tenant mode, in which other chats register their own nodes with /setup.
+type tenantsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxNodes is the number of nodes a chat may register, defaults to 3.
+	MaxNodes int `yaml:"max_nodes"`
+	// AllowPrivate allows nodes on loopback, private and link-local addresses, e.g. if all tenants are trusted.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+func (c *tenantsConfig) finalize() {
+	if c.MaxNodes <= 0 {
+		c.MaxNodes = 3
+	}
+}
+
+// tenantNameRe matches the valid names of the tenant nodes.
+var tenantNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,32}$`)
+
+// tenants runs the nodes registered by the chats and routes their alerts to the chat that registered them,
+// the alerts of the configured nodes are passed on to next. It implements telegram.Tenants.
+type tenants struct {
+	ctx   context.Context
+	b     *gotgbot.Bot
+	cfg   *config
+	st    *insync.StateStore
+	mon   *insync.Monitor
+	next  insync.Notifier
+	audit insync.NotificationRecorder
+	// reserved are the names of the configured nodes and the reference, insync itself and all, which mutes every node.
+	reserved map[string]bool
+
+	mu      sync.Mutex
+	tenants map[int64]insync.Tenant
+	nodes   map[int64][]*insync.Node
+	// owners are the chats of the nodes, a name is reserved here while the node is created.
+	owners map[string]int64
+	routes map[int64]*tenantRoute
+	wg     sync.WaitGroup
+}
+
+// tenantRoute is the telegram route of a tenant.
+type tenantRoute struct {
+	insync.Notifier
+	// route is the telegram route, nil in a dry run.
+	route *telegram.Route
+	// stop stops the digest of the held alerts.
+	stop context.CancelFunc
+}
+
+// close stops the digest and delivers the alerts held back by the route.
+func (r *tenantRoute) close() error {
+	r.stop()
+	if r.route == nil {
+		return nil
+	}
+	return r.route.Close()
+}
+
+// newTenants creates the routing of the tenants, audit is optional. The nodes are added to the monitor with load.
+func newTenants(ctx context.Context, b *gotgbot.Bot, cfg *config, st *insync.StateStore, next insync.Notifier, audit insync.NotificationRecorder) *tenants {
+	t := &tenants{
+		ctx:      ctx,
+		b:        b,
+		cfg:      cfg,
+		st:       st,
+		next:     next,
+		audit:    audit,
+		reserved: make(map[string]bool, len(cfg.Nodes)),
+		tenants:  make(map[int64]insync.Tenant),
+		nodes:    make(map[int64][]*insync.Node),
+		owners:   make(map[string]int64),
+		routes:   make(map[int64]*tenantRoute),
+	}
+	for _, nc := range cfg.Nodes {
+		t.reserved[nc.Name] = true
+	}
+	if cfg.Reference != nil {
+		t.reserved[cfg.Reference.Name] = true
+	}
+	t.reserved[insync.SelfNode] = true
+	t.reserved[insync.AllNodes] = true
+	return t
+}
+
+// load adds the nodes of the registered tenants to the monitor, which runs the nodes registered later on as well.
+func (t *tenants) load(mon *insync.Monitor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mon = mon
+	for _, tenant := range t.st.Tenants() {
+		t.tenants[tenant.Chat] = tenant
+		t.setRoute(tenant.Chat, tenant.QuietHours)
+		for _, tn := range tenant.Nodes {
+			if t.reserved[tn.Name] || t.owners[tn.Name] != 0 {
+				slog.Warn("skipping tenant node, the name is taken", "chat", tenant.Chat, "node", tn.Name)
+				continue
+			}
+			redact.URL(tn.URL)
+			// stored before the check was introduced or allow_private was turned off since
+			var re resolveError
+			if err := checkTenantURL(tn.URL, t.cfg.Tenants.AllowPrivate); err != nil && !errors.As(err, &re) {
+				slog.Warn("skipping tenant node", "chat", tenant.Chat, "node", tn.Name, "err", err)
+				continue
+			}
+			nc := t.nodeConfig(tn.Name, tn.URL, tn.Chain)
+			if err := nc.Finalize(); err != nil {
+				slog.Warn("skipping invalid tenant node", "chat", tenant.Chat, "node", tn.Name, "err", err)
+				continue
+			}
+			t.owners[tn.Name] = tenant.Chat
+			t.nodes[tenant.Chat] = append(t.nodes[tenant.Chat], t.addNode(nc))
+		}
+	}
+	if len(t.tenants) > 0 {
+		slog.Info("tenants loaded", "tenants", len(t.tenants), "nodes", len(t.owners))
+	}
+}
+
+// nodeConfig returns the config of a tenant node. Unless private addresses are allowed, they're also rejected when
+// the node is dialed, the address the url resolves to may have changed since it was checked.
+func (t *tenants) nodeConfig(name, rawURL, chain string) insync.NodeConfig {
+	nc := insync.NodeConfig{Name: name, URL: rawURL, Chain: chain}
+	if !t.cfg.Tenants.AllowPrivate {
+		nc.DialControl = denyPrivate
+	}
+	return nc
+}
+
+// addNode creates the node and adds it together with its checks to the monitor.
+func (t *tenants) addNode(nc insync.NodeConfig) *insync.Node {
+	n := insync.NewNode(nc, t.st.Incident(nc.Name))
+	checks := []insync.Check{insync.NewSyncCheck(n, t.cfg.Checks.Sync, time.Duration(t.cfg.ReminderInterval))}
+	if t.cfg.Checks.Peers.Interval > 0 {
+		checks = append(checks, insync.NewPeersCheck(n, t.cfg.Checks.Peers))
+	}
+	if t.cfg.Checks.Genesis.Interval > 0 {
+		// alerts a node which isn't on the chain the tenant expects
+		checks = append(checks, insync.NewGenesisCheck(n, t.cfg.Checks.Genesis))
+	}
+	t.mon.AddNode(n, checks...)
+	return n
+}
+
+// setRoute replaces the route of the chat, the alerts held back by the old one are delivered. t.mu must be held.
+func (t *tenants) setRoute(chat int64, quietHours string) {
+	if old, ok := t.routes[chat]; ok {
+		if err := old.close(); err != nil {
+			slog.Error("error draining tenant route", "chat", chat, "err", err)
+		}
+	}
+	name := "tenant " + strconv.FormatInt(chat, 10)
+	if *dryRun {
+		t.routes[chat] = &tenantRoute{Notifier: dryRunRoute{name: name}, stop: func() {}}
+		return
+	}
+	r := telegram.NewRoute(t.b, chat, telegram.MustParseQuietHours(quietHours), time.Duration(t.cfg.GroupWait), nil, t.cfg.location)
+	if t.audit != nil {
+		r.SetAuditor(t.audit, name)
+	}
+	ctx, cancel := context.WithCancel(t.ctx)
+	t.routes[chat] = &tenantRoute{Notifier: r, route: r, stop: cancel}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		r.RunDigest(ctx, time.Minute)
+	}()
+}
+
+// Send routes the alerts of the tenant nodes to their chat.
+func (t *tenants) Send(a insync.Alert) error {
+	t.mu.Lock()
+	chat, ok := t.owners[a.Node]
+	r := t.routes[chat]
+	t.mu.Unlock()
+	if !ok || r == nil {
+		return t.next.Send(a)
+	}
+	return r.Send(a)
+}
+
+func (t *tenants) Tenant(chat int64) (insync.Tenant, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenant, ok := t.tenants[chat]
+	return tenant, ok
+}
+
+func (t *tenants) Nodes(chat int64) []*insync.Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*insync.Node(nil), t.nodes[chat]...)
+}
+
+func (t *tenants) Register(chat int64, user, name, rawURL, chain string) error {
+	if !tenantNameRe.MatchString(name) {
+		return errors.New("the name may only contain letters, digits, dots, dashes and underscores")
+	}
+	redact.URL(rawURL)
+	nc := t.nodeConfig(name, rawURL, chain)
+	if err := checkTenantURL(rawURL, t.cfg.Tenants.AllowPrivate); err != nil {
+		return err
+	}
+	if err := nc.Finalize(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	if t.reserved[name] || t.owners[name] != 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("the name %s is taken, choose another one", name)
+	}
+	tenant, ok := t.tenants[chat]
+	if !ok {
+		tenant = insync.Tenant{Chat: chat}
+	}
+	if len(tenant.Nodes) >= t.cfg.Tenants.MaxNodes {
+		t.mu.Unlock()
+		return fmt.Errorf("a chat may register at most %d node(s)", t.cfg.Tenants.MaxNodes)
+	}
+	tenant.Nodes = append(tenant.Nodes, insync.TenantNode{Name: name, URL: rawURL, Chain: chain, User: user, Created: time.Now()})
+	if err := t.st.SaveTenant(tenant); err != nil {
+		t.mu.Unlock()
+		return fmt.Errorf("error saving the node: %w", err)
+	}
+	t.tenants[chat] = tenant
+	t.owners[name] = chat
+	if _, ok := t.routes[chat]; !ok {
+		t.setRoute(chat, tenant.QuietHours)
+	}
+	t.mu.Unlock()
+
+	// dialing takes a while, the lock would hold back the alerts meanwhile
+	n := t.addNode(nc)
+	t.mu.Lock()
+	if t.owners[name] != chat {
+		// removed again in the meantime
+		t.mu.Unlock()
+		t.mon.RemoveNode(n)
+		return nil
+	}
+	t.nodes[chat] = append(t.nodes[chat], n)
+	t.mu.Unlock()
+	return nil
+}
+
+// probeTimeout bounds the probe of a node before it's registered.
+const probeTimeout = 15 * time.Second
+
+func (t *tenants) Probe(rawURL string) (insync.NodeStatus, error) {
+	redact.URL(rawURL)
+	if err := checkTenantURL(rawURL, t.cfg.Tenants.AllowPrivate); err != nil {
+		return insync.NodeStatus{}, err
+	}
+	nc := t.nodeConfig("setup", rawURL, "")
+	if err := nc.Finalize(); err != nil {
+		return insync.NodeStatus{}, err
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, probeTimeout)
+	defer cancel()
+	// the probe must not touch the incidents of the monitored nodes
+	st, _ := insync.LoadState("")
+	n := insync.NewNode(nc, st.Incident(nc.Name))
+	defer n.Close()
+	state, err := insync.NewSyncCheck(n, t.cfg.Checks.Sync, 0).Probe(ctx)
+	if err != nil {
+		return insync.NodeStatus{}, err
+	}
+	status := n.Status()
+	status.State = state
+	return status, nil
+}
+
+func (t *tenants) Unregister(chat int64, name string) error {
+	t.mu.Lock()
+	tenant := t.tenants[chat]
+	i := tenantNodeIndex(tenant, name)
+	if i < 0 || t.owners[name] != chat {
+		t.mu.Unlock()
+		return fmt.Errorf("this chat didn't register %s", name)
+	}
+	tenant.Nodes = append(tenant.Nodes[:i:i], tenant.Nodes[i+1:]...)
+	if err := t.st.SaveTenant(tenant); err != nil {
+		t.mu.Unlock()
+		return fmt.Errorf("error saving the setup: %w", err)
+	}
+	t.tenants[chat] = tenant
+	var removed *insync.Node
+	nodes := t.nodes[chat][:0:0]
+	for _, n := range t.nodes[chat] {
+		if n.Name() == name {
+			removed = n
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	t.nodes[chat] = nodes
+	delete(t.owners, name)
+	t.mu.Unlock()
+
+	if removed != nil {
+		t.mon.RemoveNode(removed)
+	}
+	return nil
+}
+
+func (t *tenants) SetQuietHours(chat int64, hours string) error {
+	if hours != "" {
+		if _, err := telegram.ParseQuietHours(hours); err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenant, ok := t.tenants[chat]
+	if !ok {
+		tenant = insync.Tenant{Chat: chat}
+	}
+	tenant.QuietHours = hours
+	if err := t.st.SaveTenant(tenant); err != nil {
+		return fmt.Errorf("error saving the setup: %w", err)
+	}
+	t.tenants[chat] = tenant
+	t.setRoute(chat, hours)
+	return nil
+}
+
+// close delivers the alerts held back by the routes of the tenants.
+func (t *tenants) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for chat, r := range t.routes {
+		if err := r.close(); err != nil {
+			slog.Error("error draining tenant route", "chat", chat, "err", err)
+		}
+	}
+	t.wg.Wait()
+}
+
+func tenantNodeIndex(t insync.Tenant, name string) int {
+	for i, tn := range t.Nodes {
+		if tn.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveError is returned by checkTenantURL if the host of the url can't be resolved.
+type resolveError struct {
+	host string
+}
+
+func (e resolveError) Error() string {
+	return "error resolving " + e.host
+}
+
+// checkTenantURL rejects urls other than http and websocket endpoints and, unless allowPrivate is set,
+// endpoints on loopback, private and link-local addresses, so tenants can't probe the network of insync.
+// The addresses are checked again when the node is dialed, see denyPrivate.
+func checkTenantURL(rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("invalid url")
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return errors.New("only http and websocket endpoints are supported")
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil {
+			return resolveError{host: host}
+		}
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return fmt.Errorf("%s is a private address, only public endpoints are supported", host)
+		}
+	}
+	return nil
+}
+
+// denyPrivate is the dial control of the tenant nodes, it rejects connections to private addresses. Unlike
+// checkTenantURL it checks the address actually dialed, so a host can't resolve to a public address when it's checked
+// and to a private one when it's connected to.
+func denyPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("%s is a private address, only public endpoints are supported", host)
+	}
+	return nil
+}
+
+// isPrivateIP reports whether the ip is a loopback, private, link-local or unspecified address.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
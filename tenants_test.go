@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jon4hz/insync/pkg/insync"
+)
+
+func TestTenantsReserved(t *testing.T) {
+	cfg := &config{
+		Nodes:     []insync.NodeConfig{{Name: "node-1", URL: "http://localhost:8545"}},
+		Reference: &insync.NodeConfig{Name: "infura", URL: "https://mainnet.infura.io"},
+		Tenants:   tenantsConfig{Enabled: true, MaxNodes: 3, AllowPrivate: true},
+	}
+	tn := newTenants(context.Background(), nil, cfg, nil, nil, nil)
+	for _, name := range []string{"node-1", "infura", insync.SelfNode, insync.AllNodes} {
+		t.Run(name, func(t *testing.T) {
+			err := tn.Register(1, "@alice", name, "http://10.0.0.1:8545", "")
+			if err == nil || !strings.Contains(err.Error(), "is taken") {
+				t.Fatalf("got error %v, want the name to be taken", err)
+			}
+		})
+	}
+}